@@ -12,12 +12,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/sns"
 
 	c "rob/lib/common/constants"
+	"rob/lib/config"
 
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	sesRegion      = "us-west-2"
 	client         *ses.SES
 	defaultCharset = "UTF-8"
 	// This should be enabled in main.go for emails to actually be sent
@@ -110,9 +110,16 @@ func SendTestEmail() {
 }
 
 func init() {
-	creds := credentials.NewSharedCredentials(c.AWSCredsFile, c.AWSSESProfile)
-	config := aws.NewConfig().WithCredentials(creds).WithRegion(sesRegion)
-	sess := session.Must(session.NewSession(config))
+	Init()
+}
+
+// Init (re)creates the ses and sns clients from config.Get().AWS.
+// Call it again after loading a configuration
+func Init() {
+	cfg := config.Get().AWS
+	creds := credentials.NewSharedCredentials(cfg.CredsFile, cfg.SESProfile)
+	awsConfig := aws.NewConfig().WithCredentials(creds).WithRegion(cfg.SESRegion)
+	sess := session.Must(session.NewSession(awsConfig))
 	client = ses.New(sess)
 	snsClient = sns.New(sess)
 }
@@ -0,0 +1,103 @@
+// Package blob stores the files of uploaded media, on the local disk or in
+// a bucket of s3 or a store compatible with it.
+// Objects named private/... are only served through signed urls that
+// expire, the others have a plain url that never changes
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"rob/lib/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("No such object")
+
+// PrivatePrefix starts the names of private objects
+const PrivatePrefix = "private/"
+
+type Store interface {
+	// Writes content under name, replacing what was there
+	Put(name string, content []byte, contentType string) error
+	// ErrNotFound if there is no such object
+	Get(name string) ([]byte, error)
+	// Removing an object that isn't there is not an error
+	Delete(name string) error
+	// Address the object is served from. For private objects it is signed
+	// and valid for the given time
+	Url(name string, expiry time.Duration) (string, error)
+}
+
+// Private tells if the object is only served through signed urls
+func Private(name string) bool {
+	return strings.HasPrefix(name, PrivatePrefix)
+}
+
+var (
+	store   Store
+	storeMu sync.Mutex
+)
+
+/*
+Purpose : Opens the store described by config.Get().Blob
+Input : None
+Outputs : Error if the configuration doesn't describe a usable store
+Remark : Called at start-up. Without it the first use opens the store
+*/
+func Init() error {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	s, err := Open(config.Get().Blob)
+	if err != nil {
+		return err
+	}
+	store = s
+	return nil
+}
+
+// Open returns the store of the driver of cfg
+func Open(cfg config.Blob) (Store, error) {
+	switch cfg.Driver {
+	case config.BlobLocal:
+		return NewLocal(cfg), nil
+	case config.BlobS3:
+		return NewS3(cfg)
+	}
+	return nil, fmt.Errorf("Unknown blob driver %q", cfg.Driver)
+}
+
+// Use replaces the store returned by Current
+func Use(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	store = s
+}
+
+// Current returns the store in use, opening the configured one if there
+// is none yet
+func Current() (Store, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	if store == nil {
+		s, err := Open(config.Get().Blob)
+		if err != nil {
+			return nil, err
+		}
+		store = s
+	}
+	return store, nil
+}
+
+// Url of the object in the current store, signed for config.Get().Blob.UrlExpiry
+// seconds when it is private
+func Url(name string) (string, error) {
+	s, err := Current()
+	if err != nil {
+		return "", err
+	}
+	return s.Url(name, time.Duration(config.Get().Blob.UrlExpiry)*time.Second)
+}
@@ -0,0 +1,197 @@
+package blob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"rob/lib/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	l := NewLocal(config.Blob{Dir: filepath.Join(dir, "store"), BaseUrl: "http://localhost/files/", SigningKey: "secret"})
+	testStore(t, l)
+
+	// Names never reach out of the directory
+	if err := l.Put("../outside", []byte("x"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Errorf("Object expected within the directory but found outside, %v", err)
+	}
+	if content, err := l.Get("outside"); err != nil || string(content) != "x" {
+		t.Errorf("Object expected kept as outside but received %q, %v", content, err)
+	}
+	if _, err := l.Get("private"); err != ErrNotFound {
+		t.Errorf("Directory expected=%v but received=%v", ErrNotFound, err)
+	}
+
+	if u, _ := l.Url("a.png", time.Hour); u != "http://localhost/files/a.png" {
+		t.Errorf("Public url expected unsigned but received %q", u)
+	}
+	u, err := l.Url("private/a.png", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Path != "/files/private/a.png" {
+		t.Fatalf("Private url mismatch %q, %v", u, err)
+	}
+	expires, signature := parsed.Query().Get(Expires), parsed.Query().Get(Signature)
+	now := time.Now().UTC()
+	for _, test := range []struct {
+		name      string
+		object    string
+		expires   string
+		signature string
+		at        time.Time
+		expected  bool
+	}{
+		{"genuine", "private/a.png", expires, signature, now, true},
+		{"expired", "private/a.png", expires, signature, now.Add(2 * time.Hour), false},
+		{"other object", "private/b.png", expires, signature, now, false},
+		{"later expiry", "private/a.png", expires + "0", signature, now, false},
+		{"no signature", "private/a.png", expires, "", now, false},
+		{"no expiry", "private/a.png", "", signature, now, false},
+	} {
+		if got := l.Verify(test.object, test.expires, test.signature, test.at); got != test.expected {
+			t.Errorf("Verify of %s expected=%t but received=%t", test.name, test.expected, got)
+		}
+	}
+	other := NewLocal(config.Blob{Dir: dir, SigningKey: "other"})
+	if other.Verify("private/a.png", expires, signature, now) {
+		t.Error("Signature of another key expected refused")
+	}
+}
+
+func TestS3(t *testing.T) {
+	stand := newFakeS3("media")
+	server := httptest.NewServer(stand)
+	defer server.Close()
+
+	cfg := config.Blob{
+		Endpoint:  server.URL,
+		Region:    "ap-south-1",
+		Bucket:    "media",
+		AccessKey: "key",
+		SecretKey: "secret",
+		PathStyle: true,
+	}
+	s, err := NewS3(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	if got := stand.contentTypes["a.png"]; got != "image/png" {
+		t.Errorf("Content type expected=image/png but received=%q", got)
+	}
+
+	if u, err := s.Url("a.png", time.Hour); err != nil || u != server.URL+"/media/a.png" {
+		t.Errorf("Url expected=%s but received %q, %v", server.URL+"/media/a.png", u, err)
+	}
+	cfg.BaseUrl = "https://cdn.example.com/"
+	s, _ = NewS3(cfg)
+	if u, _ := s.Url("a.png", time.Hour); u != "https://cdn.example.com/a.png" {
+		t.Errorf("Url expected on the base url but received %q", u)
+	}
+
+	u, err := s.Url("private/a.png", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || !strings.HasPrefix(u, server.URL+"/media/private/a.png?") {
+		t.Fatalf("Presigned url mismatch %q, %v", u, err)
+	}
+	if q := parsed.Query(); q.Get("X-Amz-Signature") == "" || q.Get("X-Amz-Expires") != "3600" {
+		t.Errorf("Presigned url expected signed for an hour but received %q", u)
+	}
+}
+
+// testStore puts, gets and deletes objects, public and private
+func testStore(t *testing.T, s Store) {
+	for _, name := range []string{"a.png", "private/a.png"} {
+		if _, err := s.Get(name); err != ErrNotFound {
+			t.Errorf("Get of missing %s expected=%v but received=%v", name, ErrNotFound, err)
+		}
+		if err := s.Put(name, []byte("first"), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(name, []byte("second "+name), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+		if content, err := s.Get(name); err != nil || string(content) != "second "+name {
+			t.Errorf("Get of %s mismatch %q, %v", name, content, err)
+		}
+	}
+	if err := s.Delete("private/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("private/a.png"); err != ErrNotFound {
+		t.Errorf("Get of deleted expected=%v but received=%v", ErrNotFound, err)
+	}
+	if err := s.Delete("private/a.png"); err != nil {
+		t.Errorf("Delete of missing expected to succeed but received %v", err)
+	}
+	if content, err := s.Get("a.png"); err != nil || string(content) != "second a.png" {
+		t.Errorf("Other object expected kept but received %q, %v", content, err)
+	}
+}
+
+// fakeS3 stands in for a path style s3 bucket, keeping objects in memory
+type fakeS3 struct {
+	bucket       string
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: map[string][]byte{}, contentTypes: map[string]string{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		http.Error(w, "", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = content
+		f.contentTypes[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		content, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Header().Set("Content-Type", f.contentTypes[key])
+		bytes.NewReader(content).WriteTo(w)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		delete(f.contentTypes, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
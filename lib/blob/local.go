@@ -0,0 +1,124 @@
+package blob
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"rob/lib/config"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Query parameters of signed urls of the local driver
+const (
+	Expires   = "Expires"
+	Signature = "Signature"
+)
+
+// Local keeps objects as files of a directory, served by the /files
+// endpoint of the api. Signed urls carry the time they expire at and an
+// hmac of it with the name, checked by Verify
+type Local struct {
+	Dir     string
+	BaseUrl string
+	Key     []byte
+}
+
+func NewLocal(cfg config.Blob) *Local {
+	return &Local{Dir: cfg.Dir, BaseUrl: cfg.BaseUrl, Key: []byte(cfg.SigningKey)}
+}
+
+// file is the path of the file of an object. Names are cleaned so that
+// none reaches out of Dir
+func (l *Local) file(name string) string {
+	return filepath.Join(l.Dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// Put writes the file aside and renames it, so that a partial file is
+// never served
+func (l *Local) Put(name string, content []byte, contentType string) error {
+	file := l.file(name)
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.WithFields(log.Fields{
+			"path": file,
+		}).Error("Failed to write blob ", err)
+	}
+	return err
+}
+
+func (l *Local) Get(name string) ([]byte, error) {
+	file := l.file(name)
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		// Directories hold objects but aren't any
+		if fi, serr := os.Stat(file); serr == nil && fi.IsDir() {
+			return nil, ErrNotFound
+		}
+	}
+	return content, err
+}
+
+func (l *Local) Delete(name string) error {
+	err := os.Remove(l.file(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) Url(name string, expiry time.Duration) (string, error) {
+	u := l.BaseUrl + name
+	if !Private(name) {
+		return u, nil
+	}
+	expires := strconv.FormatInt(time.Now().UTC().Add(expiry).Unix(), 10)
+	v := url.Values{}
+	v.Set(Expires, expires)
+	v.Set(Signature, l.sign(name, expires))
+	return u + "?" + v.Encode(), nil
+}
+
+// Verify tells if the Expires and Signature of a url signed for the object
+// are genuine and not expired at now
+func (l *Local) Verify(name, expires, signature string, now time.Time) bool {
+	at, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > at {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.sign(name, expires)))
+}
+
+func (l *Local) sign(name, expires string) string {
+	mac := hmac.New(sha256.New, l.Key)
+	mac.Write([]byte(name + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,94 @@
+package blob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"rob/lib/config"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3 keeps objects in a bucket of s3 or of a store compatible with it.
+// The bucket policy is expected to let anyone read the objects outside of
+// private/, objects being written without an acl
+type S3 struct {
+	client  *s3.S3
+	bucket  string
+	baseUrl string
+}
+
+// NewS3 connects to the bucket of cfg. Without keys the credentials are
+// looked up the usual aws way, environment, shared files or instance role
+func NewS3(cfg config.Blob) (*S3, error) {
+	awsCfg := aws.NewConfig().
+		WithRegion(cfg.Region).
+		WithS3ForcePathStyle(cfg.PathStyle)
+	if cfg.Endpoint != "" {
+		awsCfg = awsCfg.WithEndpoint(cfg.Endpoint)
+	}
+	if cfg.AccessKey != "" {
+		awsCfg = awsCfg.WithCredentials(credentials.NewStaticCredentials(cfg.AccessKey, cfg.SecretKey, ""))
+	}
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: s3.New(sess), bucket: cfg.Bucket, baseUrl: cfg.BaseUrl}, nil
+}
+
+func (s *S3) Put(name string, content []byte, contentType string) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(name),
+		Body:        bytes.NewReader(content),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (s *S3) Get(name string) ([]byte, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		if failure, ok := err.(awserr.RequestFailure); ok && (failure.StatusCode() == http.StatusNotFound || failure.Code() == s3.ErrCodeNoSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	return ioutil.ReadAll(out.Body)
+}
+
+// Delete succeeds for missing objects, as s3 does
+func (s *S3) Delete(name string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	return err
+}
+
+func (s *S3) Url(name string, expiry time.Duration) (string, error) {
+	if !Private(name) && s.baseUrl != "" {
+		return s.baseUrl + name, nil
+	}
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(name),
+	})
+	if Private(name) {
+		return req.Presign(expiry)
+	}
+	if err := req.Build(); err != nil {
+		return "", err
+	}
+	return req.HTTPRequest.URL.String(), nil
+}
@@ -7,27 +7,21 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"rob/lib/config"
 	"strings"
 )
 
 var (
-	testSubDomain    = "test"
-	prodSubDomain    = "secure"
-	subDomain        = testSubDomain
-	EncryptionKeyUrl = fmt.Sprintf("https://%s.ccavenue.com/transaction/getRSAKey", subDomain)
+	subDomain        string
+	EncryptionKeyUrl string
 )
 
 var (
-	merchantId = "145970"
+	merchantId string
 	accessCode string
 	workingKey string
 )
 
-var (
-	testAccessCode = "AVJI01EI22AO92IJOA"
-	testWorkingKey = "4BCF230B635E0040976D8119CB21FCB8"
-)
-
 func GetEncryptionKey(orderId string) (string, error) {
 	data := url.Values{}
 	data.Set("access_code", accessCode)
@@ -60,12 +54,18 @@ func GetEncryptionKey(orderId string) (string, error) {
 }
 
 func init() {
-	if subDomain == testSubDomain {
-		accessCode = testAccessCode
-		workingKey = testWorkingKey
-	} else {
-		// TODO: Get the keys from .ccavenue_creds
-	}
+	Init()
+}
+
+// Init reads the gateway and keys from config.Get().Ccavenue.
+// Call it again after loading a configuration
+func Init() {
+	cfg := config.Get().Ccavenue
+	subDomain = cfg.SubDomain
+	EncryptionKeyUrl = fmt.Sprintf("https://%s.ccavenue.com/transaction/getRSAKey", subDomain)
+	merchantId = cfg.MerchantId
+	accessCode = cfg.AccessCode
+	workingKey = cfg.WorkingKey
 	/*
 		s, err := GetEncryptionKey("1")
 		if err != nil {
@@ -1,14 +1,5 @@
 package constants
 
-import (
-	"bufio"
-	"fmt"
-	"os"
-	"strings"
-
-	log "github.com/sirupsen/logrus"
-)
-
 // App wide we are going to use a common naming mechanism
 // Everything will be starting with capital letter.
 // That is because in go capital letter is public, and so in many structs
@@ -27,9 +18,6 @@ var (
 	RoleId             = "RoleId"
 	User               = "User"
 	Id                 = "Id"
-	DbUriBase          = "root:ubuntu@/"
-	DbName             = "disha"
-	DbUri              = fmt.Sprintf("%s%s", DbUriBase, DbName)
 	TimeOfCreation     = "TimeOfCreation"
 	Phone              = "Phone"
 	UserId             = "UserId"
@@ -53,18 +41,34 @@ var (
 	Icon          = "Icon"
 	GradientStart = "GradientStart"
 	GradientEnd   = "GradientEnd"
+	Poster        = "Poster"
+	Duration      = "Duration"
+	Media         = "Media"
 )
 
 // Allowed card types
 var (
-	CardTypeImage   = 0
-	CardTypeArticle = 1
-	CardTypeGif     = 2
-	CardTypeDateSep = 3
-	CardTypeList    = 4
+	CardTypeImage    = 0
+	CardTypeArticle  = 1
+	CardTypeGif      = 2
+	CardTypeDateSep  = 3
+	CardTypeList     = 4
+	CardTypeVideo    = 5
+	CardTypeCarousel = 6
+	CardTypeProduct  = 7
+	CardTypeSale     = 8
+	CardTypePoll     = 9
 	// When updating this, update the below array
 )
 
+// Limits on the cards of the above types
+var (
+	MinCarouselMedia = 2
+	MaxCarouselMedia = 10
+	// Seconds
+	MaxVideoDuration = 600
+)
+
 // All mysql database tables as an array
 var CardTypes = []int{
 	CardTypeImage,
@@ -72,19 +76,53 @@ var CardTypes = []int{
 	CardTypeGif,
 	CardTypeDateSep,
 	CardTypeList,
+	CardTypeVideo,
+	CardTypeCarousel,
+	CardTypeProduct,
+	CardTypeSale,
+	CardTypePoll,
 }
 
 var (
 	StatusNotVerified = "NotVerified"
 	StatusVerified    = "Verified"
 	StatusDeleted     = "Deleted"
+	// Posts written by writers are drafts, submitted for review and
+	// published or rejected by admins. Posts created before they had a
+	// status have none and are published
+	StatusDraft     = "Draft"
+	StatusSubmitted = "Submitted"
+	StatusPublished = "Published"
+	StatusRejected  = "Rejected"
 )
 
 var (
-	Server            = "localhost:27017"
-	Collection        = "posts"
-	CounterCollection = "counters"
-	ProductCollection = "products"
+	Collection         = "posts"
+	RevisionCollection = "revisions"
+	CounterCollection  = "counters"
+	ProductCollection  = "products"
+	MediaCollection    = "media"
+)
+
+// Variables related to media uploads. Posts and products refer to uploaded
+// media by sending their ids in the *MediaId fields instead of urls
+var (
+	File          = "File"
+	MediaId       = "MediaId"
+	SrcMediaId    = "SrcMediaId"
+	DpSrcMediaId  = "DpSrcMediaId"
+	PosterMediaId = "PosterMediaId"
+	MediaIds      = "MediaIds"
+	ImageMediaId  = "ImageMediaId"
+	Private       = "Private"
+)
+
+// Variables related to Mascot
+var (
+	Avatar          = "Avatar"
+	MaxMascotName   = 50
+	MaxMascotDesc   = 255
+	MaxMascotAvatar = 255
 )
 
 var (
@@ -104,6 +142,159 @@ var (
 	Flag             = "Flag"
 )
 
+// Variables related to cursor based feed pages
+var (
+	Cursor          = "Cursor"
+	PageSize        = "PageSize"
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Variables related to search. Results are paged by Offset, the number of
+// results before the page
+var (
+	Query           = "Query"
+	Offset          = "Offset"
+	MaxSearchQuery  = 100
+	MaxSearchOffset = 1000
+)
+
+// Variables related to the manifest of assets the app keeps offline. Each
+// change to it makes a new Version, and the app asks for the changes Since
+// the version it has. Type CacheAdd adds or updates an url, CacheRemove
+// removes it
+var (
+	Priority    = "Priority"
+	Removed     = "Removed"
+	Since       = "Since"
+	CacheAdd    = "1"
+	CacheRemove = "0"
+	MaxCacheUrl = 500
+	MaxPriority = 100
+)
+
+// Variables related to push notifications. A notification goes to the
+// devices of one user, the subscribers of a mascot, the users of a role or
+// everyone, its Target, TargetId being the user, mascot or role
+var (
+	NotificationId   = "NotificationId"
+	Data             = "Data"
+	Target           = "Target"
+	TargetId         = "TargetId"
+	Recipients       = "Recipients"
+	Sent             = "Sent"
+	Failed           = "Failed"
+	Pruned           = "Pruned"
+	Attempts         = "Attempts"
+	MessageId        = "MessageId"
+	Error            = "Error"
+	TimeOfCompletion = "TimeOfCompletion"
+	CreatedBy        = "CreatedBy"
+
+	TargetUser   = "user"
+	TargetMascot = "mascot"
+	TargetRole   = "role"
+	TargetAll    = "all"
+
+	NotificationSending = "sending"
+	NotificationDone    = "done"
+
+	// Delivery to a device. Invalid ones had their token pruned
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+	DeliveryInvalid = "invalid"
+
+	MaxNotificationTitle = 100
+	MaxNotificationBody  = 1000
+	// FCM refuses messages over 4KB
+	MaxNotificationData = 2048
+	// Characters kept of why a delivery failed
+	MaxDeliveryError = 500
+)
+
+// Variables related to scheduled post links
+var (
+	PublishAt = "PublishAt"
+	ExpireAt  = "ExpireAt"
+)
+
+// Variables related to arranging mascot queues
+var (
+	Position       = "Position"
+	PinnedAt       = "PinnedAt"
+	MaxPinnedPosts = 3
+)
+
+// Variables related to the trash of deleted posts
+var (
+	Days = "Days"
+)
+
+// Variables related to reviewing posts
+var (
+	Comment = "Comment"
+)
+
+// Variables related to post revisions. Every change to a post is
+// recorded as one of these
+var (
+	Revision = "Revision"
+	From     = "From"
+	To       = "To"
+
+	ChangeCreated   = "Created"
+	ChangeEdited    = "Edited"
+	ChangeSubmitted = "Submitted"
+	ChangeApproved  = "Approved"
+	ChangeRejected  = "Rejected"
+	ChangeDeleted   = "Deleted"
+	ChangeRestored  = "Restored"
+	ChangeReverted  = "Reverted"
+	// A list card lost children purged from the trash
+	ChangeChildrenPurged = "ChildrenPurged"
+	// The post as it was before its history was kept, recorded ahead of its
+	// first change since
+	ChangeBaseline = "Baseline"
+)
+
+// Variables related to poll cards and their votes
+var (
+	Options        = "Options"
+	Option         = "Option"
+	OptionIndex    = "OptionIndex"
+	ClosesAt       = "ClosesAt"
+	MinPollOptions = 2
+	MaxPollOptions = 6
+)
+
+// Variables related to likes, saves and views of posts. Each user counts
+// once for each kind on a post
+var (
+	Kind           = "Kind"
+	EngagementLike = 1
+	EngagementSave = 2
+	EngagementView = 3
+	// Views recorded in one request
+	MaxViewBatch = 100
+)
+
+// Variables related to comments on posts. Comments reply to the post or to
+// one of the comments on it, never to a reply
+var (
+	CommentId = "CommentId"
+	ParentId  = "ParentId"
+	Body      = "Body"
+	After     = "After"
+	Status    = "Status"
+
+	CommentVisible = "Visible"
+	CommentHeld    = "Held"
+	CommentHidden  = "Hidden"
+
+	ModeratedBy      = "ModeratedBy"
+	TimeOfModeration = "TimeOfModeration"
+)
+
 var (
 	AdminRole  = 1
 	UserRole   = 2
@@ -129,6 +320,18 @@ var (
 	AddressTable     = "Address"
 	TransactionTable = "Transaction"
 	UrlCacheTable    = "Url"
+	// Mascots followed by each user
+	SubscriptionTable = "Subscription"
+	// Votes on poll cards
+	PollVoteTable = "PollVote"
+	// Likes, saves and views of posts
+	EngagementTable = "PostEngagement"
+	CommentTable    = "Comments"
+	// Push notifications sent and their delivery to each device
+	NotificationTable = "Notification"
+	DeliveryTable     = "NotificationDelivery"
+	// Applied schema migrations, see datastore/migrations.go
+	SchemaVersionTable = "SchemaVersion"
 	// When updating this, update the below array
 )
 
@@ -145,8 +348,21 @@ var MysqlTables = []string{
 	FeedbackTable,
 	AddressTable,
 	TransactionTable,
+	UrlCacheTable,
+	SubscriptionTable,
+	PollVoteTable,
+	EngagementTable,
+	CommentTable,
+	NotificationTable,
+	DeliveryTable,
+	SchemaVersionTable,
 }
 
+// Variables related to schema migrations
+var (
+	Version = "Version"
+)
+
 // Variables related to feedback
 // To keep it simple and easy for now a lot of endpoints use just feedback table
 // type column in the database will tell if it is related to "feedback" or
@@ -179,38 +395,17 @@ var (
 	SaleEndTime   = "SaleEndTime"
 )
 
-// Variables related to configuration
-var (
-	EnvDebug          = "DISHA_DEBUG"
-	CredsBase         = ".creds"
-	MysqlCredsFile    = CredsBase + "/.mysql"
-	AWSCredsFile      = CredsBase + "/.aws"
-	CcavenueCredsFile = CredsBase + "/.ccavenue"
-	CcavenuePemFile   = CredsBase + "/.ccavenue.pem"
-	PayUCredsFile     = CredsBase + "/.payu"
-)
+// Addresses, credentials and secrets live in rob/lib/config
 
 // Variables related to PayU
 var (
-	PayUKey     = ""
-	PayUSalt    = ""
-	Surl        = "https://twiq.in/api/payment-success"
-	Furl        = "https://twiq.in/api/payment-failure"
 	Hash        = "Hash"
 	ProductInfo = "ProductInfo"
 )
 
 // Variables related to aws ses & mailing module
 var (
-	AWSSESProfile = "ses"
-	EmailInfo     = "info@twiq.in"
-)
-
-// Variables related to testing
-var (
-	TestMysqlUser   = "disha_test"
-	TestMysqlPass   = "Disha@1test"
-	TestMysqlDbName = "dishatest"
+	EmailInfo = "info@twiq.in"
 )
 
 // Variables related to Order
@@ -269,76 +464,10 @@ var (
 
 var (
 	UnAuthorized = "UnAuthorized"
-	LocalHost    = "http://localhost:9980"
 	TwiqUrl      = "https://twiq.in/api"
 	TopPost      = 1
 	PostBefore   = 2
 	PostAfter    = 3
 )
 
-var DE = false
 var EV = true // Email verification ON/OFF
-func SetMysqlCreds(user, pass, dbName string) {
-	DbUriBase = fmt.Sprintf("%s:%s@/", user, pass)
-	DbName = dbName
-	DbUri = fmt.Sprintf("%s%s", DbUriBase, DbName)
-}
-
-func init() {
-	// To start the binary in debug mode simply set environment variable.
-	// 'export DEBUG_DISHA=TRUE'
-	if os.Getenv(EnvDebug) == "TRUE" {
-		log.Info("Started in global debug mode")
-		DE = true
-	}
-	// Ability to override default database username/password using
-	// credentials file. .mysql_creds should be present in current
-	// running directory
-	// Format for the creds file is username on line 1 and password on line 2
-	// and both lines ending with '\n'
-
-	file, err := os.Open(MysqlCredsFile)
-	if err == nil {
-		defer file.Close()
-		log.Info("Overridding mysql username/password with cred file")
-		r := bufio.NewReader(file)
-
-		mysqlUser, err := r.ReadString('\n')
-		if err != nil {
-			panic(fmt.Sprintf("Error reading %s file: %v", MysqlCredsFile, err.Error()))
-		}
-
-		mysqlPass, err := r.ReadString('\n')
-		if err != nil {
-			panic(fmt.Sprintf("Error reading %s file: %v", MysqlCredsFile, err.Error()))
-		}
-
-		mysqlUser = strings.TrimSuffix(mysqlUser, "\n")
-		mysqlPass = strings.TrimSuffix(mysqlPass, "\n")
-
-		SetMysqlCreds(mysqlUser, mysqlPass, DbName)
-	}
-
-	file, err = os.Open(PayUCredsFile)
-	if err == nil {
-		defer file.Close()
-		log.Info("Setting up PayU Creds with cred file")
-		r := bufio.NewReader(file)
-
-		PayUKey, err = r.ReadString('\n')
-		if err != nil {
-			panic(fmt.Sprintf("Error reading %s file: %v", PayUCredsFile, err.Error()))
-		}
-
-		PayUSalt, err = r.ReadString('\n')
-		if err != nil {
-			panic(fmt.Sprintf("Error reading %s file: %v", PayUCredsFile, err.Error()))
-		}
-
-		PayUKey = strings.TrimSuffix(PayUKey, "\n")
-		PayUSalt = strings.TrimSuffix(PayUSalt, "\n")
-
-	} else {
-		panic("Error Reading file. PayU Creds was not set")
-	}
-}
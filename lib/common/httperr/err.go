@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	c "rob/lib/common/constants"
+	"rob/lib/config"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -25,7 +25,7 @@ func E(w http.ResponseWriter, status int, message string, err *error) {
 		Status:  status,
 		Message: message,
 	}
-	if c.DE {
+	if config.Get().Debug {
 		if err == nil {
 			he.DebugError = "nil"
 		} else {
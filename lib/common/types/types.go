@@ -22,10 +22,27 @@ type Role struct {
 	Name string
 }
 
+type Mascot struct {
+	Id          int
+	Name        string
+	Description string
+	// Url of the mascot's picture
+	Avatar        string
+	GradientStart string
+	GradientEnd   string
+	// Retired mascots keep their queue but take no new posts
+	IsActive bool
+}
+
 type PostLink struct {
+	// When the link goes live, it is ordered in the queue by this time
 	TimeOfCreation int64
 	PostId         string
 	MascotId       int
+	// When the link stops being served, 0 for never
+	ExpireAt int64
+	// When the post was pinned to the top of the feed, 0 if not pinned
+	PinnedAt int64
 }
 
 type Post struct {
@@ -44,6 +61,188 @@ type Post struct {
 	GradientStart  string
 	GradientEnd    string
 	Icon           string
+	// Video cards play Src, showing Poster until then. Duration in seconds
+	Poster   string
+	Duration int
+	// Carousel cards show these in order
+	Media []string
+	// Product and Sale cards show one of these
+	ProductId string
+	SaleId    int
+	// Live price and stock of Product and Sale cards. Never in mongodb
+	Price       int   `bson:"-"`
+	StockLeft   int   `bson:"-"`
+	TimeToStart int64 `bson:"-"`
+	// Poll cards ask Title with these Options. Voting closes at ClosesAt
+	// unless it is zero
+	Options  []string
+	ClosesAt int64
+	// Votes for each option so far, and the option the user voted for if
+	// Voted. Never in mongodb
+	Votes  []int `bson:"-"`
+	Voted  bool  `bson:"-"`
+	MyVote int   `bson:"-"`
+	// Counts of users who liked, saved and viewed the post, and whether the
+	// user asking liked or saved it. Never in mongodb
+	Likes int  `bson:"-"`
+	Saves int  `bson:"-"`
+	Views int  `bson:"-"`
+	Liked bool `bson:"-"`
+	Saved bool `bson:"-"`
+	// Visible comments on the post, replies included. Never in mongodb
+	Comments int `bson:"-"`
+	// Last edit, zero if never edited
+	EditedBy   int
+	TimeOfEdit int64
+	// Draft, Submitted, Published, Rejected or Deleted
+	Status    string
+	CreatedBy int
+	// Last submission for review and its outcome. The comment tells the
+	// writer why the post was rejected
+	TimeOfSubmission int64
+	ReviewedBy       int
+	TimeOfReview     int64
+	ReviewComment    string
+	// Set while the post is in the trash, with the status it is restored to
+	DeletedBy      int
+	TimeOfDeletion int64
+	DeletedStatus  string
+}
+
+// A change to a post with the post as it was right after. Revisions are
+// never changed once written
+type Revision struct {
+	Id bson.ObjectId `bson:"_id"`
+	// 1 for the creation of the post, then one more for every change
+	Number         int
+	PostId         string
+	Author         int
+	TimeOfCreation int64
+	// What changed, Created, Edited, Submitted, ...
+	Change string
+	// The revision reverted to, for Reverted changes
+	RevertedTo int `json:",omitempty"`
+	Post       Post
+}
+
+// A vote on a poll card. Option is the index of one of its Options
+type PollVote struct {
+	PostId         string
+	UserId         int
+	Option         int
+	TimeOfCreation int64
+}
+
+// Votes cast on a poll. Mine is the option voted for by the user asking,
+// -1 if they haven't voted
+type PollTally struct {
+	Counts map[int]int
+	Mine   int
+}
+
+// Likes, saves and views of a post, and those of one user
+type Engagement struct {
+	Likes int
+	Saves int
+	Views int
+	Liked bool
+	Saved bool
+}
+
+// A comment on a post. ParentId is the comment it replies to, 0 for one on
+// the post itself
+type Comment struct {
+	Id       int
+	PostId   string
+	ParentId int
+	UserId   int
+	Body     string
+	// Visible, Held for review or Hidden by an admin
+	Status         string
+	TimeOfCreation int64
+	// Last admin who hid or approved the comment
+	ModeratedBy      int
+	TimeOfModeration int64
+	// Visible replies to the comment
+	Replies int
+}
+
+// Comments oldest first. After is passed on to read the next page
+type CommentPage struct {
+	Comments []Comment
+	HasMore  bool
+	After    int
+}
+
+// An uploaded image or video, stored under a name made of the hash of its
+// content so that the same file uploaded twice is stored once
+type Media struct {
+	// Hex sha256 of the content
+	Id          string `bson:"_id"`
+	ContentType string
+	Size        int
+	// Pixels, 0 for videos
+	Width  int
+	Height int
+	// Names of the file and of its thumbnail in the media storage. Videos
+	// have no thumbnail
+	Name  string
+	Thumb string
+	// Only served through signed urls that expire
+	Private        bool
+	UploadedBy     int
+	TimeOfCreation int64
+	// Where they are served from. Never in mongodb
+	Url      string `bson:"-"`
+	ThumbUrl string `bson:"-"`
+}
+
+// Posts matching a search, best match first. Offset is passed on to read
+// the next page
+type PostSearchPage struct {
+	Posts   []Post
+	HasMore bool
+	Offset  int
+}
+
+// Products matching a search, best match first
+type ProductSearchPage struct {
+	Products []Product
+	HasMore  bool
+	Offset   int
+}
+
+// Everything voted on a poll, as exported for admins
+type PollResults struct {
+	PostId   string
+	Question string
+	Options  []string
+	ClosesAt int64
+	// Votes for each option and their sum
+	Votes  []int
+	Total  int
+	Ballot []PollVote
+}
+
+// A field that differs between two revisions of a post
+type FieldChange struct {
+	Field string
+	From  interface{}
+	To    interface{}
+}
+
+// One page of a mascot feed, newest first
+type FeedPage struct {
+	Posts []Post
+	// Cursor for the older posts after this page
+	Next string
+	// Cursor for the newer posts before this page
+	Prev string
+	// More posts exist in the direction this page was read
+	HasMore bool
+	// Posts pinned to the top, only on the first page. They are not
+	// repeated in Posts
+	Pinned []Post `json:",omitempty"`
 }
 
 type Posts []string
@@ -175,6 +374,99 @@ type HashResponse struct {
 	//	MerchantId  string
 }
 
+// ManifestEntry is an asset the app keeps for offline use
+type ManifestEntry struct {
+	Url string
+	// sha256 of the content in hex, empty when it isn't known
+	Hash string
+	// Bytes of content
+	Size int64
+	// Assets of higher priority are downloaded first
+	Priority int
+	// Version of the manifest the entry last changed in
+	Version int64
+	// Removed entries are only kept to report their removal
+	Removed bool `json:"-"`
+}
+
+// Manifest lists the assets the app keeps offline, by priority
+type Manifest struct {
+	Version int64
+	Entries []ManifestEntry
+}
+
+// ManifestChanges take a manifest from version Since to Version
+type ManifestChanges struct {
+	Since   int64
+	Version int64
+	// Entries added or updated
+	Changed []ManifestEntry
+	// Urls removed
+	Removed []string
+}
+
+// Notification is a push message to the devices of some users
+type Notification struct {
+	Id    int
+	Title string
+	Body  string
+	// Passed on to the app with the message
+	Data map[string]string `json:",omitempty"`
+	// c.TargetUser, c.TargetMascot, c.TargetRole or c.TargetAll
+	Target   string
+	TargetId int `json:",omitempty"`
+	// c.NotificationSending until every device was tried, then c.NotificationDone
+	Status    string
+	CreatedBy int
+	// Devices it is sent to, and how many got it, didn't or had their token
+	// pruned as no longer registered
+	Recipients       int
+	Sent             int
+	Failed           int
+	Pruned           int
+	TimeOfCreation   int64
+	TimeOfCompletion int64 `json:",omitempty"`
+}
+
+// Delivery is the fate of a notification on the device of a user
+type Delivery struct {
+	NotificationId int `json:"-"`
+	UserId         int
+	// c.DeliverySent, c.DeliveryFailed or c.DeliveryInvalid
+	Status   string
+	Attempts int
+	// Id FCM gave the message once sent
+	MessageId      string `json:",omitempty"`
+	Error          string `json:",omitempty"`
+	TimeOfCreation int64
+}
+
+// NotificationReport is a notification with its deliveries
+type NotificationReport struct {
+	Notification Notification
+	Deliveries   []Delivery
+}
+
+// PushToken is the Firebase registration token of the device of a user
+type PushToken struct {
+	UserId int
+	Token  string
+}
+
+// CacheStats counts the lookups of a cache and the entries it dropped
+type CacheStats struct {
+	Name       string
+	Entries    int
+	MaxEntries int
+	// Seconds entries are kept, 0 for no limit
+	TTL           int
+	Hits          int64
+	Misses        int64
+	Evictions     int64
+	Expirations   int64
+	Invalidations int64
+}
+
 type InitiateSignUpResponse struct {
 	Sum     int
 	Product int
@@ -0,0 +1,668 @@
+// Package config holds everything that changes between deployments:
+// addresses, ports, credentials and secrets.
+//
+// Values are layered, each layer overriding the previous one
+//  1. Defaults of the profile (dev, test or prod) chosen with DISHA_PROFILE
+//  2. The legacy credential files in .creds (.mysql and .payu), except for
+//     the test profile
+//  3. The json config file at DISHA_CONFIG (config.json by default)
+//  4. The section for the profile under "Profiles" in that same file
+//  5. Environment variables named DISHA_<SECTION>_<FIELD>, for example
+//     DISHA_MYSQL_PASSWORD or DISHA_SERVER_PORT. Top level fields drop the
+//     section, so DISHA_DEBUG and DISHA_STORE work as before
+//
+// Load validates the result so that a bad configuration is reported before
+// the server starts listening. Packages read their section with Get at
+// start-up.
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Profiles
+const (
+	Dev  = "dev"
+	Test = "test"
+	Prod = "prod"
+)
+
+// Environment variables read by Load
+const (
+	EnvPrefix  = "DISHA"
+	EnvProfile = "DISHA_PROFILE"
+	EnvFile    = "DISHA_CONFIG"
+)
+
+var (
+	DefaultFile    = "config.json"
+	CredsBase      = ".creds"
+	MysqlCredsFile = CredsBase + "/.mysql"
+	PayUCredsFile  = CredsBase + "/.payu"
+)
+
+// Values for Config.Store
+const (
+	StoreMysql  = "mysql"
+	StoreMemory = "memory"
+)
+
+type Server struct {
+	Port       int
+	PortalPort int
+	// Address the portal uses to reach the api server
+	ApiUrl string
+}
+
+type Mysql struct {
+	User     string
+	Password string
+	// host:port, empty for the default local server
+	Host   string
+	DbName string
+}
+
+type Mongo struct {
+	Server string
+	DbName string
+	// Max connections per server shared by all requests, 0 for no limit
+	PoolLimit int
+	// Timeouts in seconds. Dial bounds connecting and finding a server,
+	// Socket bounds every read and write on a connection
+	DialTimeout   int
+	SocketTimeout int
+	// Attempts made to connect at start-up before giving up, waiting
+	// RetryWait seconds between them. Later requests finding no connection
+	// try once, sharing the attempt in progress if there is one
+	DialRetries int
+	RetryWait   int
+}
+
+type Session struct {
+	Name string
+	// Authenticates the cookie
+	HashKey string
+	// Encrypts the cookie. Has to be 16, 24 or 32 bytes long
+	BlockKey string
+	// Cookie life in seconds, 0 for a browser session cookie
+	MaxAge int
+}
+
+type CSRF struct {
+	Enable bool
+	// Has to be 32 bytes long
+	Key    string
+	Secure bool
+}
+
+type PayU struct {
+	Key  string
+	Salt string
+	// Success and failure urls PayU redirects to
+	Surl string
+	Furl string
+}
+
+type Ccavenue struct {
+	// test or secure
+	SubDomain  string
+	MerchantId string
+	AccessCode string
+	WorkingKey string
+}
+
+type AWS struct {
+	SESRegion  string
+	CredsFile  string
+	SESProfile string
+}
+
+type Trash struct {
+	// Deleted posts are kept this many days before they are purged
+	Days int
+	// Hours between two purges of the trash, 0 to only purge on request
+	PurgeInterval int
+}
+
+type Comments struct {
+	// Comma separated words that hold a comment for review when found in
+	// it, ignoring case
+	BannedWords string
+	// Longest comment body, in bytes
+	MaxLength int
+}
+
+// Banned lists the BannedWords in lower case
+func (cm Comments) Banned() []string {
+	var words []string
+	for _, w := range strings.Split(cm.BannedWords, ",") {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+type Media struct {
+	// Largest upload in bytes
+	MaxBytes int
+	// Largest image in pixels
+	MaxWidth  int
+	MaxHeight int
+	// Longest side of thumbnails in pixels
+	ThumbSize int
+}
+
+// Values for Blob.Driver
+const (
+	BlobLocal = "local"
+	BlobS3    = "s3"
+)
+
+// Blob is where uploaded media are stored. Objects named private/... are
+// only served through signed urls that expire
+type Blob struct {
+	// local or s3
+	Driver string
+	// Address objects are served from, their name appended. For the local
+	// driver that's the /files endpoint of the api. For s3 it can be left
+	// empty for the address of the bucket
+	BaseUrl string
+	// Seconds signed urls stay valid
+	UrlExpiry int
+
+	// Directory of the local driver and the key it signs urls with
+	Dir        string
+	SigningKey string
+
+	// Bucket of the s3 driver. Endpoint is only set for stores compatible
+	// with s3, most of which need PathStyle, the bucket in the path rather
+	// than the host name
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// Cache sizes the in memory caches and bounds the assets hashed for the
+// offline manifest of the app
+type Cache struct {
+	// Most posts kept, the least recently used going first
+	PostEntries int
+	// Seconds a post is kept, 0 to keep it until it is evicted or changed
+	PostTTL int
+	// Seconds the manifest is kept, 0 to keep it until it changes. Other
+	// servers only see changes once it expires
+	ManifestTTL int
+	// Assets added without their hash are downloaded to hash them, within
+	// AssetTimeout seconds and up to MaxAssetBytes
+	AssetTimeout  int
+	MaxAssetBytes int
+}
+
+// Push sends notifications through Firebase Cloud Messaging. Without
+// Credentials nothing is sent
+type Push struct {
+	// Service account json key of the Firebase project
+	Credentials string
+	// Project of the service account when empty
+	ProjectId string
+	// Address of the FCM api, and of the service giving it access tokens,
+	// that of the service account when empty
+	Endpoint string
+	TokenUrl string
+	// Tries per device, waiting Backoff milliseconds after the first failure
+	// and twice as long after each next one, or as long as FCM asks, but
+	// never more than MaxBackoff milliseconds
+	MaxAttempts int
+	Backoff     int
+	MaxBackoff  int
+	// Devices sent to at once
+	Workers int
+	// Seconds a request to FCM may take
+	Timeout int
+}
+
+type Config struct {
+	Profile string
+	Debug   bool
+	// mysql or memory
+	Store string
+
+	Server   Server
+	Mysql    Mysql
+	Mongo    Mongo
+	Session  Session
+	CSRF     CSRF
+	PayU     PayU
+	Ccavenue Ccavenue
+	AWS      AWS
+	Trash    Trash
+	Comments Comments
+	Media    Media
+	Blob     Blob
+	Cache    Cache
+	Push     Push
+}
+
+// Uri returns the mysql dsn for the configured database
+func (m Mysql) Uri() string {
+	return m.BaseUri() + m.DbName
+}
+
+// BaseUri returns the mysql dsn without a database, used to create it
+func (m Mysql) BaseUri() string {
+	if m.Host == "" {
+		return fmt.Sprintf("%s:%s@/", m.User, m.Password)
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/", m.User, m.Password, m.Host)
+}
+
+var current = Defaults(Dev)
+
+// Get returns the configuration in use. Until Use is called that's the dev
+// defaults
+func Get() *Config {
+	return current
+}
+
+// Use makes cfg the configuration returned by Get
+func Use(cfg *Config) {
+	current = cfg
+}
+
+// Defaults returns the built in configuration of a profile.
+// dev and test are usable as they are, prod has no secrets and won't pass
+// Validate until they are provided
+func Defaults(profile string) *Config {
+	cfg := &Config{
+		Profile: profile,
+		Store:   StoreMysql,
+		Server: Server{
+			Port:       9980,
+			PortalPort: 8898,
+			ApiUrl:     "http://localhost:9980",
+		},
+		Mysql: Mysql{
+			User:     "root",
+			Password: "ubuntu",
+			DbName:   "disha",
+		},
+		Mongo: Mongo{
+			Server:        "localhost:27017",
+			DbName:        "disha",
+			PoolLimit:     128,
+			DialTimeout:   10,
+			SocketTimeout: 60,
+			DialRetries:   3,
+			RetryWait:     2,
+		},
+		Session: Session{
+			Name:     "sesid",
+			HashKey:  "@r4B?EhaSEh_drudR7P_hdsa=s#s2Pah",
+			BlockKey: "@71S_D_@3d86!@0-",
+		},
+		CSRF: CSRF{
+			Key: "AJSD@*JD82!#$S@@DS(*HJDnasd2*@#1",
+		},
+		PayU: PayU{
+			Surl: "https://twiq.in/api/payment-success",
+			Furl: "https://twiq.in/api/payment-failure",
+		},
+		Ccavenue: Ccavenue{
+			SubDomain:  "test",
+			MerchantId: "145970",
+			AccessCode: "AVJI01EI22AO92IJOA",
+			WorkingKey: "4BCF230B635E0040976D8119CB21FCB8",
+		},
+		AWS: AWS{
+			SESRegion:  "us-west-2",
+			CredsFile:  CredsBase + "/.aws",
+			SESProfile: "ses",
+		},
+		Trash: Trash{
+			Days:          30,
+			PurgeInterval: 24,
+		},
+		Comments: Comments{
+			MaxLength: 1000,
+		},
+		Cache: Cache{
+			PostEntries:   4096,
+			PostTTL:       300,
+			ManifestTTL:   60,
+			AssetTimeout:  30,
+			MaxAssetBytes: 50 << 20,
+		},
+		Push: Push{
+			Endpoint:    "https://fcm.googleapis.com",
+			MaxAttempts: 4,
+			Backoff:     500,
+			MaxBackoff:  60000,
+			Workers:     8,
+			Timeout:     10,
+		},
+		Media: Media{
+			MaxBytes:  20 << 20,
+			MaxWidth:  4096,
+			MaxHeight: 4096,
+			ThumbSize: 320,
+		},
+		Blob: Blob{
+			Driver:     BlobLocal,
+			BaseUrl:    "http://localhost:9980/files/",
+			UrlExpiry:  3600,
+			Dir:        "uploads",
+			SigningKey: "Xq2@h7!Lmv9#Ew4$Rt6%Yu8^Io0&Pa3*",
+			Region:     "ap-south-1",
+		},
+	}
+
+	switch profile {
+	case Test:
+		cfg.Mysql = Mysql{
+			User:     "disha_test",
+			Password: "Disha@1test",
+			DbName:   "dishatest",
+		}
+		cfg.Mongo.DbName = "dishatest"
+		cfg.PayU.Key = "testkey"
+		cfg.PayU.Salt = "testsalt"
+	case Prod:
+		cfg.Mysql.Password = ""
+		cfg.Session.HashKey = ""
+		cfg.Session.BlockKey = ""
+		cfg.CSRF.Key = ""
+		cfg.CSRF.Secure = true
+		cfg.Blob.BaseUrl = "https://twiq.in/api/files/"
+		cfg.Blob.SigningKey = ""
+		cfg.Ccavenue = Ccavenue{SubDomain: "secure", MerchantId: "145970"}
+	}
+	return cfg
+}
+
+// Load builds the configuration for the profile in DISHA_PROFILE, dev when
+// not set, validates it and makes it the one returned by Get
+func Load() (*Config, error) {
+	profile := os.Getenv(EnvProfile)
+	if profile == "" {
+		profile = Dev
+	}
+	return LoadProfile(profile)
+}
+
+// LoadProfile is Load for the given profile
+func LoadProfile(profile string) (*Config, error) {
+	if profile != Dev && profile != Test && profile != Prod {
+		return nil, fmt.Errorf("Unknown profile %q, expected one of %s, %s, %s", profile, Dev, Test, Prod)
+	}
+
+	cfg := Defaults(profile)
+
+	// Tests always run against their own database
+	if profile != Test {
+		if err := readCredsFiles(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	path := os.Getenv(EnvFile)
+	if path == "" {
+		path = DefaultFile
+	}
+	if err := readFile(cfg, path, os.Getenv(EnvFile) != ""); err != nil {
+		return nil, err
+	}
+
+	if err := readEnv(cfg, os.Getenv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	Use(cfg)
+	return cfg, nil
+}
+
+// Layout of the config file, the base settings plus per profile overrides
+type file struct {
+	Config
+	Profiles map[string]json.RawMessage
+}
+
+// readFile applies the json file at path onto cfg. A missing file is only
+// an error when required
+func readFile(cfg *Config, path string, required bool) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Unmarshal only touches the fields present in the file
+	profile := cfg.Profile
+	f := file{Config: *cfg}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	*cfg = f.Config
+
+	if p, ok := f.Profiles[profile]; ok {
+		if err := json.Unmarshal(p, cfg); err != nil {
+			return fmt.Errorf("Error reading profile %s in %s: %v", profile, path, err)
+		}
+	}
+	// The profile is chosen by DISHA_PROFILE, not by the file
+	cfg.Profile = profile
+	return nil
+}
+
+// readCredsFiles applies the credential files used before the config file
+// existed. Both hold two lines, user/key on the first and password/salt on
+// the second
+func readCredsFiles(cfg *Config) error {
+	user, pass, err := readCredsFile(MysqlCredsFile)
+	if err != nil {
+		return err
+	}
+	if user != "" {
+		cfg.Mysql.User, cfg.Mysql.Password = user, pass
+	}
+
+	key, salt, err := readCredsFile(PayUCredsFile)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		cfg.PayU.Key, cfg.PayU.Salt = key, salt
+	}
+	return nil
+}
+
+func readCredsFile(path string) (string, string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	first, err := r.ReadString('\n')
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading %s file: %v", path, err)
+	}
+	second, err := r.ReadString('\n')
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading %s file: %v", path, err)
+	}
+	return strings.TrimSuffix(first, "\n"), strings.TrimSuffix(second, "\n"), nil
+}
+
+// readEnv applies DISHA_<SECTION>_<FIELD> variables onto cfg
+func readEnv(cfg *Config, getenv func(string) string) error {
+	return readEnvStruct(reflect.ValueOf(cfg).Elem(), EnvPrefix, getenv)
+}
+
+func readEnvStruct(v reflect.Value, prefix string, getenv func(string) string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + "_" + strings.ToUpper(t.Field(i).Name)
+
+		if field.Kind() == reflect.Struct {
+			if err := readEnvStruct(field, name, getenv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The profile can't change once defaults are picked
+		if name == EnvProfile {
+			continue
+		}
+
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%s should be a number, found %q", name, value)
+			}
+			field.SetInt(int64(n))
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%s should be true or false, found %q", name, value)
+			}
+			field.SetBool(b)
+		}
+	}
+	return nil
+}
+
+// Validate reports every problem found in the configuration at once
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Store == StoreMysql || cfg.Store == StoreMemory,
+		"Store should be %s or %s, found %q", StoreMysql, StoreMemory, cfg.Store)
+
+	check(validPort(cfg.Server.Port), "Server.Port %d is not a valid port", cfg.Server.Port)
+	check(validPort(cfg.Server.PortalPort), "Server.PortalPort %d is not a valid port", cfg.Server.PortalPort)
+	check(validUrl(cfg.Server.ApiUrl), "Server.ApiUrl %q is not a valid url", cfg.Server.ApiUrl)
+
+	if cfg.Store == StoreMysql {
+		check(cfg.Mysql.User != "", "Mysql.User is empty")
+		check(cfg.Mysql.DbName != "", "Mysql.DbName is empty")
+		check(cfg.Profile != Prod || cfg.Mysql.Password != "", "Mysql.Password is empty")
+		check(cfg.Mongo.Server != "", "Mongo.Server is empty")
+		check(cfg.Mongo.DbName != "", "Mongo.DbName is empty")
+		check(cfg.Mongo.PoolLimit >= 0, "Mongo.PoolLimit can't be negative")
+		check(cfg.Mongo.DialTimeout > 0, "Mongo.DialTimeout should be more than 0")
+		check(cfg.Mongo.SocketTimeout > 0, "Mongo.SocketTimeout should be more than 0")
+		check(cfg.Mongo.DialRetries > 0, "Mongo.DialRetries should be more than 0")
+		check(cfg.Mongo.RetryWait >= 0, "Mongo.RetryWait can't be negative")
+	}
+
+	check(cfg.Session.Name != "", "Session.Name is empty")
+	check(len(cfg.Session.HashKey) >= 32, "Session.HashKey should be at least 32 bytes long")
+	check(validAESKey(cfg.Session.BlockKey), "Session.BlockKey should be 16, 24 or 32 bytes long")
+	check(cfg.Session.MaxAge >= 0, "Session.MaxAge can't be negative")
+
+	check(len(cfg.CSRF.Key) == 32, "CSRF.Key should be 32 bytes long")
+
+	check(cfg.Profile != Prod || cfg.PayU.Key != "", "PayU.Key is empty")
+	check(cfg.Profile != Prod || cfg.PayU.Salt != "", "PayU.Salt is empty")
+	check(validUrl(cfg.PayU.Surl), "PayU.Surl %q is not a valid url", cfg.PayU.Surl)
+	check(validUrl(cfg.PayU.Furl), "PayU.Furl %q is not a valid url", cfg.PayU.Furl)
+
+	check(cfg.Ccavenue.SubDomain == "test" || cfg.Ccavenue.SubDomain == "secure",
+		"Ccavenue.SubDomain should be test or secure, found %q", cfg.Ccavenue.SubDomain)
+	check(cfg.Ccavenue.AccessCode != "", "Ccavenue.AccessCode is empty")
+	check(cfg.Ccavenue.WorkingKey != "", "Ccavenue.WorkingKey is empty")
+
+	check(cfg.AWS.SESRegion != "", "AWS.SESRegion is empty")
+
+	check(cfg.Trash.Days >= 0, "Trash.Days can't be negative")
+	check(cfg.Trash.PurgeInterval >= 0, "Trash.PurgeInterval can't be negative")
+
+	check(cfg.Comments.MaxLength > 0, "Comments.MaxLength should be positive")
+
+	check(cfg.Cache.PostEntries > 0, "Cache.PostEntries should be positive")
+	check(cfg.Cache.PostTTL >= 0, "Cache.PostTTL can't be negative")
+	check(cfg.Cache.ManifestTTL >= 0, "Cache.ManifestTTL can't be negative")
+	check(cfg.Cache.AssetTimeout > 0, "Cache.AssetTimeout should be positive")
+	check(cfg.Cache.MaxAssetBytes > 0, "Cache.MaxAssetBytes should be positive")
+
+	check(validUrl(cfg.Push.Endpoint), "Push.Endpoint %q is not a valid url", cfg.Push.Endpoint)
+	check(cfg.Push.TokenUrl == "" || validUrl(cfg.Push.TokenUrl), "Push.TokenUrl %q is not a valid url", cfg.Push.TokenUrl)
+	check(cfg.Push.MaxAttempts > 0, "Push.MaxAttempts should be positive")
+	check(cfg.Push.Backoff >= 0, "Push.Backoff can't be negative")
+	check(cfg.Push.MaxBackoff >= cfg.Push.Backoff, "Push.MaxBackoff can't be less than Push.Backoff")
+	check(cfg.Push.Workers > 0, "Push.Workers should be positive")
+	check(cfg.Push.Timeout > 0, "Push.Timeout should be positive")
+
+	check(cfg.Media.MaxBytes > 0, "Media.MaxBytes should be positive")
+	check(cfg.Media.MaxWidth > 0 && cfg.Media.MaxHeight > 0, "Media.MaxWidth and Media.MaxHeight should be positive")
+	check(cfg.Media.ThumbSize > 0, "Media.ThumbSize should be positive")
+
+	check(cfg.Blob.UrlExpiry > 0, "Blob.UrlExpiry should be positive")
+	switch cfg.Blob.Driver {
+	case BlobLocal:
+		check(validUrl(cfg.Blob.BaseUrl), "Blob.BaseUrl %q is not a valid url", cfg.Blob.BaseUrl)
+		check(cfg.Blob.Dir != "", "Blob.Dir is empty")
+		check(len(cfg.Blob.SigningKey) >= 32, "Blob.SigningKey should be at least 32 bytes long")
+	case BlobS3:
+		check(cfg.Blob.BaseUrl == "" || validUrl(cfg.Blob.BaseUrl), "Blob.BaseUrl %q is not a valid url", cfg.Blob.BaseUrl)
+		check(cfg.Blob.Endpoint == "" || validUrl(cfg.Blob.Endpoint), "Blob.Endpoint %q is not a valid url", cfg.Blob.Endpoint)
+		check(cfg.Blob.Region != "", "Blob.Region is empty")
+		check(cfg.Blob.Bucket != "", "Blob.Bucket is empty")
+	default:
+		check(false, "Blob.Driver should be %s or %s, found %q", BlobLocal, BlobS3, cfg.Blob.Driver)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("Invalid %s configuration:\n  %s", cfg.Profile, strings.Join(problems, "\n  ")))
+	}
+	return nil
+}
+
+func validPort(p int) bool {
+	return p > 0 && p < 65536
+}
+
+func validUrl(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
+
+func validAESKey(k string) bool {
+	return len(k) == 16 || len(k) == 24 || len(k) == 32
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaults(t *testing.T) {
+	for _, p := range []string{Dev, Test} {
+		if err := Defaults(p).Validate(); err != nil {
+			t.Errorf("Defaults of %s expected to be valid: %v", p, err)
+		}
+	}
+
+	// prod has no secrets built in
+	err := Defaults(Prod).Validate()
+	if err == nil {
+		t.Fatal("Defaults of prod expected to be invalid but it passed")
+	}
+	for _, field := range []string{"Mysql.Password", "Session.HashKey", "CSRF.Key", "PayU.Key", "Ccavenue.AccessCode", "Blob.SigningKey"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s to be reported in %q", field, err)
+		}
+	}
+
+	if _, err := LoadProfile("staging"); err == nil {
+		t.Error("Unknown profile expected to fail but it passed")
+	}
+}
+
+func TestReadEnv(t *testing.T) {
+	env := map[string]string{
+		"DISHA_DEBUG":          "true",
+		"DISHA_STORE":          StoreMemory,
+		"DISHA_PROFILE":        Prod,
+		"DISHA_SERVER_PORT":    "8080",
+		"DISHA_MYSQL_PASSWORD": "secret",
+		"DISHA_CSRF_ENABLE":    "1",
+	}
+	getenv := func(k string) string { return env[k] }
+
+	cfg := Defaults(Dev)
+	if err := readEnv(cfg, getenv); err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Debug || cfg.Store != StoreMemory || cfg.Server.Port != 8080 ||
+		cfg.Mysql.Password != "secret" || !cfg.CSRF.Enable {
+		t.Errorf("Environment not applied: %+v", cfg)
+	}
+	if cfg.Profile != Dev {
+		t.Errorf("Profile changed by the environment to %s", cfg.Profile)
+	}
+
+	env["DISHA_SERVER_PORT"] = "http"
+	if err := readEnv(Defaults(Dev), getenv); err == nil {
+		t.Error("Non numeric port expected to fail but it passed")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	data := `{
+		"Profile": "dev",
+		"Server": {"Port": 9000},
+		"Mysql": {"Host": "db:3306"},
+		"Profiles": {
+			"prod": {"Server": {"Port": 80}, "Mysql": {"Password": "prodpass"}}
+		}
+	}`
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Defaults(Prod)
+	if err := readFile(cfg, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile != Prod {
+		t.Errorf("Profile changed by the file to %s", cfg.Profile)
+	}
+	if cfg.Server.Port != 80 || cfg.Mysql.Password != "prodpass" {
+		t.Errorf("Profile section not applied: %+v", cfg)
+	}
+	// Fields missing from the file keep their values
+	if cfg.Mysql.User != "root" || cfg.Server.PortalPort != 8898 {
+		t.Errorf("Defaults lost while reading the file: %+v", cfg)
+	}
+	if cfg.Mysql.Uri() != "root:prodpass@tcp(db:3306)/disha" {
+		t.Errorf("Unexpected mysql uri %q", cfg.Mysql.Uri())
+	}
+
+	cfg = Defaults(Dev)
+	if err := readFile(cfg, path, true); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Mysql.Password != "ubuntu" {
+		t.Errorf("Prod section applied to dev: %+v", cfg)
+	}
+
+	missing := filepath.Join(dir, "missing.json")
+	if err := readFile(Defaults(Dev), missing, false); err != nil {
+		t.Errorf("Optional missing file expected to pass: %v", err)
+	}
+	if err := readFile(Defaults(Dev), missing, true); err == nil {
+		t.Error("Required missing file expected to fail but it passed")
+	}
+}
+
+func TestBannedWords(t *testing.T) {
+	cm := Comments{BannedWords: " Spam, ,scam ,"}
+	if got := strings.Join(cm.Banned(), "|"); got != "spam|scam" {
+		t.Errorf("Banned words expected=spam|scam but received=%s", got)
+	}
+	if got := (Comments{}).Banned(); len(got) != 0 {
+		t.Errorf("No banned words expected but received %v", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Defaults(Dev)
+	cfg.Store = "postgres"
+	cfg.Server.Port = 0
+	cfg.Server.ApiUrl = "localhost"
+	cfg.Session.BlockKey = "short"
+	cfg.Ccavenue.SubDomain = "sandbox"
+	cfg.Trash.Days = -1
+	cfg.Comments.MaxLength = 0
+	cfg.Blob.Driver = "ftp"
+	cfg.Cache.PostEntries = 0
+	cfg.Push.Workers = 0
+	cfg.Push.MaxBackoff = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Invalid configuration expected to fail but it passed")
+	}
+	// Every problem is reported, not just the first
+	for _, field := range []string{"Store", "Server.Port", "Server.ApiUrl", "Session.BlockKey", "Ccavenue.SubDomain", "Trash.Days", "Comments.MaxLength", "Blob.Driver", "Cache.PostEntries", "Push.Workers", "Push.MaxBackoff"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s to be reported in %q", field, err)
+		}
+	}
+}
@@ -1,47 +1,187 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	cache "rob/lib/datacache"
 	"rob/lib/datastore"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-var curls []string
+// ErrFutureVersion is returned for changes since a version the manifest
+// hasn't reached, the app should then fetch it whole
+var ErrFutureVersion = errors.New("The manifest is not at that version yet")
 
-func GetCacheDetails() ([]string, error) {
+// AssetError tells that an asset couldn't be downloaded to be hashed
+type AssetError struct {
+	Url string
+	Err error
+}
+
+func (e *AssetError) Error() string {
+	return fmt.Sprintf("Couldn't download %s: %v", e.Url, e.Err)
+}
 
-	var funcName = "data:cache.go/GetCacheDetails"
-	logrus.Debugf("Enter :%s", funcName)
+/*
+Purpose : Reads the manifest of urls the app keeps offline
+Input : None
+Outputs : The manifest
+Remark : Cached until it changes or config.Get().Cache.ManifestTTL passes
+*/
+func GetManifest() (*types.Manifest, error) {
+	var funcName = "data:cache.go/GetManifest"
+	logrus.Debugf("Enter %s", funcName)
 	defer logrus.Debugf("Exit %s", funcName)
 
-	if curls == nil {
-		urls, err := datastore.GetCacheDetails()
+	all, err := manifest()
+	if err != nil {
+		return nil, err
+	}
+	m := &types.Manifest{Version: all.Version, Entries: []types.ManifestEntry{}}
+	for _, e := range all.Entries {
+		if !e.Removed {
+			m.Entries = append(m.Entries, e)
+		}
+	}
+	return m, nil
+}
 
-		if err != nil {
-			return nil, err
+// manifest returns the manifest with its removed entries, from the cache
+// when it is there
+func manifest() (*types.Manifest, error) {
+	if m, hit := cache.GetManifest(); hit {
+		return m, nil
+	}
+	entries, err := datastore.GetManifestEntries()
+	if err != nil {
+		return nil, err
+	}
+	m := &types.Manifest{Entries: entries}
+	for _, e := range entries {
+		if e.Version > m.Version {
+			m.Version = e.Version
 		}
+	}
+	cache.AddManifest(m)
+	return m, nil
+}
 
-		curls = urls
-		return curls, nil
+/*
+Purpose : Lists what changed in the manifest since a version the app has
+Input : The version, 0 for the whole manifest
+Outputs : The entries added or updated and the urls removed since then
+Remark : ErrFutureVersion when since is past the version of the manifest
+*/
+func GetManifestChanges(since int64) (*types.ManifestChanges, error) {
+	var funcName = "data:cache.go/GetManifestChanges"
+	logrus.WithFields(logrus.Fields{
+		"since": since,
+	}).Debugf("Enter %s", funcName)
+	defer logrus.Debugf("Exit %s", funcName)
+
+	m, err := manifest()
+	if err != nil {
+		return nil, err
+	}
+	if since > m.Version {
+		return nil, ErrFutureVersion
 	}
 
-	return curls, nil
+	changes := &types.ManifestChanges{
+		Since:   since,
+		Version: m.Version,
+		Changed: []types.ManifestEntry{},
+		Removed: []string{},
+	}
+	for _, e := range m.Entries {
+		switch {
+		case e.Version <= since:
+		case e.Removed:
+			changes.Removed = append(changes.Removed, e.Url)
+		default:
+			changes.Changed = append(changes.Changed, e)
+		}
+	}
+	return changes, nil
 }
 
-func DeleteCacheUrl(url string) error {
-	var funcName = "data:cache.go/DeleteCacheUrl"
-	logrus.Debugf("Enter %s", funcName)
+/*
+Purpose : Adds an url to the manifest or updates it
+Input : The entry. Without a Hash the url is downloaded to hash it and measure its Size
+Outputs : The version of the manifest afterwards
+Remark : *AssetError when the url couldn't be downloaded
+*/
+func PutCacheUrl(e types.ManifestEntry) (int64, error) {
+	var funcName = "data:cache.go/PutCacheUrl"
+	logrus.WithFields(logrus.Fields{
+		"url": e.Url,
+	}).Debugf("Enter %s", funcName)
 	defer logrus.Debugf("Exit %s", funcName)
 
-	curls = nil
-	return datastore.DeleteCacheUrl(url)
+	if e.Hash == "" {
+		var err error
+		if e.Hash, e.Size, err = digest(e.Url); err != nil {
+			return 0, &AssetError{Url: e.Url, Err: err}
+		}
+	}
+	version, err := datastore.PutManifestEntry(e)
+	if err != nil {
+		return 0, err
+	}
+	cache.RemoveManifest()
+	return version, nil
 }
 
-func InsertCacheUrl(url string) error {
-	var funcName = "data:cache.go/InsertCacheUrl"
-	logrus.Debugf("Enter %s", funcName)
+/*
+Purpose : Removes an url from the manifest
+Input : The url
+Outputs : The version of the manifest afterwards
+Remark : sql.ErrNoRows if the url isn't in it
+*/
+func RemoveCacheUrl(url string) (int64, error) {
+	var funcName = "data:cache.go/RemoveCacheUrl"
+	logrus.WithFields(logrus.Fields{
+		"url": url,
+	}).Debugf("Enter %s", funcName)
 	defer logrus.Debugf("Exit %s", funcName)
 
-	curls = nil
-	return datastore.InsertCacheUrl(url)
+	version, err := datastore.RemoveManifestEntry(url)
+	if err != nil {
+		return 0, err
+	}
+	cache.RemoveManifest()
+	return version, nil
+}
+
+// digest downloads the asset at url and returns the sha256 of its content
+// in hex and its size
+func digest(url string) (string, int64, error) {
+	cfg := config.Get().Cache
+	client := http.Client{Timeout: time.Duration(cfg.AssetTimeout) * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return "", 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("status %d", res.StatusCode)
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, io.LimitReader(res.Body, int64(cfg.MaxAssetBytes)+1))
+	if err != nil {
+		return "", 0, err
+	}
+	if size > int64(cfg.MaxAssetBytes) {
+		return "", 0, fmt.Errorf("larger than %d bytes", cfg.MaxAssetBytes)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
 }
@@ -0,0 +1,80 @@
+package data
+
+import (
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"rob/lib/datastore"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Purpose : Adds a comment on a post
+Input : The comment, its Status is set here
+Outputs : The comment as added
+Remark : Comments with one of the configured banned words are held for review, the rest are visible right away
+*/
+func AddComment(cm types.Comment) (*types.Comment, error) {
+	cm.Status = c.CommentVisible
+	if word := bannedWord(cm.Body, config.Get().Comments.Banned()); word != "" {
+		log.WithFields(log.Fields{
+			"postId": cm.PostId,
+			"userId": cm.UserId,
+			"word":   word,
+		}).Info("Comment held for review")
+		cm.Status = c.CommentHeld
+	}
+	id, err := datastore.AddComment(cm)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.GetComment(id)
+}
+
+// bannedWord is the first word of body found in banned, ignoring case, or
+// "" if there is none. Words are runs of letters and digits
+func bannedWord(body string, banned []string) string {
+	if len(banned) == 0 {
+		return ""
+	}
+	isBanned := make(map[string]bool, len(banned))
+	for _, w := range banned {
+		isBanned[w] = true
+	}
+	words := strings.FieldsFunc(strings.ToLower(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if isBanned[w] {
+			return w
+		}
+	}
+	return ""
+}
+
+func GetComment(commentId int) (*types.Comment, error) {
+	return datastore.GetComment(commentId)
+}
+
+func GetComments(postId string, parentId int, afterId int, n int) ([]types.Comment, error) {
+	return datastore.GetComments(postId, parentId, afterId, n)
+}
+
+func GetHeldComments() ([]types.Comment, error) {
+	return datastore.GetHeldComments()
+}
+
+func ModerateComment(commentId int, status string, moderatedBy int) error {
+	return datastore.ModerateComment(commentId, status, moderatedBy)
+}
+
+func DeleteComment(commentId int) error {
+	return datastore.DeleteComment(commentId)
+}
+
+func GetCommentCounts(postIds []string) (map[string]int, error) {
+	return datastore.GetCommentCounts(postIds)
+}
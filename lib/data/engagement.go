@@ -0,0 +1,29 @@
+package data
+
+import (
+	"rob/lib/common/types"
+	"rob/lib/datastore"
+)
+
+// Likes, saves and views are read live from the database, never from the
+// post cache
+
+func AddEngagement(postId string, userId int, kind int) error {
+	return datastore.AddEngagement(postId, userId, kind)
+}
+
+func RemoveEngagement(postId string, userId int, kind int) error {
+	return datastore.RemoveEngagement(postId, userId, kind)
+}
+
+func AddViews(userId int, postIds []string) error {
+	return datastore.AddViews(userId, postIds)
+}
+
+func GetEngagement(postIds []string, userId int) (map[string]types.Engagement, error) {
+	return datastore.GetEngagement(postIds, userId)
+}
+
+func GetSavedPostIds(userId int) ([]string, error) {
+	return datastore.GetSavedPostIds(userId)
+}
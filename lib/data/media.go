@@ -0,0 +1,103 @@
+package data
+
+import (
+	"encoding/hex"
+	"path"
+	"rob/lib/blob"
+	"rob/lib/common/types"
+	"rob/lib/datastore"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+)
+
+func AddMedia(m types.Media) error {
+	return datastore.AddMedia(m)
+}
+
+func GetMedia(mediaId string) (*types.Media, error) {
+	return datastore.GetMedia(mediaId)
+}
+
+/*
+Purpose : Removes the uploaded media that urls are of and nothing refers to any more
+Input : Urls, as found in posts and products. Those not of uploaded media are skipped
+Outputs : error if any
+Remark : Called once the posts or products holding the urls are gone. The files go from the blob store with the record
+*/
+func ReleaseMedia(urls []string) error {
+	var funcName = "data/media.go:ReleaseMedia"
+	log.WithFields(log.Fields{
+		"urls": urls,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	seen := map[string]bool{}
+	for _, u := range urls {
+		mediaId, ok := mediaIdOf(u)
+		if !ok || seen[mediaId] {
+			continue
+		}
+		seen[mediaId] = true
+
+		inUse, err := datastore.MediaInUse(mediaId)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			continue
+		}
+		m, err := datastore.GetMedia(mediaId)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		store, err := blob.Current()
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{m.Thumb, m.Name} {
+			if name == "" {
+				continue
+			}
+			if err := store.Delete(name); err != nil {
+				return err
+			}
+		}
+		if err := datastore.DeleteMedia(mediaId); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"mediaId": mediaId,
+		}).Info("Media released")
+	}
+	return nil
+}
+
+// PostUrls are the urls of media a post can hold
+func PostUrls(p types.Post) []string {
+	return append([]string{p.Src, p.DpSrc, p.Poster}, p.Media...)
+}
+
+// mediaIdOf is the id of the media whose file or thumbnail u is the url of.
+// Signed urls are recognised as well
+func mediaIdOf(u string) (string, bool) {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		u = u[:i]
+	}
+	name := path.Base(u)
+	if len(name) < 64 {
+		return "", false
+	}
+	id, rest := name[:64], name[64:]
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	if rest != "_thumb.jpg" && !strings.HasPrefix(rest, ".") {
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,20 @@
+package data
+
+import (
+	"rob/lib/common/types"
+	"rob/lib/datastore"
+)
+
+// Votes are read live from the database, never from the post cache
+
+func AddVote(postId string, userId int, option int) error {
+	return datastore.AddVote(postId, userId, option)
+}
+
+func GetPollTallies(postIds []string, userId int) (map[string]types.PollTally, error) {
+	return datastore.GetPollTallies(postIds, userId)
+}
+
+func GetPollVotes(postId string) ([]types.PollVote, error) {
+	return datastore.GetPollVotes(postId)
+}
@@ -1,11 +1,25 @@
 package data
 
 import (
+	"fmt"
+	c "rob/lib/common/constants"
 	"rob/lib/common/types"
 	cache "rob/lib/datacache"
 	"rob/lib/datastore"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// MissingPostsError lists the posts that could not be found
+type MissingPostsError struct {
+	PostIds []string
+}
+
+func (e *MissingPostsError) Error() string {
+	return fmt.Sprintf("Posts not found: %s", strings.Join(e.PostIds, ", "))
+}
+
 func GetTopPosts(n, mascotId int) ([]types.PostLink, error) {
 	return datastore.GetTopPosts(n, mascotId)
 }
@@ -18,8 +32,63 @@ func GetPostsAfter(lastSync int64, mascotId, n int) ([]types.PostLink, error) {
 	return datastore.GetPostsAfter(lastSync, mascotId, n)
 }
 
-func GetPostsMetaData(links []types.PostLink) ([]types.Post, error) {
-	return datastore.GetPostsMetaData(links)
+func GetPostsBeforeCursor(timestamp int64, postId string, mascotId, n int) ([]types.PostLink, error) {
+	return datastore.GetPostsBeforeCursor(timestamp, postId, mascotId, n)
+}
+
+func GetPostsAfterCursor(timestamp int64, postId string, mascotId, n int) ([]types.PostLink, error) {
+	return datastore.GetPostsAfterCursor(timestamp, postId, mascotId, n)
+}
+
+func GetMergedTopPosts(n int, mascotIds []int) ([]types.PostLink, error) {
+	return datastore.GetMergedTopPosts(n, mascotIds)
+}
+
+func GetMergedPostsBeforeCursor(timestamp int64, postId string, mascotIds []int, n int) ([]types.PostLink, error) {
+	return datastore.GetMergedPostsBeforeCursor(timestamp, postId, mascotIds, n)
+}
+
+func GetMergedPostsAfterCursor(timestamp int64, postId string, mascotIds []int, n int) ([]types.PostLink, error) {
+	return datastore.GetMergedPostsAfterCursor(timestamp, postId, mascotIds, n)
+}
+
+func GetPinnedPostLinks(mascotIds []int) ([]types.PostLink, error) {
+	return datastore.GetPinnedPostLinks(mascotIds)
+}
+
+func GetPostLinks(mascotId int) ([]types.PostLink, error) {
+	return datastore.GetPostLinks(mascotId)
+}
+
+func MovePostLink(mascotId int, postId string, timestamp int64) error {
+	return datastore.MovePostLink(mascotId, postId, timestamp)
+}
+
+/*
+Purpose : Resolves the posts of a mascot queue
+Input : Links from the PostQueue
+Outputs : The posts in the order of links with TimeOfLink set, and the ids of the posts not found
+Remark : Links to missing posts are left out of the result
+*/
+func GetPostsMetaData(links []types.PostLink) ([]types.Post, []string, error) {
+	postIds := make([]string, len(links))
+	for i, link := range links {
+		postIds[i] = link.PostId
+	}
+
+	byId, missing, err := getPostsById(postIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	posts := []types.Post{}
+	for _, link := range links {
+		if p, ok := byId[link.PostId]; ok {
+			p.TimeOfLink = link.TimeOfCreation
+			posts = append(posts, p)
+		}
+	}
+	return posts, missing, nil
 }
 
 func GetPostMetaData(postId string) (*types.Post, error) {
@@ -37,20 +106,252 @@ func GetPostMetaData(postId string) (*types.Post, error) {
 	}
 
 	// Add to cache
-	go cache.AddPostMetaData(*v)
+	cache.AddPostMetaData(*v)
 	return v, nil
 }
 
-func GetPosts(postIds []string) ([]types.Post, error) {
-	var posts []types.Post
+// The changes below record a revision once written, see recordRevision.
+// A failure to record it doesn't fail the change
 
-	for _, postId := range postIds {
-		p, err := GetPostMetaData(postId)
+// AddPost adds the post and records its first revision
+func AddPost(p types.Post) (string, error) {
+	postId, err := datastore.AddPost(p)
+	if err != nil {
+		return "", err
+	}
+	recordRevision(postId, nil, types.Revision{Author: p.CreatedBy, Change: c.ChangeCreated})
+	return postId, nil
+}
+
+// DeletePost moves the post to the trash and drops it from the cache
+func DeletePost(postId string, deletedBy int) error {
+	base := baseline(postId)
+	if err := datastore.DeletePost(postId, deletedBy); err != nil {
+		return err
+	}
+	cache.RemovePostMetaData(postId)
+	recordRevision(postId, base, types.Revision{Author: deletedBy, Change: c.ChangeDeleted})
+	return nil
+}
+
+// RestorePost takes the post out of the trash and drops it from the cache
+func RestorePost(postId string, restoredBy int) error {
+	base := baseline(postId)
+	if err := datastore.RestorePost(postId); err != nil {
+		return err
+	}
+	cache.RemovePostMetaData(postId)
+	recordRevision(postId, base, types.Revision{Author: restoredBy, Change: c.ChangeRestored})
+	return nil
+}
+
+// SubmitPost submits the post for review and drops it from the cache
+func SubmitPost(postId string, submittedBy int) error {
+	base := baseline(postId)
+	if err := datastore.SubmitPost(postId); err != nil {
+		return err
+	}
+	cache.RemovePostMetaData(postId)
+	recordRevision(postId, base, types.Revision{Author: submittedBy, Change: c.ChangeSubmitted})
+	return nil
+}
+
+// ReviewPost publishes or rejects the post and drops it from the cache
+func ReviewPost(postId string, status string, reviewedBy int, comment string) error {
+	base := baseline(postId)
+	if err := datastore.ReviewPost(postId, status, reviewedBy, comment); err != nil {
+		return err
+	}
+	cache.RemovePostMetaData(postId)
+
+	change := c.ChangeApproved
+	if status == c.StatusRejected {
+		change = c.ChangeRejected
+	}
+	recordRevision(postId, base, types.Revision{Author: reviewedBy, Change: change})
+	return nil
+}
+
+/*
+Purpose : Removes for good the posts in the trash since before a time
+Input : time in UnixNano
+Outputs : Ids of the posts removed
+Remark : The list cards they were children of lose them, which is recorded as a revision of each by no author, and they are dropped from the cache as well. Uploaded media they alone used are removed with them
+*/
+func PurgeTrash(deletedBefore int64) ([]string, error) {
+	var funcName = "data/posts.go:PurgeTrash"
+	log.WithFields(log.Fields{
+		"deletedBefore": deletedBefore,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	// Parents are looked up first, purging takes the children out of them
+	trash, err := datastore.GetDeletedPosts()
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	// Parents without a history yet, as they are before losing children
+	bases := map[string]*types.Post{}
+	// Urls of the purged posts and of their revisions, gone with them
+	urls := map[string][]string{}
+	for _, p := range trash {
+		if p.TimeOfDeletion >= deletedBefore {
+			continue
+		}
+		parents, err := datastore.GetParentPosts(p.Id.Hex())
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, *p)
+		for _, parent := range parents {
+			stale = append(stale, parent.Id.Hex())
+			if _, read := bases[parent.Id.Hex()]; !read {
+				bases[parent.Id.Hex()] = baselineOf(parent)
+			}
+		}
+		revisions, err := datastore.GetRevisions(p.Id.Hex())
+		if err != nil {
+			return nil, err
+		}
+		urls[p.Id.Hex()] = PostUrls(p)
+		for _, r := range revisions {
+			urls[p.Id.Hex()] = append(urls[p.Id.Hex()], PostUrls(r.Post)...)
+		}
 	}
 
+	postIds, err := datastore.PurgePosts(deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	var released []string
+	purged := map[string]bool{}
+	for _, postId := range postIds {
+		released = append(released, urls[postId]...)
+		purged[postId] = true
+	}
+	for _, postId := range append(stale, postIds...) {
+		cache.RemovePostMetaData(postId)
+	}
+	// A parent of many purged posts changed once. Parents purged as well
+	// have no history left
+	for _, postId := range stale {
+		if purged[postId] {
+			continue
+		}
+		purged[postId] = true
+		recordRevision(postId, bases[postId], types.Revision{Change: c.ChangeChildrenPurged})
+	}
+	// The posts are gone whatever happens to their media
+	if err := ReleaseMedia(released); err != nil {
+		log.WithFields(log.Fields{
+			"postIds": postIds,
+		}).Error("Failed to release the media of purged posts ", err)
+	}
+	return postIds, nil
+}
+
+/*
+Purpose : Replaces the content of a post and drops the stale copies from the cache
+Input : the post with its new values, Id and EditedBy set
+Outputs : error if any
+Remark : List cards embedding the post are dropped from the cache as well
+*/
+func UpdatePost(p types.Post) error {
+	base := baseline(p.Id.Hex())
+	if err := updatePost(p); err != nil {
+		return err
+	}
+	recordRevision(p.Id.Hex(), base, types.Revision{Author: p.EditedBy, Change: c.ChangeEdited})
+	return nil
+}
+
+func updatePost(p types.Post) error {
+	if err := datastore.UpdatePost(p); err != nil {
+		return err
+	}
+	cache.RemovePostMetaData(p.Id.Hex())
+
+	parents, err := datastore.GetParentPosts(p.Id.Hex())
+	if err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		cache.RemovePostMetaData(parent.Id.Hex())
+	}
+	return nil
+}
+
+/*
+Purpose : Resolves many posts, serving what it can from the cache and the rest with one query
+Input : Ids of the posts, may repeat
+Outputs : The posts in the order of postIds, and the ids not found
+Remark :
+*/
+func GetPostsByIds(postIds []string) ([]types.Post, []string, error) {
+	byId, missing, err := getPostsById(postIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	posts := []types.Post{}
+	for _, postId := range postIds {
+		if p, ok := byId[postId]; ok {
+			posts = append(posts, p)
+		}
+	}
+	return posts, missing, nil
+}
+
+// GetPosts is GetPostsByIds that fails with a *MissingPostsError when any
+// post is missing
+func GetPosts(postIds []string) ([]types.Post, error) {
+	posts, missing, err := GetPostsByIds(postIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, &MissingPostsError{PostIds: missing}
+	}
 	return posts, nil
 }
+
+// getPostsById returns copies of the posts found by id and the ids not
+// found, each once
+func getPostsById(postIds []string) (map[string]types.Post, []string, error) {
+	var funcName = "data/posts.go:getPostsById"
+	log.WithFields(log.Fields{
+		"numOfPosts": len(postIds),
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	hits, misses := cache.GetPostsMetaData(postIds)
+
+	byId := make(map[string]types.Post, len(postIds))
+	for postId, p := range hits {
+		byId[postId] = *p
+	}
+
+	if len(misses) == 0 {
+		return byId, nil, nil
+	}
+
+	fetched, err := datastore.GetPostsByIds(misses)
+	if err != nil {
+		return nil, nil, err
+	}
+	cache.AddPostsMetaData(fetched)
+	for _, p := range fetched {
+		byId[p.Id.Hex()] = p
+	}
+
+	var missing []string
+	for _, postId := range misses {
+		if _, ok := byId[postId]; !ok {
+			missing = append(missing, postId)
+		}
+	}
+	if len(missing) > 0 {
+		log.WithField("postIds", missing).Warn("Posts not found")
+	}
+	return byId, missing, nil
+}
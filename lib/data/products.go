@@ -1,7 +1,10 @@
 package data
 
 import (
+	"rob/lib/common/types"
 	"rob/lib/datastore"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func IsProductInStock(productId string) (bool, error) {
@@ -15,3 +18,33 @@ func DecrementStock(productId string) error {
 func IncrementStock(productId string) error {
 	return datastore.IncrementStock(productId)
 }
+
+func GetProduct(productId string) (*types.Product, error) {
+	return datastore.GetProduct(productId)
+}
+
+func GetProductBySku(sku string) (*types.Product, error) {
+	return datastore.GetProductBySku(sku)
+}
+
+/*
+Purpose : Removes a product listing
+Input : ProductId
+Outputs : error if any, mgo.ErrNotFound when there is no such product
+Remark : Uploaded media only the product used are removed with it
+*/
+func DeleteProduct(productId string) error {
+	p, err := datastore.GetProduct(productId)
+	if err != nil {
+		return err
+	}
+	if err := datastore.DeleteProduct(productId); err != nil {
+		return err
+	}
+	if err := ReleaseMedia([]string{p.Image, p.ThumbNail}); err != nil {
+		log.WithFields(log.Fields{
+			"productId": productId,
+		}).Error("Failed to release the media of the product ", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"reflect"
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/datastore"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// baseline returns the post as it is now if it has no revision yet, as
+// posts from before revisions were kept. Read ahead of a change, it is
+// recorded by recordRevision before the change
+func baseline(postId string) *types.Post {
+	p, err := datastore.GetPostMetaData(postId)
+	if err != nil {
+		// The change fails the same way
+		return nil
+	}
+	return baselineOf(*p)
+}
+
+// baselineOf is baseline for a post already read
+func baselineOf(p types.Post) *types.Post {
+	revisions, err := datastore.GetRevisions(p.Id.Hex())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"postId": p.Id.Hex(),
+		}).Error("Failed to read the revisions of the post ", err)
+		return nil
+	}
+	if len(revisions) > 0 {
+		return nil
+	}
+	return &p
+}
+
+/*
+Purpose : Adds r as the next revision of the post, with the post as it is now in the database
+Input : the post id, its baseline if it had no revision before the change, and the revision
+Outputs : None
+Remark : The change is already written, so failures are logged and not returned. Reporting them would have clients retry a change that was applied
+*/
+func recordRevision(postId string, base *types.Post, r types.Revision) {
+	logger := log.WithFields(log.Fields{
+		"postId": postId,
+		"author": r.Author,
+		"change": r.Change,
+	})
+	if base != nil {
+		if _, err := datastore.AddRevision(types.Revision{
+			PostId: postId,
+			Author: base.CreatedBy,
+			Change: c.ChangeBaseline,
+			Post:   *base,
+		}); err != nil {
+			logger.Error("Failed to record the baseline revision ", err)
+		}
+	}
+
+	p, err := datastore.GetPostMetaData(postId)
+	if err != nil {
+		logger.Error("Failed to read the post to record its revision ", err)
+		return
+	}
+	r.PostId = postId
+	r.Post = *p
+	number, err := datastore.AddRevision(r)
+	if err != nil {
+		logger.Error("Failed to record the revision ", err)
+		return
+	}
+	logger.Debugf("Recorded revision %d", number)
+}
+
+/*
+Purpose : Puts back the content a post had in an earlier revision
+Input : the post with the content of the revision, Id and EditedBy set, and the number of the revision
+Outputs : error if any
+Remark : The revert is itself recorded as a new revision, the history is never rewritten
+*/
+func RevertPost(p types.Post, revertedTo int) error {
+	// Reverting to a revision, the post has a history already
+	if err := updatePost(p); err != nil {
+		return err
+	}
+	recordRevision(p.Id.Hex(), nil, types.Revision{
+		Author:     p.EditedBy,
+		Change:     c.ChangeReverted,
+		RevertedTo: revertedTo,
+	})
+	return nil
+}
+
+/*
+Purpose : Lists what differs between two versions of a post
+Input : the older and newer post
+Outputs : The fields changed in the order of types.Post
+Remark : Id and the fields never stored are left out. Empty and missing lists are the same
+*/
+func DiffPosts(from, to types.Post) []types.FieldChange {
+	changes := []types.FieldChange{}
+	a, b := reflect.ValueOf(from), reflect.ValueOf(to)
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		if field.Name == "Id" || field.Tag.Get("bson") == "-" {
+			continue
+		}
+		x, y := a.Field(i), b.Field(i)
+		if x.Kind() == reflect.Slice && x.Len() == 0 && y.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(x.Interface(), y.Interface()) {
+			changes = append(changes, types.FieldChange{
+				Field: field.Name,
+				From:  x.Interface(),
+				To:    y.Interface(),
+			})
+		}
+	}
+	return changes
+}
@@ -1,9 +1,18 @@
 package data
 
 import (
+	"rob/lib/common/types"
 	"rob/lib/datastore"
 )
 
 func UpdateSalesStock(saleId int, value int) error {
 	return datastore.UpdateSaleStock(saleId, value)
 }
+
+func GetSale(saleId int) (*types.Sale, error) {
+	return datastore.GetSale(saleId)
+}
+
+func GetSaleStatus(saleId int) (*types.StatusResponse, error) {
+	return datastore.GetStatus(saleId)
+}
@@ -0,0 +1,16 @@
+package data
+
+import (
+	"rob/lib/common/types"
+	"rob/lib/datastore"
+)
+
+// Searches run against the database text indexes, never the post cache
+
+func SearchPosts(query string, cardTypes []int, skip int, limit int) ([]types.Post, error) {
+	return datastore.SearchPosts(query, cardTypes, skip, limit)
+}
+
+func SearchProducts(query string, brand string, skip int, limit int) ([]types.Product, error) {
+	return datastore.SearchProducts(query, brand, skip, limit)
+}
@@ -1,36 +1,122 @@
+// Package cache keeps recently read data in memory, in front of the
+// datastore. Caches are safe for concurrent use, entries expire after a
+// time and are dropped explicitly when what they hold changes
 package cache
 
 import (
 	"rob/lib/common/types"
-	"rob/lib/datastore"
+	"sync"
+	"time"
 
 	"github.com/golang/groupcache/lru"
-	log "github.com/sirupsen/logrus"
 )
 
-var cacheData = lru.New(1000)
+// Cache is a least recently used cache whose entries also expire
+type Cache struct {
+	name string
+	ttl  time.Duration
+	// Read for the current time, replaced by tests
+	now func() time.Time
 
-func GetMetaData(postId string) (*types.Post, error) {
-	var funcName = "lib/datacache/cache.go:GetMetaData"
-	log.WithFields(log.Fields{
-		"postId": postId,
-	}).Debugf("Enter: %s", funcName)
-	defer log.Debugf("Exit: %s", funcName)
+	// lru.Cache is not safe for concurrent use
+	mu    sync.Mutex
+	lru   *lru.Cache
+	stats types.CacheStats
+}
+
+type entry struct {
+	value interface{}
+	// Zero when the entry doesn't expire
+	expires time.Time
+}
 
-	value, hit := cacheData.Get(postId)
+/*
+Purpose : Creates a cache
+Input : Its name, reported in its statistics, the most entries it keeps and how long it keeps them, 0 for no limit
+Outputs : The cache
+Remark :
+*/
+func New(name string, maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		name: name,
+		ttl:  ttl,
+		now:  time.Now,
+		lru:  lru.New(maxEntries),
+	}
+}
 
-	if hit == false {
-		post, err := datastore.GetPostMetaData(postId)
+// Get returns the value of the key if it is there and not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key)
+}
 
-		if err != nil {
-			log.WithField("ErrMsg", err.Error()).Error("Failed to get post data from db")
-			return nil, err
-		}
-		go cacheData.Add(postId, post)
-		return post, nil
+// get expects mu to be held
+func (c *Cache) get(key string) (interface{}, bool) {
+	v, hit := c.lru.Get(key)
+	if !hit {
+		c.stats.Misses++
+		return nil, false
 	}
+	e := v.(entry)
+	if !e.expires.IsZero() && !c.now().Before(e.expires) {
+		c.lru.Remove(key)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Add stores the value under key, replacing any there and evicting the
+// least recently used entry when the cache is full
+func (c *Cache) Add(key string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(key, value)
+}
+
+// add expects mu to be held
+func (c *Cache) add(key string, value interface{}) {
+	e := entry{value: value}
+	if c.ttl > 0 {
+		e.expires = c.now().Add(c.ttl)
+	}
+	if _, present := c.lru.Get(key); !present && c.lru.MaxEntries > 0 && c.lru.Len() >= c.lru.MaxEntries {
+		c.stats.Evictions++
+	}
+	c.lru.Add(key, e)
+}
+
+// Remove drops the key, as when its value changes
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Remove(key)
+	c.stats.Invalidations++
+}
+
+// Clear drops every entry. The statistics are kept
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Clear()
+}
+
+// Stats counts the lookups and the entries dropped since the cache was
+// created
+func (c *Cache) Stats() types.CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	v := value.(*types.Post)
-	log.Debugf("Fetched metadata for postId=%s, value=%+v", postId, v)
-	return v, nil
+	s := c.stats
+	s.Name = c.name
+	s.Entries = c.lru.Len()
+	s.MaxEntries = c.lru.MaxEntries
+	s.TTL = int(c.ttl / time.Second)
+	return s
 }
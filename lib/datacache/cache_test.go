@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"rob/lib/common/types"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New("test", 2, time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, hit := c.Get("a"); !hit || v != 1 {
+		t.Errorf("Get of a expected=1 but received=%v, %t", v, hit)
+	}
+	// b is the least recently used
+	c.Add("c", 3)
+	if _, hit := c.Get("b"); hit {
+		t.Error("b expected evicted")
+	}
+	// Replacing doesn't evict
+	c.Add("c", 4)
+	if v, hit := c.Get("c"); !hit || v != 4 {
+		t.Errorf("Get of c expected=4 but received=%v, %t", v, hit)
+	}
+
+	now = now.Add(time.Minute)
+	if _, hit := c.Get("a"); hit {
+		t.Error("a expected expired")
+	}
+	c.Add("a", 5)
+	c.Remove("a")
+	if _, hit := c.Get("a"); hit {
+		t.Error("a expected removed")
+	}
+
+	expected := types.CacheStats{
+		Name:          "test",
+		Entries:       1,
+		MaxEntries:    2,
+		TTL:           60,
+		Hits:          2,
+		Misses:        3,
+		Evictions:     1,
+		Expirations:   1,
+		Invalidations: 1,
+	}
+	if got := c.Stats(); got != expected {
+		t.Errorf("Stats expected=%+v but received=%+v", expected, got)
+	}
+
+	// Without a ttl entries stay until evicted
+	c = New("test", 0, 0)
+	c.now = func() time.Time { return now }
+	c.Add("a", 1)
+	now = now.Add(24 * time.Hour)
+	if _, hit := c.Get("a"); !hit {
+		t.Error("a expected kept without a ttl")
+	}
+}
+
+func TestCacheConcurrency(t *testing.T) {
+	c := New("test", 100, time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa((i + j) % 150)
+				c.Add(key, j)
+				c.Get(key)
+				if j%10 == 0 {
+					c.Remove(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s := c.Stats()
+	if s.Entries > 100 || s.Hits+s.Misses != 8000 || s.Invalidations != 800 {
+		t.Errorf("Stats mismatch %+v", s)
+	}
+}
+
+func TestPosts(t *testing.T) {
+	prev := posts
+	defer func() { posts = prev }()
+	posts = New("posts", 10, time.Minute)
+
+	p := types.Post{Id: bson.NewObjectId(), Title: "Cached"}
+	AddPostMetaData(p)
+	cached, err := GetPostMetaData(p.Id.Hex())
+	if err != nil || cached.Title != "Cached" {
+		t.Fatalf("Cached post expected but received %+v, %v", cached, err)
+	}
+	// Callers get copies
+	cached.Title = "Changed"
+	if again, _ := GetPostMetaData(p.Id.Hex()); again.Title != "Cached" {
+		t.Errorf("Cached post expected unchanged but received %q", again.Title)
+	}
+
+	other := types.Post{Id: bson.NewObjectId()}
+	AddPostsMetaData([]types.Post{other})
+	missing := bson.NewObjectId().Hex()
+	hits, misses := GetPostsMetaData([]string{p.Id.Hex(), missing, other.Id.Hex(), missing})
+	if len(hits) != 2 || len(misses) != 1 || misses[0] != missing {
+		t.Errorf("Expected 2 hits and %s missed but received %v, %v", missing, hits, misses)
+	}
+
+	RemovePostMetaData(p.Id.Hex())
+	if _, err := GetPostMetaData(p.Id.Hex()); err != ErrCacheMiss {
+		t.Errorf("Removed post expected=%v but received=%v", ErrCacheMiss, err)
+	}
+	if s := Stats(); len(s) != 2 || s[0].Name != "posts" || s[0].Invalidations != 1 || s[1].Name != "manifest" {
+		t.Errorf("Stats mismatch %+v", s)
+	}
+}
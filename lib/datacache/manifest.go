@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"rob/lib/common/types"
+	"time"
+)
+
+const manifestKey = "manifest"
+
+var manifest = New("manifest", 1, time.Minute)
+
+// GetManifest returns the cached manifest, shared by all callers who must
+// not change it
+func GetManifest() (*types.Manifest, bool) {
+	cachesMu.RLock()
+	c := manifest
+	cachesMu.RUnlock()
+
+	value, hit := c.Get(manifestKey)
+	if !hit {
+		return nil, false
+	}
+	m, ok := value.(*types.Manifest)
+	return m, ok
+}
+
+func AddManifest(m *types.Manifest) {
+	cachesMu.RLock()
+	defer cachesMu.RUnlock()
+	manifest.Add(manifestKey, m)
+}
+
+// RemoveManifest drops the manifest once it changes
+func RemoveManifest() {
+	cachesMu.RLock()
+	defer cachesMu.RUnlock()
+	manifest.Remove(manifestKey)
+}
@@ -3,16 +3,52 @@ package cache
 import (
 	"errors"
 	"rob/lib/common/types"
+	"rob/lib/config"
+	"sync"
+	"time"
 
-	"github.com/golang/groupcache/lru"
 	log "github.com/sirupsen/logrus"
 )
 
-var postsCache = lru.New(4096)
+var (
+	posts = New("posts", 4096, 5*time.Minute)
+	// Guards the caches being replaced by Init, each cache guards itself
+	cachesMu sync.RWMutex
+)
 
 var ErrCacheMiss = errors.New("Not found in cache")
 var ErrCacheWrongType = errors.New("Type conversion error")
 
+/*
+Purpose : Sizes the caches as configured
+Input : None
+Outputs : None
+Remark : Called at start-up. What was cached is dropped
+*/
+func Init() {
+	cfg := config.Get().Cache
+
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	posts = New("posts", cfg.PostEntries, time.Duration(cfg.PostTTL)*time.Second)
+	manifest = New("manifest", 1, time.Duration(cfg.ManifestTTL)*time.Second)
+}
+
+func postsCache() *Cache {
+	cachesMu.RLock()
+	defer cachesMu.RUnlock()
+	return posts
+}
+
+// Stats of every cache, for admins
+func Stats() []types.CacheStats {
+	cachesMu.RLock()
+	defer cachesMu.RUnlock()
+	return []types.CacheStats{posts.Stats(), manifest.Stats()}
+}
+
+// GetPostMetaData returns a copy of the cached post, so that callers can't
+// change what others read
 func GetPostMetaData(postId string) (*types.Post, error) {
 	var funcName = "lib/datacache/posts.go:GetPostMetaData"
 	log.WithFields(log.Fields{
@@ -20,19 +56,76 @@ func GetPostMetaData(postId string) (*types.Post, error) {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	value, hit := postsCache.Get(postId)
-
-	if hit == false {
+	value, hit := postsCache().Get(postId)
+	if !hit {
 		return nil, ErrCacheMiss
 	}
+	return asPost(value)
+}
 
-	if v, ok := value.(*types.Post); !ok {
+func asPost(value interface{}) (*types.Post, error) {
+	v, ok := value.(types.Post)
+	if !ok {
 		return nil, ErrCacheWrongType
-	} else {
-		return v, nil
 	}
+	return &v, nil
+}
+
+/*
+Purpose : Looks up many posts at once
+Input : Ids of the posts
+Outputs : Copies of the cached posts by id, and the ids not in the cache
+Remark : Each missed id is reported once even if repeated in postIds
+*/
+func GetPostsMetaData(postIds []string) (map[string]*types.Post, []string) {
+	var funcName = "lib/datacache/posts.go:GetPostsMetaData"
+	log.WithFields(log.Fields{
+		"numOfPosts": len(postIds),
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	c := postsCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hits := make(map[string]*types.Post)
+	var misses []string
+	missed := make(map[string]bool)
+	for _, postId := range postIds {
+		if _, ok := hits[postId]; ok || missed[postId] {
+			continue
+		}
+		value, hit := c.get(postId)
+		if hit {
+			if v, err := asPost(value); err == nil {
+				hits[postId] = v
+				continue
+			}
+		}
+		missed[postId] = true
+		misses = append(misses, postId)
+	}
+
+	log.Debugf("Posts cache hits: %d, misses: %d", len(hits), len(misses))
+	return hits, misses
 }
 
 func AddPostMetaData(post types.Post) {
-	postsCache.Add(post.Id.Hex(), post)
+	postsCache().Add(post.Id.Hex(), post)
+}
+
+// RemovePostMetaData drops the post once it changes. Every write to posts
+// goes through lib/data, which calls it
+func RemovePostMetaData(postId string) {
+	postsCache().Remove(postId)
+}
+
+func AddPostsMetaData(posts []types.Post) {
+	c := postsCache()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, p := range posts {
+		c.add(p.Id.Hex(), p)
+	}
 }
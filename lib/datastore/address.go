@@ -3,7 +3,6 @@ package datastore
 
 import (
 	"errors"
-	"fmt"
 	c "rob/lib/common/constants"
 	lh "rob/lib/common/loghelper"
 	"rob/lib/common/types"
@@ -20,27 +19,18 @@ Outputs : addressId and error if any
 Remark :
 */
 
-func AddAddress(address types.Address) (int, error) {
+func (s *DbStore) AddAddress(address types.Address) (int, error) {
 	var funcName = "datastore/address.go:AddAddress"
 	log.WithFields(log.Fields{
 		"Address": address,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
 	timeofCreation := time.Now().UTC().UnixNano()
-	query = fmt.Sprintf("INSERT INTO %s(%s,%s,%s,%s,%s,%s,%s,%s) VALUES(%d,'%s','%s','%s','%s',%d,'%s',%d);", c.AddressTable, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.TimeOfCreation, address.UserId, address.Address, address.AddressType, address.City, address.State, address.PostalCode, address.Phone, timeofCreation)
-	lh.Mysql.Query(query)
+	query := insertQuery(c.AddressTable, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.TimeOfCreation)
 
-	stmt, err := db.Prepare(query)
+	res, err := execQuery(db, query, address.UserId, address.Address, address.AddressType, address.City, address.State, address.PostalCode, address.Phone, timeofCreation)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return -1, err
-	}
-	defer stmt.Close()
-	res, err := stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
 		return -1, err
 	}
 
@@ -59,26 +49,17 @@ Outputs : an address object pointer and error if any
 Remark :
 */
 
-func GetAddress(aId int) (*types.Address, error) {
+func (s *DbStore) GetAddress(aId int) (*types.Address, error) {
 	var funcName = "datastore/address.go:GetAddress"
 	log.WithFields(log.Fields{
 		"addressId": aId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select %s,%s,%s,%s,%s,%s,%s,%s from %s where Id = %d", c.Id, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.AddressTable, aId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.AddressTable, []string{c.Id, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone}, c.Id)
 
 	var address types.Address
-	err = stmt.QueryRow().Scan(&address.Id, &address.UserId, &address.Address, &address.AddressType, &address.City, &address.State, &address.PostalCode, &address.Phone)
+	err := scanRow(query, []interface{}{aId}, &address.Id, &address.UserId, &address.Address, &address.AddressType, &address.City, &address.State, &address.PostalCode, &address.Phone)
 
 	if err != nil {
 		lh.Mysql.ScanError(err)
@@ -96,26 +77,16 @@ Outputs : AddressList object pointer
 Remark : Wraps all address in a addressList
 */
 
-func GetUserAddresses(userId int) (*types.AddressList, error) {
+func (s *DbStore) GetUserAddresses(userId int) (*types.AddressList, error) {
 
 	var funcName = "datastore/address.go:GetUserAdresses"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select * from %s where %s=%d", c.AddressTable, c.UserId, userId)
-	lh.Mysql.Query(query)
+	query := selectQuery(c.AddressTable, []string{"*"}, c.UserId)
 
-	stmt, err := db.Prepare(query)
+	rows, err := queryRows(query, userId)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query()
-	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -144,29 +115,17 @@ Outputs : error if any
 Remark : Frontend should auto fill the address to be edited else fields can be replaced by null
 */
 
-func EditAddress(addressId int, newAddress types.Address) error {
+func (s *DbStore) EditAddress(addressId int, newAddress types.Address) error {
 	var funcName = "datastore/address.go:EditAddress"
 	log.WithFields(log.Fields{
 		"Address": newAddress,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
 	timeofCreation := time.Now().UTC().UnixNano()
-	query = fmt.Sprintf("UPDATE %s SET %s='%s',%s='%s',%s='%s',%s='%s',%s=%d,%s='%s',%s=%d WHERE %s = %d;", c.AddressTable, c.Address, newAddress.Address, c.AddressType, newAddress.AddressType, c.City, newAddress.City, c.State, newAddress.State, c.PostalCode, newAddress.PostalCode, c.Phone, newAddress.Phone, c.TimeOfCreation, timeofCreation, c.Id, addressId)
-	lh.Mysql.Query(query)
+	query := updateQuery(c.AddressTable, []string{c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.TimeOfCreation}, c.Id)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-	return nil
+	_, err := execQuery(db, query, newAddress.Address, newAddress.AddressType, newAddress.City, newAddress.State, newAddress.PostalCode, newAddress.Phone, timeofCreation, addressId)
+	return err
 
 }
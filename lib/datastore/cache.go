@@ -1,101 +1,145 @@
+// All the database requests related to the manifest of urls the app keeps
+// offline go here
 package datastore
 
 import (
+	"database/sql"
 	"fmt"
-
 	c "rob/lib/common/constants"
 	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
 
 	log "github.com/sirupsen/logrus"
 )
 
-func GetCacheDetails() ([]string, error) {
-	var funcName = "datastore/cache.go:GetCacheDetails"
-	log.Debugf("Enter : %s", funcName)
+/*
+Purpose : Reads the manifest of cached urls
+Input : None
+Outputs : Every entry, removed ones included, by priority then url
+Remark : The version of the manifest is the highest Version of its entries
+*/
+func (s *DbStore) GetManifestEntries() ([]types.ManifestEntry, error) {
+	var funcName = "datastore/cache.go:GetManifestEntries"
+	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var tableName string
-	tableName = c.UrlCacheTable
-	query := fmt.Sprintf(`
-	Select %s 
-	FROM %s
-	`, c.Url, tableName)
-
-	lh.Mysql.Query(query)
+	query := fmt.Sprintf("SELECT %s, %s, %s, %s, %s, %s FROM %s ORDER BY %s DESC, %s",
+		c.Url, c.Hash, c.Size, c.Priority, c.Version, c.Removed, c.UrlCacheTable, c.Priority, c.Url)
 
-	rows, err := db.Query(query)
+	rows, err := queryRows(query)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	log.Debugf("Returned UrlCache rows: %v", rows)
-
-	var urls []string
-
+	entries := []types.ManifestEntry{}
 	for rows.Next() {
-		var url string
-
-		err = rows.Scan(&url)
-
-		log.Debugf("UrlCache url:%s", url)
-		if err != nil {
+		var e types.ManifestEntry
+		if err := rows.Scan(&e.Url, &e.Hash, &e.Size, &e.Priority, &e.Version, &e.Removed); err != nil {
 			log.WithField("ErrMsg", err.Error()).Error("Failed to scan one row of UrlCache. Continuing to next row")
 			continue
 		}
-
-		urls = append(urls, url)
+		entries = append(entries, e)
 	}
-
-	return urls, nil
-
+	return entries, rows.Err()
 }
 
-func InsertCacheUrl(url string) error {
-	var funcName = "datastore/cache.go:GetCacheDetails"
-	log.Debugf("Enter : %s", funcName)
+/*
+Purpose : Adds an url to the manifest or updates it
+Input : The entry, its Version and Removed are ignored
+Outputs : The version of the manifest afterwards
+Remark : An entry already there as it is doesn't change the version
+*/
+func (s *DbStore) PutManifestEntry(e types.ManifestEntry) (int64, error) {
+	var funcName = "datastore/cache.go:PutManifestEntry"
+	log.WithFields(log.Fields{
+		"url": e.Url,
+	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-	INSERT INTO %s(%s)
-	VALUES ('%s');
-	`, c.UrlCacheTable, c.Url, url)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
+	version, err := lockManifest(tx)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
+		return 0, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec()
-	return err
-}
+	var current types.ManifestEntry
+	query := fmt.Sprintf("SELECT %s, %s, %s, %s FROM %s WHERE %s = ? FOR UPDATE",
+		c.Hash, c.Size, c.Priority, c.Removed, c.UrlCacheTable, c.Url)
+	lh.Mysql.Query(query)
+	err = tx.QueryRow(query, e.Url).Scan(&current.Hash, &current.Size, &current.Priority, &current.Removed)
+	if err == nil && !current.Removed && current.Hash == e.Hash && current.Size == e.Size && current.Priority == e.Priority {
+		return version, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
 
-func DeleteCacheUrl(url string) error {
-	var funcName = "datastore/cache.go:DeletetCacheUrl"
-	log.Debugf("Enter %s", funcName)
-	defer log.Debugf("Exit %s", funcName)
+	version++
+	query = fmt.Sprintf(`
+		INSERT INTO %s(%s, %s, %s, %s, %s, %s)
+		VALUES(?,?,?,?,?,0)
+		ON DUPLICATE KEY
+		UPDATE %s = VALUES(%s), %s = VALUES(%s), %s = VALUES(%s), %s = VALUES(%s), %s = 0;`,
+		c.UrlCacheTable, c.Url, c.Hash, c.Size, c.Priority, c.Version, c.Removed,
+		c.Hash, c.Hash, c.Size, c.Size, c.Priority, c.Priority, c.Version, c.Version, c.Removed)
+	if _, err := execQuery(tx, query, e.Url, e.Hash, e.Size, e.Priority, version); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
 
-	query := fmt.Sprintf(`
-	DELETE FROM %s
-	WHERE %s = '%s';
-	`, c.UrlCacheTable, c.Url, url)
+/*
+Purpose : Removes an url from the manifest
+Input : The url
+Outputs : The version of the manifest afterwards
+Remark : sql.ErrNoRows if the url isn't in it. The entry is kept, marked removed, to report the removal to the app
+*/
+func (s *DbStore) RemoveManifestEntry(url string) (int64, error) {
+	var funcName = "datastore/cache.go:RemoveManifestEntry"
+	log.WithFields(log.Fields{
+		"url": url,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
 
-	lh.Mysql.Query(query)
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	stmt, err := db.Prepare(query)
+	version, err := lockManifest(tx)
+	if err != nil {
+		return 0, err
+	}
 
+	version++
+	query := fmt.Sprintf("UPDATE %s SET %s = 1, %s = ? WHERE %s = ? AND %s = 0",
+		c.UrlCacheTable, c.Removed, c.Version, c.Url, c.Removed)
+	res, err := execQuery(tx, query, version, url)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n == 0 {
+		return 0, sql.ErrNoRows
 	}
-	defer stmt.Close()
+	return version, tx.Commit()
+}
+
+// lockManifest returns the version of the manifest, holding its entries
+// until tx ends so that no two changes make the same version
+func lockManifest(tx *sql.Tx) (int64, error) {
+	query := fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s FOR UPDATE", c.Version, c.UrlCacheTable)
+	lh.Mysql.Query(query)
 
-	_, err = stmt.Exec()
-	return err
+	var version int64
+	err := tx.QueryRow(query).Scan(&version)
+	return version, err
 }
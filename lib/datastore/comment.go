@@ -0,0 +1,248 @@
+// All the database requests related to comments on posts go here
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var commentColumns = []string{c.Id, c.PostId, c.ParentId, c.UserId, c.Body, c.Status,
+	c.TimeOfCreation, c.ModeratedBy, c.TimeOfModeration}
+
+// commentFields are the destinations of commentColumns in cm
+func commentFields(cm *types.Comment) []interface{} {
+	return []interface{}{&cm.Id, &cm.PostId, &cm.ParentId, &cm.UserId, &cm.Body, &cm.Status,
+		&cm.TimeOfCreation, &cm.ModeratedBy, &cm.TimeOfModeration}
+}
+
+/*
+Purpose : Adds a comment on a post
+Input : the comment, its Id and TimeOfCreation are set here
+Outputs : Id of the comment and error if any
+Remark :
+*/
+func (s *DbStore) AddComment(cm types.Comment) (int, error) {
+	var funcName = "datastore/comment.go:AddComment"
+	log.WithFields(log.Fields{
+		"postId":   cm.PostId,
+		"parentId": cm.ParentId,
+		"userId":   cm.UserId,
+		"status":   cm.Status,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := insertQuery(c.CommentTable, c.PostId, c.ParentId, c.UserId, c.Body, c.Status, c.TimeOfCreation)
+	res, err := execQuery(db, query, cm.PostId, cm.ParentId, cm.UserId, cm.Body, cm.Status, time.Now().UTC().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		lh.Mysql.ExecError(err)
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (s *DbStore) GetComment(commentId int) (*types.Comment, error) {
+	var funcName = "datastore/comment.go:GetComment"
+	log.WithFields(log.Fields{
+		"commentId": commentId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := selectQuery(c.CommentTable, commentColumns, c.Id)
+	var cm types.Comment
+	err := scanRow(query, []interface{}{commentId}, commentFields(&cm)...)
+	if err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
+
+/*
+Purpose : One page of the visible comments on a post, or of the replies to one of them
+Input : postId, parentId or 0 for the comments on the post itself, the Id to read after and how many
+Outputs : Up to n comments, oldest first, each with its count of visible Replies
+Remark :
+*/
+func (s *DbStore) GetComments(postId string, parentId int, afterId int, n int) ([]types.Comment, error) {
+	var funcName = "datastore/comment.go:GetComments"
+	log.WithFields(log.Fields{
+		"postId":   postId,
+		"parentId": parentId,
+		"afterId":  afterId,
+		"n":        n,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s,
+			(SELECT COUNT(*) FROM %s R WHERE R.%s = %s.%s AND R.%s = ?)
+		FROM %s
+		WHERE %s = ? AND %s = ? AND %s = ? AND %s > ?
+		ORDER BY %s
+		LIMIT ?`,
+		strings.Join(commentColumns, ", "),
+		c.CommentTable, c.ParentId, c.CommentTable, c.Id, c.Status,
+		c.CommentTable,
+		c.PostId, c.ParentId, c.Status, c.Id,
+		c.Id)
+
+	rows, err := queryRows(query, c.CommentVisible, postId, parentId, c.CommentVisible, afterId, n)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+/*
+Purpose : Lists the comments held for review
+Input :
+Outputs : The comments, oldest first
+Remark :
+*/
+func (s *DbStore) GetHeldComments() ([]types.Comment, error) {
+	var funcName = "datastore/comment.go:GetHeldComments"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s, 0
+		FROM %s
+		WHERE %s = ?
+		ORDER BY %s`,
+		strings.Join(commentColumns, ", "),
+		c.CommentTable,
+		c.Status,
+		c.Id)
+
+	rows, err := queryRows(query, c.CommentHeld)
+	if err != nil {
+		return nil, err
+	}
+	return scanComments(rows)
+}
+
+/*
+Purpose : Hides a comment or makes it visible
+Input : commentId, c.CommentHidden or c.CommentVisible, and the admin doing it
+Outputs : sql.ErrNoRows if there is no such comment
+Remark :
+*/
+func (s *DbStore) ModerateComment(commentId int, status string, moderatedBy int) error {
+	var funcName = "datastore/comment.go:ModerateComment"
+	log.WithFields(log.Fields{
+		"commentId":   commentId,
+		"status":      status,
+		"moderatedBy": moderatedBy,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if _, err := s.GetComment(commentId); err != nil {
+		return err
+	}
+	query := updateQuery(c.CommentTable, []string{c.Status, c.ModeratedBy, c.TimeOfModeration}, c.Id)
+	_, err := execQuery(db, query, status, moderatedBy, time.Now().UTC().UnixNano(), commentId)
+	return err
+}
+
+/*
+Purpose : Removes a comment with the replies to it
+Input : commentId
+Outputs : error if any
+Remark :
+*/
+func (s *DbStore) DeleteComment(commentId int) error {
+	var funcName = "datastore/comment.go:DeleteComment"
+	log.WithFields(log.Fields{
+		"commentId": commentId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? OR %s = ?", c.CommentTable, c.Id, c.ParentId)
+	_, err := execQuery(db, query, commentId, commentId)
+	return err
+}
+
+/*
+Purpose : Counts the visible comments on several posts at once
+Input : postIds
+Outputs : Counts by postId, replies included. Posts without comments are left out
+Remark :
+*/
+func (s *DbStore) GetCommentCounts(postIds []string) (map[string]int, error) {
+	var funcName = "datastore/comment.go:GetCommentCounts"
+	log.WithFields(log.Fields{
+		"postIds": postIds,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	counts := make(map[string]int)
+	if len(postIds) == 0 {
+		return counts, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*)
+		FROM %s
+		WHERE %s IN (%s) AND %s = ?
+		GROUP BY %s`,
+		c.PostId,
+		c.CommentTable,
+		c.PostId, placeholders(len(postIds)), c.Status,
+		c.PostId)
+
+	args := make([]interface{}, 0, len(postIds)+1)
+	for _, id := range postIds {
+		args = append(args, id)
+	}
+	rows, err := queryRows(query, append(args, c.CommentVisible)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postId string
+		var count int
+		if err := rows.Scan(&postId, &count); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		counts[postId] = count
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+// scanComments reads rows of commentColumns followed by the count of
+// replies, and closes them
+func scanComments(rows *sql.Rows) ([]types.Comment, error) {
+	defer rows.Close()
+
+	comments := []types.Comment{}
+	for rows.Next() {
+		var cm types.Comment
+		if err := rows.Scan(append(commentFields(&cm), &cm.Replies)...); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		comments = append(comments, cm)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return comments, nil
+}
@@ -5,8 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	c "rob/lib/common/constants"
-
-	mgo "gopkg.in/mgo.v2"
+	"rob/lib/config"
 
 	lh "rob/lib/common/loghelper"
 
@@ -21,7 +20,9 @@ func InitMySql() {
 
 	log.Info("Checking Mysql instance")
 
-	dbb, err := sql.Open("mysql", c.DbUriBase)
+	cfg := config.Get().Mysql
+
+	dbb, err := sql.Open("mysql", cfg.BaseUri())
 	if err != nil {
 		panic(err)
 	}
@@ -31,14 +32,15 @@ func InitMySql() {
 
 	// Create database if needed
 	query = fmt.Sprintf(`
-		CREATE DATABASE IF NOT EXISTS %s`,
-		c.DbName)
+		CREATE DATABASE IF NOT EXISTS %s
+		CHARACTER SET utf8mb4`,
+		cfg.DbName)
 
 	if err := PrepareAndExec(query, dbb); err != nil {
 		panic(err)
 	}
 
-	db, err = sql.Open("mysql", c.DbUri)
+	db, err = sql.Open("mysql", cfg.Uri())
 	if err != nil {
 		log.Panic(err)
 	}
@@ -56,293 +58,29 @@ func CloseMySql() {
 	}
 }
 
-func InitDb() error {
+func (s *DbStore) InitDb() error {
 	var funcName = "datastore/common.go:InitDb"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
 	log.Info("Checking Mongo instance")
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return err
 	}
 	defer session.Close()
-	log.Info("Mongo instance running OK")
-
-	var query string
-	// Create Users table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s
-		(
-			%s int(11) NOT NULL AUTO_INCREMENT,
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(6),
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(12) NOT NULL UNIQUE,
-			%s bigint,
-			%s int,
-			%s varchar(400),
-			%s varchar(400),
-			%s varchar(400),
-			PRIMARY KEY(%s)
-		);`,
-		c.UsersTable, c.Id, c.Email, c.Password, c.Gender, c.FirstName, c.LastName, c.Phone, c.TimeOfCreation, c.Verified, c.Code, c.Token, c.ResetPasswordToken, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Create Roles table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s
-		(
-			%s int(11) NOT NULL AUTO_INCREMENT,
-			%s varchar(50) NOT NULL,
-			PRIMARY KEY(%s)
-		);`,
-		c.RolesTable, c.Id, c.Name, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Add/update admin role to Roles table
-	query = fmt.Sprintf(`
-		INSERT INTO %s 
-		VALUES(%d,'%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.RolesTable, c.AdminRole, c.AdminRoleName, c.Id, c.AdminRole)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Add/update user role to Roles table
-	query = fmt.Sprintf(`
-		INSERT INTO %s 
-		VALUES(%d,'%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.RolesTable, c.UserRole, c.UserRoleName, c.Id, c.UserRole)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Add/update writer role to Roles table
-	query = fmt.Sprintf(`
-		INSERT INTO %s 
-		VALUES(%d,'%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.RolesTable, c.WriterRole, c.WriterRoleName, c.Id, c.WriterRole)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Create UserRole table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s
-		(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s int(11) NOT NULL,
-			%s int(11) NOT NULL,
-			FOREIGN KEY (%s) REFERENCES %s(%s),
-			PRIMARY KEY (%s)
-		);`,
-		c.UserRoleTable, c.Id, c.UserId, c.RoleId, c.RoleId, c.RolesTable, c.Id, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Create Mascot table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s
-		(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s varchar(50),
-			%s varchar(255),
-			PRIMARY KEY(%s)
-		);`,
-		c.MascotTable, c.Id, c.Name, c.Description, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Add/Update default mascot details
-	query = fmt.Sprintf(`
-		INSERT INTO %s
-		VALUES(%d,'%s','%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.MascotTable, c.DefaultMascotId, c.DefaultMascotName,
-		c.DefaultMascotDescription, c.Id, c.DefaultMascotId)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Create PostQueue table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS %s
-		(
-			%s bigint,
-			%s varchar(255) NOT NULL,
-			%s int NOT NULL,
-			FOREIGN KEY (%s) REFERENCES %s(%s),
-			PRIMARY KEY(%s,%s)
-		);`,
-		c.PostQueueTable, c.TimeOfCreation, c.PostId, c.MascotId,
-		c.MascotId, c.MascotTable, c.Id, c.MascotId, c.PostId)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	//Create Sale table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		Sale(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s varchar(500),
-			%s varchar(200),
-			%s varchar(50),
-			%s varchar(500),
-			%s varchar(500),
-			%s int,
-			%s bigint,
-			%s bigint,
-			%s bigint,
-			PRIMARY KEY(%s)
-		);`,
-		c.Id, c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime, c.TimeOfCreation, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	//Create Order table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		%s(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s varchar(400),
-			%s varchar(400),
-			%s varchar(400),
-			%s int(11),
-			%s bigint,
-			%s int(11),
-			%s int(11),
-			%s int(11),
-			%s int(11),
-			%s int(11),
-			%s varchar(400),
-			%s int(11),
-			%s int(11),
-			%s int(11),
-			%s varchar(400),
-			%s varchar(40),
-			%s bigint,
-			PRIMARY KEY(%s)
-		);`, c.OrderTable, c.Id, c.ProductId, c.ProductTitle, c.ProductThumb, c.UserId, c.OrderDate, c.Price, c.Tax, c.ShippingCost, c.Amount, c.TransId, c.TransStatus, c.SaleId, c.AddressId, c.ShippingId, c.ShippingStatus, c.TrackingId, c.TimeOfCreation, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	//Create Address table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		%s(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s int,
-			%s varchar(1000),
-			%s varchar(200),
-			%s varchar(400),
-			%s varchar(400),
-			%s int(6),
-			%s varchar(10),
-			%s bigint,
-			PRIMARY KEY(%s)
-		);`, c.AddressTable, c.Id, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.TimeOfCreation, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	//Create Transaction table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		%s(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s int,
-			%s int,
-			%s int,
-			%s bigint,
-			%s varchar(500),
-			%s varchar(100),			
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(500),
-			PRIMARY KEY(%s)
-		);`, c.TransactionTable, c.Id, c.Amount, c.OrderId, c.Phone, c.TimeOfCreation, c.ProductInfo, c.Email, c.PaymentMethod, c.PaymentId, c.PaymentStatus, c.FirstName, c.Hash, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
+	if err := session.Ping(); err != nil {
+		lh.Mongo.ConnectError(err)
 		return err
 	}
+	log.Info("Mongo instance running OK")
 
-	//Create Shipping table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		%s(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s int,
-			%s int,
-			%s varchar(100),
-			%s int,
-			%s varchar(200),
-			%s bigint,
-			PRIMARY KEY(%s)
-		);`, c.ShippingTable, c.Id, c.OrderId, c.UserId, c.TrackingId, c.AddressId, c.ShippingStatus, c.TimeOfCreation, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
+	if err := ensureSearchIndexes(session); err != nil {
 		return err
 	}
 
-	// Create Feedback table if needed
-	query = fmt.Sprintf(`
-		CREATE TABLE IF NOT EXISTS
-		%s(
-			%s int NOT NULL AUTO_INCREMENT,
-			%s varchar(100),
-			%s varchar(100),
-			%s varchar(2000),
-			PRIMARY KEY(%s)
-		);`, c.FeedbackTable, c.Id, c.Phone, c.Type, c.Description, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
-		return err
-	}
-
-	// Create UrlCache table if needed
-	query = fmt.Sprintf(`
-	CREATE TABLE IF NOT EXISTS 
-	%s(
-		%s int NOT NULL AUTO_INCREMENT,
-		%s varchar(100),
-		PRIMARY KEY(%s)
-	);`, c.UrlCacheTable, c.Id, c.Url, c.Id)
-
-	if err := PrepareAndExec(query, db); err != nil {
+	if _, err := Migrate(LatestSchemaVersion(), false); err != nil {
 		return err
 	}
 
@@ -351,7 +89,7 @@ func InitDb() error {
 	return nil
 }
 
-func AddFeedback(ph, typ, desc string) error {
+func (s *DbStore) AddFeedback(ph, typ, desc string) error {
 	var funcName = "datastore/common.go:AddFeedback"
 	log.WithFields(log.Fields{
 		"type": typ,
@@ -359,36 +97,24 @@ func AddFeedback(ph, typ, desc string) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s(%s, %s, %s)
-		VALUES('%s', '%s', '%s')`,
-		c.FeedbackTable,
-		c.Phone, c.Type, c.Description,
-		ph, typ, desc)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
+	query := insertQuery(c.FeedbackTable, c.Phone, c.Type, c.Description)
 
-	_, err = stmt.Exec()
+	_, err := execQuery(db, query, ph, typ, desc)
 	return err
 }
 
 // Intended behaviour to not add common Enter/Exit statements to this func
-func PrepareAndExec(query string, ldb *sql.DB) error {
+// args are bound to the ? placeholders of the query
+func PrepareAndExec(query string, ldb *sql.DB, args ...interface{}) error {
 	lh.Mysql.Query(query)
 	stmt, err := ldb.Prepare(query)
 	if err != nil {
 		lh.Mysql.PrepareError(err)
 		return err
 	}
+	defer stmt.Close()
 
-	_, err = stmt.Exec()
+	_, err = stmt.Exec(args...)
 	if err != nil {
 		lh.Mysql.ExecError(err)
 		return err
@@ -0,0 +1,206 @@
+// All the database requests related to likes, saves and views of posts go here
+package datastore
+
+import (
+	"fmt"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Purpose : Records that a user liked or saved a post
+Input : postId, userId and the kind, c.EngagementLike or c.EngagementSave
+Outputs : error if any
+Remark : Doing it again changes nothing
+*/
+func (s *DbStore) AddEngagement(postId string, userId int, kind int) error {
+	var funcName = "datastore/engagement.go:AddEngagement"
+	log.WithFields(log.Fields{
+		"postId": postId,
+		"userId": userId,
+		"kind":   kind,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		INSERT IGNORE INTO %s(%s, %s, %s, %s)
+		VALUES(?,?,?,?);`,
+		c.EngagementTable, c.PostId, c.UserId, c.Kind, c.TimeOfCreation)
+
+	_, err := execQuery(db, query, postId, userId, kind, time.Now().UTC().UnixNano())
+	return err
+}
+
+func (s *DbStore) RemoveEngagement(postId string, userId int, kind int) error {
+	var funcName = "datastore/engagement.go:RemoveEngagement"
+	log.WithFields(log.Fields{
+		"postId": postId,
+		"userId": userId,
+		"kind":   kind,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ? AND %s = ?",
+		c.EngagementTable, c.PostId, c.UserId, c.Kind)
+
+	_, err := execQuery(db, query, postId, userId, kind)
+	return err
+}
+
+/*
+Purpose : Records views of posts by a user
+Input : userId and the postIds viewed
+Outputs : error if any
+Remark : All in one insert. Only the first view of a post by the user is kept
+*/
+func (s *DbStore) AddViews(userId int, postIds []string) error {
+	var funcName = "datastore/engagement.go:AddViews"
+	log.WithFields(log.Fields{
+		"userId":  userId,
+		"postIds": postIds,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if len(postIds) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().UnixNano()
+	values := make([]string, len(postIds))
+	args := make([]interface{}, 0, 4*len(postIds))
+	for i, postId := range postIds {
+		values[i] = "(" + placeholders(4) + ")"
+		args = append(args, postId, userId, c.EngagementView, now)
+	}
+	query := fmt.Sprintf(`
+		INSERT IGNORE INTO %s(%s, %s, %s, %s)
+		VALUES %s;`,
+		c.EngagementTable, c.PostId, c.UserId, c.Kind, c.TimeOfCreation,
+		strings.Join(values, ","))
+
+	_, err := execQuery(db, query, args...)
+	return err
+}
+
+/*
+Purpose : Counts the likes, saves and views of several posts at once
+Input : postIds, and the user whose likes and saves are looked for
+Outputs : Engagement by postId. Posts nobody engaged with are left out
+Remark : One grouped query for all the posts, the user's own rows are summed along
+*/
+func (s *DbStore) GetEngagement(postIds []string, userId int) (map[string]types.Engagement, error) {
+	var funcName = "datastore/engagement.go:GetEngagement"
+	log.WithFields(log.Fields{
+		"postIds": postIds,
+		"userId":  userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	result := make(map[string]types.Engagement)
+	if len(postIds) == 0 {
+		return result, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, COUNT(*), SUM(%s = ?)
+		FROM %s
+		WHERE %s IN (%s)
+		GROUP BY %s, %s`,
+		c.PostId, c.Kind, c.UserId,
+		c.EngagementTable,
+		c.PostId, placeholders(len(postIds)),
+		c.PostId, c.Kind)
+
+	args := make([]interface{}, 0, len(postIds)+1)
+	args = append(args, userId)
+	for _, id := range postIds {
+		args = append(args, id)
+	}
+	rows, err := queryRows(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postId string
+		var kind, count, mine int
+		if err := rows.Scan(&postId, &kind, &count, &mine); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		e := result[postId]
+		addEngagement(&e, kind, count, mine > 0)
+		result[postId] = e
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// addEngagement adds count users of kind to e, mine if the user asking is
+// one of them
+func addEngagement(e *types.Engagement, kind int, count int, mine bool) {
+	switch kind {
+	case c.EngagementLike:
+		e.Likes += count
+		e.Liked = e.Liked || mine
+	case c.EngagementSave:
+		e.Saves += count
+		e.Saved = e.Saved || mine
+	case c.EngagementView:
+		e.Views += count
+	}
+}
+
+/*
+Purpose : Lists the posts saved by a user
+Input : userId
+Outputs : Ids of the posts, last saved first
+Remark :
+*/
+func (s *DbStore) GetSavedPostIds(userId int) ([]string, error) {
+	var funcName = "datastore/engagement.go:GetSavedPostIds"
+	log.WithFields(log.Fields{
+		"userId": userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE %s = ? AND %s = ?
+		ORDER BY %s DESC, %s DESC`,
+		c.PostId,
+		c.EngagementTable,
+		c.UserId, c.Kind,
+		c.TimeOfCreation, c.PostId)
+
+	rows, err := queryRows(query, userId, c.EngagementSave)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	postIds := []string{}
+	for rows.Next() {
+		var postId string
+		if err := rows.Scan(&postId); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		postIds = append(postIds, postId)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return postIds, nil
+}
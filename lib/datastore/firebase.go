@@ -4,12 +4,13 @@ import (
 	"fmt"
 	c "rob/lib/common/constants"
 	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
 
 	_ "github.com/go-sql-driver/mysql"
 	log "github.com/sirupsen/logrus"
 )
 
-func UpdateToken(userId int, token string) error {
+func (s *DbStore) UpdateToken(userId int, token string) error {
 	var funcName = "datastore/firebase.go:UpdateToken"
 	log.WithFields(log.Fields{
 		"userId": userId,
@@ -17,23 +18,89 @@ func UpdateToken(userId int, token string) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s='%s'
-		WHERE %s = %d`,
-		c.UsersTable,
-		// Key, value paris
-		c.Token, token, c.Id, userId)
+	query := updateQuery(c.UsersTable, []string{c.Token}, c.Id)
+
+	_, err := execQuery(db, query, token, userId)
+	return err
+}
+
+/*
+Purpose : Finds the devices a notification goes to
+Input : The target, c.TargetUser, c.TargetMascot, c.TargetRole or c.TargetAll, and the user, mascot or role it names
+Outputs : The registration token of each user of the target who has one, by user id
+Remark :
+*/
+func (s *DbStore) GetPushTokens(target string, targetId int) ([]types.PushToken, error) {
+	var funcName = "datastore/firebase.go:GetPushTokens"
+	log.WithFields(log.Fields{
+		"target":   target,
+		"targetId": targetId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	var join, where string
+	args := []interface{}{}
+	switch target {
+	case c.TargetUser:
+		where = fmt.Sprintf("AND u.%s = ?", c.Id)
+		args = append(args, targetId)
+	case c.TargetMascot:
+		join = fmt.Sprintf("JOIN %s t ON t.%s = u.%s", c.SubscriptionTable, c.UserId, c.Id)
+		where = fmt.Sprintf("AND t.%s = ?", c.MascotId)
+		args = append(args, targetId)
+	case c.TargetRole:
+		join = fmt.Sprintf("JOIN %s t ON t.%s = u.%s", c.UserRoleTable, c.UserId, c.Id)
+		where = fmt.Sprintf("AND t.%s = ?", c.RoleId)
+		args = append(args, targetId)
+	case c.TargetAll:
+	default:
+		return nil, fmt.Errorf("Unknown target %q", target)
+	}
 
-	lh.Mysql.Query(query)
+	query := fmt.Sprintf(`
+		SELECT u.%s, u.%s
+		FROM %s u %s
+		WHERE u.%s IS NOT NULL AND u.%s <> '' %s
+		ORDER BY u.%s`,
+		c.Id, c.Token,
+		c.UsersTable, join,
+		c.Token, c.Token, where,
+		c.Id)
 
-	stmt, err := db.Prepare(query)
+	rows, err := queryRows(query, args...)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []types.PushToken{}
+	for rows.Next() {
+		var t types.PushToken
+		if err := rows.Scan(&t.UserId, &t.Token); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		tokens = append(tokens, t)
 	}
-	defer stmt.Close()
+	return tokens, rows.Err()
+}
+
+/*
+Purpose : Forgets the registration token of a user once FCM no longer knows it
+Input : The user and the token
+Outputs : error if any
+Remark : A token the user registered since is kept
+*/
+func (s *DbStore) ClearPushToken(userId int, token string) error {
+	var funcName = "datastore/firebase.go:ClearPushToken"
+	log.WithFields(log.Fields{
+		"userId": userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s = ? AND %s = ?",
+		c.UsersTable, c.Token, c.Id, c.Token)
 
-	_, err = stmt.Exec()
+	_, err := execQuery(db, query, userId, token)
 	return err
 }
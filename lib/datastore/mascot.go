@@ -0,0 +1,232 @@
+// All the database requests related to a mascot go here
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Name and Description are nullable in the Mascot table
+var mascotColumns = []string{c.Id, "IFNULL(" + c.Name + ",'')", "IFNULL(" + c.Description + ",'')",
+	c.Avatar, c.GradientStart, c.GradientEnd, c.IsActive}
+
+/*
+Purpose : Adds a mascot
+Input : a Mascot object, its Id is ignored
+Outputs : mascotId and error if any
+Remark : New mascots are active
+*/
+func (s *DbStore) CreateMascot(m types.Mascot) (int, error) {
+	var funcName = "datastore/mascot.go:CreateMascot"
+	log.WithFields(log.Fields{
+		"name": m.Name,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := insertQuery(c.MascotTable, c.Name, c.Description, c.Avatar, c.GradientStart, c.GradientEnd, c.IsActive)
+
+	res, err := execQuery(db, query, m.Name, m.Description, m.Avatar, m.GradientStart, m.GradientEnd, true)
+	if err != nil {
+		return -1, err
+	}
+
+	lastId, err := res.LastInsertId()
+	if err != nil {
+		return -1, errors.New("Coudnt retirve last inserted id ")
+	}
+	return int(lastId), nil
+}
+
+func (s *DbStore) GetMascot(mascotId int) (*types.Mascot, error) {
+	var funcName = "datastore/mascot.go:GetMascot"
+	log.WithFields(log.Fields{
+		"mascotId": mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := selectQuery(c.MascotTable, mascotColumns, c.Id)
+
+	var m types.Mascot
+	err := scanRow(query, []interface{}{mascotId},
+		&m.Id, &m.Name, &m.Description, &m.Avatar, &m.GradientStart, &m.GradientEnd, &m.IsActive)
+	if err != nil {
+		lh.Mysql.ScanError(err)
+		return nil, err
+	}
+	return &m, nil
+}
+
+/*
+Purpose : Lists mascots ordered by Id
+Input : whether retired mascots are included
+Outputs : the mascots and error if any
+Remark :
+*/
+func (s *DbStore) GetMascots(includeRetired bool) ([]types.Mascot, error) {
+	var funcName = "datastore/mascot.go:GetMascots"
+	log.WithFields(log.Fields{
+		"includeRetired": includeRetired,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := selectQuery(c.MascotTable, mascotColumns, "")
+	var args []interface{}
+	if !includeRetired {
+		query += " WHERE " + c.IsActive + " = ?"
+		args = append(args, true)
+	}
+	query += " ORDER BY " + c.Id
+
+	rows, err := queryRows(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mascots := []types.Mascot{}
+	for rows.Next() {
+		var m types.Mascot
+		if err := rows.Scan(&m.Id, &m.Name, &m.Description, &m.Avatar, &m.GradientStart, &m.GradientEnd, &m.IsActive); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		mascots = append(mascots, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return mascots, nil
+}
+
+/*
+Purpose : Changes the name, description, avatar and colors of a mascot
+Input : the Mascot with its new values
+Outputs : error if any
+Remark : IsActive is left as it is, see RetireMascot
+*/
+func (s *DbStore) UpdateMascot(m types.Mascot) error {
+	var funcName = "datastore/mascot.go:UpdateMascot"
+	log.WithFields(log.Fields{
+		"mascotId": m.Id,
+		"name":     m.Name,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := updateQuery(c.MascotTable, []string{c.Name, c.Description, c.Avatar, c.GradientStart, c.GradientEnd}, c.Id)
+
+	_, err := execQuery(db, query, m.Name, m.Description, m.Avatar, m.GradientStart, m.GradientEnd, m.Id)
+	return err
+}
+
+/*
+Purpose : Stops a mascot from taking new posts and from being listed to users
+Input : mascotId
+Outputs : error if any
+Remark : The mascot and its queue are kept, PostQueue rows reference it
+*/
+func (s *DbStore) RetireMascot(mascotId int) error {
+	var funcName = "datastore/mascot.go:RetireMascot"
+	log.WithFields(log.Fields{
+		"mascotId": mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := updateQuery(c.MascotTable, []string{c.IsActive}, c.Id)
+
+	_, err := execQuery(db, query, false, mascotId)
+	return err
+}
+
+/*
+Purpose : Subscribes a user to a mascot
+Input : userId and mascotId
+Outputs : error if any
+Remark : Subscribing again keeps the original subscription
+*/
+func (s *DbStore) Subscribe(userId int, mascotId int) error {
+	var funcName = "datastore/mascot.go:Subscribe"
+	log.WithFields(log.Fields{
+		"userId":   userId,
+		"mascotId": mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s(%s, %s, %s)
+		VALUES(?,?,?)
+		ON DUPLICATE KEY
+		UPDATE %s = %s;`,
+		c.SubscriptionTable, c.UserId, c.MascotId, c.TimeOfCreation,
+		c.UserId, c.UserId)
+
+	_, err := execQuery(db, query, userId, mascotId, time.Now().UTC().UnixNano())
+	return err
+}
+
+func (s *DbStore) Unsubscribe(userId int, mascotId int) error {
+	var funcName = "datastore/mascot.go:Unsubscribe"
+	log.WithFields(log.Fields{
+		"userId":   userId,
+		"mascotId": mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ?",
+		c.SubscriptionTable, c.UserId, c.MascotId)
+
+	_, err := execQuery(db, query, userId, mascotId)
+	return err
+}
+
+/*
+Purpose : Lists the mascots a user follows
+Input : userId
+Outputs : the active subscribed mascots ordered by Id, and error if any
+Remark : Subscriptions to retired mascots are kept but not listed
+*/
+func (s *DbStore) GetSubscriptions(userId int) ([]types.Mascot, error) {
+	var funcName = "datastore/mascot.go:GetSubscriptions"
+	log.WithFields(log.Fields{
+		"userId": userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s JOIN %s ON %s.%s = %s.%s
+		WHERE %s.%s = ? AND %s = ?
+		ORDER BY %s.%s`,
+		strings.Join(mascotColumns, ", "),
+		c.MascotTable, c.SubscriptionTable, c.MascotTable, c.Id, c.SubscriptionTable, c.MascotId,
+		c.SubscriptionTable, c.UserId, c.IsActive,
+		c.MascotTable, c.Id)
+
+	rows, err := queryRows(query, userId, true)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mascots := []types.Mascot{}
+	for rows.Next() {
+		var m types.Mascot
+		if err := rows.Scan(&m.Id, &m.Name, &m.Description, &m.Avatar, &m.GradientStart, &m.GradientEnd, &m.IsActive); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		mascots = append(mascots, m)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return mascots, nil
+}
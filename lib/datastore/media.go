@@ -0,0 +1,157 @@
+// All the database requests related to uploaded media go here
+package datastore
+
+import (
+	"fmt"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+/*
+Purpose : Records an uploaded media
+Input : the media, its Id being the hash of its content
+Outputs : error if any
+Remark : The same content uploaded again changes nothing, the first upload is kept
+*/
+func (s *DbStore) AddMedia(m types.Media) error {
+	var funcName = "datastore/media.go:AddMedia"
+	log.WithFields(log.Fields{
+		"mediaId":     m.Id,
+		"contentType": m.ContentType,
+		"size":        m.Size,
+		"uploadedBy":  m.UploadedBy,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	m.TimeOfCreation = time.Now().UTC().UnixNano()
+	c := session.DB(config.Get().Mongo.DbName).C(c.MediaCollection)
+	if err := c.Insert(&m); err != nil && !mgo.IsDup(err) {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *DbStore) GetMedia(mediaId string) (*types.Media, error) {
+	var funcName = "datastore/media.go:GetMedia"
+	log.WithFields(log.Fields{
+		"mediaId": mediaId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	var result types.Media
+	c := session.DB(config.Get().Mongo.DbName).C(c.MediaCollection)
+	if err := c.FindId(mediaId).One(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Fields of posts holding urls of media, as named in mongo
+var postMediaFields = []string{"src", "dpsrc", "poster", "media"}
+
+/*
+Purpose : Tells if anything still refers to uploaded media
+Input : the id of the media
+Outputs : true when a post, in the trash or not, a revision of one, a product or an order has a url of the media
+Remark : Urls are matched on the id they contain, whatever the address they were served from
+*/
+func (s *DbStore) MediaInUse(mediaId string) (bool, error) {
+	var funcName = "datastore/media.go:MediaInUse"
+	log.WithFields(log.Fields{
+		"mediaId": mediaId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return false, err
+	}
+	defer session.Close()
+
+	// Ids are hex, nothing to escape
+	match := bson.RegEx{Pattern: mediaId}
+	anyOf := func(prefix string, fields ...string) bson.M {
+		var or []bson.M
+		for _, field := range fields {
+			or = append(or, bson.M{prefix + field: match})
+		}
+		return bson.M{"$or": or}
+	}
+	database := session.DB(config.Get().Mongo.DbName)
+	for _, check := range []struct {
+		collection string
+		filter     bson.M
+	}{
+		{c.Collection, anyOf("", postMediaFields...)},
+		{c.RevisionCollection, anyOf("post.", postMediaFields...)},
+		{c.ProductCollection, anyOf("", "image", "thumbnail")},
+	} {
+		n, err := database.C(check.collection).Find(check.filter).Limit(1).Count()
+		if err != nil {
+			lh.Mongo.ReadError(err)
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM %s
+		WHERE %s LIKE ?`,
+		c.OrderTable, c.ProductThumb)
+
+	var orders int
+	if err := scanRow(query, []interface{}{"%" + mediaId + "%"}, &orders); err != nil {
+		lh.Mysql.ScanError(err)
+		return false, err
+	}
+	return orders > 0, nil
+}
+
+func (s *DbStore) DeleteMedia(mediaId string) error {
+	var funcName = "datastore/media.go:DeleteMedia"
+	log.WithFields(log.Fields{
+		"mediaId": mediaId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.MediaCollection)
+	if err := c.RemoveId(mediaId); err != nil && err != mgo.ErrNotFound {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
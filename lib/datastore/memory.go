@@ -0,0 +1,2179 @@
+// In-memory implementation of Store
+// Behaviour follows DbStore as closely as possible, including the errors
+// returned (sql.ErrNoRows, mgo.ErrNotFound, "Invalid postId", ...) since
+// handlers look at them to decide the http status.
+package datastore
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type memUserRole struct {
+	UserId int
+	RoleId int
+}
+
+type memSubscription struct {
+	UserId         int
+	MascotId       int
+	TimeOfCreation int64
+}
+
+type memEngagement struct {
+	PostId         string
+	UserId         int
+	Kind           int
+	TimeOfCreation int64
+}
+
+type memFeedback struct {
+	Phone       string
+	Type        string
+	Description string
+}
+
+type MemStore struct {
+	mu sync.Mutex
+
+	users        []types.User
+	userRoles    []memUserRole
+	mascots      map[int]types.Mascot
+	subscribed   []memSubscription
+	postQueue    []types.PostLink
+	posts        []types.Post
+	revisions    []types.Revision
+	votes        []types.PollVote
+	engagement   []memEngagement
+	comments     []types.Comment
+	media        []types.Media
+	products     []types.Product
+	sales        []types.Sale
+	orders       []types.Order
+	addresses    []types.Address
+	transactions []types.Transaction
+	shipping     []types.Shipping
+	feedback     []memFeedback
+	manifest     []types.ManifestEntry
+	notified     []types.Notification
+	deliveries   []types.Delivery
+
+	// Last used auto increment ids per table
+	ids map[string]int
+}
+
+func NewMemStore() *MemStore {
+	m := &MemStore{}
+	m.reset()
+	return m
+}
+
+func (m *MemStore) reset() {
+	m.users = nil
+	m.userRoles = nil
+	m.mascots = map[int]types.Mascot{
+		c.DefaultMascotId: {Id: c.DefaultMascotId, Name: c.DefaultMascotName, Description: c.DefaultMascotDescription, IsActive: true},
+	}
+	m.subscribed = nil
+	m.postQueue = nil
+	m.posts = nil
+	m.revisions = nil
+	m.media = nil
+	m.products = nil
+	m.sales = nil
+	m.orders = nil
+	m.addresses = nil
+	m.transactions = nil
+	m.shipping = nil
+	m.feedback = nil
+	m.manifest = nil
+	m.notified = nil
+	m.deliveries = nil
+	m.ids = map[string]int{}
+}
+
+func (m *MemStore) nextId(table string) int {
+	m.ids[table]++
+	return m.ids[table]
+}
+
+// Truncate empties the mysql table or mongo collection with the given name.
+// Auto increment counters of mysql tables are reset as well.
+func (m *MemStore) Truncate(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch name {
+	case c.UsersTable:
+		m.users = nil
+	case c.UserRoleTable:
+		m.userRoles = nil
+	case c.MascotTable:
+		m.mascots = map[int]types.Mascot{}
+	case c.SubscriptionTable:
+		m.subscribed = nil
+	case c.PostQueueTable:
+		m.postQueue = nil
+	case c.SaleTable:
+		m.sales = nil
+	case c.OrderTable:
+		m.orders = nil
+	case c.ShippingTable:
+		m.shipping = nil
+	case c.FeedbackTable:
+		m.feedback = nil
+	case c.AddressTable:
+		m.addresses = nil
+	case c.TransactionTable:
+		m.transactions = nil
+	case c.UrlCacheTable:
+		m.manifest = nil
+	case c.PollVoteTable:
+		m.votes = nil
+	case c.EngagementTable:
+		m.engagement = nil
+	case c.CommentTable:
+		m.comments = nil
+	case c.NotificationTable:
+		m.notified = nil
+	case c.DeliveryTable:
+		m.deliveries = nil
+	case c.Collection:
+		m.posts = nil
+	case c.RevisionCollection:
+		m.revisions = nil
+	case c.ProductCollection:
+		m.products = nil
+	case c.MediaCollection:
+		m.media = nil
+	default:
+		return fmt.Errorf("Unknown table %q", name)
+	}
+	delete(m.ids, name)
+	return nil
+}
+
+// AddMascot adds or renames a mascot. Equivalent of inserting into the
+// Mascot table with ON DUPLICATE KEY UPDATE
+func (m *MemStore) AddMascot(id int, name, desc string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mascots[id] = types.Mascot{Id: id, Name: name, Description: desc, IsActive: true}
+}
+
+// Mascots
+
+func (m *MemStore) CreateMascot(mascot types.Mascot) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Like AUTO_INCREMENT, continue after the highest id in use
+	for id := range m.mascots {
+		if id > mascot.Id {
+			mascot.Id = id
+		}
+	}
+	mascot.Id++
+	mascot.IsActive = true
+	m.mascots[mascot.Id] = mascot
+	return mascot.Id, nil
+}
+
+func (m *MemStore) GetMascot(mascotId int) (*types.Mascot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mascot, ok := m.mascots[mascotId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &mascot, nil
+}
+
+func (m *MemStore) GetMascots(includeRetired bool) ([]types.Mascot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mascots := []types.Mascot{}
+	for _, mascot := range m.mascots {
+		if includeRetired || mascot.IsActive {
+			mascots = append(mascots, mascot)
+		}
+	}
+	sort.Slice(mascots, func(i, j int) bool { return mascots[i].Id < mascots[j].Id })
+	return mascots, nil
+}
+
+func (m *MemStore) UpdateMascot(mascot types.Mascot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.mascots[mascot.Id]
+	if !ok {
+		return nil
+	}
+	mascot.IsActive = old.IsActive
+	m.mascots[mascot.Id] = mascot
+	return nil
+}
+
+func (m *MemStore) RetireMascot(mascotId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mascot, ok := m.mascots[mascotId]; ok {
+		mascot.IsActive = false
+		m.mascots[mascotId] = mascot
+	}
+	return nil
+}
+
+func (m *MemStore) Subscribe(userId int, mascotId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mascots[mascotId]; !ok {
+		return fmt.Errorf("Cannot add or update a child row: no %s with %s %d", c.MascotTable, c.Id, mascotId)
+	}
+	for _, s := range m.subscribed {
+		if s.UserId == userId && s.MascotId == mascotId {
+			return nil
+		}
+	}
+	m.subscribed = append(m.subscribed, memSubscription{userId, mascotId, time.Now().UTC().UnixNano()})
+	return nil
+}
+
+func (m *MemStore) Unsubscribe(userId int, mascotId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.subscribed[:0]
+	for _, s := range m.subscribed {
+		if s.UserId != userId || s.MascotId != mascotId {
+			kept = append(kept, s)
+		}
+	}
+	m.subscribed = kept
+	return nil
+}
+
+func (m *MemStore) GetSubscriptions(userId int) ([]types.Mascot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mascots := []types.Mascot{}
+	for _, s := range m.subscribed {
+		if mascot, ok := m.mascots[s.MascotId]; s.UserId == userId && ok && mascot.IsActive {
+			mascots = append(mascots, mascot)
+		}
+	}
+	sort.Slice(mascots, func(i, j int) bool { return mascots[i].Id < mascots[j].Id })
+	return mascots, nil
+}
+
+func (m *MemStore) InitDb() error {
+	log.Info("Using in-memory datastore")
+	return nil
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func validObjectId(id string) bool {
+	d, err := hex.DecodeString(id)
+	return err == nil && len(d) == 12
+}
+
+// Users
+
+func (m *MemStore) findUser(match func(u *types.User) bool) *types.User {
+	for i := range m.users {
+		if match(&m.users[i]) {
+			return &m.users[i]
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) AddUser(newUser types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findUser(func(u *types.User) bool { return u.Phone.String == newUser.Phone.String }) != nil {
+		return fmt.Errorf("Duplicate entry '%s' for key '%s'", newUser.Phone.String, c.Phone)
+	}
+
+	// Same columns as the mysql insert, the rest stay NULL
+	u := types.User{
+		Id:             m.nextId(c.UsersTable),
+		Email:          newUser.Email,
+		Password:       newUser.Password,
+		Gender:         sql.NullString{String: newUser.Gender.String, Valid: true},
+		FirstName:      sql.NullString{String: newUser.FirstName.String, Valid: true},
+		LastName:       sql.NullString{String: newUser.LastName.String, Valid: true},
+		Phone:          sql.NullString{String: newUser.Phone.String, Valid: true},
+		TimeOfCreation: time.Now().UTC().UnixNano(),
+		Verified:       newUser.Verified,
+		Code:           newUser.Code,
+	}
+	m.users = append(m.users, u)
+	return nil
+}
+
+func (m *MemStore) UpdateUserDetails(user types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Id == user.Id }); u != nil {
+		u.FirstName = sql.NullString{String: user.FirstName.String, Valid: true}
+		u.LastName = sql.NullString{String: user.LastName.String, Valid: true}
+		u.Gender = sql.NullString{String: user.Gender.String, Valid: true}
+		u.Password = user.Password
+		u.Verified = user.Verified
+	}
+	return nil
+}
+
+func (m *MemStore) UpdateUserProfile(user types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Id == user.Id }); u != nil {
+		u.FirstName = sql.NullString{String: user.FirstName.String, Valid: true}
+		u.LastName = sql.NullString{String: user.LastName.String, Valid: true}
+		u.Gender = sql.NullString{String: user.Gender.String, Valid: true}
+	}
+	return nil
+}
+
+// Token is not part of the columns selected by DbStore, so it's left out
+func selectUser(u *types.User) *types.User {
+	if u == nil {
+		return nil
+	}
+	r := *u
+	r.Token = sql.NullString{}
+	return &r
+}
+
+func (m *MemStore) GetUserByPhone(phone string) (*types.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := selectUser(m.findUser(func(u *types.User) bool { return u.Phone.String == phone }))
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *MemStore) GetUserByEmail(email string) (*types.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u := selectUser(m.findUser(func(u *types.User) bool { return u.Email == email }))
+	if u == nil {
+		return nil, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *MemStore) GetRole(userId int) (*int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ur := range m.userRoles {
+		if ur.UserId == userId {
+			roleId := ur.RoleId
+			return &roleId, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func validRole(roleId int) bool {
+	return roleId == c.AdminRole || roleId == c.UserRole || roleId == c.WriterRole
+}
+
+func (m *MemStore) InsertRole(userId int, roleId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validRole(roleId) {
+		return fmt.Errorf("Cannot add or update a child row: no %s with %s %d", c.RolesTable, c.Id, roleId)
+	}
+	m.userRoles = append(m.userRoles, memUserRole{userId, roleId})
+	return nil
+}
+
+func (m *MemStore) UpdateRole(userId int, roleId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validRole(roleId) {
+		return fmt.Errorf("Cannot add or update a child row: no %s with %s %d", c.RolesTable, c.Id, roleId)
+	}
+	for i := range m.userRoles {
+		if m.userRoles[i].UserId == userId {
+			m.userRoles[i].RoleId = roleId
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) UpdatePasswordResetToken(phone, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Phone.String == phone }); u != nil {
+		u.ResetPasswordToken = sql.NullString{String: token, Valid: true}
+	}
+	return nil
+}
+
+func (m *MemStore) ResetPassword(phone, newPassword string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Phone.String == phone }); u != nil {
+		u.Password = newPassword
+		u.ResetPasswordToken = sql.NullString{String: "", Valid: true}
+	}
+	return nil
+}
+
+func (m *MemStore) DeleteUserByEmail(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := m.users[:0]
+	for _, u := range m.users {
+		if u.Email != email {
+			users = append(users, u)
+		}
+	}
+	m.users = users
+	return nil
+}
+
+func (m *MemStore) UpdateToken(userId int, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Id == userId }); u != nil {
+		u.Token = sql.NullString{String: token, Valid: true}
+	}
+	return nil
+}
+
+// Posts and mascot queues
+
+// Returns the live links of a mascot queue sorted by time of creation,
+// newest first. Only PostId and TimeOfCreation are filled, same as the
+// mysql select.
+func (m *MemStore) mascotQueue(mascotId int) []types.PostLink {
+	now := time.Now().UTC().UnixNano()
+	var q []types.PostLink
+	for _, pl := range m.postQueue {
+		if pl.MascotId == mascotId && queuedLink(pl, now) {
+			q = append(q, types.PostLink{TimeOfCreation: pl.TimeOfCreation, PostId: pl.PostId})
+		}
+	}
+	// Newest first, same as mysql's ORDER BY TimeOfCreation DESC, PostId DESC
+	sort.Slice(q, func(i, j int) bool {
+		return newerLink(q[i], q[j])
+	})
+	return q
+}
+
+// Returns the live links of the mascots merged, newest first. Each post is
+// listed once, at the time of its newest link, same as the mysql GROUP BY
+func (m *MemStore) mergedQueue(mascotIds []int) []types.PostLink {
+	wanted := make(map[int]bool, len(mascotIds))
+	for _, id := range mascotIds {
+		wanted[id] = true
+	}
+	now := time.Now().UTC().UnixNano()
+	newest := make(map[string]int64)
+	for _, pl := range m.postQueue {
+		if !wanted[pl.MascotId] || !queuedLink(pl, now) {
+			continue
+		}
+		if t, ok := newest[pl.PostId]; !ok || pl.TimeOfCreation > t {
+			newest[pl.PostId] = pl.TimeOfCreation
+		}
+	}
+
+	q := make([]types.PostLink, 0, len(newest))
+	for postId, t := range newest {
+		q = append(q, types.PostLink{TimeOfCreation: t, PostId: postId})
+	}
+	sort.Slice(q, func(i, j int) bool {
+		return newerLink(q[i], q[j])
+	})
+	return q
+}
+
+// linksBefore returns up to n links of q older than cursor
+func linksBefore(q []types.PostLink, cursor types.PostLink, n int) []types.PostLink {
+	var retItem []types.PostLink
+	for _, pl := range q {
+		if len(retItem) == n {
+			break
+		}
+		if newerLink(cursor, pl) {
+			retItem = append(retItem, pl)
+		}
+	}
+	return retItem
+}
+
+// linksAfter returns the n links of q newer than and closest to cursor,
+// newest first
+func linksAfter(q []types.PostLink, cursor types.PostLink, n int) []types.PostLink {
+	var after []types.PostLink
+	for i := len(q) - 1; i >= 0 && len(after) < n; i-- {
+		if newerLink(q[i], cursor) {
+			after = append(after, q[i])
+		}
+	}
+
+	var retItem []types.PostLink
+	for i := len(after) - 1; i >= 0; i-- {
+		retItem = append(retItem, after[i])
+	}
+	return retItem
+}
+
+// liveLink tells if the link is published and not expired at now
+func liveLink(pl types.PostLink, now int64) bool {
+	return pl.TimeOfCreation <= now && (pl.ExpireAt == 0 || pl.ExpireAt > now)
+}
+
+// queuedLink tells if the link is served in queue order at now, pinned
+// links are served apart
+func queuedLink(pl types.PostLink, now int64) bool {
+	return liveLink(pl, now) && pl.PinnedAt == 0
+}
+
+func newerLink(a, b types.PostLink) bool {
+	if a.TimeOfCreation != b.TimeOfCreation {
+		return a.TimeOfCreation > b.TimeOfCreation
+	}
+	return a.PostId > b.PostId
+}
+
+func (m *MemStore) GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var retItem []types.PostLink
+	for _, pl := range m.mascotQueue(mascotId) {
+		if len(retItem) == numOfPosts {
+			break
+		}
+		if pl.TimeOfCreation > int64(c.DefaultTimestamp) {
+			retItem = append(retItem, pl)
+		}
+	}
+	return retItem, nil
+}
+
+func (m *MemStore) GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Oldest numOfPosts after the timestamp, returned newest first
+	q := m.mascotQueue(mascotId)
+	var after []types.PostLink
+	for i := len(q) - 1; i >= 0 && len(after) < numOfPosts; i-- {
+		if q[i].TimeOfCreation > timestamp {
+			after = append(after, q[i])
+		}
+	}
+
+	var retItem []types.PostLink
+	for i := len(after) - 1; i >= 0; i-- {
+		retItem = append(retItem, after[i])
+	}
+	return retItem, nil
+}
+
+func (m *MemStore) GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var retItem []types.PostLink
+	for _, pl := range m.mascotQueue(mascotId) {
+		if len(retItem) == numOfPosts {
+			break
+		}
+		if pl.TimeOfCreation < timestamp {
+			retItem = append(retItem, pl)
+		}
+	}
+	return retItem, nil
+}
+
+func (m *MemStore) GetPostsBeforeCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cursor := types.PostLink{TimeOfCreation: timestamp, PostId: postId}
+	return linksBefore(m.mascotQueue(mascotId), cursor, numOfPosts), nil
+}
+
+func (m *MemStore) GetPostsAfterCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cursor := types.PostLink{TimeOfCreation: timestamp, PostId: postId}
+	return linksAfter(m.mascotQueue(mascotId), cursor, numOfPosts), nil
+}
+
+func (m *MemStore) GetMergedTopPosts(numOfPosts int, mascotIds []int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var retItem []types.PostLink
+	for _, pl := range m.mergedQueue(mascotIds) {
+		if len(retItem) == numOfPosts {
+			break
+		}
+		if pl.TimeOfCreation > int64(c.DefaultTimestamp) {
+			retItem = append(retItem, pl)
+		}
+	}
+	return retItem, nil
+}
+
+func (m *MemStore) GetMergedPostsBeforeCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cursor := types.PostLink{TimeOfCreation: timestamp, PostId: postId}
+	return linksBefore(m.mergedQueue(mascotIds), cursor, numOfPosts), nil
+}
+
+func (m *MemStore) GetMergedPostsAfterCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cursor := types.PostLink{TimeOfCreation: timestamp, PostId: postId}
+	return linksAfter(m.mergedQueue(mascotIds), cursor, numOfPosts), nil
+}
+
+func (m *MemStore) PostLink(mascotId int, postId string, publishAt int64, expireAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.mascots[mascotId]; !ok {
+		return fmt.Errorf("Cannot add or update a child row: no %s with %s %d", c.MascotTable, c.Id, mascotId)
+	}
+	for _, pl := range m.postQueue {
+		if pl.MascotId == mascotId && pl.PostId == postId {
+			return fmt.Errorf("Duplicate entry '%d-%s' for key 'PRIMARY'", mascotId, postId)
+		}
+	}
+
+	m.postQueue = append(m.postQueue, types.PostLink{
+		TimeOfCreation: publishAt,
+		PostId:         postId,
+		MascotId:       mascotId,
+		ExpireAt:       expireAt,
+	})
+	return nil
+}
+
+// findPostLink returns the index of the link in postQueue or -1
+func (m *MemStore) findPostLink(mascotId int, postId string) int {
+	for i, pl := range m.postQueue {
+		if pl.MascotId == mascotId && pl.PostId == postId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemStore) UnlinkPost(mascotId int, postId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPostLink(mascotId, postId)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	m.postQueue = append(m.postQueue[:i], m.postQueue[i+1:]...)
+	return nil
+}
+
+func (m *MemStore) MovePostLink(mascotId int, postId string, timestamp int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPostLink(mascotId, postId)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	m.postQueue[i].TimeOfCreation = timestamp
+	return nil
+}
+
+func (m *MemStore) PinPostLink(mascotId int, postId string, pinnedAt int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPostLink(mascotId, postId)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	m.postQueue[i].PinnedAt = pinnedAt
+	return nil
+}
+
+func (m *MemStore) GetPinnedPostLinks(mascotIds []int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[int]bool, len(mascotIds))
+	for _, id := range mascotIds {
+		wanted[id] = true
+	}
+	now := time.Now().UTC().UnixNano()
+	var links []types.PostLink
+	for _, pl := range m.postQueue {
+		if wanted[pl.MascotId] && pl.PinnedAt > 0 && liveLink(pl, now) {
+			links = append(links, pl)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].PinnedAt != links[j].PinnedAt {
+			return links[i].PinnedAt > links[j].PinnedAt
+		}
+		return links[i].PostId > links[j].PostId
+	})
+
+	// A post pinned for several mascots is kept at its last pinning
+	seen := make(map[string]bool)
+	pinned := []types.PostLink{}
+	for _, l := range links {
+		if !seen[l.PostId] {
+			seen[l.PostId] = true
+			pinned = append(pinned, l)
+		}
+	}
+	return pinned, nil
+}
+
+func (m *MemStore) GetScheduledPostLinks(mascotId int, now int64) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var postLinks []types.PostLink
+	for _, pl := range m.postQueue {
+		if pl.MascotId == mascotId && (pl.TimeOfCreation > now || pl.ExpireAt > now) {
+			postLinks = append(postLinks, pl)
+		}
+	}
+	sort.Slice(postLinks, func(i, j int) bool {
+		return newerLink(postLinks[j], postLinks[i])
+	})
+	return postLinks, nil
+}
+
+func (m *MemStore) GetPostLinks(mascotId int) ([]types.PostLink, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var postLinks []types.PostLink
+	for _, pl := range m.postQueue {
+		if pl.MascotId == mascotId {
+			postLinks = append(postLinks, pl)
+		}
+	}
+	return postLinks, nil
+}
+
+// Returns the post as it would come back from mongo
+func storedPost(p types.Post) types.Post {
+	p.TimeOfLink = 0
+	p.ChildPostsJson = ""
+	p.ChildPosts = append([]string{}, p.ChildPosts...)
+	if p.Media != nil {
+		p.Media = append([]string{}, p.Media...)
+	}
+	if p.Options != nil {
+		p.Options = append([]string{}, p.Options...)
+	}
+	p.Price, p.StockLeft, p.TimeToStart = 0, 0, 0
+	p.Votes, p.Voted, p.MyVote = nil, false, 0
+	p.Likes, p.Saves, p.Views, p.Liked, p.Saved = 0, 0, 0, false, false
+	p.Comments = 0
+	return p
+}
+
+func (m *MemStore) AddPost(p types.Post) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p.Id = bson.NewObjectId()
+	p.TimeOfCreation = time.Now().UTC().UnixNano()
+	if p.Status == "" {
+		p.Status = c.StatusPublished
+	}
+	m.posts = append(m.posts, storedPost(p))
+
+	return p.Id.Hex(), nil
+}
+
+func (m *MemStore) findPost(postId string) int {
+	for i := range m.posts {
+		if m.posts[i].Id.Hex() == postId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *MemStore) GetPostMetaData(postId string) (*types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validObjectId(postId) {
+		return nil, errors.New("Invalid postId")
+	}
+
+	i := m.findPost(postId)
+	if i == -1 {
+		return nil, mgo.ErrNotFound
+	}
+	p := storedPost(m.posts[i])
+	return &p, nil
+}
+
+func (m *MemStore) GetPostsByIds(postIds []string) ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, postId := range postIds {
+		wanted[postId] = true
+	}
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		if wanted[p.Id.Hex()] {
+			result = append(result, storedPost(p))
+		}
+	}
+	return result, nil
+}
+
+func (m *MemStore) GetPosts() (*[]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		if p.Status != c.StatusDeleted {
+			result = append(result, storedPost(p))
+		}
+	}
+	return &result, nil
+}
+
+func (m *MemStore) UpdatePost(p types.Post) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findPost(p.Id.Hex())
+	if i == -1 {
+		return mgo.ErrNotFound
+	}
+	// Only the content changes, as with the $set in mongo
+	old := m.posts[i]
+	old.CardType, old.Src, old.DpSrc = p.CardType, p.Src, p.DpSrc
+	old.Title, old.Description, old.Url, old.ButtonText = p.Title, p.Description, p.Url, p.ButtonText
+	old.ChildPosts = p.ChildPosts
+	old.GradientStart, old.GradientEnd, old.Icon = p.GradientStart, p.GradientEnd, p.Icon
+	old.Poster, old.Duration, old.Media = p.Poster, p.Duration, p.Media
+	old.ProductId, old.SaleId = p.ProductId, p.SaleId
+	old.Options, old.ClosesAt = p.Options, p.ClosesAt
+	old.EditedBy = p.EditedBy
+	old.TimeOfEdit = time.Now().UTC().UnixNano()
+	m.posts[i] = storedPost(old)
+	return nil
+}
+
+func (m *MemStore) GetParentPosts(postId string) ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		for _, childId := range p.ChildPosts {
+			if childId == postId {
+				result = append(result, storedPost(p))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MemStore) DeletePost(postId string, deletedBy int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validObjectId(postId) {
+		return errors.New("Invalid postId")
+	}
+
+	i := m.findPost(postId)
+	if i == -1 || m.posts[i].Status == c.StatusDeleted {
+		return mgo.ErrNotFound
+	}
+	m.posts[i].DeletedStatus = m.posts[i].Status
+	m.posts[i].Status = c.StatusDeleted
+	m.posts[i].DeletedBy = deletedBy
+	m.posts[i].TimeOfDeletion = time.Now().UTC().UnixNano()
+	return nil
+}
+
+func (m *MemStore) RestorePost(postId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validObjectId(postId) {
+		return errors.New("Invalid postId")
+	}
+
+	i := m.findPost(postId)
+	if i == -1 || m.posts[i].Status != c.StatusDeleted {
+		return mgo.ErrNotFound
+	}
+	m.posts[i].Status = m.posts[i].DeletedStatus
+	if m.posts[i].Status == "" {
+		m.posts[i].Status = c.StatusPublished
+	}
+	m.posts[i].DeletedStatus = ""
+	m.posts[i].DeletedBy = 0
+	m.posts[i].TimeOfDeletion = 0
+	return nil
+}
+
+func (m *MemStore) GetDeletedPosts() ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		if p.Status == c.StatusDeleted {
+			result = append(result, storedPost(p))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].TimeOfDeletion > result[j].TimeOfDeletion
+	})
+	return result, nil
+}
+
+func (m *MemStore) PurgePosts(deletedBefore int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := make(map[string]bool)
+	kept := m.posts[:0]
+	for _, p := range m.posts {
+		if p.Status == c.StatusDeleted && p.TimeOfDeletion < deletedBefore {
+			purged[p.Id.Hex()] = true
+			continue
+		}
+		kept = append(kept, p)
+	}
+	m.posts = kept
+
+	postIds := []string{}
+	for postId := range purged {
+		postIds = append(postIds, postId)
+	}
+	if len(postIds) == 0 {
+		return postIds, nil
+	}
+
+	queue := m.postQueue[:0]
+	for _, pl := range m.postQueue {
+		if !purged[pl.PostId] {
+			queue = append(queue, pl)
+		}
+	}
+	m.postQueue = queue
+
+	revisions := m.revisions[:0]
+	for _, r := range m.revisions {
+		if !purged[r.PostId] {
+			revisions = append(revisions, r)
+		}
+	}
+	m.revisions = revisions
+
+	votes := m.votes[:0]
+	for _, v := range m.votes {
+		if !purged[v.PostId] {
+			votes = append(votes, v)
+		}
+	}
+	m.votes = votes
+
+	engagement := m.engagement[:0]
+	for _, e := range m.engagement {
+		if !purged[e.PostId] {
+			engagement = append(engagement, e)
+		}
+	}
+	m.engagement = engagement
+
+	comments := m.comments[:0]
+	for _, cm := range m.comments {
+		if !purged[cm.PostId] {
+			comments = append(comments, cm)
+		}
+	}
+	m.comments = comments
+
+	for i := range m.posts {
+		children := m.posts[i].ChildPosts[:0]
+		for _, childId := range m.posts[i].ChildPosts {
+			if !purged[childId] {
+				children = append(children, childId)
+			}
+		}
+		m.posts[i].ChildPosts = children
+	}
+	return postIds, nil
+}
+
+func (m *MemStore) SubmitPost(postId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validObjectId(postId) {
+		return errors.New("Invalid postId")
+	}
+
+	i := m.findPost(postId)
+	if i == -1 || (m.posts[i].Status != c.StatusDraft && m.posts[i].Status != c.StatusRejected) {
+		return mgo.ErrNotFound
+	}
+	m.posts[i].Status = c.StatusSubmitted
+	m.posts[i].TimeOfSubmission = time.Now().UTC().UnixNano()
+	return nil
+}
+
+func (m *MemStore) ReviewPost(postId string, status string, reviewedBy int, comment string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !validObjectId(postId) {
+		return errors.New("Invalid postId")
+	}
+
+	i := m.findPost(postId)
+	if i == -1 || m.posts[i].Status != c.StatusSubmitted {
+		return mgo.ErrNotFound
+	}
+	m.posts[i].Status = status
+	m.posts[i].ReviewedBy = reviewedBy
+	m.posts[i].TimeOfReview = time.Now().UTC().UnixNano()
+	m.posts[i].ReviewComment = comment
+	return nil
+}
+
+func (m *MemStore) GetSubmittedPosts() ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		if p.Status == c.StatusSubmitted {
+			result = append(result, storedPost(p))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].TimeOfSubmission < result[j].TimeOfSubmission
+	})
+	return result, nil
+}
+
+func (m *MemStore) GetPostsCreatedBy(userId int) ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Post{}
+	for _, p := range m.posts {
+		if p.CreatedBy == userId && p.Status != c.StatusDeleted {
+			result = append(result, storedPost(p))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].TimeOfCreation > result[j].TimeOfCreation
+	})
+	return result, nil
+}
+
+// Revisions
+
+func (m *MemStore) AddRevision(r types.Revision) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r.Number = 1
+	for _, old := range m.revisions {
+		if old.PostId == r.PostId && old.Number >= r.Number {
+			r.Number = old.Number + 1
+		}
+	}
+	r.Id = bson.NewObjectId()
+	r.TimeOfCreation = time.Now().UTC().UnixNano()
+	r.Post = storedPost(r.Post)
+	m.revisions = append(m.revisions, r)
+	return r.Number, nil
+}
+
+func (m *MemStore) GetRevisions(postId string) ([]types.Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Appended in order of their numbers
+	result := []types.Revision{}
+	for _, r := range m.revisions {
+		if r.PostId == postId {
+			r.Post = storedPost(r.Post)
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemStore) GetRevision(postId string, number int) (*types.Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.revisions {
+		if r.PostId == postId && r.Number == number {
+			r.Post = storedPost(r.Post)
+			return &r, nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+// Polls
+
+func (m *MemStore) AddVote(postId string, userId int, option int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, v := range m.votes {
+		if v.PostId == postId && v.UserId == userId {
+			return ErrAlreadyVoted
+		}
+	}
+	m.votes = append(m.votes, types.PollVote{
+		PostId:         postId,
+		UserId:         userId,
+		Option:         option,
+		TimeOfCreation: time.Now().UTC().UnixNano(),
+	})
+	return nil
+}
+
+func (m *MemStore) GetPollTallies(postIds []string, userId int) (map[string]types.PollTally, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(postIds))
+	for _, id := range postIds {
+		wanted[id] = true
+	}
+	tallies := make(map[string]types.PollTally)
+	for _, v := range m.votes {
+		if !wanted[v.PostId] {
+			continue
+		}
+		t, ok := tallies[v.PostId]
+		if !ok {
+			t = types.PollTally{Counts: make(map[int]int), Mine: -1}
+		}
+		t.Counts[v.Option]++
+		if v.UserId == userId {
+			t.Mine = v.Option
+		}
+		tallies[v.PostId] = t
+	}
+	return tallies, nil
+}
+
+func (m *MemStore) GetPollVotes(postId string) ([]types.PollVote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Appended in time order
+	votes := []types.PollVote{}
+	for _, v := range m.votes {
+		if v.PostId == postId {
+			votes = append(votes, v)
+		}
+	}
+	return votes, nil
+}
+
+// Engagement
+
+// addEngagement must be called with the lock held
+func (m *MemStore) addEngagement(postId string, userId int, kind int, now int64) {
+	for _, e := range m.engagement {
+		if e.PostId == postId && e.UserId == userId && e.Kind == kind {
+			return
+		}
+	}
+	m.engagement = append(m.engagement, memEngagement{postId, userId, kind, now})
+}
+
+func (m *MemStore) AddEngagement(postId string, userId int, kind int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addEngagement(postId, userId, kind, time.Now().UTC().UnixNano())
+	return nil
+}
+
+func (m *MemStore) RemoveEngagement(postId string, userId int, kind int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.engagement[:0]
+	for _, e := range m.engagement {
+		if e.PostId != postId || e.UserId != userId || e.Kind != kind {
+			kept = append(kept, e)
+		}
+	}
+	m.engagement = kept
+	return nil
+}
+
+func (m *MemStore) AddViews(userId int, postIds []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC().UnixNano()
+	for _, postId := range postIds {
+		m.addEngagement(postId, userId, c.EngagementView, now)
+	}
+	return nil
+}
+
+func (m *MemStore) GetEngagement(postIds []string, userId int) (map[string]types.Engagement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(postIds))
+	for _, id := range postIds {
+		wanted[id] = true
+	}
+	result := make(map[string]types.Engagement)
+	for _, e := range m.engagement {
+		if !wanted[e.PostId] {
+			continue
+		}
+		r := result[e.PostId]
+		addEngagement(&r, e.Kind, 1, e.UserId == userId)
+		result[e.PostId] = r
+	}
+	return result, nil
+}
+
+func (m *MemStore) GetSavedPostIds(userId int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Appended in time order, last saved first is the reverse
+	postIds := []string{}
+	for i := len(m.engagement) - 1; i >= 0; i-- {
+		e := m.engagement[i]
+		if e.UserId == userId && e.Kind == c.EngagementSave {
+			postIds = append(postIds, e.PostId)
+		}
+	}
+	return postIds, nil
+}
+
+// Comments
+
+func (m *MemStore) findComment(commentId int) int {
+	for i := range m.comments {
+		if m.comments[i].Id == commentId {
+			return i
+		}
+	}
+	return -1
+}
+
+// replies must be called with the lock held
+func (m *MemStore) replies(commentId int) int {
+	n := 0
+	for _, cm := range m.comments {
+		if cm.ParentId == commentId && cm.Status == c.CommentVisible {
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemStore) AddComment(cm types.Comment) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cm.Id = m.nextId(c.CommentTable)
+	cm.TimeOfCreation = time.Now().UTC().UnixNano()
+	cm.ModeratedBy, cm.TimeOfModeration, cm.Replies = 0, 0, 0
+	m.comments = append(m.comments, cm)
+	return cm.Id, nil
+}
+
+func (m *MemStore) GetComment(commentId int) (*types.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findComment(commentId)
+	if i == -1 {
+		return nil, sql.ErrNoRows
+	}
+	cm := m.comments[i]
+	return &cm, nil
+}
+
+func (m *MemStore) GetComments(postId string, parentId int, afterId int, n int) ([]types.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Appended in Id order
+	result := []types.Comment{}
+	for _, cm := range m.comments {
+		if len(result) == n {
+			break
+		}
+		if cm.PostId == postId && cm.ParentId == parentId && cm.Status == c.CommentVisible && cm.Id > afterId {
+			cm.Replies = m.replies(cm.Id)
+			result = append(result, cm)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemStore) GetHeldComments() ([]types.Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []types.Comment{}
+	for _, cm := range m.comments {
+		if cm.Status == c.CommentHeld {
+			result = append(result, cm)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemStore) ModerateComment(commentId int, status string, moderatedBy int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.findComment(commentId)
+	if i == -1 {
+		return sql.ErrNoRows
+	}
+	m.comments[i].Status = status
+	m.comments[i].ModeratedBy = moderatedBy
+	m.comments[i].TimeOfModeration = time.Now().UTC().UnixNano()
+	return nil
+}
+
+func (m *MemStore) DeleteComment(commentId int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.comments[:0]
+	for _, cm := range m.comments {
+		if cm.Id != commentId && cm.ParentId != commentId {
+			kept = append(kept, cm)
+		}
+	}
+	m.comments = kept
+	return nil
+}
+
+func (m *MemStore) GetCommentCounts(postIds []string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(postIds))
+	for _, id := range postIds {
+		wanted[id] = true
+	}
+	counts := make(map[string]int)
+	for _, cm := range m.comments {
+		if wanted[cm.PostId] && cm.Status == c.CommentVisible {
+			counts[cm.PostId]++
+		}
+	}
+	return counts, nil
+}
+
+// Search
+
+// searchHit is a post or product matching a search, at index i of its
+// list in MemStore
+type searchHit struct {
+	i     int
+	id    bson.ObjectId
+	score int
+}
+
+// rankHits orders hits best first, newest first among equals as mongo
+// does, and keeps those of the page
+func rankHits(hits []searchHit, skip int, limit int) []searchHit {
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].score != hits[b].score {
+			return hits[a].score > hits[b].score
+		}
+		return hits[a].id.Hex() > hits[b].id.Hex()
+	})
+	if skip >= len(hits) {
+		return nil
+	}
+	hits = hits[skip:]
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func (m *MemStore) SearchPosts(query string, cardTypes []int, skip int, limit int) ([]types.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := searchTerms(query)
+	var hits []searchHit
+	for i, p := range m.posts {
+		if p.Status != "" && p.Status != c.StatusPublished {
+			continue
+		}
+		if len(cardTypes) > 0 && !containsInt(cardTypes, p.CardType) {
+			continue
+		}
+		score := searchScore(terms, postSearchWeights, map[string]string{
+			"title":       p.Title,
+			"description": p.Description,
+		})
+		if score > 0 {
+			hits = append(hits, searchHit{i, p.Id, score})
+		}
+	}
+
+	result := []types.Post{}
+	for _, hit := range rankHits(hits, skip, limit) {
+		result = append(result, storedPost(m.posts[hit.i]))
+	}
+	return result, nil
+}
+
+func (m *MemStore) SearchProducts(query string, brand string, skip int, limit int) ([]types.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	terms := searchTerms(query)
+	var hits []searchHit
+	for i, p := range m.products {
+		if brand != "" && p.Brand != brand {
+			continue
+		}
+		score := searchScore(terms, productSearchWeights, map[string]string{
+			"title":       p.Title,
+			"brand":       p.Brand,
+			"summary":     p.Summary,
+			"description": p.Description,
+		})
+		if score > 0 {
+			hits = append(hits, searchHit{i, p.Id, score})
+		}
+	}
+
+	result := []types.Product{}
+	for _, hit := range rankHits(hits, skip, limit) {
+		result = append(result, m.products[hit.i])
+	}
+	return result, nil
+}
+
+// Media
+
+func (m *MemStore) AddMedia(md types.Media) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.media {
+		if existing.Id == md.Id {
+			return nil
+		}
+	}
+	md.TimeOfCreation = time.Now().UTC().UnixNano()
+	md.Url, md.ThumbUrl = "", ""
+	m.media = append(m.media, md)
+	return nil
+}
+
+func (m *MemStore) GetMedia(mediaId string) (*types.Media, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, md := range m.media {
+		if md.Id == mediaId {
+			return &md, nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (m *MemStore) MediaInUse(mediaId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	postUses := func(p types.Post) bool {
+		for _, u := range append([]string{p.Src, p.DpSrc, p.Poster}, p.Media...) {
+			if strings.Contains(u, mediaId) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range m.posts {
+		if postUses(p) {
+			return true, nil
+		}
+	}
+	for _, r := range m.revisions {
+		if postUses(r.Post) {
+			return true, nil
+		}
+	}
+	for _, p := range m.products {
+		if strings.Contains(p.Image, mediaId) || strings.Contains(p.ThumbNail, mediaId) {
+			return true, nil
+		}
+	}
+	for _, o := range m.orders {
+		if strings.Contains(o.ProductThumb, mediaId) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MemStore) DeleteMedia(mediaId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, md := range m.media {
+		if md.Id == mediaId {
+			m.media = append(m.media[:i], m.media[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Products
+
+func (m *MemStore) findProduct(productId string) (*types.Product, error) {
+	if !validObjectId(productId) {
+		return nil, errors.New("Invalid productId")
+	}
+	for i := range m.products {
+		if m.products[i].Id.Hex() == productId {
+			return &m.products[i], nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (m *MemStore) AddProduct(newProduct types.Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if newProduct.Id == "" {
+		newProduct.Id = bson.NewObjectId()
+	}
+	if _, err := m.findProduct(newProduct.Id.Hex()); err == nil {
+		return fmt.Errorf("E11000 duplicate key error _id: %s", newProduct.Id.Hex())
+	}
+	newProduct.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.products = append(m.products, newProduct)
+	return nil
+}
+
+func (m *MemStore) GetProduct(productId string) (*types.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.findProduct(productId)
+	if err != nil {
+		return nil, err
+	}
+	r := *p
+	return &r, nil
+}
+
+func (m *MemStore) DeleteProduct(productId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findProduct(productId); err != nil {
+		return err
+	}
+	for i := range m.products {
+		if m.products[i].Id.Hex() == productId {
+			m.products = append(m.products[:i], m.products[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) GetProductBySku(sku string) (*types.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.products {
+		if p.Sku == sku {
+			return &p, nil
+		}
+	}
+	return nil, mgo.ErrNotFound
+}
+
+func (m *MemStore) IsProductInStock(productId string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.findProduct(productId)
+	if err != nil {
+		return false, err
+	}
+	return p.Quantity > 0, nil
+}
+
+func (m *MemStore) IncrementStock(productId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.findProduct(productId)
+	if err != nil {
+		return err
+	}
+	p.Quantity++
+	return nil
+}
+
+func (m *MemStore) DecrementStock(productId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.findProduct(productId)
+	if err != nil {
+		return err
+	}
+	if p.Quantity < 1 {
+		return errors.New("Cannot Decrement Out of stock product")
+	}
+	p.Quantity--
+	return nil
+}
+
+// Sales
+
+func (m *MemStore) findSale(saleId int) *types.Sale {
+	for i := range m.sales {
+		if m.sales[i].Id == saleId {
+			return &m.sales[i]
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) AddSale(newSale types.Sale) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newSale.Id = m.nextId(c.SaleTable)
+	newSale.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.sales = append(m.sales, newSale)
+	return newSale.Id, nil
+}
+
+func (m *MemStore) GetSale(sId int) (*types.Sale, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.findSale(sId)
+	if s == nil {
+		return nil, sql.ErrNoRows
+	}
+	r := *s
+	r.TimeOfCreation = 0
+	return &r, nil
+}
+
+func (m *MemStore) GetSales() (*types.SalesList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sales types.SalesList
+	for _, s := range m.sales {
+		// Id and TimeOfCreation are not part of the listing
+		s.Id = 0
+		s.TimeOfCreation = 0
+		sales.Data = append(sales.Data, s)
+	}
+	return &sales, nil
+}
+
+func (m *MemStore) UpdateSaleStock(saleId int, value int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.findSale(saleId)
+	if s == nil {
+		return sql.ErrNoRows
+	}
+	if s.StockUnits < 1 {
+		return errors.New("Product Out Of Stock")
+	}
+	s.StockUnits += value
+	return nil
+}
+
+func (m *MemStore) GetStatus(saleId int) (*types.StatusResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.findSale(saleId)
+	if s == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	var status types.StatusResponse
+	status.StockLeft = s.StockUnits
+	status.TimeToStart = time.Unix(0, s.SaleStartTime).Sub(time.Now()).Nanoseconds()
+	return &status, nil
+}
+
+// Orders
+
+func (m *MemStore) CreateOrder(newOrder types.Order) (int, error) {
+	product, err := m.GetProduct(newOrder.ProductId)
+	if err != nil {
+		log.Error("Could not fetch Product details", err)
+		return -1, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newOrder.Id = m.nextId(c.OrderTable)
+	newOrder.ProductTitle = product.Title
+	newOrder.ProductThumb = product.ThumbNail
+	newOrder.TransId = c.UninitiatedId
+	newOrder.TransStatus = c.Uninitiated
+	newOrder.ShippingStatus = c.Uninitiated
+	newOrder.TrackingId = c.Uninitiated
+	newOrder.ShippingId = c.UninitiatedId
+	newOrder.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.orders = append(m.orders, newOrder)
+
+	return newOrder.Id, nil
+}
+
+func (m *MemStore) GetOrder(oId int) (*types.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, o := range m.orders {
+		if o.Id == oId {
+			return &o, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemStore) GetUserOrders(userId int) (*types.OrdersList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var orders types.OrdersList
+	for _, o := range m.orders {
+		if o.UserId == userId {
+			orders.Data = append(orders.Data, o)
+		}
+	}
+	return &orders, nil
+}
+
+// Addresses
+
+func (m *MemStore) AddAddress(address types.Address) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	address.Id = m.nextId(c.AddressTable)
+	address.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.addresses = append(m.addresses, address)
+	return address.Id, nil
+}
+
+func (m *MemStore) GetAddress(aId int) (*types.Address, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, a := range m.addresses {
+		if a.Id == aId {
+			a.TimeOfCreation = 0
+			return &a, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemStore) GetUserAddresses(userId int) (*types.AddressList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var addresses types.AddressList
+	for _, a := range m.addresses {
+		if a.UserId == userId {
+			addresses.Data = append(addresses.Data, a)
+		}
+	}
+	return &addresses, nil
+}
+
+func (m *MemStore) EditAddress(addressId int, newAddress types.Address) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.addresses {
+		a := &m.addresses[i]
+		if a.Id == addressId {
+			a.Address = newAddress.Address
+			a.AddressType = newAddress.AddressType
+			a.City = newAddress.City
+			a.State = newAddress.State
+			a.PostalCode = newAddress.PostalCode
+			a.Phone = newAddress.Phone
+			a.TimeOfCreation = time.Now().UTC().UnixNano()
+		}
+	}
+	return nil
+}
+
+// Transactions
+
+func (m *MemStore) InitiateTransaction(trans types.Transaction, saleId int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s := m.findSale(saleId); s != nil {
+		s.StockUnits--
+	}
+	trans.Id = m.nextId(c.TransactionTable)
+	trans.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.transactions = append(m.transactions, trans)
+	return trans.Id, nil
+}
+
+func (m *MemStore) UpdateSuccessTransaction(trans types.Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.transactions {
+		if m.transactions[i].Id == trans.Id {
+			orderId := m.transactions[i].OrderId
+			m.transactions[i] = trans
+			m.transactions[i].OrderId = orderId
+		}
+	}
+	for i := range m.orders {
+		if m.orders[i].Id == trans.OrderId {
+			m.orders[i].TransId = trans.Id
+			m.orders[i].TransStatus = trans.PaymentStatus
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) GetTransaction(transId int) (*types.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.transactions {
+		if t.Id == transId {
+			return &t, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Shipping
+
+func (m *MemStore) PlaceOrder(ship types.Shipping) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ship.Id = m.nextId(c.ShippingTable)
+	ship.TrackingId = c.Uninitiated
+	ship.ShippingStatus = c.Uninitiated
+	ship.TimeOfCreation = time.Now().UTC().UnixNano()
+	m.shipping = append(m.shipping, ship)
+	return ship.Id, nil
+}
+
+// Feedback
+
+func (m *MemStore) AddFeedback(ph, typ, desc string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.feedback = append(m.feedback, memFeedback{ph, typ, desc})
+	return nil
+}
+
+// FeedbackCount returns the number of feedback entries made from a phone
+func (m *MemStore) FeedbackCount(phone string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, f := range m.feedback {
+		if f.Phone == phone {
+			n++
+		}
+	}
+	return n
+}
+
+// Url cache
+
+func (m *MemStore) GetManifestEntries() ([]types.ManifestEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := append([]types.ManifestEntry{}, m.manifest...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Priority != entries[j].Priority {
+			return entries[i].Priority > entries[j].Priority
+		}
+		return entries[i].Url < entries[j].Url
+	})
+	return entries, nil
+}
+
+func (m *MemStore) PutManifestEntry(e types.ManifestEntry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	version := m.manifestVersion()
+	for i := range m.manifest {
+		current := &m.manifest[i]
+		if current.Url != e.Url {
+			continue
+		}
+		if !current.Removed && current.Hash == e.Hash && current.Size == e.Size && current.Priority == e.Priority {
+			return version, nil
+		}
+		e.Version, e.Removed = version+1, false
+		*current = e
+		return e.Version, nil
+	}
+	e.Version, e.Removed = version+1, false
+	m.manifest = append(m.manifest, e)
+	return e.Version, nil
+}
+
+func (m *MemStore) RemoveManifestEntry(url string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	version := m.manifestVersion()
+	for i := range m.manifest {
+		if e := &m.manifest[i]; e.Url == url && !e.Removed {
+			e.Removed, e.Version = true, version+1
+			return e.Version, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+// manifestVersion expects mu to be held
+func (m *MemStore) manifestVersion() int64 {
+	var version int64
+	for _, e := range m.manifest {
+		if e.Version > version {
+			version = e.Version
+		}
+	}
+	return version
+}
+
+// Push notifications
+
+func (m *MemStore) GetPushTokens(target string, targetId int) ([]types.PushToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	in := func(userId int) bool {
+		switch target {
+		case c.TargetUser:
+			return userId == targetId
+		case c.TargetMascot:
+			for _, s := range m.subscribed {
+				if s.UserId == userId && s.MascotId == targetId {
+					return true
+				}
+			}
+		case c.TargetRole:
+			for _, ur := range m.userRoles {
+				if ur.UserId == userId && ur.RoleId == targetId {
+					return true
+				}
+			}
+		case c.TargetAll:
+			return true
+		}
+		return false
+	}
+	switch target {
+	case c.TargetUser, c.TargetMascot, c.TargetRole, c.TargetAll:
+	default:
+		return nil, fmt.Errorf("Unknown target %q", target)
+	}
+
+	tokens := []types.PushToken{}
+	for _, u := range m.users {
+		if u.Token.Valid && u.Token.String != "" && in(u.Id) {
+			tokens = append(tokens, types.PushToken{UserId: u.Id, Token: u.Token.String})
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].UserId < tokens[j].UserId })
+	return tokens, nil
+}
+
+func (m *MemStore) ClearPushToken(userId int, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Id == userId }); u != nil && u.Token.Valid && u.Token.String == token {
+		u.Token = sql.NullString{}
+	}
+	return nil
+}
+
+// PushToken is the registration token stored for the user, for tests
+func (m *MemStore) PushToken(userId int) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u := m.findUser(func(u *types.User) bool { return u.Id == userId }); u != nil && u.Token.Valid {
+		return u.Token.String, true
+	}
+	return "", false
+}
+
+func (m *MemStore) AddNotification(n types.Notification) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n.Id = m.nextId(c.NotificationTable)
+	m.notified = append(m.notified, n)
+	return n.Id, nil
+}
+
+func (m *MemStore) UpdateNotification(n types.Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.notified {
+		if p := &m.notified[i]; p.Id == n.Id {
+			p.Status, p.Recipients, p.Sent, p.Failed, p.Pruned = n.Status, n.Recipients, n.Sent, n.Failed, n.Pruned
+			p.TimeOfCompletion = n.TimeOfCompletion
+		}
+	}
+	return nil
+}
+
+func (m *MemStore) GetNotification(notificationId int) (*types.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, n := range m.notified {
+		if n.Id == notificationId {
+			return &n, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemStore) AddDelivery(d types.Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.deliveries {
+		if e.NotificationId == d.NotificationId && e.UserId == d.UserId {
+			return fmt.Errorf("Duplicate delivery of notification %d to user %d", d.NotificationId, d.UserId)
+		}
+	}
+	m.deliveries = append(m.deliveries, d)
+	return nil
+}
+
+func (m *MemStore) GetDeliveries(notificationId int) ([]types.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []types.Delivery{}
+	for _, d := range m.deliveries {
+		if d.NotificationId == notificationId {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].UserId < deliveries[j].UserId })
+	return deliveries, nil
+}
@@ -0,0 +1,673 @@
+// Versioned mysql schema migrations
+// Every change to the mysql schema goes in as a new numbered migration at the
+// end of allMigrations, never by editing one that has been released, so that
+// existing databases pick it up on the next start. Applied versions are
+// recorded in the SchemaVersion table.
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	c "rob/lib/common/constants"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A single sql statement with values bound to its ? placeholders
+type Statement struct {
+	Query string
+	Args  []interface{}
+	// Select of a single boolean, the statement only runs when it is true.
+	// Guards statements that fail when run twice, like adding a column
+	If *Statement
+}
+
+func stmt(query string, args ...interface{}) Statement {
+	return Statement{Query: query, Args: args}
+}
+
+// Whether a column or an index of a table of the current database exists
+const (
+	columnExists = `SELECT COUNT(*) > 0 FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	indexExists = `SELECT COUNT(*) > 0 FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+)
+
+// addColumn adds column to table unless it is there already
+func addColumn(table, column, definition string) Statement {
+	s := stmt(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, definition))
+	s.If = &Statement{Query: "SELECT NOT (" + columnExists + ")", Args: []interface{}{table, column}}
+	return s
+}
+
+// dropColumn drops column of table if it is still there
+func dropColumn(table, column string) Statement {
+	s := stmt(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, column))
+	s.If = &Statement{Query: columnExists, Args: []interface{}{table, column}}
+	return s
+}
+
+// addUniqueKey adds a unique index on column of table, named after the
+// column, unless it is there already
+func addUniqueKey(table, column string) Statement {
+	s := stmt(fmt.Sprintf("ALTER TABLE %s ADD UNIQUE KEY %s(%s);", table, column, column))
+	s.If = &Statement{Query: "SELECT NOT (" + indexExists + ")", Args: []interface{}{table, column}}
+	return s
+}
+
+// dropIndex drops index of table if it is still there
+func dropIndex(table, index string) Statement {
+	s := stmt(fmt.Sprintf("ALTER TABLE %s DROP INDEX %s;", table, index))
+	s.If = &Statement{Query: indexExists, Args: []interface{}{table, index}}
+	return s
+}
+
+type Migration struct {
+	Version     int
+	Description string
+	// Statements run in order to apply the migration
+	Up []Statement
+	// Statements run in order to undo the migration
+	Down []Statement
+}
+
+// A migration to be applied (Upgrade is true) or undone
+type MigrationStep struct {
+	Migration
+	Upgrade bool
+}
+
+func (m MigrationStep) String() string {
+	direction := "down"
+	if m.Upgrade {
+		direction = "up"
+	}
+	return fmt.Sprintf("%4s %03d %s", direction, m.Version, m.Description)
+}
+
+// Migrations in version order. Versions start at 1 and have no gaps
+func allMigrations() []Migration {
+	return []Migration{
+		// Uses IF NOT EXISTS so that databases created before migrations
+		// were introduced are adopted as they are
+		{
+			Version:     1,
+			Description: "Initial schema",
+			Up: []Statement{
+				// Create Users table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int(11) NOT NULL AUTO_INCREMENT,
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(6),
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(12) NOT NULL UNIQUE,
+					%s bigint,
+					%s int,
+					%s varchar(400),
+					%s varchar(400),
+					%s varchar(400),
+					PRIMARY KEY(%s)
+				);`,
+					c.UsersTable, c.Id, c.Email, c.Password, c.Gender, c.FirstName, c.LastName, c.Phone, c.TimeOfCreation, c.Verified, c.Code, c.Token, c.ResetPasswordToken, c.Id)),
+
+				// Create Roles table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int(11) NOT NULL AUTO_INCREMENT,
+					%s varchar(50) NOT NULL,
+					PRIMARY KEY(%s)
+				);`,
+					c.RolesTable, c.Id, c.Name, c.Id)),
+
+				// Add/update admin role to Roles table
+				stmt(fmt.Sprintf(`
+				INSERT INTO %s 
+				VALUES(?,?)
+				ON DUPLICATE KEY
+				UPDATE %s = ?;`,
+					c.RolesTable, c.Id),
+					c.AdminRole, c.AdminRoleName, c.AdminRole),
+
+				// Add/update user role to Roles table
+				stmt(fmt.Sprintf(`
+				INSERT INTO %s 
+				VALUES(?,?)
+				ON DUPLICATE KEY
+				UPDATE %s = ?;`,
+					c.RolesTable, c.Id),
+					c.UserRole, c.UserRoleName, c.UserRole),
+
+				// Add/update writer role to Roles table
+				stmt(fmt.Sprintf(`
+				INSERT INTO %s 
+				VALUES(?,?)
+				ON DUPLICATE KEY
+				UPDATE %s = ?;`,
+					c.RolesTable, c.Id),
+					c.WriterRole, c.WriterRoleName, c.WriterRole),
+
+				// Create UserRole table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s int(11) NOT NULL,
+					%s int(11) NOT NULL,
+					FOREIGN KEY (%s) REFERENCES %s(%s),
+					PRIMARY KEY (%s)
+				);`,
+					c.UserRoleTable, c.Id, c.UserId, c.RoleId, c.RoleId, c.RolesTable, c.Id, c.Id)),
+
+				// Create Mascot table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(50),
+					%s varchar(255),
+					PRIMARY KEY(%s)
+				);`,
+					c.MascotTable, c.Id, c.Name, c.Description, c.Id)),
+
+				// Add/Update default mascot details
+				stmt(fmt.Sprintf(`
+				INSERT INTO %s
+				VALUES(?,?,?)
+				ON DUPLICATE KEY
+				UPDATE %s = ?;`,
+					c.MascotTable, c.Id),
+					c.DefaultMascotId, c.DefaultMascotName,
+					c.DefaultMascotDescription, c.DefaultMascotId),
+
+				// Create PostQueue table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s bigint,
+					%s varchar(255) NOT NULL,
+					%s int NOT NULL,
+					FOREIGN KEY (%s) REFERENCES %s(%s),
+					PRIMARY KEY(%s,%s)
+				);`,
+					c.PostQueueTable, c.TimeOfCreation, c.PostId, c.MascotId,
+					c.MascotId, c.MascotTable, c.Id, c.MascotId, c.PostId)),
+
+				// Create Sale table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				Sale(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(500),
+					%s varchar(200),
+					%s varchar(50),
+					%s varchar(500),
+					%s varchar(500),
+					%s int,
+					%s bigint,
+					%s bigint,
+					%s bigint,
+					PRIMARY KEY(%s)
+				);`,
+					c.Id, c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime, c.TimeOfCreation, c.Id)),
+
+				// Create Order table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				%s(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(400),
+					%s varchar(400),
+					%s varchar(400),
+					%s int(11),
+					%s bigint,
+					%s int(11),
+					%s int(11),
+					%s int(11),
+					%s int(11),
+					%s int(11),
+					%s varchar(400),
+					%s int(11),
+					%s int(11),
+					%s int(11),
+					%s varchar(400),
+					%s varchar(40),
+					%s bigint,
+					PRIMARY KEY(%s)
+				);`,
+					c.OrderTable, c.Id, c.ProductId, c.ProductTitle, c.ProductThumb, c.UserId, c.OrderDate, c.Price, c.Tax, c.ShippingCost, c.Amount, c.TransId, c.TransStatus, c.SaleId, c.AddressId, c.ShippingId, c.ShippingStatus, c.TrackingId, c.TimeOfCreation, c.Id)),
+
+				// Create Address table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				%s(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s int,
+					%s varchar(1000),
+					%s varchar(200),
+					%s varchar(400),
+					%s varchar(400),
+					%s int(6),
+					%s varchar(10),
+					%s bigint,
+					PRIMARY KEY(%s)
+				);`,
+					c.AddressTable, c.Id, c.UserId, c.Address, c.AddressType, c.City, c.State, c.PostalCode, c.Phone, c.TimeOfCreation, c.Id)),
+
+				// Create Transaction table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				%s(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s int,
+					%s int,
+					%s int,
+					%s bigint,
+					%s varchar(500),
+					%s varchar(100),			
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(500),
+					PRIMARY KEY(%s)
+				);`,
+					c.TransactionTable, c.Id, c.Amount, c.OrderId, c.Phone, c.TimeOfCreation, c.ProductInfo, c.Email, c.PaymentMethod, c.PaymentId, c.PaymentStatus, c.FirstName, c.Hash, c.Id)),
+
+				// Create Shipping table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				%s(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s int,
+					%s int,
+					%s varchar(100),
+					%s int,
+					%s varchar(200),
+					%s bigint,
+					PRIMARY KEY(%s)
+				);`,
+					c.ShippingTable, c.Id, c.OrderId, c.UserId, c.TrackingId, c.AddressId, c.ShippingStatus, c.TimeOfCreation, c.Id)),
+
+				// Create Feedback table if needed
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS
+				%s(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(100),
+					%s varchar(100),
+					%s varchar(2000),
+					PRIMARY KEY(%s)
+				);`,
+					c.FeedbackTable, c.Id, c.Phone, c.Type, c.Description, c.Id)),
+
+				// Create UrlCache table if needed
+				stmt(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS 
+		%s(
+				%s int NOT NULL AUTO_INCREMENT,
+				%s varchar(100),
+				PRIMARY KEY(%s)
+		);`,
+					c.UrlCacheTable, c.Id, c.Url, c.Id)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.UrlCacheTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.FeedbackTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.ShippingTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.TransactionTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.AddressTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.OrderTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.SaleTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.PostQueueTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.MascotTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.UserRoleTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.RolesTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.UsersTable)),
+			},
+		},
+		{
+			Version:     2,
+			Description: "Mascot avatar, theme colors and retirement",
+			Up: []Statement{
+				addColumn(c.MascotTable, c.Avatar, "varchar(255) NOT NULL DEFAULT ''"),
+				addColumn(c.MascotTable, c.GradientStart, "varchar(20) NOT NULL DEFAULT ''"),
+				addColumn(c.MascotTable, c.GradientEnd, "varchar(20) NOT NULL DEFAULT ''"),
+				addColumn(c.MascotTable, c.IsActive, "tinyint(1) NOT NULL DEFAULT 1"),
+			},
+			Down: []Statement{
+				dropColumn(c.MascotTable, c.Avatar),
+				dropColumn(c.MascotTable, c.GradientStart),
+				dropColumn(c.MascotTable, c.GradientEnd),
+				dropColumn(c.MascotTable, c.IsActive),
+			},
+		},
+		{
+			Version:     3,
+			Description: "Mascot subscriptions",
+			Up: []Statement{
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL,
+					%s int NOT NULL,
+					%s bigint NOT NULL,
+					FOREIGN KEY (%s) REFERENCES %s(%s),
+					PRIMARY KEY(%s,%s)
+				);`,
+					c.SubscriptionTable, c.UserId, c.MascotId, c.TimeOfCreation,
+					c.MascotId, c.MascotTable, c.Id, c.UserId, c.MascotId)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.SubscriptionTable)),
+			},
+		},
+		{
+			Version:     4,
+			Description: "Post link expiry",
+			Up: []Statement{
+				addColumn(c.PostQueueTable, c.ExpireAt, "bigint NOT NULL DEFAULT 0"),
+			},
+			Down: []Statement{
+				dropColumn(c.PostQueueTable, c.ExpireAt),
+			},
+		},
+		{
+			Version:     5,
+			Description: "Pinned post links",
+			Up: []Statement{
+				addColumn(c.PostQueueTable, c.PinnedAt, "bigint NOT NULL DEFAULT 0"),
+			},
+			Down: []Statement{
+				dropColumn(c.PostQueueTable, c.PinnedAt),
+			},
+		},
+		{
+			Version:     6,
+			Description: "Poll votes",
+			Up: []Statement{
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s varchar(24) NOT NULL,
+					%s int NOT NULL,
+					%s int NOT NULL,
+					%s bigint NOT NULL,
+					PRIMARY KEY(%s,%s)
+				);`,
+					c.PollVoteTable, c.PostId, c.UserId, c.OptionIndex, c.TimeOfCreation,
+					c.PostId, c.UserId)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.PollVoteTable)),
+			},
+		},
+		{
+			Version:     7,
+			Description: "Likes, saves and views of posts",
+			Up: []Statement{
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s varchar(24) NOT NULL,
+					%s int NOT NULL,
+					%s tinyint NOT NULL,
+					%s bigint NOT NULL,
+					PRIMARY KEY(%s,%s,%s),
+					KEY(%s,%s,%s)
+				);`,
+					c.EngagementTable, c.PostId, c.UserId, c.Kind, c.TimeOfCreation,
+					c.PostId, c.Kind, c.UserId,
+					c.UserId, c.Kind, c.TimeOfCreation)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.EngagementTable)),
+			},
+		},
+		{
+			Version:     8,
+			Description: "Comments on posts",
+			Up: []Statement{
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(24) NOT NULL,
+					%s int NOT NULL DEFAULT 0,
+					%s int NOT NULL,
+					%s text NOT NULL,
+					%s varchar(12) NOT NULL,
+					%s bigint NOT NULL,
+					%s int NOT NULL DEFAULT 0,
+					%s bigint NOT NULL DEFAULT 0,
+					PRIMARY KEY(%s),
+					KEY(%s,%s,%s,%s),
+					KEY(%s,%s)
+				);`,
+					c.CommentTable, c.Id, c.PostId, c.ParentId, c.UserId, c.Body, c.Status,
+					c.TimeOfCreation, c.ModeratedBy, c.TimeOfModeration,
+					c.Id,
+					c.PostId, c.ParentId, c.Status, c.Id,
+					c.ParentId, c.Status)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.CommentTable)),
+			},
+		},
+		{
+			Version:     9,
+			Description: "Versioned manifest of cached urls",
+			Up: []Statement{
+				// Urls become unique, the first one added is kept
+				stmt(fmt.Sprintf("DELETE FROM %s WHERE %s IS NULL", c.UrlCacheTable, c.Url)),
+				stmt(fmt.Sprintf(`
+				DELETE a FROM %s a JOIN %s b
+					ON a.%s = b.%s AND a.%s > b.%s;`,
+					c.UrlCacheTable, c.UrlCacheTable, c.Url, c.Url, c.Id, c.Id)),
+				stmt(fmt.Sprintf("ALTER TABLE %s MODIFY %s varchar(%d) NOT NULL;", c.UrlCacheTable, c.Url, c.MaxCacheUrl)),
+				// Urls already there make version 1
+				addColumn(c.UrlCacheTable, c.Hash, "char(64) NOT NULL DEFAULT ''"),
+				addColumn(c.UrlCacheTable, c.Size, "bigint NOT NULL DEFAULT 0"),
+				addColumn(c.UrlCacheTable, c.Priority, "int NOT NULL DEFAULT 0"),
+				addColumn(c.UrlCacheTable, c.Version, "bigint NOT NULL DEFAULT 1"),
+				addColumn(c.UrlCacheTable, c.Removed, "tinyint(1) NOT NULL DEFAULT 0"),
+				addUniqueKey(c.UrlCacheTable, c.Url),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DELETE FROM %s WHERE %s = 1", c.UrlCacheTable, c.Removed)),
+				dropIndex(c.UrlCacheTable, c.Url),
+				dropColumn(c.UrlCacheTable, c.Hash),
+				dropColumn(c.UrlCacheTable, c.Size),
+				dropColumn(c.UrlCacheTable, c.Priority),
+				dropColumn(c.UrlCacheTable, c.Version),
+				dropColumn(c.UrlCacheTable, c.Removed),
+				stmt(fmt.Sprintf("ALTER TABLE %s MODIFY %s varchar(100);", c.UrlCacheTable, c.Url)),
+			},
+		},
+		{
+			Version:     10,
+			Description: "Push notifications and their deliveries",
+			Up: []Statement{
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL AUTO_INCREMENT,
+					%s varchar(%d) NOT NULL,
+					%s varchar(%d) NOT NULL,
+					%s text NOT NULL,
+					%s varchar(12) NOT NULL,
+					%s int NOT NULL DEFAULT 0,
+					%s varchar(12) NOT NULL,
+					%s int NOT NULL,
+					%s int NOT NULL DEFAULT 0,
+					%s int NOT NULL DEFAULT 0,
+					%s int NOT NULL DEFAULT 0,
+					%s int NOT NULL DEFAULT 0,
+					%s bigint NOT NULL,
+					%s bigint NOT NULL DEFAULT 0,
+					PRIMARY KEY(%s)
+				);`,
+					c.NotificationTable, c.Id, c.Title, c.MaxNotificationTitle, c.Body, c.MaxNotificationBody,
+					c.Data, c.Target, c.TargetId, c.Status, c.CreatedBy,
+					c.Recipients, c.Sent, c.Failed, c.Pruned, c.TimeOfCreation, c.TimeOfCompletion,
+					c.Id)),
+				stmt(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s
+				(
+					%s int NOT NULL,
+					%s int NOT NULL,
+					%s varchar(12) NOT NULL,
+					%s int NOT NULL,
+					%s varchar(200) NOT NULL DEFAULT '',
+					%s varchar(%d) NOT NULL DEFAULT '',
+					%s bigint NOT NULL,
+					PRIMARY KEY(%s,%s)
+				);`,
+					c.DeliveryTable, c.NotificationId, c.UserId, c.Status, c.Attempts, c.MessageId, c.Error, c.MaxDeliveryError, c.TimeOfCreation,
+					c.NotificationId, c.UserId)),
+			},
+			Down: []Statement{
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.DeliveryTable)),
+				stmt(fmt.Sprintf("DROP TABLE IF EXISTS %s", c.NotificationTable)),
+			},
+		},
+	}
+}
+
+// LatestSchemaVersion is the version of the last known migration
+func LatestSchemaVersion() int {
+	all := allMigrations()
+	return all[len(all)-1].Version
+}
+
+// planMigration returns the steps needed to go from version current to
+// version target. Upgrades apply migrations in ascending order and
+// downgrades undo them in descending order
+func planMigration(all []Migration, current, target int) ([]MigrationStep, error) {
+	for i, m := range all {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("Migration versions are not contiguous, found %d at position %d", m.Version, i+1)
+		}
+	}
+	if target < 0 || target > len(all) {
+		return nil, fmt.Errorf("Unknown schema version %d, latest is %d", target, len(all))
+	}
+	if current < 0 || current > len(all) {
+		return nil, fmt.Errorf("Database is at schema version %d which this server does not know about, latest is %d", current, len(all))
+	}
+
+	var steps []MigrationStep
+	for v := current + 1; v <= target; v++ {
+		steps = append(steps, MigrationStep{all[v-1], true})
+	}
+	for v := current; v > target; v-- {
+		steps = append(steps, MigrationStep{all[v-1], false})
+	}
+	return steps, nil
+}
+
+func createVersionTable() error {
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS %s
+		(
+			%s int NOT NULL,
+			%s varchar(255),
+			%s bigint,
+			PRIMARY KEY(%s)
+		);`,
+		c.SchemaVersionTable, c.Version, c.Description, c.TimeOfCreation, c.Version)
+
+	return PrepareAndExec(query, db)
+}
+
+// SchemaVersion returns the last migration applied to the database,
+// 0 if there is none
+func SchemaVersion() (int, error) {
+	if db == nil {
+		return 0, errors.New("Mysql is not initialised")
+	}
+	if err := createVersionTable(); err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s", c.Version, c.SchemaVersionTable)
+
+	var version int
+	err := scanRow(query, nil, &version)
+	return version, err
+}
+
+// Migrate brings the database schema to version target, upgrading or
+// downgrading as needed, and returns the steps taken. With dryRun nothing is
+// executed and the steps that would be taken are returned
+func Migrate(target int, dryRun bool) ([]MigrationStep, error) {
+	var funcName = "datastore/migrations.go:Migrate"
+	log.WithFields(log.Fields{
+		"target": target,
+		"dryRun": dryRun,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	current, err := SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := planMigration(allMigrations(), current, target)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return steps, nil
+	}
+
+	for i, step := range steps {
+		log.Infof("Migrating schema: %s", step)
+		if err := runStep(step); err != nil {
+			return steps[:i], fmt.Errorf("Migration %s failed: %v", step, err)
+		}
+	}
+
+	log.Infof("Mysql schema at version %d", target)
+	return steps, nil
+}
+
+// mysql commits schema changes implicitly so a step can't be wrapped in a
+// transaction. Statements are written so that rerunning a partly applied
+// step is safe, those that can't be are guarded by their If
+func runStep(step MigrationStep) error {
+	statements := step.Down
+	if step.Upgrade {
+		statements = step.Up
+	}
+
+	for _, s := range statements {
+		if s.If != nil {
+			var run bool
+			if err := scanRow(s.If.Query, s.If.Args, &run); err != nil {
+				return err
+			}
+			if !run {
+				continue
+			}
+		}
+		if err := PrepareAndExec(s.Query, db, s.Args...); err != nil {
+			return err
+		}
+	}
+
+	if step.Upgrade {
+		query := insertQuery(c.SchemaVersionTable, c.Version, c.Description, c.TimeOfCreation)
+		_, err := execQuery(db, query, step.Version, step.Description, time.Now().UTC().UnixNano())
+		return err
+	}
+
+	_, err := execQuery(db, deleteQuery(c.SchemaVersionTable, c.Version), step.Version)
+	return err
+}
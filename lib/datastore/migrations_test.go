@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestPlanMigration(t *testing.T) {
+	all := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	tests := []struct {
+		current  int
+		target   int
+		expected []int // positive for upgrades, negative for downgrades
+	}{
+		{0, 3, []int{1, 2, 3}},
+		{1, 3, []int{2, 3}},
+		{3, 3, nil},
+		{3, 1, []int{-3, -2}},
+		{2, 0, []int{-2, -1}},
+	}
+
+	for _, test := range tests {
+		steps, err := planMigration(all, test.current, test.target)
+		if err != nil {
+			t.Errorf("Plan from %d to %d failed: %v", test.current, test.target, err)
+			continue
+		}
+		var got []int
+		for _, s := range steps {
+			if s.Upgrade {
+				got = append(got, s.Version)
+			} else {
+				got = append(got, -s.Version)
+			}
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("Plan from %d to %d failed. Expected=%v but received=%v", test.current, test.target, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("Plan from %d to %d failed. Expected=%v but received=%v", test.current, test.target, test.expected, got)
+				break
+			}
+		}
+	}
+
+	// Unknown versions
+	for _, v := range [][2]int{{0, 4}, {0, -1}, {5, 3}} {
+		if _, err := planMigration(all, v[0], v[1]); err == nil {
+			t.Errorf("Plan from %d to %d expected to fail but it passed", v[0], v[1])
+		}
+	}
+
+	// Gaps in versions
+	if _, err := planMigration([]Migration{{Version: 1}, {Version: 3}}, 0, 2); err == nil {
+		t.Error("Plan with a gap in versions expected to fail but it passed")
+	}
+
+	// Released migrations
+	if LatestSchemaVersion() != len(allMigrations()) {
+		t.Errorf("Latest schema version %d does not match %d migrations", LatestSchemaVersion(), len(allMigrations()))
+	}
+}
+
+// Statements that fail when run twice are guarded so that a step can be
+// rerun after it was cut short
+func TestMigrationsRerunnable(t *testing.T) {
+	unsafe := regexp.MustCompile(`(?i)\b(ADD|DROP)\s+(COLUMN|UNIQUE|KEY|INDEX)\b`)
+	for _, m := range allMigrations() {
+		for _, s := range append(append([]Statement{}, m.Up...), m.Down...) {
+			if unsafe.MatchString(s.Query) && s.If == nil {
+				t.Errorf("Migration %d runs %q without a guard", m.Version, s.Query)
+			}
+		}
+	}
+}
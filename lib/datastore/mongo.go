@@ -0,0 +1,141 @@
+// Connection to mongo shared by all the requests
+package datastore
+
+import (
+	"rob/lib/config"
+	"sync"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+
+	lh "rob/lib/common/loghelper"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// Established once and copied for every request. Copies share the
+	// pool of connections of this session
+	mongo   *mgo.Session
+	mongoMu sync.Mutex
+	// Dial in progress, whose result is shared by all who wait for it
+	dialing *dialCall
+	// Replaced by tests
+	dial = dialMongo
+)
+
+// dialCall is one attempt to connect
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+/*
+Purpose : Connects to the mongo server in config.Get().Mongo
+Input : None
+Outputs : Error if the server could not be reached after all the retries
+Remark : Called at start-up, after the configuration is loaded. Without it the first request connects
+*/
+func InitMongo() error {
+	return connect(config.Get().Mongo)
+}
+
+// connect dials the server of cfg unless connected. Only one dial runs at a
+// time, those coming meanwhile wait for it and get its result
+func connect(cfg config.Mongo) error {
+	mongoMu.Lock()
+	if mongo != nil {
+		mongoMu.Unlock()
+		return nil
+	}
+	if call := dialing; call != nil {
+		mongoMu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &dialCall{done: make(chan struct{})}
+	dialing = call
+	mongoMu.Unlock()
+
+	// mongoMu is not held while dialing so that the retries don't hold up
+	// the requests that have a session
+	log.Info("Connecting to Mongo instance")
+	s, err := dial(cfg)
+
+	mongoMu.Lock()
+	if err == nil {
+		mongo = s
+		log.Info("Init of mongo done")
+	}
+	call.err = err
+	dialing = nil
+	mongoMu.Unlock()
+	close(call.done)
+	return err
+}
+
+func CloseMongo() {
+	mongoMu.Lock()
+	defer mongoMu.Unlock()
+
+	if mongo != nil {
+		mongo.Close()
+		mongo = nil
+	}
+}
+
+/*
+Purpose : Gives a request its own session on the shared connection pool
+Input : None
+Outputs : A session the caller must Close, which returns its connection to the pool
+Remark : A copy gets a fresh connection, so requests recover after a server restart without a new dial. Without a connection a request tries to connect once, the retries are for start-up
+*/
+func MongoSession() (*mgo.Session, error) {
+	cfg := config.Get().Mongo
+	cfg.DialRetries = 1
+	for {
+		if err := connect(cfg); err != nil {
+			return nil, err
+		}
+		mongoMu.Lock()
+		// Nil again only if it was closed since
+		if mongo != nil {
+			s := mongo.Copy()
+			mongoMu.Unlock()
+			return s, nil
+		}
+		mongoMu.Unlock()
+	}
+}
+
+func dialMongo(cfg config.Mongo) (*mgo.Session, error) {
+	var funcName = "datastore/mongo.go:dialMongo"
+	log.WithFields(log.Fields{
+		"server":    cfg.Server,
+		"poolLimit": cfg.PoolLimit,
+		"retries":   cfg.DialRetries,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	var s *mgo.Session
+	var err error
+	for attempt := 1; attempt <= cfg.DialRetries; attempt++ {
+		s, err = mgo.DialWithTimeout(cfg.Server, time.Duration(cfg.DialTimeout)*time.Second)
+		if err == nil {
+			break
+		}
+		lh.Mongo.ConnectError(err)
+		if attempt < cfg.DialRetries {
+			log.Infof("Retrying mongo connection in %d seconds, attempt %d of %d", cfg.RetryWait, attempt+1, cfg.DialRetries)
+			time.Sleep(time.Duration(cfg.RetryWait) * time.Second)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.SetPoolLimit(cfg.PoolLimit)
+	s.SetSyncTimeout(time.Duration(cfg.DialTimeout) * time.Second)
+	s.SetSocketTimeout(time.Duration(cfg.SocketTimeout) * time.Second)
+	return s, nil
+}
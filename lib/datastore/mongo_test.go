@@ -0,0 +1,298 @@
+package datastore
+
+import (
+	"errors"
+	"reflect"
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"sync"
+	"testing"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The lock on the shared session is not held while dialing
+func TestDialOutsideLock(t *testing.T) {
+	prev := dial
+	defer func() { dial = prev }()
+	dialing, release := make(chan struct{}), make(chan struct{})
+	dial = func(cfg config.Mongo) (*mgo.Session, error) {
+		close(dialing)
+		<-release
+		return nil, errors.New("unreachable")
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := MongoSession()
+		done <- err
+	}()
+	<-dialing
+	closed := make(chan struct{})
+	go func() {
+		CloseMongo()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("CloseMongo expected not to wait for the dial")
+	}
+	close(release)
+	if err := <-done; err == nil || err.Error() != "unreachable" {
+		t.Errorf("MongoSession expected the dial error but received %v", err)
+	}
+}
+
+// Requests finding no connection share one dial of a single attempt
+func TestDialShared(t *testing.T) {
+	prev := dial
+	defer func() { dial = prev }()
+	var mu sync.Mutex
+	var retries []int
+	dialing, release := make(chan struct{}), make(chan struct{})
+	dial = func(cfg config.Mongo) (*mgo.Session, error) {
+		mu.Lock()
+		retries = append(retries, cfg.DialRetries)
+		mu.Unlock()
+		close(dialing)
+		<-release
+		return nil, errors.New("unreachable")
+	}
+
+	done := make(chan error)
+	for i := 0; i < 5; i++ {
+		go func() {
+			_, err := MongoSession()
+			done <- err
+		}()
+		if i == 0 {
+			<-dialing
+		}
+	}
+	// Gives the others the time to wait for the dial
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	for i := 0; i < 5; i++ {
+		if err := <-done; err == nil || err.Error() != "unreachable" {
+			t.Errorf("MongoSession expected the dial error but received %v", err)
+		}
+	}
+	if len(retries) != 1 || retries[0] != 1 {
+		t.Errorf("Dials expected=[1] but received=%v", retries)
+	}
+}
+
+func TestStatusIs(t *testing.T) {
+	if got := statusIs(""); !reflect.DeepEqual(got, bson.M{"$in": []interface{}{nil, ""}}) {
+		t.Errorf("Selector of no status expected to match a missing field but is %v", got)
+	}
+	if got := statusIs(c.StatusDraft); got != c.StatusDraft {
+		t.Errorf("Selector of a status expected=%q but received=%v", c.StatusDraft, got)
+	}
+	if got := visibleStatus; !reflect.DeepEqual(got, bson.M{"$in": []interface{}{nil, "", c.StatusPublished}}) {
+		t.Errorf("Selector of visible posts expected to match a missing field but is %v", got)
+	}
+}
+
+// Posts from before the editorial workflow are found as in the memory
+// store. Skipped when mongo is not running
+func TestSearchPostsWithoutStatus(t *testing.T) {
+	session := testMongo(t)
+	defer session.Close()
+
+	posts := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := ensureSearchIndexes(session); err != nil {
+		t.Fatal(err)
+	}
+	old, draft := bson.NewObjectId(), bson.NewObjectId()
+	if err := posts.Insert(
+		bson.M{"_id": old, "cardtype": c.CardTypeImage, "title": "Zanzibar before workflow"},
+		bson.M{"_id": draft, "cardtype": c.CardTypeImage, "title": "Zanzibar draft", "status": c.StatusDraft},
+	); err != nil {
+		t.Fatal(err)
+	}
+	defer posts.RemoveId(old)
+	defer posts.RemoveId(draft)
+
+	found, err := SearchPosts("zanzibar", nil, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Id != old {
+		t.Errorf("Only the post without status expected found but received %+v", found)
+	}
+}
+
+// Posts added before the editorial workflow have no status field.
+// Skipped when mongo is not running
+func TestDeletePostWithoutStatus(t *testing.T) {
+	session := testMongo(t)
+	defer session.Close()
+
+	posts := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	id := bson.NewObjectId()
+	if err := posts.Insert(bson.M{"_id": id, "cardtype": c.CardTypeImage, "title": "Before workflow"}); err != nil {
+		t.Fatal(err)
+	}
+	defer posts.RemoveId(id)
+
+	if err := DeletePost(id.Hex(), 7); err != nil {
+		t.Fatalf("Delete of a post without status expected to pass but received %v", err)
+	}
+	var p types.Post
+	if err := posts.FindId(id).One(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != c.StatusDeleted || p.DeletedBy != 7 {
+		t.Errorf("Post expected deleted by 7 but received %+v", p)
+	}
+	if err := RestorePost(id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := posts.FindId(id).One(&p); err != nil || p.Status != "" {
+		t.Errorf("Restored post expected without status but received %q, %v", p.Status, err)
+	}
+}
+
+// testMongo points the store at the mongo of the test profile for the
+// test, and returns a session on it
+func testMongo(t *testing.T) *mgo.Session {
+	cfg := config.Defaults(config.Test)
+	cfg.Mongo.DialTimeout = 1
+	cfg.Mongo.DialRetries = 1
+	prev := config.Get()
+	config.Use(cfg)
+	prevStore := Current()
+	Use(&DbStore{})
+	t.Cleanup(func() {
+		CloseMongo()
+		config.Use(prev)
+		Use(prevStore)
+	})
+
+	session, err := MongoSession()
+	if err != nil {
+		t.Skip("Mongo not running: ", err)
+	}
+	return session
+}
+
+// Feed latency against a local mongo, a feed being NumOfPosts posts.
+// Skipped when mongo is not running
+//
+//	go test ./lib/datastore -run NONE -bench Feed
+//
+// DialPerPost is how every post used to be fetched, SharedSession fetches
+// them one by one on the shared session and Batched in one query
+func BenchmarkFeedDialPerPost(b *testing.B) {
+	postLinks := benchPosts(b)
+	cfg := config.Get().Mongo
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, postLink := range postLinks {
+			session, err := mgo.Dial(cfg.Server)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var post types.Post
+			err = session.DB(cfg.DbName).C(c.Collection).FindId(bson.ObjectIdHex(postLink.PostId)).One(&post)
+			session.Close()
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFeedSharedSession(b *testing.B) {
+	postLinks := benchPosts(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, postLink := range postLinks {
+			if _, err := GetPostMetaData(postLink.PostId); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkFeedBatched(b *testing.B) {
+	postLinks := benchPosts(b)
+	postIds := benchPostIds(postLinks)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		posts, err := GetPostsByIds(postIds)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(posts) != len(postIds) {
+			b.Fatalf("Expected %d posts but received %d", len(postIds), len(posts))
+		}
+	}
+}
+
+func BenchmarkFeedBatchedParallel(b *testing.B) {
+	postIds := benchPostIds(benchPosts(b))
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := GetPostsByIds(postIds); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchPostIds(postLinks []types.PostLink) []string {
+	var postIds []string
+	for _, postLink := range postLinks {
+		postIds = append(postIds, postLink.PostId)
+	}
+	return postIds
+}
+
+// benchPosts adds a feed worth of posts to the test database and removes
+// them once the benchmark is done
+func benchPosts(b *testing.B) []types.PostLink {
+	cfg := config.Defaults(config.Test)
+	cfg.Mongo.DialTimeout = 1
+	cfg.Mongo.DialRetries = 1
+	prev := config.Get()
+	config.Use(cfg)
+	prevStore := Current()
+	Use(&DbStore{})
+
+	if err := InitMongo(); err != nil {
+		config.Use(prev)
+		Use(prevStore)
+		b.Skip("Mongo not running: ", err)
+	}
+
+	var postLinks []types.PostLink
+	for i := 0; i < c.NumOfPosts; i++ {
+		id, err := AddPost(types.Post{CardType: c.CardTypeImage, Title: "Benchmark post"})
+		if err != nil {
+			b.Fatal(err)
+		}
+		postLinks = append(postLinks, types.PostLink{PostId: id})
+	}
+
+	b.Cleanup(func() {
+		for _, postLink := range postLinks {
+			DeletePost(postLink.PostId, 0)
+		}
+		PurgePosts(time.Now().UTC().UnixNano())
+		CloseMongo()
+		config.Use(prev)
+		Use(prevStore)
+	})
+	return postLinks
+}
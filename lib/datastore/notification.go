@@ -0,0 +1,129 @@
+// All the database requests related to push notifications and their
+// delivery go here
+package datastore
+
+import (
+	"encoding/json"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var notificationColumns = []string{c.Id, c.Title, c.Body, c.Data, c.Target, c.TargetId, c.Status, c.CreatedBy,
+	c.Recipients, c.Sent, c.Failed, c.Pruned, c.TimeOfCreation, c.TimeOfCompletion}
+
+var deliveryColumns = []string{c.NotificationId, c.UserId, c.Status, c.Attempts, c.MessageId, c.Error, c.TimeOfCreation}
+
+/*
+Purpose : Records a notification about to be sent
+Input : The notification, its Id is ignored
+Outputs : The id of the notification
+Remark :
+*/
+func (s *DbStore) AddNotification(n types.Notification) (int, error) {
+	var funcName = "datastore/notification.go:AddNotification"
+	log.WithFields(log.Fields{
+		"target":   n.Target,
+		"targetId": n.TargetId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return 0, err
+	}
+	query := insertQuery(c.NotificationTable, notificationColumns[1:]...)
+	res, err := execQuery(db, query, n.Title, n.Body, string(data), n.Target, n.TargetId, n.Status, n.CreatedBy,
+		n.Recipients, n.Sent, n.Failed, n.Pruned, n.TimeOfCreation, n.TimeOfCompletion)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+/*
+Purpose : Records how far sending a notification got
+Input : The notification
+Outputs : error if any
+Remark : Only the status, the counts and the time of completion change
+*/
+func (s *DbStore) UpdateNotification(n types.Notification) error {
+	var funcName = "datastore/notification.go:UpdateNotification"
+	log.WithFields(log.Fields{
+		"notificationId": n.Id,
+		"status":         n.Status,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := updateQuery(c.NotificationTable,
+		[]string{c.Status, c.Recipients, c.Sent, c.Failed, c.Pruned, c.TimeOfCompletion}, c.Id)
+	_, err := execQuery(db, query, n.Status, n.Recipients, n.Sent, n.Failed, n.Pruned, n.TimeOfCompletion, n.Id)
+	return err
+}
+
+// GetNotification returns sql.ErrNoRows if there is no such notification
+func (s *DbStore) GetNotification(notificationId int) (*types.Notification, error) {
+	var funcName = "datastore/notification.go:GetNotification"
+	log.WithFields(log.Fields{
+		"notificationId": notificationId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	var n types.Notification
+	var data string
+	query := selectQuery(c.NotificationTable, notificationColumns, c.Id)
+	err := scanRow(query, []interface{}{notificationId}, &n.Id, &n.Title, &n.Body, &data, &n.Target, &n.TargetId,
+		&n.Status, &n.CreatedBy, &n.Recipients, &n.Sent, &n.Failed, &n.Pruned, &n.TimeOfCreation, &n.TimeOfCompletion)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &n.Data); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+// AddDelivery records the fate of a notification on the device of a user
+func (s *DbStore) AddDelivery(d types.Delivery) error {
+	var funcName = "datastore/notification.go:AddDelivery"
+	log.WithFields(log.Fields{
+		"notificationId": d.NotificationId,
+		"userId":         d.UserId,
+		"status":         d.Status,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := insertQuery(c.DeliveryTable, deliveryColumns...)
+	_, err := execQuery(db, query, d.NotificationId, d.UserId, d.Status, d.Attempts, d.MessageId, d.Error, d.TimeOfCreation)
+	return err
+}
+
+// GetDeliveries lists the deliveries of a notification by user id
+func (s *DbStore) GetDeliveries(notificationId int) ([]types.Delivery, error) {
+	var funcName = "datastore/notification.go:GetDeliveries"
+	log.WithFields(log.Fields{
+		"notificationId": notificationId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := selectQuery(c.DeliveryTable, deliveryColumns, c.NotificationId) + " ORDER BY " + c.UserId
+	rows, err := queryRows(query, notificationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []types.Delivery{}
+	for rows.Next() {
+		var d types.Delivery
+		if err := rows.Scan(&d.NotificationId, &d.UserId, &d.Status, &d.Attempts, &d.MessageId, &d.Error, &d.TimeOfCreation); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
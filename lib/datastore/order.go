@@ -2,7 +2,6 @@
 package datastore
 
 import (
-	"fmt"
 	c "rob/lib/common/constants"
 	lh "rob/lib/common/loghelper"
 	"rob/lib/common/types"
@@ -18,12 +17,12 @@ Input : an order object
 Outputs : orderId and errro if any
 Remark :
 */
-func CreateOrder(newOrder types.Order) (int, error) {
+func (s *DbStore) CreateOrder(newOrder types.Order) (int, error) {
 	var funcName = "datastore/order.go:CreateOrder"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	product, err := GetProduct(newOrder.ProductId)
+	product, err := s.GetProduct(newOrder.ProductId)
 	if err != nil {
 		log.Error("Could not fetch Product details", err)
 		return -1, err
@@ -37,20 +36,10 @@ func CreateOrder(newOrder types.Order) (int, error) {
 	newOrder.ShippingId = c.UninitiatedId
 	newOrder.TimeOfCreation = time.Now().UTC().UnixNano()
 
-	var query string
-	query = fmt.Sprintf("INSERT INTO %s(%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s) VALUES('%s','%s','%s',%d,%d,%d,%d,%d,%d,%d,'%s',%d,%d,%d,'%s','%s',%d);", c.OrderTable, c.ProductId, c.ProductTitle, c.ProductThumb, c.UserId, c.OrderDate, c.Price, c.Tax, c.ShippingCost, c.Amount, c.TransId, c.TransStatus, c.SaleId, c.AddressId, c.ShippingId, c.ShippingStatus, c.TrackingId, c.TimeOfCreation, newOrder.ProductId, newOrder.ProductTitle, newOrder.ProductThumb, newOrder.UserId, newOrder.OrderDate, newOrder.Price, newOrder.Tax, newOrder.ShippingCost, newOrder.Amount, newOrder.TransId, newOrder.TransStatus, newOrder.SaleId, newOrder.AddressId, newOrder.ShippingId, newOrder.ShippingStatus, newOrder.TrackingId, newOrder.TimeOfCreation)
-	lh.Mysql.Query(query)
+	query := insertQuery(c.OrderTable, c.ProductId, c.ProductTitle, c.ProductThumb, c.UserId, c.OrderDate, c.Price, c.Tax, c.ShippingCost, c.Amount, c.TransId, c.TransStatus, c.SaleId, c.AddressId, c.ShippingId, c.ShippingStatus, c.TrackingId, c.TimeOfCreation)
 
-	stmt, err := db.Prepare(query)
+	res, err := execQuery(db, query, newOrder.ProductId, newOrder.ProductTitle, newOrder.ProductThumb, newOrder.UserId, newOrder.OrderDate, newOrder.Price, newOrder.Tax, newOrder.ShippingCost, newOrder.Amount, newOrder.TransId, newOrder.TransStatus, newOrder.SaleId, newOrder.AddressId, newOrder.ShippingId, newOrder.ShippingStatus, newOrder.TrackingId, newOrder.TimeOfCreation)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return -1, err
-	}
-	defer stmt.Close()
-
-	res, err := stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
 		return -1, err
 	}
 
@@ -70,26 +59,17 @@ Outputs : Order Object pointer
 Remark :
 */
 
-func GetOrder(oId int) (*types.Order, error) {
+func (s *DbStore) GetOrder(oId int) (*types.Order, error) {
 	var funcName = "datastore/order.go:GetOrder"
 	log.WithFields(log.Fields{
 		"orderId": oId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select * from %s where Id = %d", c.OrderTable, oId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.OrderTable, []string{"*"}, c.Id)
 
 	var order types.Order
-	err = stmt.QueryRow().Scan(&order.Id, &order.ProductId, &order.ProductTitle, &order.ProductThumb, &order.UserId, &order.OrderDate, &order.Price, &order.Tax, &order.ShippingCost, &order.Amount, &order.TransId, &order.TransStatus, &order.SaleId, &order.AddressId, &order.ShippingId, &order.ShippingStatus, &order.TrackingId, &order.TimeOfCreation)
+	err := scanRow(query, []interface{}{oId}, &order.Id, &order.ProductId, &order.ProductTitle, &order.ProductThumb, &order.UserId, &order.OrderDate, &order.Price, &order.Tax, &order.ShippingCost, &order.Amount, &order.TransId, &order.TransStatus, &order.SaleId, &order.AddressId, &order.ShippingId, &order.ShippingStatus, &order.TrackingId, &order.TimeOfCreation)
 
 	if err != nil {
 		lh.Mysql.ScanError(err)
@@ -107,26 +87,16 @@ Outputs : OrderList object pointer and error if any
 Remark : Wraps all order under OrderList
 */
 
-func GetUserOrders(userId int) (*types.OrdersList, error) {
+func (s *DbStore) GetUserOrders(userId int) (*types.OrdersList, error) {
 
 	var funcName = "datastore/order.go:MyOrders"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select * from %s where %s=%d", c.OrderTable, c.UserId, userId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.OrderTable, []string{"*"}, c.UserId)
 
-	rows, err := stmt.Query()
+	rows, err := queryRows(query, userId)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
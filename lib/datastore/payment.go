@@ -63,7 +63,7 @@ Input : a Transaction object and saleId to decrement stock
 Outputs : transactionId and error if any
 Remark : Removed prepared statements as since they are likely to be reprepared multiple times on different connections when connections are busy.
 */
-func InitiateTransaction(trans types.Transaction, saleId int) (int, error) {
+func (s *DbStore) InitiateTransaction(trans types.Transaction, saleId int) (int, error) {
 	var funcName = "datastore/payment.go:InitiateTransaction"
 	log.WithFields(log.Fields{
 		"transaction": trans,
@@ -76,19 +76,17 @@ func InitiateTransaction(trans types.Transaction, saleId int) (int, error) {
 	}
 	var value = -1
 	var query string
-	query = fmt.Sprintf("UPDATE %s SET %s = %s + %d WHERE %s = %d ;", c.SaleTable, c.StockUnits, c.StockUnits, value, c.Id, saleId)
-	lh.Mysql.Query(query)
-	_, err = tx.Exec(query)
+	query = fmt.Sprintf("UPDATE %s SET %s = %s + ? WHERE %s = ?", c.SaleTable, c.StockUnits, c.StockUnits, c.Id)
+	_, err = execQuery(tx, query, value, saleId)
 	if err != nil {
 		tx.Rollback()
 		log.Error(err.Error())
 		return -1, err
 	}
 	trans.TimeOfCreation = time.Now().UTC().UnixNano()
-	query = fmt.Sprintf("INSERT INTO %s(%s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s) VALUES(%d,%d,%d,%d,'%s','%s','%s','%s','%s','%s','%s');", c.TransactionTable, c.Amount, c.OrderId, c.Phone, c.TimeOfCreation, c.ProductInfo, c.Email, c.PaymentMethod, c.PaymentId, c.PaymentStatus, c.FirstName, c.Hash, trans.Amount, trans.OrderId, trans.Phone, trans.TimeOfCreation, trans.ProductInfo, trans.Email, trans.PaymentMethod, trans.PaymentId, trans.PaymentStatus, trans.FirstName, trans.Hash)
-	lh.Mysql.Query(query)
+	query = insertQuery(c.TransactionTable, c.Amount, c.OrderId, c.Phone, c.TimeOfCreation, c.ProductInfo, c.Email, c.PaymentMethod, c.PaymentId, c.PaymentStatus, c.FirstName, c.Hash)
 
-	res, err := tx.Exec(query)
+	res, err := execQuery(tx, query, trans.Amount, trans.OrderId, trans.Phone, trans.TimeOfCreation, trans.ProductInfo, trans.Email, trans.PaymentMethod, trans.PaymentId, trans.PaymentStatus, trans.FirstName, trans.Hash)
 	if err != nil {
 		tx.Rollback()
 		log.Error(err.Error())
@@ -110,7 +108,7 @@ Input : Transactionid, transaction status , and the orderId
 Outputs : error if any
 Remark :
 */
-func UpdateSuccessTransaction(trans types.Transaction) error {
+func (s *DbStore) UpdateSuccessTransaction(trans types.Transaction) error {
 	var funcName = "datastore/payment.go:UpdateOrderTransaction"
 	log.WithFields(log.Fields{
 		"transaction": trans,
@@ -119,9 +117,12 @@ func UpdateSuccessTransaction(trans types.Transaction) error {
 
 	// Update Transaction Table
 	tx, err := db.Begin()
-	query := fmt.Sprintf("UPDATE %s SET %s = %d,%s=%d,%s=%d,%s = '%s',%s = '%s',%s = '%s',%s = '%s',%s = '%s',%s = '%s'%s = '%s' WHERE %s = %d", c.TransactionTable, c.Amount, trans.Amount, c.Phone, trans.Phone, c.TimeOfCreation, trans.TimeOfCreation, c.ProductInfo, trans.ProductInfo, c.Email, trans.Email, c.PaymentMethod, trans.PaymentMethod, c.PaymentId, trans.PaymentId, c.PaymentStatus, trans.PaymentStatus, c.FirstName, trans.FirstName, c.Hash, trans.Hash, c.Id, trans.Id)
-	lh.Mysql.Query(query)
-	_, err = tx.Exec(query)
+	if err != nil {
+		log.Error(err.Error())
+		return err
+	}
+	query := updateQuery(c.TransactionTable, []string{c.Amount, c.Phone, c.TimeOfCreation, c.ProductInfo, c.Email, c.PaymentMethod, c.PaymentId, c.PaymentStatus, c.FirstName, c.Hash}, c.Id)
+	_, err = execQuery(tx, query, trans.Amount, trans.Phone, trans.TimeOfCreation, trans.ProductInfo, trans.Email, trans.PaymentMethod, trans.PaymentId, trans.PaymentStatus, trans.FirstName, trans.Hash, trans.Id)
 	if err != nil {
 		tx.Rollback()
 		log.Error(err.Error())
@@ -129,9 +130,8 @@ func UpdateSuccessTransaction(trans types.Transaction) error {
 	}
 
 	// Update Order Table
-	query = fmt.Sprintf("UPDATE %s SET %s=%d,%s=%s WHERE %s=%d", c.OrderTable, c.TransId, trans.Id, c.TransStatus, trans.PaymentStatus, c.Id, trans.OrderId)
-	lh.Mysql.Query(query)
-	_, err = tx.Exec(query)
+	query = updateQuery(c.OrderTable, []string{c.TransId, c.TransStatus}, c.Id)
+	_, err = execQuery(tx, query, trans.Id, trans.PaymentStatus, trans.OrderId)
 	if err != nil {
 		tx.Rollback()
 		log.Error(err.Error())
@@ -142,24 +142,16 @@ func UpdateSuccessTransaction(trans types.Transaction) error {
 	return nil
 }
 
-func GetTransaction(transId int) (*types.Transaction, error) {
+func (s *DbStore) GetTransaction(transId int) (*types.Transaction, error) {
 	var funcName = "datastore/payment.go:GetTransaction"
 	log.WithFields(log.Fields{
 		"transactionId": transId,
 	}).Debugf("Enter: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select * from %s where Id = %d", c.TransactionTable, transId)
-	lh.Mysql.Query(query)
+	query := selectQuery(c.TransactionTable, []string{"*"}, c.Id)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
 	var trans types.Transaction
-	err = stmt.QueryRow().Scan(&trans.Id, &trans.Amount, &trans.OrderId, &trans.Phone, &trans.TimeOfCreation, &trans.ProductInfo, &trans.Email, &trans.PaymentMethod, &trans.PaymentId, &trans.PaymentStatus, &trans.FirstName, &trans.Hash)
+	err := scanRow(query, []interface{}{transId}, &trans.Id, &trans.Amount, &trans.OrderId, &trans.Phone, &trans.TimeOfCreation, &trans.ProductInfo, &trans.Email, &trans.PaymentMethod, &trans.PaymentId, &trans.PaymentStatus, &trans.FirstName, &trans.Hash)
 	if err != nil {
 		lh.Mysql.ScanError(err)
 		return nil, err
@@ -0,0 +1,160 @@
+// All the database requests related to votes on poll cards go here
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrAlreadyVoted = errors.New("Already voted on the poll")
+
+/*
+Purpose : Records the vote of a user on a poll
+Input : poll postId, userId and the index of the option voted for
+Outputs : ErrAlreadyVoted if the user has voted on the poll before
+Remark : A vote can't be changed once cast
+*/
+func (s *DbStore) AddVote(postId string, userId int, option int) error {
+	var funcName = "datastore/poll.go:AddVote"
+	log.WithFields(log.Fields{
+		"postId": postId,
+		"userId": userId,
+		"option": option,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		INSERT IGNORE INTO %s(%s, %s, %s, %s)
+		VALUES(?,?,?,?);`,
+		c.PollVoteTable, c.PostId, c.UserId, c.OptionIndex, c.TimeOfCreation)
+
+	res, err := execQuery(db, query, postId, userId, option, time.Now().UTC().UnixNano())
+	if err != nil {
+		return err
+	}
+	// The primary key keeps a vote per user and poll
+	n, err := res.RowsAffected()
+	if err != nil {
+		lh.Mysql.ExecError(err)
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyVoted
+	}
+	return nil
+}
+
+/*
+Purpose : Counts the votes on several polls at once
+Input : poll postIds, and the user whose votes are looked for
+Outputs : Tallies by postId. Polls without votes are left out
+Remark : One grouped query for all the polls, the user's vote is summed along
+*/
+func (s *DbStore) GetPollTallies(postIds []string, userId int) (map[string]types.PollTally, error) {
+	var funcName = "datastore/poll.go:GetPollTallies"
+	log.WithFields(log.Fields{
+		"postIds": postIds,
+		"userId":  userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	tallies := make(map[string]types.PollTally)
+	if len(postIds) == 0 {
+		return tallies, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, COUNT(*), SUM(%s = ?)
+		FROM %s
+		WHERE %s IN (%s)
+		GROUP BY %s, %s`,
+		c.PostId, c.OptionIndex, c.UserId,
+		c.PollVoteTable,
+		c.PostId, placeholders(len(postIds)),
+		c.PostId, c.OptionIndex)
+
+	args := make([]interface{}, 0, len(postIds)+1)
+	args = append(args, userId)
+	for _, id := range postIds {
+		args = append(args, id)
+	}
+	rows, err := queryRows(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postId string
+		var option, count, mine int
+		if err := rows.Scan(&postId, &option, &count, &mine); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		t, ok := tallies[postId]
+		if !ok {
+			t = types.PollTally{Counts: make(map[int]int), Mine: -1}
+		}
+		t.Counts[option] = count
+		if mine > 0 {
+			t.Mine = option
+		}
+		tallies[postId] = t
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return tallies, nil
+}
+
+/*
+Purpose : Lists the votes on a poll
+Input : poll postId
+Outputs : The votes, oldest first
+Remark :
+*/
+func (s *DbStore) GetPollVotes(postId string) ([]types.PollVote, error) {
+	var funcName = "datastore/poll.go:GetPollVotes"
+	log.WithFields(log.Fields{
+		"postId": postId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s, %s
+		FROM %s
+		WHERE %s = ?
+		ORDER BY %s, %s`,
+		c.UserId, c.OptionIndex, c.TimeOfCreation,
+		c.PollVoteTable,
+		c.PostId,
+		c.TimeOfCreation, c.UserId)
+
+	rows, err := queryRows(query, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	votes := []types.PollVote{}
+	for rows.Next() {
+		v := types.PollVote{PostId: postId}
+		if err := rows.Scan(&v.UserId, &v.Option, &v.TimeOfCreation); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		votes = append(votes, v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return votes, nil
+}
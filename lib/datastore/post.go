@@ -3,14 +3,16 @@
 package datastore
 
 import (
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	c "rob/lib/common/constants"
 	"rob/lib/common/types"
+	"rob/lib/config"
+	"strings"
 	"time"
 
-	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	lh "rob/lib/common/loghelper"
@@ -18,7 +20,40 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-func GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
+// liveLinks keeps the links published and not yet expired at the time
+// given twice as arguments
+var liveLinks = fmt.Sprintf("%s <= ? AND (%s = 0 OR %s > ?)", c.TimeOfCreation, c.ExpireAt, c.ExpireAt)
+
+// queuedLinks are the live links served in queue order. Pinned links are
+// served apart, see GetPinnedPostLinks
+var queuedLinks = fmt.Sprintf("%s AND %s = 0", liveLinks, c.PinnedAt)
+
+var postLinkColumns = []string{c.TimeOfCreation, c.PostId, c.MascotId, c.ExpireAt, c.PinnedAt}
+
+// Post statuses for the mongo queries, where the collection shadows the
+// constants package
+var (
+	draft     = c.StatusDraft
+	submitted = c.StatusSubmitted
+	published = c.StatusPublished
+	rejected  = c.StatusRejected
+	deleted   = c.StatusDeleted
+)
+
+// statusIs selects the posts of the status. Posts from before the editorial
+// workflow have no status field, which "" doesn't match in mongo
+func statusIs(status string) interface{} {
+	if status == "" {
+		return bson.M{"$in": []interface{}{nil, ""}}
+	}
+	return status
+}
+
+// visibleStatus selects the posts readers see, published ones and those
+// from before the editorial workflow, as feed.visible does
+var visibleStatus = bson.M{"$in": []interface{}{nil, "", published}}
+
+func (s *DbStore) GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
 	var funcName = "datastore/post.go:GetTopPosts"
 	log.WithFields(log.Fields{
 		"numOfPosts": numOfPosts,
@@ -29,22 +64,21 @@ func GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
 	query := fmt.Sprintf(`
 		SELECT %s, %s
 		FROM %s
-		WHERE %s = %d
-		AND %s > %d
-		ORDER BY %s 
-		DESC LIMIT %d;`,
+		WHERE %s = ?
+		AND %s > ?
+		AND %s
+		ORDER BY %s DESC, %s DESC
+		LIMIT ?;`,
 		c.PostId, c.TimeOfCreation,
 		c.PostQueueTable,
-		c.MascotId, mascotId,
-		c.TimeOfCreation, c.DefaultTimestamp,
+		c.MascotId,
 		c.TimeOfCreation,
-		numOfPosts)
-
-	lh.Mysql.Query(query)
+		queuedLinks,
+		c.TimeOfCreation, c.PostId)
 
-	rows, err := db.Query(query)
+	now := time.Now().UTC().UnixNano()
+	rows, err := queryRows(query, mascotId, c.DefaultTimestamp, now, now, numOfPosts)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -68,7 +102,7 @@ func GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
 	return retItem, nil
 }
 
-func GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+func (s *DbStore) GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
 	var funcName = "datastore/post.go:GetPostsAfter"
 	log.WithFields(log.Fields{
 		"timestamp":  timestamp,
@@ -80,23 +114,23 @@ func GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostL
 	query := fmt.Sprintf(`
 		SELECT %s, %s
 		FROM  (SELECT * FROM %s 
-		WHERE %s = %d
-		AND %s > %d
-		ORDER BY %s 
-		LIMIT %d )
-		AS T ORDER BY %s DESC;`,
+		WHERE %s = ?
+		AND %s > ?
+		AND %s
+		ORDER BY %s, %s
+		LIMIT ? )
+		AS T ORDER BY %s DESC, %s DESC;`,
 		c.PostId, c.TimeOfCreation,
 		c.PostQueueTable,
-		c.MascotId, mascotId, c.TimeOfCreation, timestamp,
-		c.TimeOfCreation, numOfPosts,
-		c.TimeOfCreation,
+		c.MascotId, c.TimeOfCreation,
+		queuedLinks,
+		c.TimeOfCreation, c.PostId,
+		c.TimeOfCreation, c.PostId,
 	)
 
-	lh.Mysql.Query(query)
-
-	rows, err := db.Query(query)
+	now := time.Now().UTC().UnixNano()
+	rows, err := queryRows(query, mascotId, timestamp, now, now, numOfPosts)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -120,7 +154,7 @@ func GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostL
 	return retItem, nil
 }
 
-func GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+func (s *DbStore) GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
 	var funcName = "datastore/post.go:GetPostsBefore"
 	log.WithFields(log.Fields{
 		"timestamp":  timestamp,
@@ -132,23 +166,23 @@ func GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.Post
 	query := fmt.Sprintf(`
 		SELECT %s, %s
 		FROM (SELECT * FROM %s 
-		WHERE %s = %d
-		AND %s < %d
-		ORDER BY %s 
-		DESC LIMIT %d )
-		AS T ORDER BY %s DESC;`,
+		WHERE %s = ?
+		AND %s < ?
+		AND %s
+		ORDER BY %s DESC, %s DESC
+		LIMIT ? )
+		AS T ORDER BY %s DESC, %s DESC;`,
 		c.PostId, c.TimeOfCreation,
 		c.PostQueueTable,
-		c.MascotId, mascotId, c.TimeOfCreation, timestamp,
-		c.TimeOfCreation, numOfPosts,
-		c.TimeOfCreation,
+		c.MascotId, c.TimeOfCreation,
+		queuedLinks,
+		c.TimeOfCreation, c.PostId,
+		c.TimeOfCreation, c.PostId,
 	)
 
-	lh.Mysql.Query(query)
-
-	rows, err := db.Query(query)
+	now := time.Now().UTC().UnixNano()
+	rows, err := queryRows(query, mascotId, timestamp, now, now, numOfPosts)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -172,54 +206,432 @@ func GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.Post
 	return retItem, nil
 }
 
-func PostLink(mascotId int, postId string) error {
+/*
+Purpose : Page of a mascot queue older than a cursor
+Input : The cursor's TimeOfCreation and PostId, mascot and page size
+Outputs : Up to numOfPosts links, newest first
+Remark : Rows sharing a TimeOfCreation are ordered by PostId, so no row is skipped or repeated across pages
+*/
+func (s *DbStore) GetPostsBeforeCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetPostsBeforeCursor"
+	log.WithFields(log.Fields{
+		"timestamp":  timestamp,
+		"postId":     postId,
+		"numOfPosts": numOfPosts,
+		"mascotId":   mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM %s
+		WHERE %s = ?
+		AND (%s < ? OR (%s = ? AND %s < ?))
+		AND %s
+		ORDER BY %s DESC, %s DESC
+		LIMIT ?;`,
+		c.PostId, c.TimeOfCreation,
+		c.PostQueueTable,
+		c.MascotId,
+		c.TimeOfCreation, c.TimeOfCreation, c.PostId,
+		queuedLinks,
+		c.TimeOfCreation, c.PostId,
+	)
+
+	now := time.Now().UTC().UnixNano()
+	return queryPostLinks(query, mascotId, timestamp, timestamp, postId, now, now, numOfPosts)
+}
+
+/*
+Purpose : Page of a mascot queue newer than a cursor
+Input : The cursor's TimeOfCreation and PostId, mascot and page size
+Outputs : The numOfPosts links closest to the cursor, newest first
+Remark : Rows sharing a TimeOfCreation are ordered by PostId, so no row is skipped or repeated across pages
+*/
+func (s *DbStore) GetPostsAfterCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetPostsAfterCursor"
+	log.WithFields(log.Fields{
+		"timestamp":  timestamp,
+		"postId":     postId,
+		"numOfPosts": numOfPosts,
+		"mascotId":   mascotId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM (SELECT * FROM %s
+		WHERE %s = ?
+		AND (%s > ? OR (%s = ? AND %s > ?))
+		AND %s
+		ORDER BY %s, %s
+		LIMIT ? )
+		AS T ORDER BY %s DESC, %s DESC;`,
+		c.PostId, c.TimeOfCreation,
+		c.PostQueueTable,
+		c.MascotId,
+		c.TimeOfCreation, c.TimeOfCreation, c.PostId,
+		queuedLinks,
+		c.TimeOfCreation, c.PostId,
+		c.TimeOfCreation, c.PostId,
+	)
+
+	now := time.Now().UTC().UnixNano()
+	return queryPostLinks(query, mascotId, timestamp, timestamp, postId, now, now, numOfPosts)
+}
+
+// queryPostLinks runs a PostQueue query selecting PostId, TimeOfCreation
+func queryPostLinks(query string, args ...interface{}) ([]types.PostLink, error) {
+	rows, err := queryRows(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var retItem []types.PostLink
+	for rows.Next() {
+		var cur types.PostLink
+		if err := rows.Scan(&cur.PostId, &cur.TimeOfCreation); err != nil {
+			lh.Mysql.ScanError(err)
+			continue
+		}
+		retItem = append(retItem, cur)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return retItem, nil
+}
+
+// mergedLinks selects each post with a queued link to any of the mascots
+// once, with the time of its newest link as TimeOfCreation. having filters
+// on that time, aliased T
+func mergedLinks(mascotIds []int, having string) string {
+	return fmt.Sprintf(`
+		SELECT %s, MAX(%s) AS T
+		FROM %s
+		WHERE %s IN (%s)
+		AND %s
+		GROUP BY %s
+		HAVING %s`,
+		c.PostId, c.TimeOfCreation,
+		c.PostQueueTable,
+		c.MascotId, placeholders(len(mascotIds)),
+		queuedLinks,
+		c.PostId,
+		having)
+}
+
+// mascotArgs are the arguments of a query on the links of mascotIds
+// filtered by liveLinks, followed by args
+func mascotArgs(mascotIds []int, args ...interface{}) []interface{} {
+	now := time.Now().UTC().UnixNano()
+	all := make([]interface{}, 0, len(mascotIds)+len(args)+2)
+	for _, id := range mascotIds {
+		all = append(all, id)
+	}
+	all = append(all, now, now)
+	return append(all, args...)
+}
+
+/*
+Purpose : Newest posts of several mascot queues merged
+Input : page size and the mascots
+Outputs : Up to numOfPosts links, newest first, each post once
+Remark : A post linked to more than one of the mascots is placed at its newest link
+*/
+func (s *DbStore) GetMergedTopPosts(numOfPosts int, mascotIds []int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetMergedTopPosts"
+	log.WithFields(log.Fields{
+		"numOfPosts": numOfPosts,
+		"mascotIds":  mascotIds,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if len(mascotIds) == 0 {
+		return nil, nil
+	}
+
+	query := mergedLinks(mascotIds, "T > ?") + `
+		ORDER BY T DESC, ` + c.PostId + ` DESC
+		LIMIT ?;`
+
+	return queryPostLinks(query, mascotArgs(mascotIds, c.DefaultTimestamp, numOfPosts)...)
+}
+
+/*
+Purpose : Page of several mascot queues merged, older than a cursor
+Input : The cursor's TimeOfCreation and PostId, the mascots and page size
+Outputs : Up to numOfPosts links, newest first, each post once
+Remark : See GetMergedTopPosts
+*/
+func (s *DbStore) GetMergedPostsBeforeCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetMergedPostsBeforeCursor"
+	log.WithFields(log.Fields{
+		"timestamp":  timestamp,
+		"postId":     postId,
+		"numOfPosts": numOfPosts,
+		"mascotIds":  mascotIds,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if len(mascotIds) == 0 {
+		return nil, nil
+	}
+
+	query := mergedLinks(mascotIds, "(T < ? OR (T = ? AND "+c.PostId+" < ?))") + `
+		ORDER BY T DESC, ` + c.PostId + ` DESC
+		LIMIT ?;`
+
+	return queryPostLinks(query, mascotArgs(mascotIds, timestamp, timestamp, postId, numOfPosts)...)
+}
+
+/*
+Purpose : Page of several mascot queues merged, newer than a cursor
+Input : The cursor's TimeOfCreation and PostId, the mascots and page size
+Outputs : The numOfPosts links closest to the cursor, newest first, each post once
+Remark : See GetMergedTopPosts
+*/
+func (s *DbStore) GetMergedPostsAfterCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetMergedPostsAfterCursor"
+	log.WithFields(log.Fields{
+		"timestamp":  timestamp,
+		"postId":     postId,
+		"numOfPosts": numOfPosts,
+		"mascotIds":  mascotIds,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if len(mascotIds) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + c.PostId + `, T
+		FROM (` + mergedLinks(mascotIds, "(T > ? OR (T = ? AND "+c.PostId+" > ?))") + `
+		ORDER BY T, ` + c.PostId + `
+		LIMIT ? )
+		AS M ORDER BY T DESC, ` + c.PostId + ` DESC;`
+
+	return queryPostLinks(query, mascotArgs(mascotIds, timestamp, timestamp, postId, numOfPosts)...)
+}
+
+/*
+Purpose : Queues a post in a mascot feed
+Input : mascot, post, when the link goes live and when it expires, 0 for never
+Outputs : error if any
+Remark : The link is placed in the queue at publishAt, which is stored as its TimeOfCreation
+*/
+func (s *DbStore) PostLink(mascotId int, postId string, publishAt int64, expireAt int64) error {
 	var funcName = "datastore/post.go:PostLink"
+	log.WithFields(log.Fields{
+		"mascotId":  mascotId,
+		"postId":    postId,
+		"publishAt": publishAt,
+		"expireAt":  expireAt,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := insertQuery(c.PostQueueTable, c.TimeOfCreation, c.PostId, c.MascotId, c.ExpireAt)
+
+	_, err := execQuery(db, query, publishAt, postId, mascotId, expireAt)
+	return err
+}
+
+/*
+Purpose : Lists what is yet to happen in a mascot queue
+Input : mascot and the current time
+Outputs : links to be published or to expire after now, by time of publishing
+Remark :
+*/
+func (s *DbStore) GetScheduledPostLinks(mascotId int, now int64) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetScheduledPostLinks"
+	log.WithFields(log.Fields{
+		"mascotId": mascotId,
+		"now":      now,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s
+		WHERE %s = ?
+		AND (%s > ? OR %s > ?)
+		ORDER BY %s, %s;`,
+		strings.Join(postLinkColumns, ", "),
+		c.PostQueueTable,
+		c.MascotId,
+		c.TimeOfCreation, c.ExpireAt,
+		c.TimeOfCreation, c.PostId)
+
+	return scanPostLinks(query, mascotId, now, now)
+}
+
+/*
+Purpose : Removes a post from a mascot queue
+Input : mascot and post
+Outputs : error if any, sql.ErrNoRows when the post is not in the queue
+Remark :
+*/
+func (s *DbStore) UnlinkPost(mascotId int, postId string) error {
+	var funcName = "datastore/post.go:UnlinkPost"
+	log.WithFields(log.Fields{
+		"mascotId": mascotId,
+		"postId":   postId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ? AND %s = ?",
+		c.PostQueueTable, c.MascotId, c.PostId)
+
+	return execOne(query, mascotId, postId)
+}
+
+/*
+Purpose : Moves a post to another place in a mascot queue
+Input : mascot, post and its new time in the queue
+Outputs : error if any, sql.ErrNoRows when the post is not in the queue
+Remark : The queue is ordered by TimeOfCreation, see feed.Move for picking the time of a position
+*/
+func (s *DbStore) MovePostLink(mascotId int, postId string, timestamp int64) error {
+	var funcName = "datastore/post.go:MovePostLink"
+	log.WithFields(log.Fields{
+		"mascotId":  mascotId,
+		"postId":    postId,
+		"timestamp": timestamp,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	return updatePostLink(c.TimeOfCreation, timestamp, mascotId, postId)
+}
+
+/*
+Purpose : Pins a post to the top of a mascot feed or unpins it
+Input : mascot, post, and the time of pinning or 0 to unpin
+Outputs : error if any, sql.ErrNoRows when the post is not in the queue
+Remark : Unpinned posts go back to their place in the queue
+*/
+func (s *DbStore) PinPostLink(mascotId int, postId string, pinnedAt int64) error {
+	var funcName = "datastore/post.go:PinPostLink"
 	log.WithFields(log.Fields{
 		"mascotId": mascotId,
 		"postId":   postId,
+		"pinnedAt": pinnedAt,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	return updatePostLink(c.PinnedAt, pinnedAt, mascotId, postId)
+}
+
+/*
+Purpose : Pinned posts of mascots
+Input : the mascots
+Outputs : the live pinned links, last pinned first, each post once
+Remark :
+*/
+func (s *DbStore) GetPinnedPostLinks(mascotIds []int) ([]types.PostLink, error) {
+	var funcName = "datastore/post.go:GetPinnedPostLinks"
+	log.WithFields(log.Fields{
+		"mascotIds": mascotIds,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	timeOfCreation := time.Now().UTC().UnixNano()
+	if len(mascotIds) == 0 {
+		return nil, nil
+	}
 
 	query := fmt.Sprintf(`
-		INSERT INTO %s(%s, %s, %s)
-		VALUES(%d,'%s',%d);`,
-		c.PostQueueTable, c.TimeOfCreation, c.PostId, c.MascotId,
-		timeOfCreation, postId, mascotId)
-	lh.Mysql.Query(query)
+		SELECT %s
+		FROM %s
+		WHERE %s IN (%s)
+		AND %s
+		AND %s > 0
+		ORDER BY %s DESC, %s DESC;`,
+		strings.Join(postLinkColumns, ", "),
+		c.PostQueueTable,
+		c.MascotId, placeholders(len(mascotIds)),
+		liveLinks,
+		c.PinnedAt,
+		c.PinnedAt, c.PostId)
 
-	stmt, err := db.Prepare(query)
+	links, err := scanPostLinks(query, mascotArgs(mascotIds)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// A post pinned for several mascots is kept at its last pinning
+	seen := make(map[string]bool)
+	pinned := []types.PostLink{}
+	for _, l := range links {
+		if !seen[l.PostId] {
+			seen[l.PostId] = true
+			pinned = append(pinned, l)
+		}
+	}
+	return pinned, nil
+}
+
+// updatePostLink sets one column of a link and returns sql.ErrNoRows when
+// there is no such link
+func updatePostLink(col string, value interface{}, mascotId int, postId string) error {
+	query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?",
+		c.PostQueueTable, col, c.MascotId, c.PostId)
+
+	res, err := execQuery(db, query, value, mascotId, postId)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec()
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
 
-	return err
+	// mysql only counts the rows changed, the value may have been set already
+	var count int
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ? AND %s = ?",
+		c.PostQueueTable, c.MascotId, c.PostId)
+	if err := scanRow(query, []interface{}{mascotId, postId}, &count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// execOne runs a delete expected to remove a row and returns sql.ErrNoRows
+// when none matched
+func execOne(query string, args ...interface{}) error {
+	res, err := execQuery(db, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func GetPostLinks(mascotId int) ([]types.PostLink, error) {
+func (s *DbStore) GetPostLinks(mascotId int) ([]types.PostLink, error) {
 
 	var funcName = "datastore/post.go:GetPostLinks"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select * from %s where %s=%d", c.PostQueueTable, c.MascotId, mascotId)
-	lh.Mysql.Query(query)
+	query := selectQuery(c.PostQueueTable, postLinkColumns, c.MascotId)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	return scanPostLinks(query, mascotId)
+}
 
-	rows, err := stmt.Query()
+// scanPostLinks runs a PostQueue query selecting postLinkColumns
+func scanPostLinks(query string, args ...interface{}) ([]types.PostLink, error) {
+	rows, err := queryRows(query, args...)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -227,7 +639,7 @@ func GetPostLinks(mascotId int) ([]types.PostLink, error) {
 
 	for rows.Next() {
 		var postLink types.PostLink
-		if err = rows.Scan(&postLink.TimeOfCreation, &postLink.PostId, &postLink.MascotId); err != nil {
+		if err = rows.Scan(&postLink.TimeOfCreation, &postLink.PostId, &postLink.MascotId, &postLink.ExpireAt, &postLink.PinnedAt); err != nil {
 			lh.Mysql.ScanError(err)
 			continue
 		}
@@ -238,10 +650,9 @@ func GetPostLinks(mascotId int) ([]types.PostLink, error) {
 		return nil, err
 	}
 	return postLinks, nil
-
 }
 
-func AddPost(p types.Post) (string, error) {
+func (s *DbStore) AddPost(p types.Post) (string, error) {
 	var funcName = "datastore/post.go:AddPost"
 	log.WithFields(log.Fields{
 		"cardType":   p.CardType,
@@ -254,17 +665,20 @@ func AddPost(p types.Post) (string, error) {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return "", err
 	}
 	defer session.Close()
 
-	c := session.DB(c.DbName).C(c.Collection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
 
 	p.Id = bson.NewObjectId()
 	p.TimeOfCreation = time.Now().UTC().UnixNano()
+	if p.Status == "" {
+		p.Status = published
+	}
 
 	if err := c.Insert(&p); err != nil {
 		lh.Mongo.WriteError(err)
@@ -275,7 +689,7 @@ func AddPost(p types.Post) (string, error) {
 	return p.Id.Hex(), nil
 }
 
-func GetPostMetaData(postId string) (*types.Post, error) {
+func (s *DbStore) GetPostMetaData(postId string) (*types.Post, error) {
 	var funcName = "datastore/post.go:GetPostMetaData"
 	log.WithFields(log.Fields{
 		"postId": postId,
@@ -284,7 +698,7 @@ func GetPostMetaData(postId string) (*types.Post, error) {
 
 	var result types.Post
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return nil, err
@@ -298,7 +712,7 @@ func GetPostMetaData(postId string) (*types.Post, error) {
 		return nil, errors.New("Invalid postId")
 	}
 
-	c := session.DB(c.DbName).C(c.Collection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
 	if err := c.Find(bson.M{"_id": bson.ObjectIdHex(postId)}).One(&result); err != nil {
 		lh.Mongo.ReadError(err)
 		return nil, err
@@ -308,25 +722,67 @@ func GetPostMetaData(postId string) (*types.Post, error) {
 
 }
 
-func GetPosts() (*[]types.Post, error) {
+/*
+Purpose : Fetches many posts in a single mongo query
+Input : Ids of the posts
+Outputs : The posts found, in no particular order
+Remark : Invalid and unknown ids are left out, callers compare the result with postIds
+*/
+func (s *DbStore) GetPostsByIds(postIds []string) ([]types.Post, error) {
+	var funcName = "datastore/post.go:GetPostsByIds"
+	log.WithFields(log.Fields{
+		"numOfPosts": len(postIds),
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	// Calling bson.ObjectIdHex will panic if it's invalid
+	var ids []bson.ObjectId
+	for _, postId := range postIds {
+		d, err := hex.DecodeString(postId)
+		if err != nil || len(d) != 12 {
+			log.Debugf("Skipping invalid postId: %s", postId)
+			continue
+		}
+		ids = append(ids, bson.ObjectIdHex(postId))
+	}
+
+	result := []types.Post{}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := c.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	log.Debugf("Retrieved %d of %d posts", len(result), len(postIds))
+	return result, nil
+}
+
+func (s *DbStore) GetPosts() (*[]types.Post, error) {
 	var funcName = "datastore/post.go:GetPosts"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
 	var result []types.Post
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return nil, err
 	}
 	defer session.Close()
 
-	// Calling bson.ObjectIdHex will panic if it's invalid.
-	// To avoid that I am making validation checks here
-
-	c := session.DB(c.DbName).C(c.Collection)
-	if err := c.Find(nil).All(&result); err != nil {
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := c.Find(bson.M{"status": bson.M{"$ne": deleted}}).All(&result); err != nil {
 		lh.Mongo.ReadError(err)
 		return nil, err
 	}
@@ -335,8 +791,141 @@ func GetPosts() (*[]types.Post, error) {
 
 }
 
-func DeletePost(postId string) error {
+/*
+Purpose : Replaces the content of a post
+Input : the post with its new values, Id and EditedBy set
+Outputs : error if any, mgo.ErrNotFound when the post does not exist
+Remark : TimeOfCreation is kept and TimeOfEdit set to now
+*/
+func (s *DbStore) UpdatePost(p types.Post) error {
+	var funcName = "datastore/post.go:UpdatePost"
+	log.WithFields(log.Fields{
+		"postId":   p.Id.Hex(),
+		"cardType": p.CardType,
+		"title":    p.Title,
+		"editedBy": p.EditedBy,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+
+	// mgo stores the fields lowercased
+	err = c.UpdateId(p.Id, bson.M{"$set": bson.M{
+		"cardtype":      p.CardType,
+		"src":           p.Src,
+		"dpsrc":         p.DpSrc,
+		"title":         p.Title,
+		"description":   p.Description,
+		"url":           p.Url,
+		"buttontext":    p.ButtonText,
+		"childposts":    p.ChildPosts,
+		"gradientstart": p.GradientStart,
+		"gradientend":   p.GradientEnd,
+		"icon":          p.Icon,
+		"poster":        p.Poster,
+		"duration":      p.Duration,
+		"media":         p.Media,
+		"productid":     p.ProductId,
+		"saleid":        p.SaleId,
+		"options":       p.Options,
+		"closesat":      p.ClosesAt,
+		"editedby":      p.EditedBy,
+		"timeofedit":    time.Now().UTC().UnixNano(),
+	}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *DbStore) GetParentPosts(postId string) ([]types.Post, error) {
+	var funcName = "datastore/post.go:GetParentPosts"
+	log.WithFields(log.Fields{
+		"postId": postId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	result := []types.Post{}
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := c.Find(bson.M{"childposts": postId}).All(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+Purpose : Moves a post to the trash
+Input : the post and the user deleting it
+Outputs : error if any, mgo.ErrNotFound when the post does not exist or is already in the trash
+Remark : The post keeps its links so that restoring it puts it back in its queues
+*/
+func (s *DbStore) DeletePost(postId string, deletedBy int) error {
 	var funcName = "datastore/post.go:DeletePost"
+	log.WithFields(log.Fields{
+		"postId":    postId,
+		"deletedBy": deletedBy,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	d, err := hex.DecodeString(postId)
+	if err != nil || len(d) != 12 {
+		return errors.New("Invalid postId")
+	}
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+
+	var old types.Post
+	err = c.Find(bson.M{
+		"_id":    bson.ObjectIdHex(postId),
+		"status": bson.M{"$ne": deleted},
+	}).One(&old)
+	if err != nil {
+		lh.Mongo.ReadError(err)
+		return err
+	}
+
+	// Matching the status read makes a concurrent change fail the delete
+	err = c.Update(bson.M{
+		"_id":    old.Id,
+		"status": statusIs(old.Status),
+	}, bson.M{"$set": bson.M{
+		"status":         deleted,
+		"deletedstatus":  old.Status,
+		"deletedby":      deletedBy,
+		"timeofdeletion": time.Now().UTC().UnixNano(),
+	}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *DbStore) RestorePost(postId string) error {
+	var funcName = "datastore/post.go:RestorePost"
 	log.WithFields(log.Fields{
 		"postId": postId,
 	}).Debugf("Enter: %s", funcName)
@@ -346,42 +935,271 @@ func DeletePost(postId string) error {
 	if err != nil || len(d) != 12 {
 		return errors.New("Invalid postId")
 	}
-	session, err := mgo.Dial(c.Server)
+
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return err
 	}
 	defer session.Close()
 
-	c := session.DB(c.DbName).C(c.Collection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
 
-	if err := c.Remove(bson.M{"_id": bson.ObjectIdHex(postId)}); err != nil {
-		lh.Mongo.RemoveError(err)
+	var old types.Post
+	err = c.Find(bson.M{
+		"_id":    bson.ObjectIdHex(postId),
+		"status": deleted,
+	}).One(&old)
+	if err != nil {
+		lh.Mongo.ReadError(err)
+		return err
+	}
+	// Posts deleted before statuses were kept are published
+	status := old.DeletedStatus
+	if status == "" {
+		status = published
+	}
+
+	err = c.Update(bson.M{
+		"_id":    old.Id,
+		"status": deleted,
+	}, bson.M{"$set": bson.M{
+		"status":         status,
+		"deletedstatus":  "",
+		"deletedby":      0,
+		"timeofdeletion": 0,
+	}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
 		return err
 	}
 	return nil
 }
 
-func GetPostsMetaData(postLinks []types.PostLink) ([]types.Post, error) {
-	var funcName = "datastore/post.go:GetPostsMetaData"
+func (s *DbStore) GetDeletedPosts() ([]types.Post, error) {
+	var funcName = "datastore/post.go:GetDeletedPosts"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	result := []types.Post{}
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := c.Find(bson.M{"status": deleted}).Sort("-timeofdeletion").All(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+Purpose : Empties the trash of the posts deleted before a time
+Input : time in UnixNano
+Outputs : Ids of the posts removed
+Remark : Their links are removed from every queue, their ids from the list cards having them as children, and their revisions, poll votes, likes, saves, views and comments with them
+*/
+func (s *DbStore) PurgePosts(deletedBefore int64) ([]string, error) {
+	var funcName = "datastore/post.go:PurgePosts"
 	log.WithFields(log.Fields{
-		"postLinks": postLinks,
+		"deletedBefore": deletedBefore,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
-	allPostMetaData := []types.Post{}
-	// For above reason, looping in reverse order will solve
-	for _, postLink := range postLinks {
-		log.Debugf("Looping over MascotPosts, current item: %v", postLink)
-		postData, err := GetPostMetaData(postLink.PostId)
-		if err != nil {
-			log.WithField("ErrMsg", err.Error()).Error("Failed to get post data from DB. Continueing")
-			continue
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	postQueue, pollVotes, engagement, comments := c.PostQueueTable, c.PollVoteTable, c.EngagementTable, c.CommentTable
+	postId, revisions := c.PostId, c.RevisionCollection
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+
+	selector := bson.M{
+		"status":         deleted,
+		"timeofdeletion": bson.M{"$lt": deletedBefore},
+	}
+	var found []types.Post
+	if err := c.Find(selector).Select(bson.M{"_id": 1}).All(&found); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	ids := []bson.ObjectId{}
+	postIds := []string{}
+	for _, p := range found {
+		ids = append(ids, p.Id)
+		postIds = append(postIds, p.Id.Hex())
+	}
+	if len(postIds) == 0 {
+		return postIds, nil
+	}
+
+	// Links first, a failure leaves the posts in the trash for the next purge
+	args := make([]interface{}, len(postIds))
+	for i, id := range postIds {
+		args[i] = id
+	}
+	unqueue := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", postQueue, postId, placeholders(len(postIds)))
+	if _, err := execQuery(db, unqueue, args...); err != nil {
+		return nil, err
+	}
+	for _, table := range []string{pollVotes, engagement, comments} {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", table, postId, placeholders(len(postIds)))
+		if _, err := execQuery(db, query, args...); err != nil {
+			return nil, err
 		}
+	}
+
+	_, err = c.UpdateAll(bson.M{"childposts": bson.M{"$in": postIds}},
+		bson.M{"$pull": bson.M{"childposts": bson.M{"$in": postIds}}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
+		return nil, err
+	}
+
+	if _, err := c.RemoveAll(bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		lh.Mongo.RemoveError(err)
+		return nil, err
+	}
+	_, err = session.DB(config.Get().Mongo.DbName).C(revisions).RemoveAll(bson.M{"postid": bson.M{"$in": postIds}})
+	if err != nil {
+		lh.Mongo.RemoveError(err)
+		return nil, err
+	}
+	log.Infof("Purged %d posts from the trash", len(postIds))
+	return postIds, nil
+}
+
+func (s *DbStore) SubmitPost(postId string) error {
+	var funcName = "datastore/post.go:SubmitPost"
+	log.WithFields(log.Fields{
+		"postId": postId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	d, err := hex.DecodeString(postId)
+	if err != nil || len(d) != 12 {
+		return errors.New("Invalid postId")
+	}
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+
+	err = c.Update(bson.M{
+		"_id":    bson.ObjectIdHex(postId),
+		"status": bson.M{"$in": []string{draft, rejected}},
+	}, bson.M{"$set": bson.M{
+		"status":           submitted,
+		"timeofsubmission": time.Now().UTC().UnixNano(),
+	}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
 
-		postData.TimeOfLink = postLink.TimeOfCreation
-		allPostMetaData = append(allPostMetaData, *postData)
+/*
+Purpose : Records the review of a submitted post
+Input : the post, Published or Rejected, the admin reviewing it and a comment for the writer
+Outputs : error if any, mgo.ErrNotFound when the post does not exist or is not submitted
+Remark :
+*/
+func (s *DbStore) ReviewPost(postId string, status string, reviewedBy int, comment string) error {
+	var funcName = "datastore/post.go:ReviewPost"
+	log.WithFields(log.Fields{
+		"postId":     postId,
+		"status":     status,
+		"reviewedBy": reviewedBy,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	d, err := hex.DecodeString(postId)
+	if err != nil || len(d) != 12 {
+		return errors.New("Invalid postId")
 	}
 
-	log.Debugf("Selected posts = %+v", allPostMetaData)
-	return allPostMetaData, nil
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+
+	err = c.Update(bson.M{
+		"_id":    bson.ObjectIdHex(postId),
+		"status": submitted,
+	}, bson.M{"$set": bson.M{
+		"status":        status,
+		"reviewedby":    reviewedBy,
+		"timeofreview":  time.Now().UTC().UnixNano(),
+		"reviewcomment": comment,
+	}})
+	if err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *DbStore) GetSubmittedPosts() ([]types.Post, error) {
+	var funcName = "datastore/post.go:GetSubmittedPosts"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	result := []types.Post{}
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	if err := c.Find(bson.M{"status": submitted}).Sort("timeofsubmission").All(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *DbStore) GetPostsCreatedBy(userId int) ([]types.Post, error) {
+	var funcName = "datastore/post.go:GetPostsCreatedBy"
+	log.WithFields(log.Fields{
+		"userId": userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	result := []types.Post{}
+	c := session.DB(config.Get().Mongo.DbName).C(c.Collection)
+	err = c.Find(bson.M{
+		"createdby": userId,
+		"status":    bson.M{"$ne": deleted},
+	}).Sort("-timeofcreation").All(&result)
+	if err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
 }
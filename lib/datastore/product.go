@@ -11,6 +11,7 @@ import (
 	c "rob/lib/common/constants"
 	lh "rob/lib/common/loghelper"
 	"rob/lib/common/types"
+	"rob/lib/config"
 	"time"
 )
 
@@ -21,7 +22,7 @@ Outputs : error if any
 Remark :
 */
 
-func AddProduct(newProduct types.Product) error {
+func (s *DbStore) AddProduct(newProduct types.Product) error {
 
 	var funcName = "datastore/product.go:AddProduct"
 	log.WithFields(log.Fields{
@@ -39,7 +40,7 @@ func AddProduct(newProduct types.Product) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return err
@@ -47,7 +48,7 @@ func AddProduct(newProduct types.Product) error {
 	defer session.Close()
 	newProduct.TimeOfCreation = time.Now().UTC().UnixNano()
 
-	c := session.DB(c.DbName).C(c.ProductCollection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
 
 	if err := c.Insert(&newProduct); err != nil {
 		lh.Mongo.WriteError(err)
@@ -66,7 +67,7 @@ Outputs : a product object pointer
 Remark :
 */
 
-func GetProduct(productId string) (*types.Product, error) {
+func (s *DbStore) GetProduct(productId string) (*types.Product, error) {
 
 	var funcName = "datastore/product.go:GetProduct"
 	log.WithFields(log.Fields{
@@ -76,7 +77,7 @@ func GetProduct(productId string) (*types.Product, error) {
 
 	var result types.Product
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return nil, err
@@ -90,7 +91,7 @@ func GetProduct(productId string) (*types.Product, error) {
 		return nil, errors.New("Invalid productId")
 	}
 
-	c := session.DB(c.DbName).C(c.ProductCollection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
 	if err := c.Find(bson.M{"_id": bson.ObjectIdHex(productId)}).One(&result); err != nil {
 		lh.Mongo.ReadError(err)
 		return nil, err
@@ -100,21 +101,82 @@ func GetProduct(productId string) (*types.Product, error) {
 
 }
 
-func IsProductInStock(productId string) (bool, error) {
+/*
+Purpose : Removes a product listing from mongo
+Input : ProductId
+Outputs : error if any, mgo.ErrNotFound when there is no such product
+Remark : Orders keep their copy of its title and thumbnail
+*/
+func (s *DbStore) DeleteProduct(productId string) error {
+	var funcName = "datastore/product.go:DeleteProduct"
+	log.WithFields(log.Fields{
+		"productId": productId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if !bson.IsObjectIdHex(productId) {
+		return errors.New("Invalid productId")
+	}
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
+	if err := c.RemoveId(bson.ObjectIdHex(productId)); err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+/*
+Purpose : Retrives the product listed under a sku from mongo
+Input : Sku
+Outputs : a product object pointer
+Remark : mgo.ErrNotFound if there is none
+*/
+func (s *DbStore) GetProductBySku(sku string) (*types.Product, error) {
+	var funcName = "datastore/product.go:GetProductBySku"
+	log.WithFields(log.Fields{
+		"sku": sku,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	var result types.Product
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
+	if err := c.Find(bson.M{"sku": sku}).One(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *DbStore) IsProductInStock(productId string) (bool, error) {
 	var funcName = "datastore/common.go:IsProductInStock"
 	log.WithFields(log.Fields{
 		"productId": productId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return false, err
 	}
 	defer session.Close()
 
-	c := session.DB(c.DbName).C(c.ProductCollection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
 	var result types.Product
 	if err := c.Find(bson.M{"_id": bson.ObjectIdHex(productId)}).One(&result); err != nil {
 		lh.Mongo.ReadError(err)
@@ -128,20 +190,20 @@ func IsProductInStock(productId string) (bool, error) {
 	}
 }
 
-func IncrementStock(productId string) error {
+func (s *DbStore) IncrementStock(productId string) error {
 	var funcName = "datastore/common.go:IncrementStock"
 	log.WithFields(log.Fields{
 		"productId": productId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return err
 	}
 	defer session.Close()
-	c := session.DB(c.DbName).C(c.ProductCollection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
 	change := mgo.Change{
 		Update:    bson.M{"$inc": bson.M{"quantity": 1}},
 		ReturnNew: true,
@@ -156,20 +218,20 @@ func IncrementStock(productId string) error {
 
 }
 
-func DecrementStock(productId string) error {
+func (s *DbStore) DecrementStock(productId string) error {
 	var funcName = "datastore/common.go:DecrementStock"
 	log.WithFields(log.Fields{
 		"productId": productId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
-	session, err := mgo.Dial(c.Server)
+	session, err := MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return err
 	}
 	defer session.Close()
 
-	c := session.DB(c.DbName).C(c.ProductCollection)
+	c := session.DB(config.Get().Mongo.DbName).C(c.ProductCollection)
 	change := mgo.Change{
 		Update:    bson.M{"$inc": bson.M{"quantity": -1}},
 		ReturnNew: true,
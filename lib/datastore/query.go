@@ -0,0 +1,98 @@
+// Helpers to build and run mysql statements
+// Values are never formatted into the query text. They are always bound to
+// ? placeholders and sent separately to the server, so quotes, backslashes
+// etc in user input can neither break a statement nor inject sql.
+// Only table and column names (which come from the constants package) are
+// formatted into queries.
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	lh "rob/lib/common/loghelper"
+)
+
+// Satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// placeholders returns n comma separated ? placeholders
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// assignments returns "col1=?,col2=?" for the given columns
+func assignments(cols ...string) string {
+	a := make([]string, len(cols))
+	for i, col := range cols {
+		a[i] = col + "=?"
+	}
+	return strings.Join(a, ",")
+}
+
+// insertQuery returns "INSERT INTO table(col1,col2) VALUES(?,?)"
+func insertQuery(table string, cols ...string) string {
+	return fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)",
+		table, strings.Join(cols, ","), placeholders(len(cols)))
+}
+
+// updateQuery returns "UPDATE table SET col1=?,col2=? WHERE where=?"
+func updateQuery(table string, cols []string, where string) string {
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s=?",
+		table, assignments(cols...), where)
+}
+
+// deleteQuery returns "DELETE FROM table WHERE where=?"
+func deleteQuery(table string, where string) string {
+	return fmt.Sprintf("DELETE FROM %s WHERE %s=?", table, where)
+}
+
+// selectQuery returns "SELECT col1,col2 FROM table WHERE where=?".
+// The WHERE clause is left out when where is empty
+func selectQuery(table string, cols []string, where string) string {
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ","), table)
+	if where != "" {
+		query = fmt.Sprintf("%s WHERE %s=?", query, where)
+	}
+	return query
+}
+
+// execQuery runs a statement on ldb with args bound to its placeholders
+func execQuery(ldb execer, query string, args ...interface{}) (sql.Result, error) {
+	lh.Mysql.Query(query)
+
+	res, err := ldb.Exec(query, args...)
+	if err != nil {
+		lh.Mysql.ExecError(err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// queryRows runs a select with args bound to its placeholders.
+// Caller has to close the returned rows
+func queryRows(query string, args ...interface{}) (*sql.Rows, error) {
+	lh.Mysql.Query(query)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		lh.Mysql.ExecError(err)
+		return nil, err
+	}
+	return rows, nil
+}
+
+// scanRow runs a select with args bound to its placeholders and scans the
+// first row into dest. Returns sql.ErrNoRows when nothing matched.
+// Scan errors are left to the caller to log since some of them are expected
+func scanRow(query string, args []interface{}, dest ...interface{}) error {
+	lh.Mysql.Query(query)
+
+	return db.QueryRow(query, args...).Scan(dest...)
+}
@@ -0,0 +1,26 @@
+package datastore
+
+import "testing"
+
+func TestQueryBuilders(t *testing.T) {
+	tests := []struct {
+		got      string
+		expected string
+	}{
+		{placeholders(0), ""},
+		{placeholders(1), "?"},
+		{placeholders(3), "?,?,?"},
+		{assignments("A", "B"), "A=?,B=?"},
+		{insertQuery("T", "A", "B", "C"), "INSERT INTO T(A,B,C) VALUES(?,?,?)"},
+		{updateQuery("T", []string{"A", "B"}, "Id"), "UPDATE T SET A=?,B=? WHERE Id=?"},
+		{deleteQuery("T", "Id"), "DELETE FROM T WHERE Id=?"},
+		{selectQuery("T", []string{"A", "B"}, "Id"), "SELECT A,B FROM T WHERE Id=?"},
+		{selectQuery("T", []string{"*"}, ""), "SELECT * FROM T"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.expected {
+			t.Errorf("Query build failed. Expected=%q but received=%q", test.expected, test.got)
+		}
+	}
+}
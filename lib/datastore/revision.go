@@ -0,0 +1,118 @@
+// All the database requests related to the history of posts go here
+package datastore
+
+import (
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Two revisions can't share a number, a concurrent change of the post
+// takes the next one
+var revisionIndex = mgo.Index{
+	Key:    []string{"postid", "number"},
+	Unique: true,
+}
+
+/*
+Purpose : Records a change to a post
+Input : the revision, its Id, Number and TimeOfCreation are set here
+Outputs : Number of the revision and error if any
+Remark : Numbers follow the last revision of the post. On a clash with a concurrent change the next number is tried
+*/
+func (s *DbStore) AddRevision(r types.Revision) (int, error) {
+	var funcName = "datastore/revision.go:AddRevision"
+	log.WithFields(log.Fields{
+		"postId": r.PostId,
+		"author": r.Author,
+		"change": r.Change,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return 0, err
+	}
+	defer session.Close()
+
+	c := session.DB(config.Get().Mongo.DbName).C(c.RevisionCollection)
+	if err := c.EnsureIndex(revisionIndex); err != nil {
+		lh.Mongo.WriteError(err)
+		return 0, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var last types.Revision
+		err := c.Find(bson.M{"postid": r.PostId}).Sort("-number").One(&last)
+		if err != nil && err != mgo.ErrNotFound {
+			lh.Mongo.ReadError(err)
+			return 0, err
+		}
+
+		r.Id = bson.NewObjectId()
+		r.Number = last.Number + 1
+		r.TimeOfCreation = time.Now().UTC().UnixNano()
+		err = c.Insert(&r)
+		if err == nil {
+			return r.Number, nil
+		}
+		if !mgo.IsDup(err) || attempt == 2 {
+			lh.Mongo.WriteError(err)
+			return 0, err
+		}
+	}
+}
+
+func (s *DbStore) GetRevisions(postId string) ([]types.Revision, error) {
+	var funcName = "datastore/revision.go:GetRevisions"
+	log.WithFields(log.Fields{
+		"postId": postId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	result := []types.Revision{}
+	c := session.DB(config.Get().Mongo.DbName).C(c.RevisionCollection)
+	if err := c.Find(bson.M{"postid": postId}).Sort("number").All(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *DbStore) GetRevision(postId string, number int) (*types.Revision, error) {
+	var funcName = "datastore/revision.go:GetRevision"
+	log.WithFields(log.Fields{
+		"postId": postId,
+		"number": number,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	var result types.Revision
+	c := session.DB(config.Get().Mongo.DbName).C(c.RevisionCollection)
+	if err := c.Find(bson.M{"postid": postId, "number": number}).One(&result); err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return &result, nil
+}
@@ -20,27 +20,18 @@ Input : Sale object
 Outputs : saleId. error
 Remark :
 */
-func AddSale(newSale types.Sale) (int, error) {
+func (s *DbStore) AddSale(newSale types.Sale) (int, error) {
 	var funcName = "datastore/sale.go:AddSale"
 	log.WithFields(log.Fields{
 		"newSale": newSale,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
 	timeofCreation := time.Now().UTC().UnixNano()
-	query = fmt.Sprintf("INSERT INTO %s(%s,%s,%s,%s,%s,%s,%s,%s,%s) VALUES('%s','%s','%s','%s','%s',%d,%d,%d,%d);", c.SaleTable, c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime, c.TimeOfCreation, newSale.Title, newSale.Brand, newSale.ProductSku, newSale.Description, newSale.ThumbNail, newSale.StockUnits, newSale.SaleStartTime, newSale.SaleEndTime, timeofCreation)
-	lh.Mysql.Query(query)
+	query := insertQuery(c.SaleTable, c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime, c.TimeOfCreation)
 
-	stmt, err := db.Prepare(query)
+	res, err := execQuery(db, query, newSale.Title, newSale.Brand, newSale.ProductSku, newSale.Description, newSale.ThumbNail, newSale.StockUnits, newSale.SaleStartTime, newSale.SaleEndTime, timeofCreation)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return -1, err
-	}
-	defer stmt.Close()
-	res, err := stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
 		return -1, err
 	}
 
@@ -58,26 +49,17 @@ Input : saleId
 Outputs : a sale object and error if any
 Remark : Return a single sale entry
 */
-func GetSale(sId int) (*types.Sale, error) {
+func (s *DbStore) GetSale(sId int) (*types.Sale, error) {
 	var funcName = "datastore/sale.go:GetSale"
 	log.WithFields(log.Fields{
 		"salesId": sId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select Id,Title,Brand,ProductSku,Description,ThumbNail,StockUnits,SaleStartTime,SaleEndTime from Sale where Id = %d", sId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.SaleTable, []string{c.Id, c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime}, c.Id)
 
 	var sale types.Sale
-	err = stmt.QueryRow().Scan(&sale.Id, &sale.Title, &sale.Brand, &sale.ProductSku, &sale.Description, &sale.ThumbNail, &sale.StockUnits, &sale.SaleStartTime, &sale.SaleEndTime)
+	err := scanRow(query, []interface{}{sId}, &sale.Id, &sale.Title, &sale.Brand, &sale.ProductSku, &sale.Description, &sale.ThumbNail, &sale.StockUnits, &sale.SaleStartTime, &sale.SaleEndTime)
 
 	if err != nil {
 		lh.Mysql.ScanError(err)
@@ -94,25 +76,15 @@ Input : null
 Outputs : SaleList object
 Remark : wraps all sales into salelist
 */
-func GetSales() (*types.SalesList, error) {
+func (s *DbStore) GetSales() (*types.SalesList, error) {
 	var funcName = "datastore/sale.go:GetSales"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select Title,Brand,ProductSku,Description,ThumbNail,StockUnits,SaleStartTime,SaleEndTime from %s", c.SaleTable)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.SaleTable, []string{c.Title, c.Brand, c.ProductSku, c.Description, c.ThumbNail, c.StockUnits, c.SaleStartTime, c.SaleEndTime}, "")
 
-	rows, err := stmt.Query()
+	rows, err := queryRows(query)
 	if err != nil {
-		lh.Mysql.ExecError(err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -139,7 +111,7 @@ Input : saleid and the value to be incremeted
 Outputs : error if any
 Remark : To increment pass +ve value , to decrement pass -ve
 */
-func UpdateSaleStock(saleId int, value int) error {
+func (s *DbStore) UpdateSaleStock(saleId int, value int) error {
 	var funcName = "datastore/sale.go:UpdateSaleStock"
 	log.WithFields(log.Fields{
 		"saleId": saleId,
@@ -147,18 +119,10 @@ func UpdateSaleStock(saleId int, value int) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select %s from %s where Id = %d", c.StockUnits, c.SaleTable, saleId)
-	lh.Mysql.Query(query)
+	query := selectQuery(c.SaleTable, []string{c.StockUnits}, c.Id)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
 	var stock int
-	err = stmt.QueryRow().Scan(&stock)
+	err := scanRow(query, []interface{}{saleId}, &stock)
 
 	if err != nil {
 		lh.Mysql.ScanError(err)
@@ -167,24 +131,13 @@ func UpdateSaleStock(saleId int, value int) error {
 	if stock < 1 {
 		return errors.New("Product Out Of Stock")
 	}
-	query = fmt.Sprintf("UPDATE %s SET %s = %s + %d WHERE %s = %d ;", c.SaleTable, c.StockUnits, c.StockUnits, value, c.Id, saleId)
-	lh.Mysql.Query(query)
+	query = fmt.Sprintf("UPDATE %s SET %s = %s + ? WHERE %s = ?", c.SaleTable, c.StockUnits, c.StockUnits, c.Id)
 
-	stmt, err = db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
 	var mutex = &sync.Mutex{}
 	mutex.Lock()
-	_, err = stmt.Exec()
+	_, err = execQuery(db, query, value, saleId)
 	mutex.Unlock()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-	return nil
+	return err
 }
 
 /*
@@ -193,27 +146,18 @@ Input : saleid
 Outputs : Object of StatusResponse and error if any
 Remark : Return the  difference between the current time and the saleStartTime
 */
-func GetStatus(saleId int) (*types.StatusResponse, error) {
+func (s *DbStore) GetStatus(saleId int) (*types.StatusResponse, error) {
 	var funcName = "datastore/sale.go:GetStatus"
 	log.WithFields(log.Fields{
 		"saleId": saleId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	var query string
-	query = fmt.Sprintf("Select %s,%s from %s where Id = %d", c.SaleStartTime, c.StockUnits, c.SaleTable, saleId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.SaleTable, []string{c.SaleStartTime, c.StockUnits}, c.Id)
 
 	var status types.StatusResponse
 	var saleStartTime int64
-	err = stmt.QueryRow().Scan(&saleStartTime, &status.StockLeft)
+	err := scanRow(query, []interface{}{saleId}, &saleStartTime, &status.StockLeft)
 	if err != nil {
 		lh.Mysql.ScanError(err)
 		return nil, err
@@ -0,0 +1,186 @@
+// All the database requests related to searching posts and products go here
+package datastore
+
+import (
+	c "rob/lib/common/constants"
+	lh "rob/lib/common/loghelper"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"sort"
+	"strings"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Words in a title count more than those in the rest of the text. MemStore
+// ranks with the same weights
+var (
+	postSearchWeights = map[string]int{
+		"title":       10,
+		"description": 2,
+	}
+	productSearchWeights = map[string]int{
+		"title":       10,
+		"brand":       5,
+		"summary":     3,
+		"description": 1,
+	}
+)
+
+// searchIndex is the text index over the fields of weights. A collection
+// has at most one
+func searchIndex(weights map[string]int) mgo.Index {
+	var key []string
+	for field := range weights {
+		key = append(key, "$text:"+field)
+	}
+	sort.Strings(key)
+	return mgo.Index{
+		Key:     key,
+		Name:    "search",
+		Weights: weights,
+	}
+}
+
+// ensureSearchIndexes creates the text indexes SearchPosts and
+// SearchProducts need, when they are not there yet
+func ensureSearchIndexes(session *mgo.Session) error {
+	database := session.DB(config.Get().Mongo.DbName)
+	if err := database.C(c.Collection).EnsureIndex(searchIndex(postSearchWeights)); err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	if err := database.C(c.ProductCollection).EnsureIndex(searchIndex(productSearchWeights)); err != nil {
+		lh.Mongo.WriteError(err)
+		return err
+	}
+	return nil
+}
+
+/*
+Purpose : Finds the posts users get to see whose title or description match a query
+Input : the query, the card types wanted, all when empty, and the number of results to skip and return
+Outputs : the posts, best match first
+Remark : Mongo text search, so words are stemmed, stop words ignored, "phrases" must match whole and -words must not
+*/
+func (s *DbStore) SearchPosts(query string, cardTypes []int, skip int, limit int) ([]types.Post, error) {
+	var funcName = "datastore/search.go:SearchPosts"
+	log.WithFields(log.Fields{
+		"query":     query,
+		"cardTypes": cardTypes,
+		"skip":      skip,
+		"limit":     limit,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	filter := bson.M{
+		"$text":  bson.M{"$search": query},
+		"status": visibleStatus,
+	}
+	if len(cardTypes) > 0 {
+		filter["cardtype"] = bson.M{"$in": cardTypes}
+	}
+
+	result := []types.Post{}
+	err = session.DB(config.Get().Mongo.DbName).C(c.Collection).
+		Find(filter).
+		Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		Sort("$textScore:score", "-_id").
+		Skip(skip).
+		Limit(limit).
+		All(&result)
+	if err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+Purpose : Finds the products whose title, brand, summary or description match a query
+Input : the query, the brand wanted, any when empty, and the number of results to skip and return
+Outputs : the products, best match first
+Remark : Mongo text search as for SearchPosts. The brand must match exactly
+*/
+func (s *DbStore) SearchProducts(query string, brand string, skip int, limit int) ([]types.Product, error) {
+	var funcName = "datastore/search.go:SearchProducts"
+	log.WithFields(log.Fields{
+		"query": query,
+		"brand": brand,
+		"skip":  skip,
+		"limit": limit,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	session, err := MongoSession()
+	if err != nil {
+		lh.Mongo.ConnectError(err)
+		return nil, err
+	}
+	defer session.Close()
+
+	filter := bson.M{"$text": bson.M{"$search": query}}
+	if brand != "" {
+		filter["brand"] = brand
+	}
+
+	result := []types.Product{}
+	err = session.DB(config.Get().Mongo.DbName).C(c.ProductCollection).
+		Find(filter).
+		Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+		Sort("$textScore:score", "-_id").
+		Skip(skip).
+		Limit(limit).
+		All(&result)
+	if err != nil {
+		lh.Mongo.ReadError(err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// searchTerms are the distinct lower case words of a query
+func searchTerms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range searchWords(query) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchScore ranks text the way MemStore does, the weight of each field
+// for every word of it that is one of the terms. It is 0 when none match.
+// Unlike mongo there is no stemming, stop words, phrases or negation
+func searchScore(terms []string, weights map[string]int, fields map[string]string) int {
+	score := 0
+	for field, text := range fields {
+		for _, word := range searchWords(text) {
+			for _, term := range terms {
+				if word == term {
+					score += weights[field]
+				}
+			}
+		}
+	}
+	return score
+}
@@ -3,9 +3,7 @@ package datastore
 
 import (
 	"errors"
-	"fmt"
 	c "rob/lib/common/constants"
-	lh "rob/lib/common/loghelper"
 	"rob/lib/common/types"
 	"time"
 
@@ -20,7 +18,7 @@ Outputs : ShippingId and error if any
 Remark : To be included as a SQL Transaction along with other transactional functions
 */
 
-func PlaceOrder(ship types.Shipping) (int, error) {
+func (s *DbStore) PlaceOrder(ship types.Shipping) (int, error) {
 	var funcName = "datastore/shipping.go:PlaceOrder"
 	log.WithFields(log.Fields{
 		"shipping": ship,
@@ -29,20 +27,11 @@ func PlaceOrder(ship types.Shipping) (int, error) {
 
 	ship.TrackingId = c.Uninitiated
 	ship.ShippingStatus = c.Uninitiated
-	var query string
 	timeofCreation := time.Now().UTC().UnixNano()
-	query = fmt.Sprintf("INSERT INTO %s(%s,%s,%s,%s,%s,%s) VALUES(%d,%d,'%s',%d,'%s',%d);", c.ShippingTable, c.OrderId, c.UserId, c.TrackingId, c.AddressId, c.ShippingStatus, c.TimeOfCreation, ship.OrderId, ship.UserId, ship.TrackingId, ship.AddressId, ship.ShippingStatus, timeofCreation)
-	lh.Mysql.Query(query)
+	query := insertQuery(c.ShippingTable, c.OrderId, c.UserId, c.TrackingId, c.AddressId, c.ShippingStatus, c.TimeOfCreation)
 
-	stmt, err := db.Prepare(query)
+	res, err := execQuery(db, query, ship.OrderId, ship.UserId, ship.TrackingId, ship.AddressId, ship.ShippingStatus, timeofCreation)
 	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return -1, err
-	}
-	defer stmt.Close()
-	res, err := stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
 		return -1, err
 	}
 
@@ -0,0 +1,714 @@
+// Storage interfaces for everything the server persists.
+// DbStore is the MySQL/Mongo implementation and MemStore keeps everything
+// in process memory so that handlers can be tested without live databases.
+// The package level functions below always go through the current store,
+// which can be swapped with Use.
+package datastore
+
+import (
+	"rob/lib/common/types"
+)
+
+type UserStore interface {
+	AddUser(newUser types.User) error
+	UpdateUserDetails(user types.User) error
+	UpdateUserProfile(user types.User) error
+	GetUserByPhone(phone string) (*types.User, error)
+	GetUserByEmail(email string) (*types.User, error)
+	GetRole(userId int) (*int, error)
+	InsertRole(userId int, roleId int) error
+	UpdateRole(userId int, roleId int) error
+	UpdatePasswordResetToken(phone, token string) error
+	ResetPassword(phone, newPassword string) error
+	DeleteUserByEmail(email string) error
+	UpdateToken(userId int, token string) error
+}
+
+// PostStore covers the mongo posts collection and the mysql mascot queues
+type PostStore interface {
+	GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error)
+	GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error)
+	GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error)
+	// Keyset pages, rows sharing a TimeOfCreation are ordered by PostId
+	GetPostsBeforeCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error)
+	GetPostsAfterCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error)
+	// Pages of several queues merged. A post linked to more than one of
+	// the mascots appears once, at the time of its newest link
+	GetMergedTopPosts(numOfPosts int, mascotIds []int) ([]types.PostLink, error)
+	GetMergedPostsBeforeCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error)
+	GetMergedPostsAfterCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error)
+	// Only links published, not expired and not pinned are served by the
+	// queries above
+	PostLink(mascotId int, postId string, publishAt int64, expireAt int64) error
+	UnlinkPost(mascotId int, postId string) error
+	MovePostLink(mascotId int, postId string, timestamp int64) error
+	PinPostLink(mascotId int, postId string, pinnedAt int64) error
+	GetPinnedPostLinks(mascotIds []int) ([]types.PostLink, error)
+	GetPostLinks(mascotId int) ([]types.PostLink, error)
+	GetScheduledPostLinks(mascotId int, now int64) ([]types.PostLink, error)
+	AddPost(p types.Post) (string, error)
+	GetPostMetaData(postId string) (*types.Post, error)
+	// Posts found for postIds in any order. Invalid and unknown ids are
+	// left out
+	GetPostsByIds(postIds []string) ([]types.Post, error)
+	// Every post except those in the trash
+	GetPosts() (*[]types.Post, error)
+	// Replaces the content of a post, mgo.ErrNotFound if there is none
+	UpdatePost(p types.Post) error
+	// List cards having postId among their ChildPosts
+	GetParentPosts(postId string) ([]types.Post, error)
+	// Moves the post to the trash, mgo.ErrNotFound if there is no such post
+	// out of it. Its links stay for when it is restored
+	DeletePost(postId string, deletedBy int) error
+	// Takes the post out of the trash, back to the status it had.
+	// mgo.ErrNotFound if it is not there
+	RestorePost(postId string) error
+	// Posts in the trash, last deleted first
+	GetDeletedPosts() ([]types.Post, error)
+	// Removes for good the posts deleted before the time, their links from
+	// every queue, their ids from list cards and their revisions. Returns
+	// the ids removed
+	PurgePosts(deletedBefore int64) ([]string, error)
+	// Submits a draft or rejected post for review, mgo.ErrNotFound if there
+	// is no such post
+	SubmitPost(postId string) error
+	// Publishes or rejects a submitted post, mgo.ErrNotFound if there is no
+	// such post
+	ReviewPost(postId string, status string, reviewedBy int, comment string) error
+	// Posts waiting for review, first submitted first
+	GetSubmittedPosts() ([]types.Post, error)
+	// Posts created by the user out of the trash, newest first
+	GetPostsCreatedBy(userId int) ([]types.Post, error)
+}
+
+type MascotStore interface {
+	CreateMascot(m types.Mascot) (int, error)
+	GetMascot(mascotId int) (*types.Mascot, error)
+	GetMascots(includeRetired bool) ([]types.Mascot, error)
+	UpdateMascot(m types.Mascot) error
+	RetireMascot(mascotId int) error
+}
+
+// SubscriptionStore keeps the mascots each user follows
+type SubscriptionStore interface {
+	Subscribe(userId int, mascotId int) error
+	Unsubscribe(userId int, mascotId int) error
+	// Active mascots the user is subscribed to, ordered by Id
+	GetSubscriptions(userId int) ([]types.Mascot, error)
+}
+
+// RevisionStore keeps the history of the posts
+type RevisionStore interface {
+	// Adds r as the next revision of its post and returns its Number
+	AddRevision(r types.Revision) (int, error)
+	// Revisions of the post, oldest first
+	GetRevisions(postId string) ([]types.Revision, error)
+	// mgo.ErrNotFound if the post has no such revision
+	GetRevision(postId string, number int) (*types.Revision, error)
+}
+
+// PollStore keeps the votes on poll cards
+type PollStore interface {
+	// ErrAlreadyVoted if the user has voted on the poll
+	AddVote(postId string, userId int, option int) error
+	// Votes on each of the polls, with the option voted for by userId
+	GetPollTallies(postIds []string, userId int) (map[string]types.PollTally, error)
+	// Votes on the poll, oldest first
+	GetPollVotes(postId string) ([]types.PollVote, error)
+}
+
+// EngagementStore keeps the likes, saves and views of posts. A user counts
+// once for each kind on a post
+type EngagementStore interface {
+	// Doing it again changes nothing
+	AddEngagement(postId string, userId int, kind int) error
+	RemoveEngagement(postId string, userId int, kind int) error
+	// Records views of the posts by userId in one go
+	AddViews(userId int, postIds []string) error
+	// Counts for each of the posts, with the likes and saves of userId
+	GetEngagement(postIds []string, userId int) (map[string]types.Engagement, error)
+	// Posts saved by userId, last saved first
+	GetSavedPostIds(userId int) ([]string, error)
+}
+
+// CommentStore keeps the comments on posts
+type CommentStore interface {
+	// Returns the Id of the comment
+	AddComment(cm types.Comment) (int, error)
+	// sql.ErrNoRows if there is no such comment
+	GetComment(commentId int) (*types.Comment, error)
+	// Up to n visible comments replying to parentId, 0 for those on the
+	// post itself, with an Id after afterId. Oldest first
+	GetComments(postId string, parentId int, afterId int, n int) ([]types.Comment, error)
+	// Comments held for review, oldest first
+	GetHeldComments() ([]types.Comment, error)
+	// sql.ErrNoRows if there is no such comment
+	ModerateComment(commentId int, status string, moderatedBy int) error
+	// Removes the comment and the replies to it
+	DeleteComment(commentId int) error
+	// Visible comments on each of the posts, replies included
+	GetCommentCounts(postIds []string) (map[string]int, error)
+}
+
+// SearchStore finds posts and products by the words in their text, best
+// match first
+type SearchStore interface {
+	// Posts users get to see, of one of cardTypes unless it is empty
+	SearchPosts(query string, cardTypes []int, skip int, limit int) ([]types.Post, error)
+	// Products of brand unless it is empty
+	SearchProducts(query string, brand string, skip int, limit int) ([]types.Product, error)
+}
+
+// MediaStore keeps what is known of uploaded media, their content being in
+// the media storage
+type MediaStore interface {
+	// Adding media already there changes nothing
+	AddMedia(m types.Media) error
+	// mgo.ErrNotFound if there is no such media
+	GetMedia(mediaId string) (*types.Media, error)
+	// Whether a post, in the trash or not, a revision, a product or an
+	// order has a url of the media
+	MediaInUse(mediaId string) (bool, error)
+	// Deleting media that isn't there changes nothing
+	DeleteMedia(mediaId string) error
+}
+
+type ProductStore interface {
+	AddProduct(newProduct types.Product) error
+	GetProduct(productId string) (*types.Product, error)
+	// mgo.ErrNotFound if no product has the sku
+	GetProductBySku(sku string) (*types.Product, error)
+	// mgo.ErrNotFound if there is no such product
+	DeleteProduct(productId string) error
+	IsProductInStock(productId string) (bool, error)
+	IncrementStock(productId string) error
+	DecrementStock(productId string) error
+}
+
+type SaleStore interface {
+	AddSale(newSale types.Sale) (int, error)
+	GetSale(sId int) (*types.Sale, error)
+	GetSales() (*types.SalesList, error)
+	UpdateSaleStock(saleId int, value int) error
+	GetStatus(saleId int) (*types.StatusResponse, error)
+}
+
+type OrderStore interface {
+	CreateOrder(newOrder types.Order) (int, error)
+	GetOrder(oId int) (*types.Order, error)
+	GetUserOrders(userId int) (*types.OrdersList, error)
+}
+
+type AddressStore interface {
+	AddAddress(address types.Address) (int, error)
+	GetAddress(aId int) (*types.Address, error)
+	GetUserAddresses(userId int) (*types.AddressList, error)
+	EditAddress(addressId int, newAddress types.Address) error
+}
+
+type TransactionStore interface {
+	InitiateTransaction(trans types.Transaction, saleId int) (int, error)
+	UpdateSuccessTransaction(trans types.Transaction) error
+	GetTransaction(transId int) (*types.Transaction, error)
+}
+
+type ShippingStore interface {
+	PlaceOrder(ship types.Shipping) (int, error)
+}
+
+type FeedbackStore interface {
+	AddFeedback(ph, typ, desc string) error
+}
+
+type UrlCacheStore interface {
+	GetManifestEntries() ([]types.ManifestEntry, error)
+	PutManifestEntry(e types.ManifestEntry) (int64, error)
+	RemoveManifestEntry(url string) (int64, error)
+}
+
+// NotificationStore finds the devices of users and records the push
+// notifications sent to them
+type NotificationStore interface {
+	GetPushTokens(target string, targetId int) ([]types.PushToken, error)
+	ClearPushToken(userId int, token string) error
+	AddNotification(n types.Notification) (int, error)
+	UpdateNotification(n types.Notification) error
+	GetNotification(notificationId int) (*types.Notification, error)
+	AddDelivery(d types.Delivery) error
+	GetDeliveries(notificationId int) ([]types.Delivery, error)
+}
+
+// Store is the complete storage surface of the server
+type Store interface {
+	UserStore
+	PostStore
+	MascotStore
+	SubscriptionStore
+	RevisionStore
+	PollStore
+	EngagementStore
+	CommentStore
+	SearchStore
+	MediaStore
+	ProductStore
+	SaleStore
+	OrderStore
+	AddressStore
+	TransactionStore
+	ShippingStore
+	FeedbackStore
+	UrlCacheStore
+	NotificationStore
+
+	// Makes sure all the tables/collections needed are present
+	InitDb() error
+}
+
+// DbStore talks to the mysql instance opened by InitMySql and to the
+// mongo server in config.Get().Mongo
+type DbStore struct {
+}
+
+var store Store = &DbStore{}
+
+// Use replaces the store behind all the package level functions
+func Use(s Store) {
+	store = s
+}
+
+// Current returns the store in use
+func Current() Store {
+	return store
+}
+
+func InitDb() error {
+	return store.InitDb()
+}
+
+func AddUser(newUser types.User) error {
+	return store.AddUser(newUser)
+}
+
+func UpdateUserDetails(user types.User) error {
+	return store.UpdateUserDetails(user)
+}
+
+func UpdateUserProfile(user types.User) error {
+	return store.UpdateUserProfile(user)
+}
+
+func GetUserByPhone(phone string) (*types.User, error) {
+	return store.GetUserByPhone(phone)
+}
+
+func GetUserByEmail(email string) (*types.User, error) {
+	return store.GetUserByEmail(email)
+}
+
+func GetRole(userId int) (*int, error) {
+	return store.GetRole(userId)
+}
+
+func InsertRole(userId int, roleId int) error {
+	return store.InsertRole(userId, roleId)
+}
+
+func UpdateRole(userId int, roleId int) error {
+	return store.UpdateRole(userId, roleId)
+}
+
+func UpdatePasswordResetToken(phone, token string) error {
+	return store.UpdatePasswordResetToken(phone, token)
+}
+
+func ResetPassword(phone, newPassword string) error {
+	return store.ResetPassword(phone, newPassword)
+}
+
+func DeleteUserByEmail(email string) error {
+	return store.DeleteUserByEmail(email)
+}
+
+func UpdateToken(userId int, token string) error {
+	return store.UpdateToken(userId, token)
+}
+
+func GetTopPosts(numOfPosts int, mascotId int) ([]types.PostLink, error) {
+	return store.GetTopPosts(numOfPosts, mascotId)
+}
+
+func GetPostsAfter(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetPostsAfter(timestamp, mascotId, numOfPosts)
+}
+
+func GetPostsBefore(timestamp int64, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetPostsBefore(timestamp, mascotId, numOfPosts)
+}
+
+func GetPostsBeforeCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetPostsBeforeCursor(timestamp, postId, mascotId, numOfPosts)
+}
+
+func GetPostsAfterCursor(timestamp int64, postId string, mascotId int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetPostsAfterCursor(timestamp, postId, mascotId, numOfPosts)
+}
+
+func PostLink(mascotId int, postId string, publishAt int64, expireAt int64) error {
+	return store.PostLink(mascotId, postId, publishAt, expireAt)
+}
+
+func UnlinkPost(mascotId int, postId string) error {
+	return store.UnlinkPost(mascotId, postId)
+}
+
+func MovePostLink(mascotId int, postId string, timestamp int64) error {
+	return store.MovePostLink(mascotId, postId, timestamp)
+}
+
+func PinPostLink(mascotId int, postId string, pinnedAt int64) error {
+	return store.PinPostLink(mascotId, postId, pinnedAt)
+}
+
+func GetPinnedPostLinks(mascotIds []int) ([]types.PostLink, error) {
+	return store.GetPinnedPostLinks(mascotIds)
+}
+
+func GetScheduledPostLinks(mascotId int, now int64) ([]types.PostLink, error) {
+	return store.GetScheduledPostLinks(mascotId, now)
+}
+
+func GetPostLinks(mascotId int) ([]types.PostLink, error) {
+	return store.GetPostLinks(mascotId)
+}
+
+func AddPost(p types.Post) (string, error) {
+	return store.AddPost(p)
+}
+
+func GetPostMetaData(postId string) (*types.Post, error) {
+	return store.GetPostMetaData(postId)
+}
+
+func GetPostsByIds(postIds []string) ([]types.Post, error) {
+	return store.GetPostsByIds(postIds)
+}
+
+func GetPosts() (*[]types.Post, error) {
+	return store.GetPosts()
+}
+
+func DeletePost(postId string, deletedBy int) error {
+	return store.DeletePost(postId, deletedBy)
+}
+
+func RestorePost(postId string) error {
+	return store.RestorePost(postId)
+}
+
+func GetDeletedPosts() ([]types.Post, error) {
+	return store.GetDeletedPosts()
+}
+
+func PurgePosts(deletedBefore int64) ([]string, error) {
+	return store.PurgePosts(deletedBefore)
+}
+
+func SubmitPost(postId string) error {
+	return store.SubmitPost(postId)
+}
+
+func ReviewPost(postId string, status string, reviewedBy int, comment string) error {
+	return store.ReviewPost(postId, status, reviewedBy, comment)
+}
+
+func GetSubmittedPosts() ([]types.Post, error) {
+	return store.GetSubmittedPosts()
+}
+
+func GetPostsCreatedBy(userId int) ([]types.Post, error) {
+	return store.GetPostsCreatedBy(userId)
+}
+
+func GetMergedTopPosts(numOfPosts int, mascotIds []int) ([]types.PostLink, error) {
+	return store.GetMergedTopPosts(numOfPosts, mascotIds)
+}
+
+func GetMergedPostsBeforeCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetMergedPostsBeforeCursor(timestamp, postId, mascotIds, numOfPosts)
+}
+
+func GetMergedPostsAfterCursor(timestamp int64, postId string, mascotIds []int, numOfPosts int) ([]types.PostLink, error) {
+	return store.GetMergedPostsAfterCursor(timestamp, postId, mascotIds, numOfPosts)
+}
+
+func UpdatePost(p types.Post) error {
+	return store.UpdatePost(p)
+}
+
+func GetParentPosts(postId string) ([]types.Post, error) {
+	return store.GetParentPosts(postId)
+}
+
+func CreateMascot(m types.Mascot) (int, error) {
+	return store.CreateMascot(m)
+}
+
+func GetMascot(mascotId int) (*types.Mascot, error) {
+	return store.GetMascot(mascotId)
+}
+
+func GetMascots(includeRetired bool) ([]types.Mascot, error) {
+	return store.GetMascots(includeRetired)
+}
+
+func UpdateMascot(m types.Mascot) error {
+	return store.UpdateMascot(m)
+}
+
+func RetireMascot(mascotId int) error {
+	return store.RetireMascot(mascotId)
+}
+
+func Subscribe(userId int, mascotId int) error {
+	return store.Subscribe(userId, mascotId)
+}
+
+func Unsubscribe(userId int, mascotId int) error {
+	return store.Unsubscribe(userId, mascotId)
+}
+
+func GetSubscriptions(userId int) ([]types.Mascot, error) {
+	return store.GetSubscriptions(userId)
+}
+
+func AddRevision(r types.Revision) (int, error) {
+	return store.AddRevision(r)
+}
+
+func GetRevisions(postId string) ([]types.Revision, error) {
+	return store.GetRevisions(postId)
+}
+
+func GetRevision(postId string, number int) (*types.Revision, error) {
+	return store.GetRevision(postId, number)
+}
+
+func AddVote(postId string, userId int, option int) error {
+	return store.AddVote(postId, userId, option)
+}
+
+func GetPollTallies(postIds []string, userId int) (map[string]types.PollTally, error) {
+	return store.GetPollTallies(postIds, userId)
+}
+
+func GetPollVotes(postId string) ([]types.PollVote, error) {
+	return store.GetPollVotes(postId)
+}
+
+func AddEngagement(postId string, userId int, kind int) error {
+	return store.AddEngagement(postId, userId, kind)
+}
+
+func RemoveEngagement(postId string, userId int, kind int) error {
+	return store.RemoveEngagement(postId, userId, kind)
+}
+
+func AddViews(userId int, postIds []string) error {
+	return store.AddViews(userId, postIds)
+}
+
+func GetEngagement(postIds []string, userId int) (map[string]types.Engagement, error) {
+	return store.GetEngagement(postIds, userId)
+}
+
+func GetSavedPostIds(userId int) ([]string, error) {
+	return store.GetSavedPostIds(userId)
+}
+
+func AddComment(cm types.Comment) (int, error) {
+	return store.AddComment(cm)
+}
+
+func GetComment(commentId int) (*types.Comment, error) {
+	return store.GetComment(commentId)
+}
+
+func GetComments(postId string, parentId int, afterId int, n int) ([]types.Comment, error) {
+	return store.GetComments(postId, parentId, afterId, n)
+}
+
+func GetHeldComments() ([]types.Comment, error) {
+	return store.GetHeldComments()
+}
+
+func ModerateComment(commentId int, status string, moderatedBy int) error {
+	return store.ModerateComment(commentId, status, moderatedBy)
+}
+
+func DeleteComment(commentId int) error {
+	return store.DeleteComment(commentId)
+}
+
+func GetCommentCounts(postIds []string) (map[string]int, error) {
+	return store.GetCommentCounts(postIds)
+}
+
+func SearchPosts(query string, cardTypes []int, skip int, limit int) ([]types.Post, error) {
+	return store.SearchPosts(query, cardTypes, skip, limit)
+}
+
+func SearchProducts(query string, brand string, skip int, limit int) ([]types.Product, error) {
+	return store.SearchProducts(query, brand, skip, limit)
+}
+
+func AddMedia(m types.Media) error {
+	return store.AddMedia(m)
+}
+
+func GetMedia(mediaId string) (*types.Media, error) {
+	return store.GetMedia(mediaId)
+}
+
+func MediaInUse(mediaId string) (bool, error) {
+	return store.MediaInUse(mediaId)
+}
+
+func DeleteMedia(mediaId string) error {
+	return store.DeleteMedia(mediaId)
+}
+
+func AddProduct(newProduct types.Product) error {
+	return store.AddProduct(newProduct)
+}
+
+func GetProduct(productId string) (*types.Product, error) {
+	return store.GetProduct(productId)
+}
+
+func GetProductBySku(sku string) (*types.Product, error) {
+	return store.GetProductBySku(sku)
+}
+
+func DeleteProduct(productId string) error {
+	return store.DeleteProduct(productId)
+}
+
+func IsProductInStock(productId string) (bool, error) {
+	return store.IsProductInStock(productId)
+}
+
+func IncrementStock(productId string) error {
+	return store.IncrementStock(productId)
+}
+
+func DecrementStock(productId string) error {
+	return store.DecrementStock(productId)
+}
+
+func AddSale(newSale types.Sale) (int, error) {
+	return store.AddSale(newSale)
+}
+
+func GetSale(sId int) (*types.Sale, error) {
+	return store.GetSale(sId)
+}
+
+func GetSales() (*types.SalesList, error) {
+	return store.GetSales()
+}
+
+func UpdateSaleStock(saleId int, value int) error {
+	return store.UpdateSaleStock(saleId, value)
+}
+
+func GetStatus(saleId int) (*types.StatusResponse, error) {
+	return store.GetStatus(saleId)
+}
+
+func CreateOrder(newOrder types.Order) (int, error) {
+	return store.CreateOrder(newOrder)
+}
+
+func GetOrder(oId int) (*types.Order, error) {
+	return store.GetOrder(oId)
+}
+
+func GetUserOrders(userId int) (*types.OrdersList, error) {
+	return store.GetUserOrders(userId)
+}
+
+func AddAddress(address types.Address) (int, error) {
+	return store.AddAddress(address)
+}
+
+func GetAddress(aId int) (*types.Address, error) {
+	return store.GetAddress(aId)
+}
+
+func GetUserAddresses(userId int) (*types.AddressList, error) {
+	return store.GetUserAddresses(userId)
+}
+
+func EditAddress(addressId int, newAddress types.Address) error {
+	return store.EditAddress(addressId, newAddress)
+}
+
+func InitiateTransaction(trans types.Transaction, saleId int) (int, error) {
+	return store.InitiateTransaction(trans, saleId)
+}
+
+func UpdateSuccessTransaction(trans types.Transaction) error {
+	return store.UpdateSuccessTransaction(trans)
+}
+
+func GetTransaction(transId int) (*types.Transaction, error) {
+	return store.GetTransaction(transId)
+}
+
+func PlaceOrder(ship types.Shipping) (int, error) {
+	return store.PlaceOrder(ship)
+}
+
+func AddFeedback(ph, typ, desc string) error {
+	return store.AddFeedback(ph, typ, desc)
+}
+
+func GetManifestEntries() ([]types.ManifestEntry, error) {
+	return store.GetManifestEntries()
+}
+
+func PutManifestEntry(e types.ManifestEntry) (int64, error) {
+	return store.PutManifestEntry(e)
+}
+
+func RemoveManifestEntry(url string) (int64, error) {
+	return store.RemoveManifestEntry(url)
+}
+
+func GetPushTokens(target string, targetId int) ([]types.PushToken, error) {
+	return store.GetPushTokens(target, targetId)
+}
+
+func ClearPushToken(userId int, token string) error {
+	return store.ClearPushToken(userId, token)
+}
+
+func AddNotification(n types.Notification) (int, error) {
+	return store.AddNotification(n)
+}
+
+func UpdateNotification(n types.Notification) error {
+	return store.UpdateNotification(n)
+}
+
+func GetNotification(notificationId int) (*types.Notification, error) {
+	return store.GetNotification(notificationId)
+}
+
+func AddDelivery(d types.Delivery) error {
+	return store.AddDelivery(d)
+}
+
+func GetDeliveries(notificationId int) ([]types.Delivery, error) {
+	return store.GetDeliveries(notificationId)
+}
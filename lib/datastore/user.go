@@ -2,7 +2,6 @@
 package datastore
 
 import (
-	"fmt"
 	c "rob/lib/common/constants"
 	"rob/lib/common/types"
 	"time"
@@ -13,8 +12,14 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Columns scanned by GetUserByPhone and GetUserByEmail, in order
+var userColumns = []string{
+	c.Id, c.Email, c.Password, c.Gender, c.FirstName, c.LastName, c.Phone,
+	c.TimeOfCreation, c.Verified, c.Code, c.ResetPasswordToken,
+}
+
 // Accepts a user object instantiated with form data and inserts the data into Users table
-func AddUser(newUser types.User) error {
+func (s *DbStore) AddUser(newUser types.User) error {
 	var funcName = "datastore/user.go:AddUser"
 	log.WithFields(log.Fields{
 		"newUser": newUser,
@@ -23,116 +28,62 @@ func AddUser(newUser types.User) error {
 
 	var timeOfCreation = time.Now().UTC().UnixNano()
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s(%s,%s,%s,%s,%s,%s,%s,%s,%s)
-		VALUES('%s','%s','%s','%s','%s','%s',%d,%d,%s)`,
-		c.UsersTable, c.Email, c.Password, c.Gender, c.FirstName,
-		c.LastName, c.Phone, c.TimeOfCreation, c.Verified, c.Code, newUser.Email,
-		newUser.Password, newUser.Gender.String, newUser.FirstName.String,
-		newUser.LastName.String, newUser.Phone.String, timeOfCreation, newUser.Verified, newUser.Code)
-
-	lh.Mysql.Query(query)
+	query := insertQuery(c.UsersTable,
+		c.Email, c.Password, c.Gender, c.FirstName, c.LastName,
+		c.Phone, c.TimeOfCreation, c.Verified, c.Code)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
+	_, err := execQuery(db, query,
+		newUser.Email, newUser.Password, newUser.Gender.String,
+		newUser.FirstName.String, newUser.LastName.String,
+		newUser.Phone.String, timeOfCreation, newUser.Verified, newUser.Code)
 	return err
 }
 
-func UpdateUserDetails(user types.User) error {
+func (s *DbStore) UpdateUserDetails(user types.User) error {
 	var funcName = "datastore/user.go:UpdateUserProfile"
 	log.WithFields(log.Fields{
 		"user": user,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s='%s',%s='%s',%s='%s',%s='%s', %s='%d'
-		WHERE %s = %d`,
-		c.UsersTable,
-		// Key, value paris
-		c.FirstName, user.FirstName.String,
-		c.LastName, user.LastName.String,
-		c.Gender, user.Gender.String,
-		c.Password, user.Password,
-		c.Verified, user.Verified,
-		c.Id, user.Id)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
+	query := updateQuery(c.UsersTable,
+		[]string{c.FirstName, c.LastName, c.Gender, c.Password, c.Verified},
+		c.Id)
 
-	_, err = stmt.Exec()
+	_, err := execQuery(db, query,
+		user.FirstName.String, user.LastName.String, user.Gender.String,
+		user.Password, user.Verified,
+		user.Id)
 	return err
 }
-func UpdateUserProfile(user types.User) error {
+func (s *DbStore) UpdateUserProfile(user types.User) error {
 	var funcName = "datastore/user.go:UpdateUserProfile"
 	log.WithFields(log.Fields{
 		"user": user,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s='%s',%s='%s',%s='%s'
-		WHERE %s = %d`,
-		c.UsersTable,
-		// Key, value paris
-		c.FirstName, user.FirstName.String,
-		c.LastName, user.LastName.String,
-		c.Gender, user.Gender.String,
-		c.Id, user.Id)
-
-	lh.Mysql.Query(query)
+	query := updateQuery(c.UsersTable,
+		[]string{c.FirstName, c.LastName, c.Gender},
+		c.Id)
 
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
+	_, err := execQuery(db, query,
+		user.FirstName.String, user.LastName.String, user.Gender.String,
+		user.Id)
 	return err
 }
 
-func GetUserByPhone(phone string) (*types.User, error) {
+func (s *DbStore) GetUserByPhone(phone string) (*types.User, error) {
 	var funcName = "datastore/user.go:GetUserByPhone"
 	log.WithFields(log.Fields{
 		"phone": phone,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		SELECT %s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s
-		FROM %s
-		WHERE %s = '%s'`,
-		c.Id, c.Email, c.Password, c.Gender, c.FirstName, c.LastName, c.Phone, c.TimeOfCreation, c.Verified, c.Code, c.ResetPasswordToken,
-		c.UsersTable,
-		c.Phone, phone)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.UsersTable, userColumns, c.Phone)
 
 	var u types.User
-	err = stmt.QueryRow().Scan(&u.Id, &u.Email, &u.Password, &u.Gender, &u.FirstName, &u.LastName, &u.Phone, &u.TimeOfCreation, &u.Verified, &u.Code, &u.ResetPasswordToken)
+	err := scanRow(query, []interface{}{phone}, &u.Id, &u.Email, &u.Password, &u.Gender, &u.FirstName, &u.LastName, &u.Phone, &u.TimeOfCreation, &u.Verified, &u.Code, &u.ResetPasswordToken)
 
 	if err != nil {
 		// Removing this statement as it will repeat everytime a user signup happens
@@ -143,32 +94,17 @@ func GetUserByPhone(phone string) (*types.User, error) {
 	return &u, nil
 }
 
-func GetUserByEmail(email string) (*types.User, error) {
+func (s *DbStore) GetUserByEmail(email string) (*types.User, error) {
 	var funcName = "datastore/user.go:GetUserByEmail"
 	log.WithFields(log.Fields{
 		"email": email,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		SELECT %s,%s,%s,%s,%s,%s,%s,%s,%s,%s,%s
-		FROM %s
-		WHERE %s = '%s'`,
-		c.Id, c.Email, c.Password, c.Gender, c.FirstName, c.LastName, c.Phone, c.TimeOfCreation, c.Verified, c.Code, c.ResetPasswordToken,
-		c.UsersTable,
-		c.Email, email)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.UsersTable, userColumns, c.Email)
 
 	var u types.User
-	err = stmt.QueryRow().Scan(&u.Id, &u.Email, &u.Password, &u.Gender, &u.FirstName, &u.LastName, &u.Phone, &u.TimeOfCreation, &u.Verified, &u.Code, &u.ResetPasswordToken)
+	err := scanRow(query, []interface{}{email}, &u.Id, &u.Email, &u.Password, &u.Gender, &u.FirstName, &u.LastName, &u.Phone, &u.TimeOfCreation, &u.Verified, &u.Code, &u.ResetPasswordToken)
 
 	if err != nil {
 		// Removing this statement as it will repeat everytime a user signup happens
@@ -179,32 +115,17 @@ func GetUserByEmail(email string) (*types.User, error) {
 	return &u, nil
 }
 
-func GetRole(userId int) (*int, error) {
+func (s *DbStore) GetRole(userId int) (*int, error) {
 	var funcName = "datastore/user.go:GetRole"
 	log.WithFields(log.Fields{
 		"userId": userId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		SELECT %s
-		FROM %s
-		WHERE %s = ?`,
-		c.RoleId,
-		c.UserRoleTable,
-		c.UserId)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return nil, err
-	}
-	defer stmt.Close()
+	query := selectQuery(c.UserRoleTable, []string{c.RoleId}, c.UserId)
 
 	var roleId int
-	err = stmt.QueryRow(userId).Scan(&roleId)
+	err := scanRow(query, []interface{}{userId}, &roleId)
 	if err != nil {
 		lh.Mysql.ScanError(err)
 		return nil, err
@@ -213,70 +134,33 @@ func GetRole(userId int) (*int, error) {
 	return &roleId, nil
 }
 
-func InsertRole(userId int, roleId int) error {
+func (s *DbStore) InsertRole(userId int, roleId int) error {
 	var funcName = "datastore/user.go:InsertRole"
 	log.WithFields(log.Fields{
 		"userId": userId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		INSERT INTO %s(%s,%s)
-		VALUES(%d,%d);`,
-		c.UserRoleTable, c.UserId, c.RoleId,
-		userId, roleId)
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-	defer stmt.Close()
+	query := insertQuery(c.UserRoleTable, c.UserId, c.RoleId)
 
-	return nil
+	_, err := execQuery(db, query, userId, roleId)
+	return err
 }
 
-func UpdateRole(userId int, roleId int) error {
+func (s *DbStore) UpdateRole(userId int, roleId int) error {
 	var funcName = "datastore/user.go:UpdateRole"
 	log.WithFields(log.Fields{
 		"userId": userId,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s=%d
-		WHERE %s=%d`,
-		c.UserRoleTable,
-		c.RoleId, roleId,
-		c.UserId, userId)
-
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
+	query := updateQuery(c.UserRoleTable, []string{c.RoleId}, c.UserId)
 
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	return nil
+	_, err := execQuery(db, query, roleId, userId)
+	return err
 }
 
-func UpdatePasswordResetToken(phone, token string) error {
+func (s *DbStore) UpdatePasswordResetToken(phone, token string) error {
 	var funcName = "datastore/user.go:UpdatePasswordResetToken"
 	log.WithFields(log.Fields{
 		"phone": phone,
@@ -284,33 +168,13 @@ func UpdatePasswordResetToken(phone, token string) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s='%s'
-		WHERE %s='%s'`,
-		c.UsersTable,
-		c.ResetPasswordToken, token,
-		c.Phone, phone)
+	query := updateQuery(c.UsersTable, []string{c.ResetPasswordToken}, c.Phone)
 
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-
-	return nil
+	_, err := execQuery(db, query, token, phone)
+	return err
 }
 
-func ResetPassword(phone, newPassword string) error {
+func (s *DbStore) ResetPassword(phone, newPassword string) error {
 	var funcName = "datastore/user.go:ResetPassword"
 	log.WithFields(log.Fields{
 		"phone":        phone,
@@ -318,61 +182,21 @@ func ResetPassword(phone, newPassword string) error {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		UPDATE %s
-		SET %s='%s', %s='%s'
-		WHERE %s='%s'`,
-		c.UsersTable,
-		c.Password, newPassword,
-		c.ResetPasswordToken, "",
-		c.Phone, phone)
+	query := updateQuery(c.UsersTable, []string{c.Password, c.ResetPasswordToken}, c.Phone)
 
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-
-	return nil
+	_, err := execQuery(db, query, newPassword, "", phone)
+	return err
 }
 
-func DeleteUserByEmail(email string) error {
+func (s *DbStore) DeleteUserByEmail(email string) error {
 	var funcName = "datastore/user.go:DeleteUserByEmail"
 	log.WithFields(log.Fields{
 		"email": email,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	query := fmt.Sprintf(`
-		DELETE FROM %s 
-		WHERE %s = '%s'`,
-		c.UsersTable,
-		c.Email,
-		email)
+	query := deleteQuery(c.UsersTable, c.Email)
 
-	lh.Mysql.Query(query)
-
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		lh.Mysql.PrepareError(err)
-		return err
-	}
-
-	_, err = stmt.Exec()
-	if err != nil {
-		lh.Mysql.ExecError(err)
-		return err
-	}
-	defer stmt.Close()
-
-	return nil
+	_, err := execQuery(db, query, email)
+	return err
 }
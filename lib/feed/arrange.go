@@ -0,0 +1,82 @@
+package feed
+
+import (
+	"errors"
+	"rob/lib/common/types"
+	"rob/lib/data"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrNotLinked = errors.New("Post is not linked to the mascot")
+var ErrNotMovable = errors.New("Only published, unpinned posts can be moved")
+var ErrNoRoom = errors.New("No room at that position, try a neighbouring one")
+
+/*
+Purpose : Moves a post to a position in a mascot feed
+Input : Mascot, post, and its new position counted from the newest post, 0 being the top
+Outputs : ErrNotLinked, ErrNotMovable or ErrNoRoom when it can't be moved
+Remark : The post takes a TimeOfCreation between its new neighbours. Positions past the end move it to the end
+*/
+func Move(mascotId int, postId string, position int) error {
+	var funcName = "feed/arrange.go:Move"
+	log.WithFields(log.Fields{
+		"mascotId": mascotId,
+		"postId":   postId,
+		"position": position,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	all, err := data.GetPostLinks(mascotId)
+	if err != nil {
+		return err
+	}
+	var link *types.PostLink
+	for i := range all {
+		if all[i].PostId == postId {
+			link = &all[i]
+			break
+		}
+	}
+	if link == nil {
+		return ErrNotLinked
+	}
+	now := time.Now().UTC().UnixNano()
+	if link.TimeOfCreation > now || (link.ExpireAt != 0 && link.ExpireAt <= now) || link.PinnedAt != 0 {
+		return ErrNotMovable
+	}
+
+	// The queue down to the new position, without the post moved
+	links, err := data.GetTopPosts(position+2, mascotId)
+	if err != nil {
+		return err
+	}
+	queue := links[:0]
+	for _, l := range links {
+		if l.PostId != postId {
+			queue = append(queue, l)
+		}
+	}
+	if position > len(queue) {
+		position = len(queue)
+	}
+
+	var timestamp int64
+	switch {
+	case len(queue) == 0:
+		return nil
+	case position == 0:
+		timestamp = queue[0].TimeOfCreation + 1
+	case position == len(queue):
+		timestamp = queue[position-1].TimeOfCreation - 1
+	default:
+		newer, older := queue[position-1].TimeOfCreation, queue[position].TimeOfCreation
+		if newer-older < 2 {
+			return ErrNoRoom
+		}
+		timestamp = older + (newer-older)/2
+	}
+
+	return data.MovePostLink(mascotId, postId, timestamp)
+}
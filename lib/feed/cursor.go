@@ -0,0 +1,43 @@
+package feed
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// Directions a cursor reads the queue in
+const (
+	Older = "o"
+	Newer = "n"
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor is a position in a mascot queue. Clients only ever see it
+// encoded, so its fields can change without breaking them
+type Cursor struct {
+	Dir            string `json:"d"`
+	TimeOfCreation int64  `json:"t"`
+	PostId         string `json:"p"`
+}
+
+func (cur Cursor) Encode() string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur Cursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if (cur.Dir != Older && cur.Dir != Newer) || cur.PostId == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &cur, nil
+}
@@ -0,0 +1,31 @@
+package feed
+
+import "testing"
+
+func TestCursor(t *testing.T) {
+	for _, cur := range []Cursor{
+		{Older, 1500000000000000000, "5a0b0c0d0e0f101112131415"},
+		{Newer, -1, "5a0b0c0d0e0f101112131415"},
+	} {
+		got, err := DecodeCursor(cur.Encode())
+		if err != nil {
+			t.Errorf("Decoding %+v failed: %v", cur, err)
+			continue
+		}
+		if *got != cur {
+			t.Errorf("Cursor round trip failed. Expected=%+v but received=%+v", cur, *got)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"not base64!",
+		"bm90IGpzb24",                       // not json
+		Cursor{"x", 1, "5a0b0c0d"}.Encode(), // unknown direction
+		Cursor{Older, 1, ""}.Encode(),       // no post
+	} {
+		if _, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("Decoding %q expected to fail but received %v", s, err)
+		}
+	}
+}
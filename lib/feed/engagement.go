@@ -0,0 +1,72 @@
+package feed
+
+import (
+	"rob/lib/common/types"
+	"rob/lib/data"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Purpose : The posts saved by a user
+Input : The user
+Outputs : The posts users get to see, last saved first
+Remark : Saved posts since deleted or unpublished are left out
+*/
+func Saved(userId int) ([]types.Post, error) {
+	var funcName = "feed/engagement.go:Saved"
+	log.WithFields(log.Fields{
+		"userId": userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postIds, err := data.GetSavedPostIds(userId)
+	if err != nil {
+		return nil, err
+	}
+	posts, missing, err := data.GetPostsByIds(postIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		log.WithFields(log.Fields{
+			"userId":  userId,
+			"postIds": missing,
+		}).Warn("Saved posts missing")
+	}
+	if posts, err = expand(visible(posts), userId); err != nil {
+		return nil, err
+	}
+	if posts == nil {
+		// Listed as [] when there is none
+		posts = []types.Post{}
+	}
+	return posts, nil
+}
+
+// engaged fills in the likes, saves, views and comment counts of posts, and
+// whether userId liked or saved them
+func engaged(posts []types.Post, userId int) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIds := make([]string, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.Id.Hex()
+	}
+	counts, err := data.GetEngagement(postIds, userId)
+	if err != nil {
+		return err
+	}
+	comments, err := data.GetCommentCounts(postIds)
+	if err != nil {
+		return err
+	}
+	for i, post := range posts {
+		e := counts[post.Id.Hex()]
+		posts[i].Likes, posts[i].Saves, posts[i].Views = e.Likes, e.Saves, e.Views
+		posts[i].Liked, posts[i].Saved = e.Liked, e.Saved
+		posts[i].Comments = comments[post.Id.Hex()]
+	}
+	return nil
+}
@@ -1,18 +1,28 @@
 package feed
 
 import (
+	"database/sql"
 	"encoding/json"
 	c "rob/lib/common/constants"
 	"rob/lib/common/types"
 	"rob/lib/data"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
 )
 
-func Get(lastSync int64, mascotId int, flag int) ([]types.Post, error) {
+func Get(lastSync int64, mascotId int, flag int, userId int) ([]types.Post, error) {
 	var mascotFeedList []types.PostLink
 	var err error
 	err = nil
 	if flag == c.TopPost {
-		mascotFeedList, err = data.GetTopPosts(c.NumOfPosts, mascotId)
+		// Pinned posts lead the newest ones
+		var pinned []types.PostLink
+		pinned, err = data.GetPinnedPostLinks([]int{mascotId})
+		if err == nil {
+			mascotFeedList, err = data.GetTopPosts(c.NumOfPosts, mascotId)
+			mascotFeedList = append(pinned, mascotFeedList...)
+		}
 	} else if flag == c.PostBefore {
 		mascotFeedList, err = data.GetPostsBefore(lastSync, mascotId, c.NumOfPosts)
 	} else if flag == c.PostAfter {
@@ -21,23 +31,198 @@ func Get(lastSync int64, mascotId int, flag int) ([]types.Post, error) {
 	if err != nil {
 		return nil, err
 	}
-	feed, err := data.GetPostsMetaData(mascotFeedList)
+	feed, missing, err := data.GetPostsMetaData(mascotFeedList)
 	if err != nil {
 		return nil, err
 	}
+	if len(missing) > 0 {
+		log.WithFields(log.Fields{
+			"mascotId": mascotId,
+			"postIds":  missing,
+		}).Warn("Queued posts missing from the feed")
+	}
 
-	feed, err = expand(feed)
+	feed, err = expand(visible(feed), userId)
 
 	return feed, err
 }
 
-func expand(posts []types.Post) ([]types.Post, error) {
+/*
+Purpose : One page of a mascot feed
+Input : Mascot, cursor from a previous page or empty for the newest posts, page size, and the user reading it
+Outputs : The page with the cursors to read on in either direction
+Remark : ErrInvalidCursor when the cursor can't be decoded
+*/
+func Page(mascotId int, cursor string, pageSize int, userId int) (*types.FeedPage, error) {
+	return readPage(cursor, pageSize, userId, []int{mascotId}, log.Fields{"mascotId": mascotId},
+		func(cur *Cursor, n int) ([]types.PostLink, error) {
+			switch {
+			case cur == nil:
+				return data.GetTopPosts(n, mascotId)
+			case cur.Dir == Older:
+				return data.GetPostsBeforeCursor(cur.TimeOfCreation, cur.PostId, mascotId, n)
+			default:
+				return data.GetPostsAfterCursor(cur.TimeOfCreation, cur.PostId, mascotId, n)
+			}
+		})
+}
+
+/*
+Purpose : One page of the feeds of several mascots merged in time order
+Input : Mascots, cursor from a previous page or empty for the newest posts, page size, and the user reading it
+Outputs : The page with the cursors to read on in either direction
+Remark : A post linked to more than one of the mascots is served once, at its newest link
+*/
+func MergedPage(mascotIds []int, cursor string, pageSize int, userId int) (*types.FeedPage, error) {
+	return readPage(cursor, pageSize, userId, mascotIds, log.Fields{"mascotIds": mascotIds},
+		func(cur *Cursor, n int) ([]types.PostLink, error) {
+			switch {
+			case cur == nil:
+				return data.GetMergedTopPosts(n, mascotIds)
+			case cur.Dir == Older:
+				return data.GetMergedPostsBeforeCursor(cur.TimeOfCreation, cur.PostId, mascotIds, n)
+			default:
+				return data.GetMergedPostsAfterCursor(cur.TimeOfCreation, cur.PostId, mascotIds, n)
+			}
+		})
+}
+
+// readPage reads one page of links with fetch, which is given the decoded
+// cursor (nil for the newest posts) and how many links to return. Posts
+// pinned for any of mascotIds lead the first page. Polls show the votes of
+// userId
+func readPage(cursor string, pageSize int, userId int, mascotIds []int, fields log.Fields,
+	fetch func(cur *Cursor, n int) ([]types.PostLink, error)) (*types.FeedPage, error) {
+	var cur *Cursor
+	var err error
+	if cursor != "" {
+		if cur, err = DecodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// One more than needed tells if there is more to read
+	links, err := fetch(cur, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &types.FeedPage{Posts: []types.Post{}}
+	if len(links) > pageSize {
+		page.HasMore = true
+		// Newer pages keep the links closest to the cursor, the oldest ones
+		if cur != nil && cur.Dir == Newer {
+			links = links[1:]
+		} else {
+			links = links[:pageSize]
+		}
+	}
+
+	if len(links) > 0 {
+		first, last := links[0], links[len(links)-1]
+		page.Prev = Cursor{Newer, first.TimeOfCreation, first.PostId}.Encode()
+		page.Next = Cursor{Older, last.TimeOfCreation, last.PostId}.Encode()
+	} else if cur != nil {
+		// Nothing past the cursor yet. Newer posts may still come
+		page.Prev = Cursor{Newer, cur.TimeOfCreation, cur.PostId}.Encode()
+		if cur.Dir == Newer {
+			page.Next = Cursor{Older, cur.TimeOfCreation, cur.PostId}.Encode()
+		}
+	}
+
+	// A post pinned for one mascot may be queued for another, it is only
+	// served as pinned
+	pinned, err := data.GetPinnedPostLinks(mascotIds)
+	if err != nil {
+		return nil, err
+	}
+	isPinned := make(map[string]bool, len(pinned))
+	for _, l := range pinned {
+		isPinned[l.PostId] = true
+	}
+	var wanted []types.PostLink
+	if cur == nil {
+		wanted = append(wanted, pinned...)
+	}
+	for _, l := range links {
+		if !isPinned[l.PostId] {
+			wanted = append(wanted, l)
+		}
+	}
+
+	posts, missing, err := data.GetPostsMetaData(wanted)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		log.WithFields(fields).WithField("postIds", missing).Warn("Queued posts missing from the feed")
+	}
+
+	if posts, err = expand(visible(posts), userId); err != nil {
+		return nil, err
+	}
+	for _, p := range posts {
+		if isPinned[p.Id.Hex()] {
+			page.Pinned = append(page.Pinned, p)
+		} else {
+			page.Posts = append(page.Posts, p)
+		}
+	}
+	return page, nil
+}
+
+// visible leaves out the posts users don't get to see, drafts and those in
+// the trash. Posts without a status predate it and are published
+func visible(posts []types.Post) []types.Post {
+	shown := posts[:0]
+	for _, p := range posts {
+		if p.Status == "" || p.Status == c.StatusPublished {
+			shown = append(shown, p)
+		}
+	}
+	return shown
+}
+
+// expand fills in what the cards show besides their own fields, the
+// children of list cards, live prices, poll votes, likes, saves and views
+// as seen by userId
+func expand(posts []types.Post, userId int) ([]types.Post, error) {
+	// Children of all the List type cards are fetched together
+	var childIds []string
+	for _, post := range posts {
+		if post.CardType == c.CardTypeList {
+			childIds = append(childIds, post.ChildPosts...)
+		}
+	}
+	children, missing, err := data.GetPostsByIds(childIds)
+	if err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		return nil, &data.MissingPostsError{PostIds: missing}
+	}
+	if children, err = priced(visible(children)); err != nil {
+		return nil, err
+	}
+	if err = tallied(children, userId); err != nil {
+		return nil, err
+	}
+	if err = engaged(children, userId); err != nil {
+		return nil, err
+	}
+	byId := make(map[string]types.Post, len(children))
+	for _, child := range children {
+		byId[child.Id.Hex()] = child
+	}
+
 	// Expand List type cards
 	for i, post := range posts {
 		if post.CardType == c.CardTypeList {
-			d, err := data.GetPosts(post.ChildPosts)
-			if err != nil {
-				return nil, err
+			var d []types.Post
+			for _, childId := range post.ChildPosts {
+				if child, ok := byId[childId]; ok {
+					d = append(d, child)
+				}
 			}
 			for j := range d {
 				d[j].TimeOfLink = post.TimeOfLink
@@ -49,5 +234,80 @@ func expand(posts []types.Post) ([]types.Post, error) {
 			posts[i].ChildPostsJson = string(m)
 		}
 	}
-	return posts, nil
+	if err := tallied(posts, userId); err != nil {
+		return nil, err
+	}
+	if err := engaged(posts, userId); err != nil {
+		return nil, err
+	}
+	return priced(posts)
+}
+
+// priced fills in the live price and stock of product and sale cards. A
+// sale is priced as the product listed under its sku. Cards whose product
+// or sale is gone are left out
+func priced(posts []types.Post) ([]types.Post, error) {
+	products := make(map[string]*types.Product)
+	product := func(id string, get func(string) (*types.Product, error)) (*types.Product, error) {
+		if p, ok := products[id]; ok {
+			return p, nil
+		}
+		p, err := get(id)
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		products[id] = p
+		return p, nil
+	}
+
+	shown := posts[:0]
+	for _, post := range posts {
+		switch post.CardType {
+		case c.CardTypeProduct:
+			p, err := product(post.ProductId, data.GetProduct)
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				log.WithFields(log.Fields{
+					"postId":    post.Id.Hex(),
+					"productId": post.ProductId,
+				}).Warn("Product of a card is gone")
+				continue
+			}
+			post.Price, post.StockLeft = p.UnitPrice, p.Quantity
+		case c.CardTypeSale:
+			sale, err := data.GetSale(post.SaleId)
+			if err == sql.ErrNoRows {
+				log.WithFields(log.Fields{
+					"postId": post.Id.Hex(),
+					"saleId": post.SaleId,
+				}).Warn("Sale of a card is gone")
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			p, err := product("sku:"+sale.ProductSku, func(string) (*types.Product, error) {
+				return data.GetProductBySku(sale.ProductSku)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				log.WithFields(log.Fields{
+					"postId": post.Id.Hex(),
+					"sku":    sale.ProductSku,
+				}).Warn("No product is listed for the sale of a card")
+				continue
+			}
+			status, err := data.GetSaleStatus(post.SaleId)
+			if err != nil {
+				return nil, err
+			}
+			post.Price, post.StockLeft, post.TimeToStart = p.UnitPrice, status.StockLeft, status.TimeToStart
+		}
+		shown = append(shown, post)
+	}
+	return shown, nil
 }
@@ -0,0 +1,61 @@
+package feed
+
+import (
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/data"
+)
+
+/*
+Purpose : Fills in the votes of a poll card
+Input : The poll and the user asking
+Outputs : The poll with its Votes, and MyVote if the user has Voted
+Remark : Other cards are returned as they are
+*/
+func Tally(post types.Post, userId int) (types.Post, error) {
+	posts := []types.Post{post}
+	if err := tallied(posts, userId); err != nil {
+		return post, err
+	}
+	return posts[0], nil
+}
+
+// tallied fills in the votes of all the poll cards in posts with a single
+// read of the votes
+func tallied(posts []types.Post, userId int) error {
+	var pollIds []string
+	for _, post := range posts {
+		if post.CardType == c.CardTypePoll {
+			pollIds = append(pollIds, post.Id.Hex())
+		}
+	}
+	if len(pollIds) == 0 {
+		return nil
+	}
+	tallies, err := data.GetPollTallies(pollIds, userId)
+	if err != nil {
+		return err
+	}
+
+	for i, post := range posts {
+		if post.CardType != c.CardTypePoll {
+			continue
+		}
+		votes := make([]int, len(post.Options))
+		t, ok := tallies[post.Id.Hex()]
+		if ok {
+			for option, count := range t.Counts {
+				// Guards against a vote past the options
+				if option < len(votes) {
+					votes[option] = count
+				}
+			}
+		}
+		posts[i].Votes = votes
+		posts[i].Voted = ok && t.Mine >= 0
+		if posts[i].Voted {
+			posts[i].MyVote = t.Mine
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package feed
+
+import (
+	"rob/lib/common/types"
+	"rob/lib/data"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+Purpose : One page of the posts matching a search
+Input : The query, the card types wanted or none for all, the number of results before the page, page size, and the user searching
+Outputs : The posts as shown in feeds, best match first, and the Offset of the next page
+Remark : Only the posts users get to see are searched
+*/
+func Search(query string, cardTypes []int, offset int, pageSize int, userId int) (*types.PostSearchPage, error) {
+	var funcName = "feed/search.go:Search"
+	log.WithFields(log.Fields{
+		"query":     query,
+		"cardTypes": cardTypes,
+		"offset":    offset,
+		"pageSize":  pageSize,
+		"userId":    userId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	// One more than needed tells if there is more to read
+	posts, err := data.SearchPosts(query, cardTypes, offset, pageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	page := types.PostSearchPage{Offset: offset + len(posts)}
+	if len(posts) > pageSize {
+		posts, page.HasMore = posts[:pageSize], true
+		page.Offset = offset + pageSize
+	}
+	if page.Posts, err = expand(posts, userId); err != nil {
+		return nil, err
+	}
+	if page.Posts == nil {
+		// Listed as [] when there is none
+		page.Posts = []types.Post{}
+	}
+	return &page, nil
+}
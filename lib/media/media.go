@@ -0,0 +1,185 @@
+// Package media keeps uploaded images and videos in the blob store. Files
+// are named after the hash of their content, so the same file uploaded twice
+// is stored once, and images get a jpeg thumbnail
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"rob/lib/blob"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"rob/lib/data"
+
+	// Decoders of the image types accepted
+	_ "image/gif"
+	_ "image/png"
+
+	log "github.com/sirupsen/logrus"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// Reasons for refusing an upload
+var (
+	ErrTooLarge    = errors.New("The file is too large")
+	ErrUnsupported = errors.New("Only jpeg, png and gif images and mp4 and webm videos can be uploaded")
+	ErrDimensions  = errors.New("The image is too wide or too high")
+	ErrCorrupt     = errors.New("The image can't be read")
+	ErrPublic      = errors.New("The file was already uploaded as public")
+)
+
+// Content types accepted, sniffed from the content whatever the client
+// says, and the extension of their files
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// Format image.DecodeConfig reports for each image type
+var formats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+}
+
+const thumbQuality = 80
+
+/*
+Purpose : Stores an uploaded file and, for images, its thumbnail
+Input : The content of the file, the user uploading it and whether it is private, only served through signed urls
+Outputs : The media with its urls
+Remark : ErrTooLarge, ErrUnsupported, ErrDimensions or ErrCorrupt when the file is refused. Content already uploaded is returned as it was first stored, ErrPublic if it is public and private was asked for
+*/
+func Save(content []byte, userId int, private bool) (*types.Media, error) {
+	var funcName = "media/media.go:Save"
+	log.WithFields(log.Fields{
+		"size":    len(content),
+		"userId":  userId,
+		"private": private,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	cfg := config.Get().Media
+	if len(content) > cfg.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(content)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	sum := sha256.Sum256(content)
+	id := hex.EncodeToString(sum[:])
+	if m, err := data.GetMedia(id); err != mgo.ErrNotFound {
+		if err != nil {
+			return nil, err
+		}
+		// Its public url can't be taken back
+		if private && !m.Private {
+			return nil, ErrPublic
+		}
+		return withUrls(m)
+	}
+
+	prefix := ""
+	if private {
+		prefix = blob.PrivatePrefix
+	}
+	m := types.Media{
+		Id:          id,
+		ContentType: contentType,
+		Size:        len(content),
+		Name:        prefix + id + ext,
+		Private:     private,
+		UploadedBy:  userId,
+	}
+	store, err := blob.Current()
+	if err != nil {
+		return nil, err
+	}
+	if format, ok := formats[contentType]; ok {
+		thumb, err := thumbnail(content, format, &m)
+		if err != nil {
+			return nil, err
+		}
+		m.Thumb = prefix + id + "_thumb.jpg"
+		if err := store.Put(m.Thumb, thumb, "image/jpeg"); err != nil {
+			return nil, err
+		}
+	}
+	if err := store.Put(m.Name, content, contentType); err != nil {
+		return nil, err
+	}
+	if err := data.AddMedia(m); err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"mediaId":     m.Id,
+		"contentType": m.ContentType,
+		"private":     m.Private,
+	}).Info("Media uploaded")
+	return withUrls(&m)
+}
+
+/*
+Purpose : Looks up uploaded media
+Input : The id returned when it was uploaded
+Outputs : The media with its urls, fresh signed ones for private media
+Remark : mgo.ErrNotFound if there is none
+*/
+func Get(mediaId string) (*types.Media, error) {
+	m, err := data.GetMedia(mediaId)
+	if err != nil {
+		return nil, err
+	}
+	return withUrls(m)
+}
+
+func withUrls(m *types.Media) (*types.Media, error) {
+	var err error
+	if m.Url, err = blob.Url(m.Name); err != nil {
+		return nil, err
+	}
+	m.ThumbUrl = ""
+	if m.Thumb != "" {
+		if m.ThumbUrl, err = blob.Url(m.Thumb); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// thumbnail checks the dimensions of the image in content, filling them
+// in m, and encodes its thumbnail. The dimensions are read from the header
+// before decoding, so oversized images are refused without the memory
+// they would take
+func thumbnail(content []byte, format string, m *types.Media) ([]byte, error) {
+	cfg := config.Get().Media
+	header, decoded, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || decoded != format {
+		return nil, ErrCorrupt
+	}
+	if header.Width < 1 || header.Height < 1 || header.Width > cfg.MaxWidth || header.Height > cfg.MaxHeight {
+		return nil, ErrDimensions
+	}
+	m.Width, m.Height = header.Width, header.Height
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Thumbnail(img, cfg.ThumbSize), &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
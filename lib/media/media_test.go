@@ -0,0 +1,156 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"path/filepath"
+	"rob/lib/blob"
+	"rob/lib/config"
+	"rob/lib/datastore"
+	"strings"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	// Red on the left, blue on the right
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if x < 200 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	thumb := Thumbnail(img, 100)
+	if b := thumb.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Fatalf("Thumbnail size expected=100x50 but received=%dx%d", b.Dx(), b.Dy())
+	}
+	if got := thumb.RGBAAt(10, 10); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Left of the thumbnail expected red but received %v", got)
+	}
+	if got := thumb.RGBAAt(90, 40); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("Right of the thumbnail expected blue but received %v", got)
+	}
+
+	// Small and transparent, the size is kept and it turns white
+	clear := image.NewNRGBA(image.Rect(0, 0, 30, 60))
+	thumb = Thumbnail(clear, 100)
+	if b := thumb.Bounds(); b.Dx() != 30 || b.Dy() != 60 {
+		t.Errorf("Small thumbnail size expected=30x60 but received=%dx%d", b.Dx(), b.Dy())
+	}
+	if got := thumb.RGBAAt(5, 5); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Transparent thumbnail expected white but received %v", got)
+	}
+
+	for _, test := range [][4]int{{1000, 10, 100, 1}, {10, 1000, 1, 100}, {50, 100, 50, 100}} {
+		if w, h := thumbSize(test[0], test[1], 100); w != test[2] || h != test[3] {
+			t.Errorf("Thumbnail of %dx%d expected=%dx%d but received=%dx%d", test[0], test[1], test[2], test[3], w, h)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	prevStore, prevConfig := datastore.Current(), config.Get()
+	defer func() {
+		datastore.Use(prevStore)
+		config.Use(prevConfig)
+		blob.Use(nil)
+	}()
+	datastore.Use(datastore.NewMemStore())
+	cfg := config.Defaults(config.Test)
+	cfg.Blob.Dir = t.TempDir()
+	blob.Use(blob.NewLocal(cfg.Blob))
+	cfg.Media.MaxBytes = 1 << 20
+	cfg.Media.MaxWidth = 1000
+	cfg.Media.MaxHeight = 1000
+	cfg.Media.ThumbSize = 100
+	config.Use(cfg)
+
+	content := encodePng(t, 300, 150)
+	m, err := Save(content, 7, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ContentType != "image/png" || m.Width != 300 || m.Height != 150 || m.Size != len(content) || m.UploadedBy != 7 {
+		t.Errorf("Saved media mismatch %+v", m)
+	}
+	if m.Url != cfg.Blob.BaseUrl+m.Id+".png" || m.ThumbUrl != cfg.Blob.BaseUrl+m.Id+"_thumb.jpg" {
+		t.Errorf("Media urls mismatch %q %q", m.Url, m.ThumbUrl)
+	}
+	stored, err := ioutil.ReadFile(filepath.Join(cfg.Blob.Dir, m.Name))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Errorf("Stored file mismatch, %v", err)
+	}
+	thumb, err := ioutil.ReadFile(filepath.Join(cfg.Blob.Dir, m.Thumb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := jpeg.DecodeConfig(bytes.NewReader(thumb))
+	if err != nil || header.Width != 100 || header.Height != 50 {
+		t.Errorf("Thumbnail expected a 100x50 jpeg but received %+v, %v", header, err)
+	}
+
+	// The same content again is the same media, but can't be made private
+	again, err := Save(content, 8, false)
+	if err != nil || again.Id != m.Id || again.UploadedBy != 7 {
+		t.Errorf("Upload of the same content expected %s by 7 but received %+v, %v", m.Id, again, err)
+	}
+	if again, err := Save(content, 8, true); err != ErrPublic {
+		t.Errorf("Private upload of public content expected=%v but received %+v, %v", ErrPublic, again, err)
+	}
+	if got, err := Get(m.Id); err != nil || got.Url != m.Url {
+		t.Errorf("Get expected %q but received %+v, %v", m.Url, got, err)
+	}
+
+	video := append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), make([]byte, 64)...)
+	if m, err := Save(video, 7, false); err != nil || m.ContentType != "video/mp4" || m.Thumb != "" || m.ThumbUrl != "" {
+		t.Errorf("Video expected without thumbnail but received %+v, %v", m, err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		content  []byte
+		expected error
+	}{
+		{"text", []byte("just some text"), ErrUnsupported},
+		{"too wide", encodePng(t, 1001, 10), ErrDimensions},
+		{"truncated", content[:len(content)/2], ErrCorrupt},
+		{"too large", make([]byte, cfg.Media.MaxBytes+1), ErrTooLarge},
+	} {
+		if _, err := Save(test.content, 7, false); err != test.expected {
+			t.Errorf("Save of %s expected=%v but received=%v", test.name, test.expected, err)
+		}
+	}
+
+	// Private media are kept apart and get signed urls
+	private, err := Save(encodePng(t, 20, 20), 7, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !private.Private || !blob.Private(private.Name) || !blob.Private(private.Thumb) {
+		t.Errorf("Private media expected under %s but received %+v", blob.PrivatePrefix, private)
+	}
+	if !strings.HasPrefix(private.Url, cfg.Blob.BaseUrl+private.Name+"?") || !strings.Contains(private.Url, blob.Signature+"=") {
+		t.Errorf("Private media expected a signed url but received %q", private.Url)
+	}
+}
+
+func encodePng(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,68 @@
+package media
+
+import (
+	"image"
+	"image/draw"
+)
+
+/*
+Purpose : Scales an image down for thumbnails
+Input : The image and the longest side of the thumbnail in pixels
+Outputs : The thumbnail, each of its pixels the average of those it covers in the image
+Remark : Images already small enough keep their size. Transparent parts turn white, thumbnails being jpeg
+*/
+func Thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := thumbSize(b.Dx(), b.Dy(), size)
+
+	// A flat copy makes reading the pixels cheap whatever the image type
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Over)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		// Rows y0 to y1 of the image make row y of the thumbnail. The
+		// thumbnail being no larger, there is at least one
+		y0, y1 := y*b.Dy()/h, (y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := x*b.Dx()/w, (x+1)*b.Dx()/w
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += int(src.Pix[i])
+					sum[1] += int(src.Pix[i+1])
+					sum[2] += int(src.Pix[i+2])
+					sum[3] += int(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			j := dst.PixOffset(x, y)
+			for k := range sum {
+				dst.Pix[j+k] = uint8(sum[k] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// thumbSize fits w by h within size by size, keeping the ratio
+func thumbSize(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		th := h * size / w
+		if th < 1 {
+			th = 1
+		}
+		return size, th
+	}
+	tw := w * size / h
+	if tw < 1 {
+		tw = 1
+	}
+	return tw, size
+}
@@ -9,13 +9,15 @@ import (
 	c "rob/lib/common/constants"
 	"rob/lib/common/httperr"
 	lh "rob/lib/common/loghelper"
+	"rob/lib/config"
+	"rob/lib/datastore"
+	"strconv"
 	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/handlers"
 	log "github.com/sirupsen/logrus"
-	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -25,11 +27,10 @@ var PhRe = regexp.MustCompile("^[789]\\d{9}$")
 func Common(h http.Handler) http.Handler {
 	h = handlers.LoggingHandler(os.Stdout, h)
 
-	var enableCSRF = false
+	cfg := config.Get().CSRF
 
-	CSRF := csrf.Protect([]byte("AJSD@*JD82!#$S@@DS(*HJDnasd2*@#"), csrf.Secure(false))
-
-	if enableCSRF {
+	if cfg.Enable {
+		CSRF := csrf.Protect([]byte(cfg.Key), csrf.Secure(cfg.Secure))
 		h = CSRF(h)
 	}
 
@@ -94,21 +95,26 @@ func CheckExistanceMysql(tableName string, fieldName string, fieldValue string,
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	db, err := sql.Open("mysql", c.DbUri)
+	db, err := sql.Open("mysql", config.Get().Mysql.Uri())
 	if err != nil {
 		lh.Mysql.ConnectError(err)
 		return false, err
 	}
 	defer db.Close()
-	var exists bool
-	queryString := fmt.Sprintf("SELECT exists (SELECT * FROM %s WHERE %s='%s')", tableName, fieldName, fieldValue)
-	queryInt := fmt.Sprintf("SELECT exists (SELECT * FROM %s WHERE %s=%s)", tableName, fieldName, fieldValue)
-
-	query := queryString
+	// Table and field names come from constants, only the value is user input
+	// so it's bound to the placeholder
+	var value interface{} = fieldValue
 	if isInt {
-		query = queryInt
+		value, err = strconv.Atoi(fieldValue)
+		if err != nil {
+			return false, err
+		}
 	}
-	err = db.QueryRow(query).Scan(&exists)
+
+	var exists bool
+	query := fmt.Sprintf("SELECT exists (SELECT * FROM %s WHERE %s=?)", tableName, fieldName)
+	lh.Mysql.Query(query)
+	err = db.QueryRow(query, value).Scan(&exists)
 	if err != nil && err != sql.ErrNoRows {
 		log.Error("error checking if row exists", err)
 		return false, err
@@ -124,14 +130,14 @@ func CheckExistanceMongo(collection string, id string) (bool, error) {
 	}).Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	session, err := mgo.Dial(c.Server)
+	session, err := datastore.MongoSession()
 	if err != nil {
 		lh.Mongo.ConnectError(err)
 		return false, err
 	}
 	defer session.Close()
 
-	c := session.DB(c.DbName).C(collection)
+	c := session.DB(config.Get().Mongo.DbName).C(collection)
 	count, err := c.Find(bson.M{"_id": bson.ObjectIdHex(id)}).Count()
 	if err != nil {
 		lh.Mongo.ReadError(err)
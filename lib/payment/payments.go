@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	c "rob/lib/common/constants"
 	"rob/lib/common/types"
+	"rob/lib/config"
 	"rob/lib/data"
 	"strconv"
 )
@@ -42,15 +42,15 @@ func InitiateTransaction(orderId int, email string) (*types.HashResponse, error)
 	}
 	response.FirstName = user.FirstName.String
 	response.Email = email
-	response.Key = c.PayUKey
+	response.Key = config.Get().PayU.Key
 	address, err := data.GetAddress(order.AddressId)
 	if err != nil {
 		return nil, err
 	}
 	phone, _ := strconv.Atoi(address.Phone)
 	response.Phone = phone
-	response.Surl = c.Surl
-	response.Furl = c.Furl
+	response.Surl = config.Get().PayU.Surl
+	response.Furl = config.Get().PayU.Furl
 	inStock, err := data.IsProductInStock(order.ProductId)
 	if err != nil {
 		return nil, err
@@ -73,7 +73,7 @@ func InitiateTransaction(orderId int, email string) (*types.HashResponse, error)
 		log.Error(err.Error())
 		return nil, err
 	}
-	var hashString = response.Key + "|" + strconv.Itoa(response.TxnId) + "|" + strconv.Itoa(response.Amount) + "|" + response.ProductInfo + "|" + response.FirstName + "|" + response.Email + "|||||||||||" + c.PayUSalt
+	var hashString = response.Key + "|" + strconv.Itoa(response.TxnId) + "|" + strconv.Itoa(response.Amount) + "|" + response.ProductInfo + "|" + response.FirstName + "|" + response.Email + "|||||||||||" + config.Get().PayU.Salt
 	s512 := sha512.New()
 	s512.Write([]byte(hashString))
 	response.Hash = fmt.Sprintf("%s", fmt.Sprintf("%x", s512.Sum(nil)))
@@ -0,0 +1,187 @@
+package push
+
+import (
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"rob/lib/datastore"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Waits between attempts, replaced by tests
+var sleep = time.Sleep
+
+// Notifications being sent in the background
+var pending sync.WaitGroup
+
+/*
+Purpose : Records a notification and sends it in the background to the devices of its target
+Input : The notification, with its title, body, data, target and creator
+Outputs : The notification as recorded, with its id and recipients
+Remark : ErrDisabled when no transport is configured. The status turns to c.NotificationDone once every device was tried
+*/
+func Notify(n types.Notification) (*types.Notification, error) {
+	var funcName = "push/dispatch.go:Notify"
+	log.WithFields(log.Fields{
+		"target":   n.Target,
+		"targetId": n.TargetId,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	t, err := Current()
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := datastore.GetPushTokens(n.Target, n.TargetId)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Status = c.NotificationSending
+	n.Recipients = len(tokens)
+	n.Sent, n.Failed, n.Pruned = 0, 0, 0
+	n.TimeOfCreation = time.Now().UTC().UnixNano()
+	n.TimeOfCompletion = 0
+	if n.Id, err = datastore.AddNotification(n); err != nil {
+		return nil, err
+	}
+
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		dispatch(t, n, tokens)
+	}()
+	return &n, nil
+}
+
+// Wait returns once every notification sent so far was tried on all its
+// devices
+func Wait() {
+	pending.Wait()
+}
+
+// dispatch sends n to the devices of tokens, config.Get().Push.Workers at
+// once, and records how it went
+func dispatch(t Transport, n types.Notification, tokens []types.PushToken) {
+	var funcName = "push/dispatch.go:dispatch"
+	log.WithFields(log.Fields{
+		"notificationId": n.Id,
+		"recipients":     len(tokens),
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	msg := Message{Title: n.Title, Body: n.Body, Data: n.Data}
+	queue := make(chan types.PushToken)
+	var mu sync.Mutex
+	var workers sync.WaitGroup
+	for i := 0; i < config.Get().Push.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for token := range queue {
+				d := deliver(t, token, msg)
+				d.NotificationId = n.Id
+				if d.Status == c.DeliveryInvalid {
+					if err := datastore.ClearPushToken(token.UserId, token.Token); err != nil {
+						log.WithFields(log.Fields{
+							"userId": token.UserId,
+						}).Errorf("Couldn't prune the token: %v", err)
+					}
+				}
+				if err := datastore.AddDelivery(d); err != nil {
+					log.WithFields(log.Fields{
+						"notificationId": n.Id,
+						"userId":         token.UserId,
+					}).Errorf("Couldn't record the delivery: %v", err)
+				}
+
+				mu.Lock()
+				switch d.Status {
+				case c.DeliverySent:
+					n.Sent++
+				case c.DeliveryInvalid:
+					n.Pruned++
+				default:
+					n.Failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, token := range tokens {
+		queue <- token
+	}
+	close(queue)
+	workers.Wait()
+
+	n.Status = c.NotificationDone
+	n.TimeOfCompletion = time.Now().UTC().UnixNano()
+	if err := datastore.UpdateNotification(n); err != nil {
+		log.WithFields(log.Fields{
+			"notificationId": n.Id,
+		}).Errorf("Couldn't record the notification as done: %v", err)
+	}
+}
+
+// deliver sends msg to one device, trying again after temporary failures
+// up to config.Get().Push.MaxAttempts times
+func deliver(t Transport, token types.PushToken, msg Message) types.Delivery {
+	cfg := config.Get().Push
+	d := types.Delivery{UserId: token.UserId}
+	for {
+		d.Attempts++
+		id, err := t.Send(token.Token, msg)
+		if err == nil {
+			d.Status = c.DeliverySent
+			d.MessageId = id
+			d.Error = ""
+			break
+		}
+		d.Error = truncate(err.Error(), c.MaxDeliveryError)
+		if err == ErrUnregistered {
+			d.Status = c.DeliveryInvalid
+			break
+		}
+		retry, ok := err.(*RetryableError)
+		if !ok || d.Attempts >= cfg.MaxAttempts {
+			d.Status = c.DeliveryFailed
+			break
+		}
+		wait := backoff(cfg, d.Attempts)
+		if retry.After > wait {
+			wait = retry.After
+		}
+		if max := time.Duration(cfg.MaxBackoff) * time.Millisecond; wait > max {
+			wait = max
+		}
+		sleep(wait)
+	}
+	d.TimeOfCreation = time.Now().UTC().UnixNano()
+	return d
+}
+
+// backoff is the wait after the given failed attempt, Backoff doubled on
+// each next one up to MaxBackoff
+func backoff(cfg config.Push, attempt int) time.Duration {
+	max := time.Duration(cfg.MaxBackoff) * time.Millisecond
+	wait := time.Duration(cfg.Backoff) * time.Millisecond
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
+
+// truncate keeps the first n characters of s, so that it fits its column
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,269 @@
+package push
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"rob/lib/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope of the access tokens FCM takes
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// Longest Retry-After taken as is, in seconds, so that it can't overflow
+const maxRetryAfter = 24 * 60 * 60
+
+// Error codes of FCM telling that a token is of no use anymore
+var unregisteredCodes = map[string]bool{
+	"UNREGISTERED":       true,
+	"SENDER_ID_MISMATCH": true,
+}
+
+// FCM sends messages through the HTTP v1 api of Firebase Cloud Messaging,
+// authorized by a service account of the project
+type FCM struct {
+	client   *http.Client
+	endpoint string
+	project  string
+	account  serviceAccount
+
+	// Access token and when it expires
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// serviceAccount holds the fields used of the json key of a service account
+type serviceAccount struct {
+	ProjectId   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// NewFCM reads the service account key of cfg
+func NewFCM(cfg config.Push) (*FCM, error) {
+	content, err := ioutil.ReadFile(cfg.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(content, &account); err != nil {
+		return nil, fmt.Errorf("Invalid service account key %s: %v", cfg.Credentials, err)
+	}
+	if account.key, err = parseKey(account.PrivateKey); err != nil {
+		return nil, fmt.Errorf("Invalid private key in %s: %v", cfg.Credentials, err)
+	}
+	if cfg.TokenUrl != "" {
+		account.TokenUri = cfg.TokenUrl
+	}
+	project := cfg.ProjectId
+	if project == "" {
+		project = account.ProjectId
+	}
+	if project == "" || account.ClientEmail == "" || account.TokenUri == "" {
+		return nil, fmt.Errorf("Service account key %s lacks the project, the client email or the token uri", cfg.Credentials)
+	}
+
+	return &FCM{
+		client:   &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second},
+		endpoint: strings.TrimSuffix(cfg.Endpoint, "/"),
+		project:  project,
+		account:  account,
+	}, nil
+}
+
+func parseKey(p string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(p))
+	if block == nil {
+		return nil, errors.New("no pem block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not a rsa key")
+	}
+	return rsaKey, nil
+}
+
+type fcmMessage struct {
+	Message struct {
+		Token        string            `json:"token"`
+		Notification fcmNotification   `json:"notification"`
+		Data         map[string]string `json:"data,omitempty"`
+	} `json:"message"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+type fcmError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// Send posts msg to the device of token and returns the name FCM gave it
+func (f *FCM) Send(token string, msg Message) (string, error) {
+	var body fcmMessage
+	body.Message.Token = token
+	body.Message.Notification = fcmNotification{Title: msg.Title, Body: msg.Body}
+	body.Message.Data = msg.Data
+	content, err := json.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+
+	access, err := f.accessToken()
+	if err != nil {
+		return "", &RetryableError{Err: err}
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/projects/%s/messages:send", f.endpoint, f.project), bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+access)
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return "", &RetryableError{Err: err}
+	}
+	defer res.Body.Close()
+	reply, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", &RetryableError{Err: err}
+	}
+
+	if res.StatusCode == http.StatusOK {
+		var sent struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(reply, &sent); err != nil {
+			return "", err
+		}
+		return sent.Name, nil
+	}
+
+	var failure fcmError
+	json.Unmarshal(reply, &failure)
+	err = fmt.Errorf("FCM replied %d %s %s", res.StatusCode, failure.Error.Status, failure.Error.Message)
+	for _, d := range failure.Error.Details {
+		if unregisteredCodes[d.ErrorCode] {
+			return "", ErrUnregistered
+		}
+	}
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		// The access token may have been revoked, a new one is asked for
+		f.mu.Lock()
+		f.token = ""
+		f.mu.Unlock()
+		return "", &RetryableError{Err: err}
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError:
+		retry := &RetryableError{Err: err}
+		if s, serr := strconv.Atoi(res.Header.Get("Retry-After")); serr == nil && s > 0 {
+			if s > maxRetryAfter {
+				s = maxRetryAfter
+			}
+			retry.After = time.Duration(s) * time.Second
+		}
+		return "", retry
+	}
+	return "", err
+}
+
+// accessToken returns the access token, asking for a new one when it is
+// about to expire
+func (f *FCM) accessToken() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.token != "" && now.Add(time.Minute).Before(f.expires) {
+		return f.token, nil
+	}
+
+	assertion, err := f.account.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	res, err := f.client.PostForm(f.account.TokenUri, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token service replied %d", res.StatusCode)
+	}
+	var reply struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&reply); err != nil {
+		return "", err
+	}
+	if reply.AccessToken == "" {
+		return "", errors.New("Token service gave no access token")
+	}
+	f.token = reply.AccessToken
+	f.expires = now.Add(time.Duration(reply.ExpiresIn) * time.Second)
+	return f.token, nil
+}
+
+// assertion is the jwt signed by the service account that the token service
+// exchanges for an access token
+func (a serviceAccount) assertion(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   a.ClientEmail,
+		"scope": fcmScope,
+		"aud":   a.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
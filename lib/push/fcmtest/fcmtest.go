@@ -0,0 +1,265 @@
+// Package fcmtest runs a local stand-in for Firebase Cloud Messaging and
+// the service giving it access tokens, to test sending notifications
+// without reaching Google
+package fcmtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Project the fake server serves
+const Project = "fcmtest"
+
+const clientEmail = "push@fcmtest.iam.gserviceaccount.com"
+
+// Sent is a message the server accepted
+type Sent struct {
+	Name  string
+	Token string
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// Server is the fake FCM, with Credentials the path of a service account
+// key it accepts
+type Server struct {
+	*httptest.Server
+	Credentials string
+
+	key *rsa.PrivateKey
+
+	mu           sync.Mutex
+	accessTokens map[string]bool
+	sent         []Sent
+	unregistered map[string]bool
+	failures     map[string]int
+	attempts     map[string]int
+}
+
+// NewServer starts the server and writes the key of its service account
+// in dir
+func NewServer(dir string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		key:          key,
+		accessTokens: map[string]bool{},
+		unregistered: map[string]bool{},
+		failures:     map[string]int{},
+		attempts:     map[string]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc(fmt.Sprintf("/v1/projects/%s/messages:send", Project), s.send)
+	s.Server = httptest.NewServer(mux)
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	account, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   Project,
+		"client_email": clientEmail,
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    s.URL + "/token",
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.Credentials = filepath.Join(dir, "fcmtest.json")
+	if err := ioutil.WriteFile(s.Credentials, account, 0600); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Unregister makes the server reject token as FCM does for an app that
+// was uninstalled
+func (s *Server) Unregister(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unregistered[token] = true
+}
+
+// FailTimes makes the next n messages to token fail as if FCM was
+// unavailable
+func (s *Server) FailTimes(token string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[token] = n
+}
+
+// Sent lists the messages accepted, in the order they came
+func (s *Server) Sent() []Sent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sent{}, s.sent...)
+}
+
+// Attempts counts the messages to token, accepted or not
+func (s *Server) Attempts(token string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[token]
+}
+
+// token exchanges a jwt signed by the service account for an access token
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+		http.Error(w, `{"error":"unsupported_grant_type"}`, http.StatusBadRequest)
+		return
+	}
+	if err := s.verify(r.FormValue("assertion")); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid_grant","error_description":%q}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	access := fmt.Sprintf("access-%d", len(s.accessTokens)+1)
+	s.accessTokens[access] = true
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": access,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+	})
+}
+
+// verify checks the signature and the claims of the jwt
+func (s *Server) verify(assertion string) error {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("malformed jwt")
+	}
+	enc := base64.RawURLEncoding
+	signature, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&s.key.PublicKey, crypto.SHA256, sum[:], signature); err != nil {
+		return err
+	}
+	content, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		Iss   string `json:"iss"`
+		Scope string `json:"scope"`
+		Aud   string `json:"aud"`
+		Exp   int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(content, &claims); err != nil {
+		return err
+	}
+	switch {
+	case claims.Iss != clientEmail:
+		return fmt.Errorf("unknown issuer %s", claims.Iss)
+	case claims.Scope != "https://www.googleapis.com/auth/firebase.messaging":
+		return fmt.Errorf("unexpected scope %s", claims.Scope)
+	case claims.Aud != s.URL+"/token":
+		return fmt.Errorf("unexpected audience %s", claims.Aud)
+	case claims.Exp < time.Now().Unix():
+		return fmt.Errorf("expired")
+	}
+	return nil
+}
+
+// send accepts a message unless its token was unregistered or made to fail
+func (s *Server) send(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Message struct {
+			Token        string `json:"token"`
+			Notification struct {
+				Title string `json:"title"`
+				Body  string `json:"body"`
+			} `json:"notification"`
+			Data map[string]string `json:"data"`
+		} `json:"message"`
+	}
+	if r.Method != http.MethodPost {
+		fail(w, http.StatusMethodNotAllowed, "INVALID_ARGUMENT", "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.accessTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+		fail(w, http.StatusUnauthorized, "UNAUTHENTICATED", "")
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Message.Token == "" {
+		fail(w, http.StatusBadRequest, "INVALID_ARGUMENT", "INVALID_ARGUMENT")
+		return
+	}
+
+	token := req.Message.Token
+	s.attempts[token]++
+	if s.unregistered[token] {
+		fail(w, http.StatusNotFound, "NOT_FOUND", "UNREGISTERED")
+		return
+	}
+	if s.failures[token] > 0 {
+		s.failures[token]--
+		fail(w, http.StatusServiceUnavailable, "UNAVAILABLE", "UNAVAILABLE")
+		return
+	}
+
+	sent := Sent{
+		Name:  fmt.Sprintf("projects/%s/messages/%d", Project, len(s.sent)+1),
+		Token: token,
+		Title: req.Message.Notification.Title,
+		Body:  req.Message.Notification.Body,
+		Data:  req.Message.Data,
+	}
+	s.sent = append(s.sent, sent)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"name": sent.Name})
+}
+
+// fail replies with an error shaped like those of FCM
+func fail(w http.ResponseWriter, code int, status, errorCode string) {
+	details := []map[string]string{}
+	if errorCode != "" {
+		details = append(details, map[string]string{
+			"@type":     "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+			"errorCode": errorCode,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": http.StatusText(code),
+			"status":  status,
+			"details": details,
+		},
+	})
+}
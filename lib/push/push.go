@@ -0,0 +1,102 @@
+// Package push sends notifications to the devices users registered with
+// Firebase, to one user, to the subscribers of a mascot, to the users of a
+// role or to everyone. Each device is retried with backoff, tokens Firebase
+// no longer knows are pruned and the fate of every device is recorded
+package push
+
+import (
+	"errors"
+	"fmt"
+	"rob/lib/config"
+	"sync"
+	"time"
+)
+
+// ErrUnregistered tells that the token no longer reaches a device, only
+// when FCM says so in the details of its error
+var ErrUnregistered = errors.New("The registration token is no longer valid")
+
+// ErrDisabled is returned when no transport is configured
+var ErrDisabled = errors.New("Push notifications are not configured")
+
+// RetryableError is a failure that may pass when tried again, after After
+// if the service said how long to wait
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("Temporary failure: %v", e.Err)
+}
+
+// Message is what is shown on the device, with data passed on to the app
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+type Transport interface {
+	// Sends msg to the device of token and returns the id of the message.
+	// ErrUnregistered when the token is no longer valid, *RetryableError
+	// when trying again may help
+	Send(token string, msg Message) (string, error)
+}
+
+var (
+	transport   Transport
+	transportMu sync.Mutex
+)
+
+/*
+Purpose : Opens the transport described by config.Get().Push
+Input : None
+Outputs : Error if the service account key can't be used
+Remark : Called at start-up. Without Credentials nothing is opened and sending returns ErrDisabled
+*/
+func Init() error {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	t, err := Open(config.Get().Push)
+	if err == ErrDisabled {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	transport = t
+	return nil
+}
+
+// Open returns the FCM transport of cfg, ErrDisabled without Credentials
+func Open(cfg config.Push) (Transport, error) {
+	if cfg.Credentials == "" {
+		return nil, ErrDisabled
+	}
+	return NewFCM(cfg)
+}
+
+// Use replaces the transport returned by Current
+func Use(t Transport) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+	transport = t
+}
+
+// Current returns the transport in use, opening the configured one if there
+// is none yet
+func Current() (Transport, error) {
+	transportMu.Lock()
+	defer transportMu.Unlock()
+
+	if transport == nil {
+		t, err := Open(config.Get().Push)
+		if err != nil {
+			return nil, err
+		}
+		transport = t
+	}
+	return transport, nil
+}
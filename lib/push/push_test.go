@@ -0,0 +1,292 @@
+package push
+
+import (
+	"database/sql"
+	"errors"
+	c "rob/lib/common/constants"
+	"rob/lib/common/types"
+	"rob/lib/config"
+	"rob/lib/datastore"
+	"rob/lib/push/fcmtest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func newServer(t *testing.T) (*fcmtest.Server, *config.Config) {
+	server, err := fcmtest.NewServer(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	cfg := config.Defaults(config.Test)
+	cfg.Push.Credentials = server.Credentials
+	cfg.Push.Endpoint = server.URL
+	cfg.Push.MaxAttempts = 3
+	cfg.Push.Backoff = 100
+	cfg.Push.Workers = 2
+	return server, cfg
+}
+
+func TestFCM(t *testing.T) {
+	server, cfg := newServer(t)
+	fcm, err := NewFCM(cfg.Push)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := Message{Title: "Hello", Body: "World", Data: map[string]string{"PostId": "42"}}
+	name, err := fcm.Send("device-1", msg)
+	if err != nil || name != "projects/fcmtest/messages/1" {
+		t.Fatalf("Send expected projects/fcmtest/messages/1 but received %q, %v", name, err)
+	}
+	sent := server.Sent()
+	if len(sent) != 1 || sent[0].Token != "device-1" || sent[0].Title != "Hello" || sent[0].Body != "World" || sent[0].Data["PostId"] != "42" {
+		t.Errorf("Sent message mismatch %+v", sent)
+	}
+	// The access token is kept for the next message
+	access := fcm.token
+	if _, err := fcm.Send("device-2", msg); err != nil || fcm.token != access {
+		t.Errorf("Access token expected reused, %v", err)
+	}
+
+	server.Unregister("device-3")
+	if _, err := fcm.Send("device-3", msg); err != ErrUnregistered {
+		t.Errorf("Unregistered token expected=%v but received=%v", ErrUnregistered, err)
+	}
+	server.FailTimes("device-4", 1)
+	if _, err := fcm.Send("device-4", msg); err == nil {
+		t.Error("Unavailable FCM expected to fail")
+	} else if _, ok := err.(*RetryableError); !ok {
+		t.Errorf("Unavailable FCM expected a RetryableError but received %v", err)
+	}
+
+	// A revoked access token is replaced on the next attempt
+	fcm.token = "revoked"
+	if _, err := fcm.Send("device-4", msg); err == nil {
+		t.Error("Revoked access token expected to fail")
+	}
+	if _, err := fcm.Send("device-4", msg); err != nil {
+		t.Errorf("New access token expected to send but received %v", err)
+	}
+
+	// The key must sign for the token service
+	other, _ := newServer(t)
+	cfg.Push.TokenUrl = other.URL + "/token"
+	fcm, err = NewFCM(cfg.Push)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fcm.Send("device-1", msg); err == nil {
+		t.Error("Key of another service account expected refused")
+	}
+}
+
+// transportFunc sends through a function
+type transportFunc func(token string, msg Message) (string, error)
+
+func (f transportFunc) Send(token string, msg Message) (string, error) {
+	return f(token, msg)
+}
+
+func TestDeliverLongError(t *testing.T) {
+	reply := strings.Repeat("é", 2*c.MaxDeliveryError)
+	failing := transportFunc(func(token string, msg Message) (string, error) {
+		return "", errors.New(reply)
+	})
+	d := deliver(failing, types.PushToken{UserId: 1, Token: "device-1"}, Message{})
+	if d.Status != c.DeliveryFailed || d.Error != reply[:len("é")*c.MaxDeliveryError] {
+		t.Errorf("Error expected cut to %d characters but received %d", c.MaxDeliveryError, utf8.RuneCountInString(d.Error))
+	}
+	if truncate("short", 10) != "short" {
+		t.Error("Short error expected kept whole")
+	}
+}
+
+func TestDeliverCappedWait(t *testing.T) {
+	prevConfig, prevSleep := config.Get(), sleep
+	defer func() {
+		config.Use(prevConfig)
+		sleep = prevSleep
+	}()
+	var waits []time.Duration
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+
+	// Neither a long Retry-After nor many attempts wait past MaxBackoff
+	cfg := config.Defaults(config.Test)
+	cfg.Push.MaxAttempts = 100
+	cfg.Push.Backoff = 100
+	cfg.Push.MaxBackoff = 1000
+	config.Use(cfg)
+	after := time.Duration(0)
+	busy := transportFunc(func(token string, msg Message) (string, error) {
+		return "", &RetryableError{Err: errors.New("busy"), After: after}
+	})
+	deliver(busy, types.PushToken{UserId: 1, Token: "device-1"}, Message{})
+	if len(waits) != 99 || waits[0] != 100*time.Millisecond || waits[3] != 800*time.Millisecond || waits[98] != time.Second {
+		t.Errorf("Waits expected to double from 100ms up to 1s but received=%v", waits)
+	}
+	waits = nil
+	after = 1000 * time.Hour
+	deliver(busy, types.PushToken{UserId: 1, Token: "device-1"}, Message{})
+	for _, wait := range waits {
+		if wait != time.Second {
+			t.Fatalf("Retry-After expected cut to 1s but received=%v", wait)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	prevStore, prevConfig, prevSleep := datastore.Current(), config.Get(), sleep
+	defer func() {
+		datastore.Use(prevStore)
+		config.Use(prevConfig)
+		Use(nil)
+		sleep = prevSleep
+	}()
+	// Workers sleep at once
+	var mu sync.Mutex
+	var waits []time.Duration
+	sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
+	}
+
+	// Without credentials nothing is sent
+	config.Use(config.Defaults(config.Test))
+	Use(nil)
+	if _, err := Notify(types.Notification{Target: c.TargetAll}); err != ErrDisabled {
+		t.Fatalf("Notify expected=%v but received=%v", ErrDisabled, err)
+	}
+
+	server, cfg := newServer(t)
+	config.Use(cfg)
+	Use(nil)
+	store := datastore.NewMemStore()
+	datastore.Use(store)
+
+	// Users 1 to 4 have a device, 5 has none
+	for i := 1; i <= 5; i++ {
+		if err := store.AddUser(types.User{Phone: sql.NullString{String: strconv.Itoa(i), Valid: true}}); err != nil {
+			t.Fatal(err)
+		}
+		if i < 5 {
+			store.UpdateToken(i, "device-"+strconv.Itoa(i))
+		}
+	}
+	store.AddMascot(1, "Mascot", "")
+	store.Subscribe(2, 1)
+	store.Subscribe(3, 1)
+	store.Subscribe(5, 1)
+	store.InsertRole(4, c.WriterRole)
+
+	// Device 2 fails once, 3 is gone and 4 always fails
+	server.FailTimes("device-2", 1)
+	server.Unregister("device-3")
+	server.FailTimes("device-4", 10)
+
+	n, err := Notify(types.Notification{
+		Title:     "Hello",
+		Body:      "Subscribers",
+		Data:      map[string]string{"MascotId": "1"},
+		Target:    c.TargetMascot,
+		TargetId:  1,
+		CreatedBy: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Id == 0 || n.Status != c.NotificationSending || n.Recipients != 2 {
+		t.Errorf("Notification expected sending to 2 devices but received %+v", n)
+	}
+	Wait()
+
+	stored, err := datastore.GetNotification(n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != c.NotificationDone || stored.Sent != 1 || stored.Pruned != 1 || stored.Failed != 0 || stored.TimeOfCompletion == 0 {
+		t.Errorf("Notification expected done with 1 sent and 1 pruned but received %+v", stored)
+	}
+	deliveries, err := datastore.GetDeliveries(n.Id)
+	if err != nil || len(deliveries) != 2 {
+		t.Fatalf("2 deliveries expected but received %+v, %v", deliveries, err)
+	}
+	if d := deliveries[0]; d.UserId != 2 || d.Status != c.DeliverySent || d.Attempts != 2 || d.MessageId == "" || d.Error != "" {
+		t.Errorf("Delivery to user 2 expected sent on the second attempt but received %+v", d)
+	}
+	if d := deliveries[1]; d.UserId != 3 || d.Status != c.DeliveryInvalid || d.Attempts != 1 {
+		t.Errorf("Delivery to user 3 expected invalid but received %+v", d)
+	}
+	if _, has := store.PushToken(3); has {
+		t.Error("Token of user 3 expected pruned")
+	}
+	if len(waits) != 1 || waits[0] != 100*time.Millisecond {
+		t.Errorf("Waits expected=[100ms] but received=%v", waits)
+	}
+
+	// The backoff doubles until the attempts run out
+	waits = nil
+	n, err = Notify(types.Notification{Title: "Hello", Body: "Writers", Target: c.TargetRole, TargetId: c.WriterRole})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	deliveries, _ = datastore.GetDeliveries(n.Id)
+	if len(deliveries) != 1 || deliveries[0].Status != c.DeliveryFailed || deliveries[0].Attempts != 3 || deliveries[0].Error == "" {
+		t.Errorf("Delivery to user 4 expected failed after 3 attempts but received %+v", deliveries)
+	}
+	if len(waits) != 2 || waits[0] != 100*time.Millisecond || waits[1] != 200*time.Millisecond {
+		t.Errorf("Waits expected=[100ms 200ms] but received=%v", waits)
+	}
+	if server.Attempts("device-4") != 3 {
+		t.Errorf("Attempts on device 4 expected=3 but received=%d", server.Attempts("device-4"))
+	}
+
+	// Everyone left with a device, the pruned token is not tried again
+	n, err = Notify(types.Notification{Title: "Hello", Body: "Everyone", Target: c.TargetAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	stored, _ = datastore.GetNotification(n.Id)
+	if stored.Recipients != 3 || stored.Sent != 2 || stored.Failed != 1 {
+		t.Errorf("Notification to everyone expected 2 of 3 sent but received %+v", stored)
+	}
+	if server.Attempts("device-3") != 1 {
+		t.Errorf("Pruned device expected not tried again but was tried %d times", server.Attempts("device-3"))
+	}
+
+	// A single user
+	n, err = Notify(types.Notification{Title: "Hello", Body: "You", Target: c.TargetUser, TargetId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	sent := server.Sent()
+	if last := sent[len(sent)-1]; last.Token != "device-1" || last.Body != "You" {
+		t.Errorf("Message to user 1 expected last but received %+v", last)
+	}
+
+	// A 404 without details, as for a wrong project, fails without pruning
+	cfg.Push.ProjectId = "unknown"
+	Use(nil)
+	n, err = Notify(types.Notification{Title: "Hello", Body: "Lost", Target: c.TargetUser, TargetId: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Wait()
+	deliveries, _ = datastore.GetDeliveries(n.Id)
+	if len(deliveries) != 1 || deliveries[0].Status != c.DeliveryFailed || deliveries[0].Attempts != 1 {
+		t.Errorf("Delivery to an unknown project expected failed but received %+v", deliveries)
+	}
+	if _, has := store.PushToken(1); !has {
+		t.Error("Token of user 1 expected kept after a bare 404")
+	}
+}
@@ -2,21 +2,29 @@ package session
 
 import (
 	"net/http"
+	"rob/lib/config"
 
 	"github.com/gorilla/sessions"
 )
 
 var (
-	store  *sessions.CookieStore
-	name   = "sesid"
-	secret = "@r4B?EhaSEh_drudR7P_hdsa=s#s2Pah"
-	esec   = "@71S_D_@3d86!@0-"
+	store *sessions.CookieStore
+	name  string
 )
 
 func init() {
-	store = sessions.NewCookieStore([]byte(secret), []byte(esec))
+	Init()
+}
+
+// Init (re)creates the cookie store from config.Get().Session.
+// Call it again after loading a configuration
+func Init() {
+	cfg := config.Get().Session
+
+	name = cfg.Name
+	store = sessions.NewCookieStore([]byte(cfg.HashKey), []byte(cfg.BlockKey))
 	store.Options.HttpOnly = true
-	store.Options.MaxAge = 0
+	store.Options.MaxAge = cfg.MaxAge
 }
 
 func Instance(r *http.Request) *sessions.Session {
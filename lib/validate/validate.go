@@ -1,16 +1,23 @@
 package validate
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	neturl "net/url"
 	"regexp"
 	c "rob/lib/common/constants"
 	"rob/lib/common/types"
 	"strconv"
 	"strings"
+
+	"gopkg.in/mgo.v2/bson"
 )
 
 var Re = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
 var PhRe = regexp.MustCompile("^[789]\\d{9}$")
+var ColorRe = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
+var HashRe = regexp.MustCompile("^[0-9a-f]{64}$")
 
 func Feed(lastSync, mascotId, flag string) (int64, int, int, error) {
 	// lastSync should be valid integer
@@ -39,6 +46,162 @@ func Feed(lastSync, mascotId, flag string) (int64, int, int, error) {
 	return ls, ms, f, nil
 }
 
+// FeedPage validates the cursor mode of the feed. The cursor itself is
+// opaque here and checked when decoded
+func FeedPage(mascotId, pageSize string) (int, int, error) {
+	// mascotId should be valid integer
+	ms, err := strconv.Atoi(mascotId)
+	if err != nil {
+		return 0, 0, errors.New("mascotId is not a valid Integer")
+	}
+
+	ps, err := PageSize(pageSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return ms, ps, nil
+}
+
+// PostLinkSchedule validates the optional publish and expiry times of a
+// post link, in unix nanoseconds. A link is published at now unless a later
+// time is given, and never expires unless an expiry is given
+func PostLinkSchedule(publishAt, expireAt string, now int64) (int64, int64, error) {
+	publish := now
+	if publishAt != "" {
+		p, err := strconv.ParseInt(publishAt, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("publishAt is not a valid Integer")
+		}
+		// Backdated links would be missed by clients already past them
+		if p > now {
+			publish = p
+		}
+	}
+
+	var expire int64
+	if expireAt != "" {
+		e, err := strconv.ParseInt(expireAt, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("expireAt is not a valid Integer")
+		}
+		if e <= publish {
+			return 0, 0, errors.New("expireAt must be after publishAt")
+		}
+		expire = e
+	}
+
+	return publish, expire, nil
+}
+
+// Comment validates the body of a comment, up to maxLength bytes once
+// trimmed, and the optional comment it replies to
+func Comment(body, parentId string, maxLength int) (string, int, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", 0, errors.New("Body cannot be empty")
+	}
+	if len(body) > maxLength {
+		return "", 0, errors.New("Body is too long")
+	}
+	parent, err := optionalId(parentId, "ParentId")
+	if err != nil {
+		return "", 0, err
+	}
+	return body, parent, nil
+}
+
+// CommentPage validates the optional parent comment, the comment to read
+// after and the page size of a list of comments
+func CommentPage(parentId, after, pageSize string) (int, int, int, error) {
+	parent, err := optionalId(parentId, "ParentId")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	a, err := optionalId(after, "After")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ps, err := PageSize(pageSize)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return parent, a, ps, nil
+}
+
+// Search validates a search query, the number of results to skip and the
+// page size
+func Search(query, offset, pageSize string) (string, int, int, error) {
+	q := strings.TrimSpace(query)
+	if q == "" {
+		return "", 0, 0, errors.New("Query is missing")
+	}
+	if len([]rune(q)) > c.MaxSearchQuery {
+		return "", 0, 0, fmt.Errorf("Query is longer than %d characters", c.MaxSearchQuery)
+	}
+	o, err := optionalId(offset, "Offset")
+	if err != nil {
+		return "", 0, 0, errors.New("Offset is not a valid Integer")
+	}
+	if o > c.MaxSearchOffset {
+		return "", 0, 0, errors.New("Offset out of range")
+	}
+	ps, err := PageSize(pageSize)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	return q, o, ps, nil
+}
+
+// CardTypes validates the card types a search is limited to, none for all
+func CardTypes(values []string) ([]int, error) {
+	var cardTypes []int
+	for _, v := range values {
+		ctn, err := strconv.Atoi(v)
+		if err != nil || !validCardType(ctn) {
+			return nil, fmt.Errorf("Invalid cardType %q", v)
+		}
+		cardTypes = append(cardTypes, ctn)
+	}
+	return cardTypes, nil
+}
+
+func validCardType(cardType int) bool {
+	for _, x := range c.CardTypes {
+		if cardType == x {
+			return true
+		}
+	}
+	return false
+}
+
+// optionalId is the non negative integer id, 0 when it is empty
+func optionalId(id, name string) (int, error) {
+	if id == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s is not a valid Id", name)
+	}
+	return n, nil
+}
+
+// PageSize validates the optional size of a feed page
+func PageSize(pageSize string) (int, error) {
+	if pageSize == "" {
+		return c.DefaultPageSize, nil
+	}
+	ps, err := strconv.Atoi(pageSize)
+	if err != nil {
+		return 0, errors.New("pageSize is not a valid Integer")
+	}
+	if ps < 1 || ps > c.MaxPageSize {
+		return 0, errors.New("pageSize out of range")
+	}
+	return ps, nil
+}
+
 func Payment(orderId string) (int, error) {
 	OrderId, err := strconv.Atoi(orderId)
 	if err != nil {
@@ -76,76 +239,351 @@ func CreatePost(cardType, src, dpSrc, title,
 	desc, buttonText, url, icon, gradientStart,
 	gradientEnd string, childPosts []string) (types.Post, error) {
 
+	form := neturl.Values{
+		c.CardType:      {cardType},
+		c.Src:           {src},
+		c.DpSrc:         {dpSrc},
+		c.Title:         {title},
+		c.Description:   {desc},
+		c.ButtonText:    {buttonText},
+		c.Url:           {url},
+		c.Icon:          {icon},
+		c.GradientStart: {gradientStart},
+		c.GradientEnd:   {gradientEnd},
+		c.ChildPosts:    childPosts,
+	}
+	return Post(form)
+}
+
+/*
+Purpose : Validates the card of a post sent as a form
+Input : The form, only the content fields of the post are read from it
+Outputs : The post with its content filled in
+Remark : The fields particular to a card type are checked by its rule in cardRules
+*/
+func Post(form neturl.Values) (types.Post, error) {
 	var p types.Post
 
-	ctn, err := strconv.Atoi(cardType)
+	ctn, err := strconv.Atoi(form.Get(c.CardType))
 	if err != nil {
 		return p, errors.New("Invalid cardType")
 	}
 
-	// valid card type?
-	validCardType := false
-	for _, x := range c.CardTypes {
-		if ctn == x {
-			validCardType = true
-			break
+	if !validCardType(ctn) {
+		return p, errors.New("Invalid cardType value")
+	}
+
+	p.CardType = ctn
+	p.Title = form.Get(c.Title)
+	p.DpSrc = form.Get(c.DpSrc)
+	p.Src = form.Get(c.Src)
+	p.Description = form.Get(c.Description)
+	p.ButtonText = form.Get(c.ButtonText)
+	p.Url = form.Get(c.Url)
+	p.Icon = form.Get(c.Icon)
+	p.GradientStart = form.Get(c.GradientStart)
+	p.GradientEnd = form.Get(c.GradientEnd)
+	p.ChildPosts = form[c.ChildPosts]
+
+	if p.Title == "" {
+		return p, errors.New("Title cannot be empty")
+	}
+
+	if rule, ok := cardRules[ctn]; ok {
+		if err := rule(&p, form); err != nil {
+			return types.Post{}, err
 		}
 	}
+	return p, nil
+}
 
-	if !validCardType {
-		return p, errors.New("Invalid cardType value")
+// PostValues is the form of the content of p, as read by Post
+func PostValues(p types.Post) neturl.Values {
+	form := neturl.Values{
+		c.CardType:      {strconv.Itoa(p.CardType)},
+		c.Src:           {p.Src},
+		c.DpSrc:         {p.DpSrc},
+		c.Title:         {p.Title},
+		c.Description:   {p.Description},
+		c.ButtonText:    {p.ButtonText},
+		c.Url:           {p.Url},
+		c.Icon:          {p.Icon},
+		c.GradientStart: {p.GradientStart},
+		c.GradientEnd:   {p.GradientEnd},
+		c.ChildPosts:    p.ChildPosts,
+		c.Poster:        {p.Poster},
+		c.Duration:      {strconv.Itoa(p.Duration)},
+		c.Media:         p.Media,
+		c.ProductId:     {p.ProductId},
+		c.SaleId:        {strconv.Itoa(p.SaleId)},
+		c.Options:       p.Options,
+		c.ClosesAt:      {strconv.FormatInt(p.ClosesAt, 10)},
 	}
+	return form
+}
 
-	if title == "" {
-		return p, errors.New("Title cannot be empty")
+// cardRules checks the fields particular to each card type and fills in
+// those only that type has. The title is checked before for all of them
+var cardRules = map[int]func(p *types.Post, form neturl.Values) error{
+	c.CardTypeImage:    dataCard,
+	c.CardTypeGif:      dataCard,
+	c.CardTypeArticle:  articleCard,
+	c.CardTypeList:     listCard,
+	c.CardTypeVideo:    videoCard,
+	c.CardTypeCarousel: carouselCard,
+	c.CardTypeProduct:  productCard,
+	c.CardTypeSale:     saleCard,
+	c.CardTypePoll:     pollCard,
+}
+
+func dataCard(p *types.Post, form neturl.Values) error {
+	if p.DpSrc == "" {
+		return errors.New("DpSrc cannot be empty for datacard")
+	}
+	if p.Src == "" {
+		return errors.New("Src cannot be empty for datacard")
+	}
+	return nil
+}
+
+func articleCard(p *types.Post, form neturl.Values) error {
+	if err := dataCard(p, form); err != nil {
+		return err
+	}
+	if p.ButtonText == "" {
+		return errors.New("ButtonText cannot be empty for articleCard")
+	}
+	if p.Url == "" {
+		return errors.New("Url cannot be empty for articleCard")
+	}
+	return nil
+}
+
+func listCard(p *types.Post, form neturl.Values) error {
+	if len(p.ChildPosts) == 0 {
+		return errors.New("ChildPosts cannot be empty for ListCard")
+	}
+	if p.Icon == "" || p.GradientStart == "" || p.GradientEnd == "" {
+		return errors.New("Icon, GradientStart, GradientEnd cannot be empty for ListCard")
+	}
+	return nil
+}
+
+// Src is the video itself
+func videoCard(p *types.Post, form neturl.Values) error {
+	if p.Src == "" {
+		return errors.New("Src cannot be empty for VideoCard")
+	}
+	p.Poster = form.Get(c.Poster)
+	if p.Poster == "" {
+		return errors.New("Poster cannot be empty for VideoCard")
+	}
+	d, err := strconv.Atoi(form.Get(c.Duration))
+	if err != nil {
+		return errors.New("Duration is not a valid Integer")
+	}
+	if d < 1 || d > c.MaxVideoDuration {
+		return errors.New("Duration out of range")
+	}
+	p.Duration = d
+	return nil
+}
+
+func carouselCard(p *types.Post, form neturl.Values) error {
+	media := form[c.Media]
+	if len(media) < c.MinCarouselMedia || len(media) > c.MaxCarouselMedia {
+		return fmt.Errorf("CarouselCard takes %d to %d Media", c.MinCarouselMedia, c.MaxCarouselMedia)
+	}
+	for _, m := range media {
+		if m == "" {
+			return errors.New("Media cannot be empty for CarouselCard")
+		}
+	}
+	p.Media = media
+	return nil
+}
+
+// The product is looked up when the card is shown, for its live price and
+// stock
+func productCard(p *types.Post, form neturl.Values) error {
+	p.ProductId = form.Get(c.ProductId)
+	if !bson.IsObjectIdHex(p.ProductId) {
+		return errors.New("Invalid ProductId for ProductCard")
+	}
+	return nil
+}
+
+// The title is the question. ClosesAt is optional, in unix nanoseconds
+func pollCard(p *types.Post, form neturl.Values) error {
+	options := append([]string{}, form[c.Options]...)
+	if len(options) < c.MinPollOptions || len(options) > c.MaxPollOptions {
+		return fmt.Errorf("PollCard takes %d to %d Options", c.MinPollOptions, c.MaxPollOptions)
 	}
+	seen := make(map[string]bool, len(options))
+	for i, o := range options {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			return errors.New("Options cannot be empty for PollCard")
+		}
+		if seen[o] {
+			return errors.New("Options of a PollCard must differ")
+		}
+		seen[o] = true
+		options[i] = o
+	}
+	p.Options = options
 
-	datacard := false
-	if ctn == c.CardTypeImage ||
-		ctn == c.CardTypeArticle ||
-		ctn == c.CardTypeGif {
-		datacard = true
+	if closesAt := form.Get(c.ClosesAt); closesAt != "" {
+		t, err := strconv.ParseInt(closesAt, 10, 64)
+		if err != nil || t < 0 {
+			return errors.New("Invalid ClosesAt for PollCard")
+		}
+		p.ClosesAt = t
 	}
+	return nil
+}
 
-	if datacard && dpSrc == "" {
-		return p, errors.New("DpSrc cannot be empty for datacard")
+func saleCard(p *types.Post, form neturl.Values) error {
+	id, err := strconv.Atoi(form.Get(c.SaleId))
+	if err != nil || id < 1 {
+		return errors.New("Invalid SaleId for SaleCard")
 	}
+	p.SaleId = id
+	return nil
+}
 
-	if datacard && src == "" {
-		return p, errors.New("Src cannot be empty for datacard")
+// Mascot validates the editable fields of a mascot. Avatar and colors are
+// optional
+func Mascot(name, desc, avatar, gradientStart, gradientEnd string) (types.Mascot, error) {
+	var m types.Mascot
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return m, errors.New("Name cannot be empty")
 	}
+	if len(name) > c.MaxMascotName {
+		return m, errors.New("Name is too long")
+	}
+	if len(desc) > c.MaxMascotDesc {
+		return m, errors.New("Description is too long")
+	}
+	if len(avatar) > c.MaxMascotAvatar {
+		return m, errors.New("Avatar is too long")
+	}
+	if avatar != "" && !strings.HasPrefix(avatar, "http://") && !strings.HasPrefix(avatar, "https://") {
+		return m, errors.New("Avatar should be a http(s) url")
+	}
+	for _, color := range []string{gradientStart, gradientEnd} {
+		if color != "" && !ColorRe.MatchString(color) {
+			return m, errors.New("Colors should be like #1a2b3c")
+		}
+	}
+
+	m.Name = name
+	m.Description = desc
+	m.Avatar = avatar
+	m.GradientStart = gradientStart
+	m.GradientEnd = gradientEnd
+
+	return m, nil
+}
 
-	if ctn == c.CardTypeArticle {
-		if buttonText == "" {
-			return p, errors.New("ButtonText cannot be empty for articleCard")
+/*
+Purpose : Validates an url added to the manifest of the app
+Input : The url, its optional priority and, when the server isn't to download it, its sha256 in hex and size
+Outputs : The entry of the manifest
+Remark : Hash and size go together
+*/
+func CacheUrl(url, priority, hash, size string) (types.ManifestEntry, error) {
+	var e types.ManifestEntry
+
+	if len(url) > c.MaxCacheUrl {
+		return e, errors.New("Url is too long")
+	}
+	if u, err := neturl.Parse(url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return e, errors.New("Url should be a http(s) url")
+	}
+	p, err := optionalId(priority, "Priority")
+	if err != nil || p > c.MaxPriority {
+		return e, fmt.Errorf("Priority should be between 0 and %d", c.MaxPriority)
+	}
+	if (hash == "") != (size == "") {
+		return e, errors.New("Hash and Size go together")
+	}
+	if hash != "" {
+		if !HashRe.MatchString(hash) {
+			return e, errors.New("Hash should be a sha256 in lower case hex")
 		}
-		if url == "" {
-			return p, errors.New("Url cannot be empty for articleCard")
+		if e.Size, err = strconv.ParseInt(size, 10, 64); err != nil || e.Size < 0 {
+			return e, errors.New("Size should be a number, 0 or more")
 		}
 	}
 
-	if ctn == c.CardTypeList {
-		if len(childPosts) == 0 {
-			return p, errors.New("ChildPosts cannot be empty for ListCard")
+	e.Url = url
+	e.Priority = p
+	e.Hash = hash
+	return e, nil
+}
+
+/*
+Purpose : Validates a push notification
+Input : Its title, body, data as a json object of strings, target and the id of the user, mascot or role targeted
+Outputs : The notification
+Remark : Data is optional, as is the target id for c.TargetAll
+*/
+func Notification(title, body, data, target, targetId string) (types.Notification, error) {
+	var n types.Notification
+
+	n.Title = strings.TrimSpace(title)
+	if n.Title == "" || len(n.Title) > c.MaxNotificationTitle {
+		return n, fmt.Errorf("Title should be 1 to %d characters", c.MaxNotificationTitle)
+	}
+	n.Body = strings.TrimSpace(body)
+	if n.Body == "" || len(n.Body) > c.MaxNotificationBody {
+		return n, fmt.Errorf("Body should be 1 to %d characters", c.MaxNotificationBody)
+	}
+	if data != "" {
+		if len(data) > c.MaxNotificationData {
+			return n, fmt.Errorf("Data should be at most %d characters", c.MaxNotificationData)
 		}
-		if icon == "" || gradientStart == "" || gradientEnd == "" {
-			return p, errors.New("Icon, GradientStart, GradientEnd cannot be empty for ListCard")
+		if err := json.Unmarshal([]byte(data), &n.Data); err != nil {
+			return n, errors.New("Data should be a json object of strings")
 		}
 	}
 
-	p.CardType = ctn
-	p.Title = title
-	p.DpSrc = dpSrc
-	p.Src = src
-	p.Description = desc
-	p.ButtonText = buttonText
-	p.Url = url
-	p.Icon = icon
-	p.GradientStart = gradientStart
-	p.GradientEnd = gradientEnd
-	p.ChildPosts = childPosts
+	switch target {
+	case c.TargetAll:
+		if targetId != "" {
+			return n, errors.New("TargetId is not expected when targeting everyone")
+		}
+	case c.TargetUser, c.TargetMascot, c.TargetRole:
+		id, err := strconv.Atoi(targetId)
+		if err != nil || id <= 0 {
+			return n, errors.New("TargetId is not a valid Id")
+		}
+		n.TargetId = id
+	default:
+		return n, fmt.Errorf("Target should be one of %s, %s, %s or %s", c.TargetUser, c.TargetMascot, c.TargetRole, c.TargetAll)
+	}
+	n.Target = target
+	return n, nil
+}
 
-	return p, nil
+/*
+Purpose : Validates the version the app asks for the changes of the manifest since
+Input : The version, empty for 0
+Outputs : The version
+Remark :
+*/
+func ManifestVersion(since string) (int64, error) {
+	if since == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || v < 0 {
+		return 0, errors.New("Since should be a version, 0 or more")
+	}
+	return v, nil
 }
 
 func ValidPhoneNumber(p string) bool {
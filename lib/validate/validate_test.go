@@ -1,6 +1,11 @@
 package validate
 
-import "testing"
+import (
+	"net/url"
+	c "rob/lib/common/constants"
+	"strings"
+	"testing"
+)
 
 func TestFeed(t *testing.T) {
 	type params struct {
@@ -89,3 +94,291 @@ func TestCreatePost(t *testing.T) {
 		}
 	}
 }
+
+func TestPost(t *testing.T) {
+	form := func(kv ...string) url.Values {
+		v := url.Values{}
+		for i := 0; i < len(kv); i += 2 {
+			v.Add(kv[i], kv[i+1])
+		}
+		return v
+	}
+	video := func(duration string) url.Values {
+		return form(c.CardType, "5", c.Title, "t", c.Src, "s", c.Poster, "p", c.Duration, duration)
+	}
+	carousel := func(media ...string) url.Values {
+		v := form(c.CardType, "6", c.Title, "t")
+		v[c.Media] = media
+		return v
+	}
+
+	invalid := []url.Values{
+		form(c.CardType, "10", c.Title, "t"),
+		form(c.CardType, "5", c.Title, "t", c.Src, "s", c.Duration, "10"),
+		video("abc"),
+		video("0"),
+		video("601"),
+		carousel("a"),
+		carousel("a", ""),
+		carousel("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"),
+		form(c.CardType, "7", c.Title, "t"),
+		form(c.CardType, "7", c.Title, "t", c.ProductId, "abc"),
+		form(c.CardType, "8", c.Title, "t", c.SaleId, "0"),
+		form(c.CardType, "9", c.Title, "t", c.Options, "a"),
+		form(c.CardType, "9", c.Title, "t", c.Options, "a", c.Options, "a "),
+		form(c.CardType, "9", c.Title, "t", c.Options, "a", c.Options, "b", c.ClosesAt, "-1"),
+	}
+	for _, v := range invalid {
+		if _, err := Post(v); err == nil {
+			t.Errorf("Expected Post validate to fail but it passed for %v", v)
+		}
+	}
+
+	p, err := Post(video("600"))
+	if err != nil || p.Duration != 600 || p.Poster != "p" {
+		t.Errorf("Video card validate failed. Received %+v, %v", p, err)
+	}
+	p, err = Post(carousel("b", "a"))
+	if err != nil || strings.Join(p.Media, ",") != "b,a" {
+		t.Errorf("Carousel card validate failed. Received %+v, %v", p, err)
+	}
+	p, err = Post(form(c.CardType, "9", c.Title, "t", c.Options, " b", c.Options, "a", c.ClosesAt, "5"))
+	if err != nil || strings.Join(p.Options, ",") != "b,a" || p.ClosesAt != 5 {
+		t.Errorf("Poll card validate failed. Received %+v, %v", p, err)
+	}
+	// Fields of other card types are left out
+	v := form(c.CardType, "8", c.Title, "t", c.SaleId, "3", c.Poster, "p", c.ProductId, "5b0e0b3c1d41c82e6c3c7d1a")
+	p, err = Post(v)
+	if err != nil || p.SaleId != 3 || p.Poster != "" || p.ProductId != "" {
+		t.Errorf("Sale card validate failed. Received %+v, %v", p, err)
+	}
+	// The form of a post validates to the same post
+	if again, err := Post(PostValues(p)); err != nil || again.SaleId != p.SaleId || again.Title != p.Title {
+		t.Errorf("PostValues round trip failed. Received %+v, %v", again, err)
+	}
+}
+
+func TestComment(t *testing.T) {
+	for _, p := range [][2]string{{"", ""}, {"   ", ""}, {"hello world!", ""}, {"hi", "-1"}, {"hi", "abc"}} {
+		if _, _, err := Comment(p[0], p[1], 10); err == nil {
+			t.Errorf("Expected Comment validate to fail but it passed for Body=%q ParentId=%q", p[0], p[1])
+		}
+	}
+	body, parent, err := Comment("  hello  ", "3", 5)
+	if err != nil || body != "hello" || parent != 3 {
+		t.Errorf("Comment validate failed. Received %q, %d, %v", body, parent, err)
+	}
+
+	if _, _, _, err := CommentPage("", "-2", ""); err == nil {
+		t.Error("Expected CommentPage validate to fail but it passed for After=-2")
+	}
+	parent, after, ps, err := CommentPage("", "", "")
+	if err != nil || parent != 0 || after != 0 || ps != c.DefaultPageSize {
+		t.Errorf("CommentPage validate failed. Received %d, %d, %d, %v", parent, after, ps, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	for _, p := range [][3]string{{"", "", ""}, {"  ", "", ""}, {"x", "abc", ""}, {"x", "-1", ""}, {"x", "1001", ""}, {"x", "", "0"}} {
+		if _, _, _, err := Search(p[0], p[1], p[2]); err == nil {
+			t.Errorf("Expected Search validate to fail but it passed for Query=%q Offset=%q PageSize=%q", p[0], p[1], p[2])
+		}
+	}
+	query, offset, ps, err := Search(" rain jacket ", "", "")
+	if err != nil || query != "rain jacket" || offset != 0 || ps != c.DefaultPageSize {
+		t.Errorf("Search validate failed. Received %q, %d, %d, %v", query, offset, ps, err)
+	}
+
+	if _, err := CardTypes([]string{"1", "99"}); err == nil {
+		t.Error("Expected CardTypes validate to fail but it passed for 99")
+	}
+	cardTypes, err := CardTypes([]string{"1", "3"})
+	if err != nil || len(cardTypes) != 2 || cardTypes[0] != 1 || cardTypes[1] != 3 {
+		t.Errorf("CardTypes validate failed. Received %v, %v", cardTypes, err)
+	}
+}
+
+func TestFeedPage(t *testing.T) {
+	var invalidParams = [][2]string{
+		{"abc", "10"},
+		{"", "10"},
+		{"1", "abc"},
+		{"1", "0"},
+		{"1", "-5"},
+		{"1", "101"},
+	}
+
+	for _, p := range invalidParams {
+		if _, _, err := FeedPage(p[0], p[1]); err == nil {
+			t.Errorf("FeedPage validate failed. Expected=error but received "+
+				"nil for values MascotId=%s PageSize=%s", p[0], p[1])
+		}
+	}
+
+	var validParams = []struct {
+		MascotId         string
+		PageSize         string
+		ExpectedMascotId int
+		ExpectedPageSize int
+	}{
+		{"1", "", 1, 20},
+		{"2", "1", 2, 1},
+		{"3", "100", 3, 100},
+	}
+
+	for _, p := range validParams {
+		ms, ps, err := FeedPage(p.MascotId, p.PageSize)
+		if err != nil {
+			t.Errorf("FeedPage validate failed. Expected=nil but received '%s'", err.Error())
+		}
+		if ms != p.ExpectedMascotId || ps != p.ExpectedPageSize {
+			t.Errorf("FeedPage validate failed. Expected=(%d, %d) but received (%d, %d)",
+				p.ExpectedMascotId, p.ExpectedPageSize, ms, ps)
+		}
+	}
+}
+
+func TestPostLinkSchedule(t *testing.T) {
+	var now int64 = 1000
+
+	var invalidParams = [][2]string{
+		{"abc", ""},
+		{"", "abc"},
+		{"", "1000"},
+		{"", "500"},
+		{"2000", "2000"},
+		{"2000", "1500"},
+	}
+
+	for _, p := range invalidParams {
+		if _, _, err := PostLinkSchedule(p[0], p[1], now); err == nil {
+			t.Errorf("PostLinkSchedule validate failed. Expected=error but received "+
+				"nil for values PublishAt=%s ExpireAt=%s", p[0], p[1])
+		}
+	}
+
+	var validParams = []struct {
+		PublishAt       string
+		ExpireAt        string
+		ExpectedPublish int64
+		ExpectedExpire  int64
+	}{
+		{"", "", 1000, 0},
+		{"2000", "", 2000, 0},
+		{"2000", "3000", 2000, 3000},
+		// Backdated links are published now
+		{"10", "", 1000, 0},
+		{"", "1001", 1000, 1001},
+	}
+
+	for _, p := range validParams {
+		publish, expire, err := PostLinkSchedule(p.PublishAt, p.ExpireAt, now)
+		if err != nil {
+			t.Errorf("PostLinkSchedule validate failed. Expected=nil but received '%s'", err.Error())
+		}
+		if publish != p.ExpectedPublish || expire != p.ExpectedExpire {
+			t.Errorf("PostLinkSchedule validate failed. Expected=(%d, %d) but received (%d, %d)",
+				p.ExpectedPublish, p.ExpectedExpire, publish, expire)
+		}
+	}
+}
+
+func TestMascot(t *testing.T) {
+	long := strings.Repeat("a", 256)
+
+	var invalidParams = [][5]string{
+		{"", "", "", "", ""},
+		{"   ", "desc", "", "", ""},
+		{long[:51], "", "", "", ""},
+		{"Name", long, "", "", ""},
+		{"Name", "", "ftp://img.png", "", ""},
+		{"Name", "", "https://" + long, "", ""},
+		{"Name", "", "", "red", ""},
+		{"Name", "", "", "#123456", "#12345g"},
+	}
+
+	for _, p := range invalidParams {
+		if _, err := Mascot(p[0], p[1], p[2], p[3], p[4]); err == nil {
+			t.Errorf("Mascot validate failed. Expected=error but received nil for values %q", p)
+		}
+	}
+
+	m, err := Mascot(" Name ", "desc", "https://cdn.twiq.in/m.png", "#123456", "#ABCDEF")
+	if err != nil {
+		t.Fatalf("Mascot validate failed. Expected=nil but received '%s'", err.Error())
+	}
+	if m.Name != "Name" || m.Description != "desc" || m.Avatar != "https://cdn.twiq.in/m.png" ||
+		m.GradientStart != "#123456" || m.GradientEnd != "#ABCDEF" {
+		t.Errorf("Mascot validate failed. Received %+v", m)
+	}
+}
+
+func TestCacheUrl(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	var invalidParams = [][4]string{
+		{"", "", "", ""},
+		{"/img/a.png", "", "", ""},
+		{"ftp://cdn.twiq.in/a.png", "", "", ""},
+		{"https://cdn.twiq.in/" + strings.Repeat("a", 500), "", "", ""},
+		{"https://cdn.twiq.in/a.png", "-1", "", ""},
+		{"https://cdn.twiq.in/a.png", "101", "", ""},
+		{"https://cdn.twiq.in/a.png", "", hash, ""},
+		{"https://cdn.twiq.in/a.png", "", "", "10"},
+		{"https://cdn.twiq.in/a.png", "", strings.ToUpper(hash), "10"},
+		{"https://cdn.twiq.in/a.png", "", hash, "-1"},
+	}
+
+	for _, p := range invalidParams {
+		if _, err := CacheUrl(p[0], p[1], p[2], p[3]); err == nil {
+			t.Errorf("CacheUrl validate failed. Expected=error but received nil for values %q", p)
+		}
+	}
+
+	e, err := CacheUrl("https://cdn.twiq.in/a.png", "5", hash, "10")
+	if err != nil {
+		t.Fatalf("CacheUrl validate failed. Expected=nil but received '%s'", err.Error())
+	}
+	if e.Url != "https://cdn.twiq.in/a.png" || e.Priority != 5 || e.Hash != hash || e.Size != 10 {
+		t.Errorf("CacheUrl validate failed. Received %+v", e)
+	}
+	if e, err := CacheUrl("http://cdn.twiq.in/a.png", "", "", ""); err != nil || e.Priority != 0 || e.Hash != "" {
+		t.Errorf("CacheUrl without priority and hash failed. Received %+v, %v", e, err)
+	}
+}
+
+func TestNotification(t *testing.T) {
+	var invalidParams = [][5]string{
+		{"", "Body", "", c.TargetAll, ""},
+		{"  ", "Body", "", c.TargetAll, ""},
+		{strings.Repeat("a", 101), "Body", "", c.TargetAll, ""},
+		{"Title", "", "", c.TargetAll, ""},
+		{"Title", strings.Repeat("a", 1001), "", c.TargetAll, ""},
+		{"Title", "Body", "[1]", c.TargetAll, ""},
+		{"Title", "Body", `{"a":1}`, c.TargetAll, ""},
+		{"Title", "Body", `{"a":"` + strings.Repeat("a", 2048) + `"}`, c.TargetAll, ""},
+		{"Title", "Body", "", c.TargetAll, "1"},
+		{"Title", "Body", "", c.TargetUser, ""},
+		{"Title", "Body", "", c.TargetMascot, "0"},
+		{"Title", "Body", "", c.TargetRole, "a"},
+		{"Title", "Body", "", "group", "1"},
+		{"Title", "Body", "", "", ""},
+	}
+
+	for _, p := range invalidParams {
+		if _, err := Notification(p[0], p[1], p[2], p[3], p[4]); err == nil {
+			t.Errorf("Notification validate failed. Expected=error but received nil for values %q", p)
+		}
+	}
+
+	n, err := Notification(" Title ", "Body", `{"PostId":"42"}`, c.TargetMascot, "3")
+	if err != nil {
+		t.Fatalf("Notification validate failed. Expected=nil but received '%s'", err.Error())
+	}
+	if n.Title != "Title" || n.Body != "Body" || n.Data["PostId"] != "42" || n.Target != c.TargetMascot || n.TargetId != 3 {
+		t.Errorf("Notification validate failed. Received %+v", n)
+	}
+	if n, err := Notification("Title", "Body", "", c.TargetAll, ""); err != nil || n.Data != nil || n.TargetId != 0 {
+		t.Errorf("Notification to everyone failed. Received %+v, %v", n, err)
+	}
+}
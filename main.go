@@ -1,34 +1,45 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"rob/lib/aws"
+	"rob/lib/blob"
 	c "rob/lib/common/constants"
 	"rob/lib/common/httperr"
 	"rob/lib/common/httpsucc"
 	"rob/lib/common/types"
+	"rob/lib/config"
 	"rob/lib/data"
+	cache "rob/lib/datacache"
 	"rob/lib/datastore"
 	"rob/lib/feed"
+	"rob/lib/media"
 	mw "rob/lib/middleware"
 	payment "rob/lib/payment"
+	"rob/lib/push"
 	"rob/lib/validate"
 	//"rob/lib/queue"
 	"rob/lib/session"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -285,9 +296,17 @@ func getPostHandler(w http.ResponseWriter, r *http.Request) {
 		httperr.DB(w, "Failed to fetch post from the DB", &err)
 		return
 	}
+	if post.Status == c.StatusDeleted {
+		httperr.E(w, http.StatusNotFound, fmt.Sprintf("No post exists for %s", pid), nil)
+		return
+	}
 
 	posts := make([]types.Post, 1)
-	posts[0] = *post
+	posts[0], err = feed.Tally(*post, session.Instance(r).Values[c.Id].(int))
+	if err != nil {
+		httperr.DB(w, "Failed to fetch the votes of the post", &err)
+		return
+	}
 
 	j, err := json.Marshal(posts)
 
@@ -311,27 +330,1686 @@ func createPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, err := validate.CreatePost(r.FormValue(c.CardType),
-		r.FormValue(c.Src), r.FormValue(c.DpSrc),
-		r.FormValue(c.Title), r.FormValue(c.Description),
-		r.FormValue(c.ButtonText), r.FormValue(c.Url),
-		r.FormValue(c.Icon), r.FormValue(c.GradientStart),
-		r.FormValue(c.GradientEnd), r.PostForm[c.ChildPosts])
-
-	if err != nil {
+	if !mediaUrls(w, r.PostForm, postMedia) {
+		return
+	}
+	p, err := validate.Post(r.PostForm)
+
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !checkCardRefs(w, p) {
+		return
+	}
+	if p.ClosesAt != 0 && p.ClosesAt <= time.Now().UTC().UnixNano() {
+		httperr.E(w, http.StatusBadRequest, "ClosesAt must be in the future", nil)
+		return
+	}
+
+	// Posts by writers reach users once an admin approves them
+	sess := session.Instance(r)
+	p.CreatedBy = sess.Values[c.Id].(int)
+	p.Status = c.StatusPublished
+	if sess.Values[c.RoleId].(int) == c.WriterRole {
+		p.Status = c.StatusDraft
+	}
+
+	postId, err := data.AddPost(p)
+
+	if err != nil {
+		httperr.DB(w, "Failed to create a post", &err)
+		return
+	}
+	log.Debugf("Created postId=%s", postId)
+
+	j, err := json.Marshal(postId)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+// Edits a post. Fields not sent keep their value and the result has to
+// pass the same checks as a new post of its card type
+func editPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:editPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if err := r.ParseForm(); err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request Form"), &err)
+		return
+	}
+
+	postId := r.FormValue(c.PostId)
+	old, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+
+	if !checkEditable(w, r, old) {
+		return
+	}
+
+	if !mediaUrls(w, r.PostForm, postMedia) {
+		return
+	}
+	// Fields left out of the form keep their values
+	form := validate.PostValues(*old)
+	for key, v := range r.PostForm {
+		form[key] = v
+	}
+
+	p, err := validate.Post(form)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if !checkCardRefs(w, p) || !checkPollOptions(w, old, p) {
+		return
+	}
+	for _, childId := range p.ChildPosts {
+		if childId == postId {
+			httperr.E(w, http.StatusBadRequest, "A post cannot be its own child", nil)
+			return
+		}
+	}
+
+	p.Id = old.Id
+	p.EditedBy = session.Instance(r).Values[c.Id].(int)
+
+	err = data.UpdatePost(p)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to edit the post", &err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"postId":   postId,
+		"editedBy": p.EditedBy,
+	}).Info("Post edited")
+	httpsucc.SuccWithMessage(w, "Post updated successfully")
+}
+
+func createPostLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:createPostLinkHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	mascotId := r.FormValue(c.MascotId)
+	mId, err := strconv.Atoi(mascotId)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "Invalid Request Parameters", &err)
+		return
+	}
+
+	// makse sure the post exists
+	post, err := datastore.GetPostMetaData(postId)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "Invalid postId or post does not exists", &err)
+		return
+	}
+	if post.Status == c.StatusDeleted {
+		httperr.E(w, http.StatusBadRequest, "Post is in the trash", nil)
+		return
+	}
+	if post.Status != "" && post.Status != c.StatusPublished {
+		httperr.E(w, http.StatusBadRequest, "Only approved posts can be linked", nil)
+		return
+	}
+
+	publishAt, expireAt, ok := postLinkSchedule(w, r, mId)
+	if !ok {
+		return
+	}
+
+	err = datastore.PostLink(mId, postId, publishAt, expireAt)
+	if err != nil {
+		httperr.DB(w, "Failed to create a post link", &err)
+		return
+	}
+	//queue.AddItemToQueue(postId, mId)
+
+	httpsucc.SuccWithMessage(w, "Post successfully linked to mascot")
+
+}
+
+// Checks that the mascot takes posts and reads the PublishAt and ExpireAt
+// of the request. The error response is written when it returns false
+func postLinkSchedule(w http.ResponseWriter, r *http.Request, mascotId int) (int64, int64, bool) {
+	mascot, err := datastore.GetMascot(mascotId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusBadRequest, "Invalid mascotId or mascot does not exists", &err)
+			return 0, 0, false
+		}
+		httperr.DB(w, "Failed to retrieve the mascot", &err)
+		return 0, 0, false
+	}
+	if !mascot.IsActive {
+		httperr.E(w, http.StatusBadRequest, "Mascot is retired", nil)
+		return 0, 0, false
+	}
+
+	publishAt, expireAt, err := validate.PostLinkSchedule(
+		r.FormValue(c.PublishAt),
+		r.FormValue(c.ExpireAt),
+		time.Now().UTC().UnixNano())
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return 0, 0, false
+	}
+	return publishAt, expireAt, true
+}
+
+// Fetches a post out of the trash. The error response is written when it
+// returns false
+func lookupPost(w http.ResponseWriter, postId string) (*types.Post, bool) {
+	p, err := datastore.GetPostMetaData(postId)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No post exists for %s", postId), &err)
+			return nil, false
+		}
+		if err.Error() == "Invalid postId" {
+			httperr.E(w, http.StatusBadRequest, "Invalid postId", &err)
+			return nil, false
+		}
+		httperr.E(w, http.StatusInternalServerError, "Failed to retrieve the post", &err)
+		return nil, false
+	}
+	if p.Status == c.StatusDeleted {
+		httperr.E(w, http.StatusNotFound, fmt.Sprintf("Post %s is in the trash", postId), nil)
+		return nil, false
+	}
+	return p, true
+}
+
+// Product and sale cards have to show one that exists. The error response
+// is written when it returns false
+func checkCardRefs(w http.ResponseWriter, p types.Post) bool {
+	var err error
+	switch p.CardType {
+	case c.CardTypeProduct:
+		_, err = data.GetProduct(p.ProductId)
+	case c.CardTypeSale:
+		_, err = data.GetSale(p.SaleId)
+	}
+	if err == mgo.ErrNotFound || err == sql.ErrNoRows {
+		httperr.E(w, http.StatusBadRequest, "The product or sale of the card doesn't exist", &err)
+		return false
+	}
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to retrieve the product or sale of the card", &err)
+		return false
+	}
+	return true
+}
+
+// Users only act on the posts they get to see. Posts without a status
+// predate it and are published. The error response is written when it
+// returns false
+func checkPublished(w http.ResponseWriter, p *types.Post) bool {
+	if p.Status != "" && p.Status != c.StatusPublished {
+		httperr.E(w, http.StatusBadRequest, "Only published posts can be acted on", nil)
+		return false
+	}
+	return true
+}
+
+// Votes are kept by the index of their option, so the options of a poll
+// stay as they are once voted on. The error response is written when it
+// returns false
+func checkPollOptions(w http.ResponseWriter, old *types.Post, p types.Post) bool {
+	if old.CardType != c.CardTypePoll {
+		return true
+	}
+	if p.CardType == c.CardTypePoll && strings.Join(p.Options, "\n") == strings.Join(old.Options, "\n") {
+		return true
+	}
+	tallies, err := data.GetPollTallies([]string{old.Id.Hex()}, 0)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the votes of the poll", &err)
+		return false
+	}
+	if len(tallies) > 0 {
+		httperr.E(w, http.StatusBadRequest, "The Options of a poll can't change once voted on", nil)
+		return false
+	}
+	return true
+}
+
+// Writers edit their own posts until they are submitted. The error
+// response is written when it returns false
+func checkEditable(w http.ResponseWriter, r *http.Request, p *types.Post) bool {
+	sess := session.Instance(r)
+	if sess.Values[c.RoleId].(int) == c.AdminRole {
+		return true
+	}
+	if p.CreatedBy != sess.Values[c.Id].(int) {
+		httperr.E(w, http.StatusUnauthorized, "No such post belongs to the user", nil)
+		return false
+	}
+	if p.Status != c.StatusDraft && p.Status != c.StatusRejected {
+		httperr.E(w, http.StatusBadRequest, "Only drafts and rejected posts can be edited by writers", nil)
+		return false
+	}
+	return true
+}
+
+// Submits a draft or rejected post for review. Writers submit their own
+// posts
+func submitPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:submitPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	sess := session.Instance(r)
+	if sess.Values[c.RoleId].(int) != c.AdminRole && p.CreatedBy != sess.Values[c.Id].(int) {
+		httperr.E(w, http.StatusUnauthorized, "No such post belongs to the user", nil)
+		return
+	}
+	if p.Status != c.StatusDraft && p.Status != c.StatusRejected {
+		httperr.E(w, http.StatusBadRequest, "Only drafts and rejected posts can be submitted", nil)
+		return
+	}
+
+	err := data.SubmitPost(postId, sess.Values[c.Id].(int))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusConflict, "Post changed while submitting it, try again", &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Failed to submit the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Post submitted for review")
+}
+
+// Approves a submitted post, publishing it. Given a MascotId the post is
+// linked to that mascot as well, at PublishAt and until ExpireAt when given
+func approvePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:approvePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	if p.Status != c.StatusSubmitted {
+		httperr.E(w, http.StatusBadRequest, "Only submitted posts can be approved", nil)
+		return
+	}
+
+	// The schedule is checked before anything changes
+	var mascotId int
+	var publishAt, expireAt int64
+	if v := r.FormValue(c.MascotId); v != "" {
+		var err error
+		if mascotId, err = strconv.Atoi(v); err != nil {
+			httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
+			return
+		}
+		if publishAt, expireAt, ok = postLinkSchedule(w, r, mascotId); !ok {
+			return
+		}
+	}
+
+	sess := session.Instance(r)
+	err := data.ReviewPost(postId, c.StatusPublished, sess.Values[c.Id].(int), r.FormValue(c.Comment))
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusConflict, "Post changed while approving it, try again", &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Failed to approve the post", &err)
+		return
+	}
+
+	if mascotId != 0 {
+		if err := datastore.PostLink(mascotId, postId, publishAt, expireAt); err != nil {
+			httperr.DB(w, "Post approved but linking it to the mascot failed", &err)
+			return
+		}
+	}
+	httpsucc.SuccWithMessage(w, "Post approved")
+}
+
+// Rejects a submitted post. The Comment tells the writer what to change
+func rejectPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:rejectPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	comment := strings.TrimSpace(r.FormValue(c.Comment))
+	if comment == "" {
+		httperr.E(w, http.StatusBadRequest, "Comment cannot be empty", nil)
+		return
+	}
+	p, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	if p.Status != c.StatusSubmitted {
+		httperr.E(w, http.StatusBadRequest, "Only submitted posts can be rejected", nil)
+		return
+	}
+
+	sess := session.Instance(r)
+	err := data.ReviewPost(postId, c.StatusRejected, sess.Values[c.Id].(int), comment)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusConflict, "Post changed while rejecting it, try again", &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Failed to reject the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Post rejected")
+}
+
+// Lists the posts waiting for review, first submitted first
+func reviewQueueHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:reviewQueueHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	posts, err := datastore.GetSubmittedPosts()
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the posts to review", &err)
+		return
+	}
+
+	j, err := json.Marshal(posts)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Lists the posts created by the user with their status and review
+func myPostsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:myPostsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	sess := session.Instance(r)
+	posts, err := datastore.GetPostsCreatedBy(sess.Values[c.Id].(int))
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the posts", &err)
+		return
+	}
+
+	j, err := json.Marshal(posts)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Checks that the post exists and that writers only look at the history of
+// their own posts. Posts in the trash keep their history. The error
+// response is written when it returns false
+func checkHistory(w http.ResponseWriter, r *http.Request, postId string) bool {
+	p, err := datastore.GetPostMetaData(postId)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No post exists for %s", postId), &err)
+			return false
+		}
+		if err.Error() == "Invalid postId" {
+			httperr.E(w, http.StatusBadRequest, "Invalid postId", &err)
+			return false
+		}
+		httperr.E(w, http.StatusInternalServerError, "Failed to retrieve the post", &err)
+		return false
+	}
+	sess := session.Instance(r)
+	if sess.Values[c.RoleId].(int) != c.AdminRole && p.CreatedBy != sess.Values[c.Id].(int) {
+		httperr.E(w, http.StatusUnauthorized, "No such post belongs to the user", nil)
+		return false
+	}
+	return true
+}
+
+// Lists the revisions of a post, oldest first
+func revisionsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:revisionsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	if !checkHistory(w, r, postId) {
+		return
+	}
+
+	revisions, err := datastore.GetRevisions(postId)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the revisions", &err)
+		return
+	}
+
+	j, err := json.Marshal(revisions)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Reads the revision of the post numbered by the form value key. The error
+// response is written when it returns false
+func revisionParam(w http.ResponseWriter, r *http.Request, postId string, key string) (*types.Revision, bool) {
+	number, err := strconv.Atoi(r.FormValue(key))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("%s should be a revision number", key), &err)
+		return nil, false
+	}
+	revision, err := datastore.GetRevision(postId, number)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("Post %s has no revision %d", postId, number), &err)
+			return nil, false
+		}
+		httperr.DB(w, "Failed to retrieve the revision", &err)
+		return nil, false
+	}
+	return revision, true
+}
+
+// Lists the fields of a post changed between the revisions From and To
+func diffRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:diffRevisionsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	if !checkHistory(w, r, postId) {
+		return
+	}
+	from, ok := revisionParam(w, r, postId, c.From)
+	if !ok {
+		return
+	}
+	to, ok := revisionParam(w, r, postId, c.To)
+	if !ok {
+		return
+	}
+
+	j, err := json.Marshal(data.DiffPosts(from.Post, to.Post))
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Puts back the content a post had at a Revision. The status of the post
+// stays, and the revert is recorded as a new revision
+func revertPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:revertPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	old, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	if !checkEditable(w, r, old) {
+		return
+	}
+	revision, ok := revisionParam(w, r, postId, c.Revision)
+	if !ok {
+		return
+	}
+
+	// The content has to pass today's checks, its children may be gone
+	p, err := validate.Post(validate.PostValues(revision.Post))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Revision %d can't be restored: %s", revision.Number, err), nil)
+		return
+	}
+	if !checkCardRefs(w, p) || !checkPollOptions(w, old, p) {
+		return
+	}
+
+	p.Id = old.Id
+	p.EditedBy = session.Instance(r).Values[c.Id].(int)
+	if err := data.RevertPost(p, revision.Number); err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to revert the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, fmt.Sprintf("Post reverted to revision %d", revision.Number))
+}
+
+// Casts the vote of the user on a poll, once. The poll is returned with
+// the votes so far
+func voteHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:voteHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	if p.CardType != c.CardTypePoll {
+		httperr.E(w, http.StatusBadRequest, "The post is not a poll", nil)
+		return
+	}
+	if !checkPublished(w, p) {
+		return
+	}
+	if p.ClosesAt != 0 && p.ClosesAt <= time.Now().UTC().UnixNano() {
+		httperr.E(w, http.StatusBadRequest, "The poll is closed", nil)
+		return
+	}
+	option, err := strconv.Atoi(r.FormValue(c.Option))
+	if err != nil || option < 0 || option >= len(p.Options) {
+		httperr.E(w, http.StatusBadRequest, "Invalid Option", nil)
+		return
+	}
+
+	userId := session.Instance(r).Values[c.Id].(int)
+	err = data.AddVote(postId, userId, option)
+	if err == datastore.ErrAlreadyVoted {
+		httperr.E(w, http.StatusConflict, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to record the vote", &err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"postId": postId,
+		"userId": userId,
+		"option": option,
+	}).Info("Vote cast")
+
+	poll, err := feed.Tally(*p, userId)
+	if err != nil {
+		httperr.DB(w, "Failed to fetch the votes of the poll", &err)
+		return
+	}
+	j, err := json.Marshal(poll)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+func likePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:likePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	setEngagement(w, r, c.EngagementLike, true, "Post liked")
+}
+
+func unlikePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:unlikePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	setEngagement(w, r, c.EngagementLike, false, "Post unliked")
+}
+
+func savePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:savePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	setEngagement(w, r, c.EngagementSave, true, "Post saved")
+}
+
+func unsavePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:unsavePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	setEngagement(w, r, c.EngagementSave, false, "Post unsaved")
+}
+
+// Likes or saves the PostId of the request for the user, or takes that
+// back when on is false. Either can be done again without changing anything
+func setEngagement(w http.ResponseWriter, r *http.Request, kind int, on bool, message string) {
+	postId := r.FormValue(c.PostId)
+	if on {
+		p, ok := lookupPost(w, postId)
+		if !ok || !checkPublished(w, p) {
+			return
+		}
+	} else if !bson.IsObjectIdHex(postId) {
+		// Posts since deleted can still be unliked and unsaved
+		httperr.E(w, http.StatusBadRequest, "Invalid postId", nil)
+		return
+	}
+
+	userId := session.Instance(r).Values[c.Id].(int)
+	var err error
+	if on {
+		err = data.AddEngagement(postId, userId, kind)
+	} else {
+		err = data.RemoveEngagement(postId, userId, kind)
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to update the post for the user", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, message)
+}
+
+// Posts saved by the user, last saved first
+func savedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:savedPostsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	posts, err := feed.Saved(session.Instance(r).Values[c.Id].(int))
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to get the saved posts", &err)
+		return
+	}
+	j, err := json.Marshal(posts)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Records that the user viewed the PostIds of the request, up to
+// c.MaxViewBatch at once. Posts users don't get to see are skipped
+func viewsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:viewsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if err := r.ParseForm(); err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request Form"), &err)
+		return
+	}
+	postIds := r.PostForm[c.PostId]
+	if len(postIds) == 0 || len(postIds) > c.MaxViewBatch {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Send 1 to %d PostId", c.MaxViewBatch), nil)
+		return
+	}
+	for _, postId := range postIds {
+		if !bson.IsObjectIdHex(postId) {
+			httperr.E(w, http.StatusBadRequest, "Invalid postId", nil)
+			return
+		}
+	}
+
+	posts, missing, err := data.GetPostsByIds(postIds)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the posts", &err)
+		return
+	}
+	if len(missing) > 0 {
+		log.WithField("postIds", missing).Debug("Views of missing posts skipped")
+	}
+	viewed := []string{}
+	seen := make(map[string]bool, len(posts))
+	for _, p := range posts {
+		if p.Status != "" && p.Status != c.StatusPublished {
+			continue
+		}
+		if id := p.Id.Hex(); !seen[id] {
+			seen[id] = true
+			viewed = append(viewed, id)
+		}
+	}
+
+	userId := session.Instance(r).Values[c.Id].(int)
+	if err := data.AddViews(userId, viewed); err != nil {
+		httperr.DB(w, "Failed to record the views", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, fmt.Sprintf("%d views recorded", len(viewed)))
+}
+
+// Comments on a post or replies to a comment on it. Replies to a reply
+// join the thread of the comment it replies to
+func commentHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:commentHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok || !checkPublished(w, p) {
+		return
+	}
+	body, parentId, err := validate.Comment(r.FormValue(c.Body), r.FormValue(c.ParentId), config.Get().Comments.MaxLength)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if parentId != 0 {
+		parent, err := data.GetComment(parentId)
+		if err == sql.ErrNoRows || (err == nil && (parent.PostId != postId || parent.Status != c.CommentVisible)) {
+			httperr.E(w, http.StatusBadRequest, fmt.Sprintf("No comment %d to reply to on the post", parentId), nil)
+			return
+		}
+		if err != nil {
+			httperr.DB(w, "Failed to retrieve the comment replied to", &err)
+			return
+		}
+		if parent.ParentId != 0 {
+			parentId = parent.ParentId
+		}
+	}
+
+	cm, err := data.AddComment(types.Comment{
+		PostId:   postId,
+		ParentId: parentId,
+		UserId:   session.Instance(r).Values[c.Id].(int),
+		Body:     body,
+	})
+	if err != nil {
+		httperr.DB(w, "Failed to add the comment", &err)
+		return
+	}
+	j, err := json.Marshal(cm)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// One page of the visible comments on a post, or of the replies to one of
+// them with ParentId
+func commentsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:commentsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok || !checkPublished(w, p) {
+		return
+	}
+	parentId, after, ps, err := validate.CommentPage(r.FormValue(c.ParentId), r.FormValue(c.After), r.FormValue(c.PageSize))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// One more than needed tells if there is more to read
+	comments, err := data.GetComments(postId, parentId, after, ps+1)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the comments", &err)
+		return
+	}
+	page := types.CommentPage{Comments: comments, After: after}
+	if len(comments) > ps {
+		page.Comments, page.HasMore = comments[:ps], true
+	}
+	if n := len(page.Comments); n > 0 {
+		page.After = page.Comments[n-1].Id
+	}
+	j, err := json.Marshal(page)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Users delete their own comments, admins any. Replies go with the comment
+func deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:deleteCommentHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	cm, ok := commentParam(w, r)
+	if !ok {
+		return
+	}
+	sess := session.Instance(r)
+	if sess.Values[c.RoleId].(int) != c.AdminRole && cm.UserId != sess.Values[c.Id].(int) {
+		httperr.E(w, http.StatusUnauthorized, "No such comment belongs to the user", nil)
+		return
+	}
+	if err := data.DeleteComment(cm.Id); err != nil {
+		httperr.DB(w, "Failed to delete the comment", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Comment deleted")
+}
+
+func hideCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:hideCommentHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	moderateComment(w, r, c.CommentHidden, "Comment hidden")
+}
+
+// Makes a held or hidden comment visible
+func approveCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:approveCommentHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	moderateComment(w, r, c.CommentVisible, "Comment approved")
+}
+
+func moderateComment(w http.ResponseWriter, r *http.Request, status string, message string) {
+	cm, ok := commentParam(w, r)
+	if !ok {
+		return
+	}
+	err := data.ModerateComment(cm.Id, status, session.Instance(r).Values[c.Id].(int))
+	if err != nil {
+		httperr.DB(w, "Failed to moderate the comment", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, message)
+}
+
+// Comments held for review, oldest first
+func heldCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:heldCommentsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	comments, err := data.GetHeldComments()
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the held comments", &err)
+		return
+	}
+	j, err := json.Marshal(comments)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Reports how well the in memory caches do
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:cacheStatsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	j, err := json.Marshal(cache.Stats())
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Stores the File of a multipart request, an image or a video, and returns
+// the media with its urls. Its Id can then be sent in place of urls when
+// creating posts and products, unless it is Private. Private media are only
+// served through signed urls that expire
+func uploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:uploadMediaHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	maxBytes := int64(config.Get().Media.MaxBytes)
+	// Room for the rest of the form around the file
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httperr.E(w, http.StatusRequestEntityTooLarge, media.ErrTooLarge.Error(), nil)
+			return
+		}
+		httperr.E(w, http.StatusBadRequest, "Invalid Request Form", &err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	private := false
+	if v := r.FormValue(c.Private); v != "" {
+		var err error
+		if private, err = strconv.ParseBool(v); err != nil {
+			httperr.E(w, http.StatusBadRequest, "Private should be true or false", nil)
+			return
+		}
+	}
+	file, _, err := r.FormFile(c.File)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "File is missing", &err)
+		return
+	}
+	defer file.Close()
+	// A byte more than allowed tells the file is too large
+	content, err := ioutil.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "Failed to read the file", &err)
+		return
+	}
+
+	m, err := media.Save(content, session.Instance(r).Values[c.Id].(int), private)
+	switch err {
+	case nil:
+	case media.ErrTooLarge:
+		httperr.E(w, http.StatusRequestEntityTooLarge, err.Error(), nil)
+		return
+	case media.ErrUnsupported:
+		httperr.E(w, http.StatusUnsupportedMediaType, err.Error(), nil)
+		return
+	case media.ErrDimensions, media.ErrCorrupt:
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	case media.ErrPublic:
+		httperr.E(w, http.StatusConflict, err.Error(), nil)
+		return
+	default:
+		httperr.E(w, http.StatusInternalServerError, "Failed to store the media", &err)
+		return
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+func getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:getMediaHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	m, err := media.Get(r.FormValue(c.MediaId))
+	if err == mgo.ErrNotFound {
+		httperr.E(w, http.StatusNotFound, "Media not found", nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to get the media", &err)
+		return
+	}
+	j, err := json.Marshal(m)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Serves the files of the local blob store. Private ones need the Expires
+// and Signature of a url signed for them
+func filesHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:filesHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	name := mux.Vars(r)["name"]
+	store, err := blob.Current()
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to open the blob store", &err)
+		return
+	}
+	local, ok := store.(*blob.Local)
+	if !ok {
+		httperr.E(w, http.StatusNotFound, "Files are not served from here", nil)
+		return
+	}
+	private := blob.Private(name)
+	if private && !local.Verify(name, r.FormValue(blob.Expires), r.FormValue(blob.Signature), time.Now().UTC()) {
+		httperr.E(w, http.StatusUnauthorized, "Invalid or expired signature", nil)
+		return
+	}
+
+	content, err := local.Get(name)
+	if err == blob.ErrNotFound {
+		httperr.E(w, http.StatusNotFound, "File not found", nil)
+		return
+	}
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to read the file", &err)
+		return
+	}
+	// Names are hashes of the content, which never changes
+	if private {
+		w.Header().Set("Cache-Control", "private")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+}
+
+// A form field taking ids of uploaded media, and the fields given their
+// urls and the urls of their thumbnails in its place
+type mediaRef struct {
+	idKey    string
+	urlKey   string
+	thumbKey string
+}
+
+var postMedia = []mediaRef{
+	{c.SrcMediaId, c.Src, ""},
+	{c.DpSrcMediaId, c.DpSrc, ""},
+	{c.PosterMediaId, c.Poster, ""},
+	{c.MediaIds, c.Media, ""},
+}
+
+var productMedia = []mediaRef{
+	{c.ImageMediaId, c.Image, c.ThumbNail},
+}
+
+// mediaUrls puts in form the urls of the media it refers to by id. The
+// error response is written when it returns false
+func mediaUrls(w http.ResponseWriter, form url.Values, refs []mediaRef) bool {
+	for _, ref := range refs {
+		ids, ok := form[ref.idKey]
+		if !ok {
+			continue
+		}
+		var urls, thumbs []string
+		for _, id := range ids {
+			m, err := media.Get(id)
+			if err == mgo.ErrNotFound {
+				httperr.E(w, http.StatusBadRequest, fmt.Sprintf("No media %q for %s", id, ref.idKey), nil)
+				return false
+			}
+			if err != nil {
+				httperr.DB(w, "Failed to get the media", &err)
+				return false
+			}
+			// Their urls expire
+			if m.Private {
+				httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Media %q is private", id), nil)
+				return false
+			}
+			urls = append(urls, m.Url)
+			thumbs = append(thumbs, m.ThumbUrl)
+		}
+		form[ref.urlKey] = urls
+		if ref.thumbKey != "" {
+			form[ref.thumbKey] = thumbs
+		}
+	}
+	return true
+}
+
+// Posts users get to see matching the Query of the request, best match
+// first, optionally of the card types of the repeated CardType. Paged by
+// Offset and PageSize
+func searchPostsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:searchPostsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if err := r.ParseForm(); err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request Form"), &err)
+		return
+	}
+	query, offset, ps, err := validate.Search(r.Form.Get(c.Query), r.Form.Get(c.Offset), r.Form.Get(c.PageSize))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	cardTypes, err := validate.CardTypes(r.Form[c.CardType])
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	page, err := feed.Search(query, cardTypes, offset, ps, session.Instance(r).Values[c.Id].(int))
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to search the posts", &err)
+		return
+	}
+	j, err := json.Marshal(page)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Products matching the Query of the request, best match first, optionally
+// of one Brand. Paged by Offset and PageSize
+func searchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:searchProductsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	query, offset, ps, err := validate.Search(r.FormValue(c.Query), r.FormValue(c.Offset), r.FormValue(c.PageSize))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	brand := strings.TrimSpace(r.FormValue(c.Brand))
+
+	// One more than needed tells if there is more to read
+	products, err := data.SearchProducts(query, brand, offset, ps+1)
+	if err != nil {
+		httperr.DB(w, "Failed to search the products", &err)
+		return
+	}
+	page := types.ProductSearchPage{Products: products, Offset: offset + len(products)}
+	if len(products) > ps {
+		page.Products, page.HasMore = products[:ps], true
+		page.Offset = offset + ps
+	}
+	j, err := json.Marshal(page)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Fetches the comment of the CommentId of the request. The error response
+// is written when it returns false
+func commentParam(w http.ResponseWriter, r *http.Request) (*types.Comment, bool) {
+	commentId, err := strconv.Atoi(r.FormValue(c.CommentId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "CommentId not compatible", &err)
+		return nil, false
+	}
+	cm, err := data.GetComment(commentId)
+	if err == sql.ErrNoRows {
+		httperr.E(w, http.StatusNotFound, fmt.Sprintf("No comment exists for %d", commentId), &err)
+		return nil, false
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the comment", &err)
+		return nil, false
+	}
+	return cm, true
+}
+
+// Results of a poll with every vote cast, for admins
+func pollResultsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:pollResultsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	p, ok := lookupPost(w, postId)
+	if !ok {
+		return
+	}
+	if p.CardType != c.CardTypePoll {
+		httperr.E(w, http.StatusBadRequest, "The post is not a poll", nil)
+		return
+	}
+	ballot, err := data.GetPollVotes(postId)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the votes of the poll", &err)
+		return
+	}
+
+	results := types.PollResults{
+		PostId:   postId,
+		Question: p.Title,
+		Options:  p.Options,
+		ClosesAt: p.ClosesAt,
+		Votes:    make([]int, len(p.Options)),
+		Ballot:   ballot,
+	}
+	for _, v := range ballot {
+		if v.Option < len(results.Votes) {
+			results.Votes[v.Option]++
+			results.Total++
+		}
+	}
+	j, err := json.Marshal(results)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Reads the MascotId and PostId of a request on a post link
+func postLinkParams(r *http.Request) (int, string, error) {
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
+	if err != nil {
+		return 0, "", errors.New("MascotId not compatible")
+	}
+	postId := r.FormValue(c.PostId)
+	if postId == "" {
+		return 0, "", errors.New("PostId cannot be empty")
+	}
+	return mascotId, postId, nil
+}
+
+func unlinkPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:unlinkPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, postId, err := postLinkParams(r)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	err = datastore.UnlinkPost(mascotId, postId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, feed.ErrNotLinked.Error(), &err)
+			return
+		}
+		httperr.DB(w, "Failed to unlink the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Post unlinked from mascot")
+}
+
+func movePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:movePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, postId, err := postLinkParams(r)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	position, err := strconv.Atoi(r.FormValue(c.Position))
+	if err != nil || position < 0 {
+		httperr.E(w, http.StatusBadRequest, "Position should be a non negative Integer", nil)
+		return
+	}
+
+	err = feed.Move(mascotId, postId, position)
+	switch err {
+	case nil:
+		httpsucc.SuccWithMessage(w, "Post moved")
+	case feed.ErrNotLinked:
+		httperr.E(w, http.StatusNotFound, err.Error(), nil)
+	case feed.ErrNotMovable, feed.ErrNoRoom:
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+	default:
+		httperr.DB(w, "Failed to move the post", &err)
+	}
+}
+
+func pinPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:pinPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, postId, err := postLinkParams(r)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	pinned, err := datastore.GetPinnedPostLinks([]int{mascotId})
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the pinned posts", &err)
+		return
+	}
+	others := 0
+	for _, l := range pinned {
+		if l.PostId != postId {
+			others++
+		}
+	}
+	if others >= c.MaxPinnedPosts {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("At most %d posts can be pinned", c.MaxPinnedPosts), nil)
+		return
+	}
+
+	err = datastore.PinPostLink(mascotId, postId, time.Now().UTC().UnixNano())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, feed.ErrNotLinked.Error(), &err)
+			return
+		}
+		httperr.DB(w, "Failed to pin the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Post pinned")
+}
+
+func unpinPostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:unpinPostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, postId, err := postLinkParams(r)
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	err = datastore.PinPostLink(mascotId, postId, 0)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, feed.ErrNotLinked.Error(), &err)
+			return
+		}
+		httperr.DB(w, "Failed to unpin the post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Post unpinned")
+}
+
+// Links of a mascot yet to be published or to expire, for admins to review
+func scheduleHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:scheduleHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
+		return
+	}
+
+	postLinks, err := datastore.GetScheduledPostLinks(mascotId, time.Now().UTC().UnixNano())
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the schedule", &err)
+		return
+	}
+	if postLinks == nil {
+		postLinks = []types.PostLink{}
+	}
+
+	j, err := json.Marshal(postLinks)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+func createMascotHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:createMascotHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascot, err := validate.Mascot(
+		r.FormValue(c.Name),
+		r.FormValue(c.Description),
+		r.FormValue(c.Avatar),
+		r.FormValue(c.GradientStart),
+		r.FormValue(c.GradientEnd))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	mascotId, err := datastore.CreateMascot(mascot)
+	if err != nil {
+		httperr.DB(w, "Failed to create the mascot", &err)
+		return
+	}
+	log.Debugf("Created mascot=%d", mascotId)
+
+	j, err := json.Marshal(mascotId)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+// Renames, describes or restyles a mascot. Fields not sent keep their value
+func editMascotHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:editMascotHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
+		return
+	}
+
+	mascot, err := datastore.GetMascot(mascotId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No mascot exists for %d", mascotId), &err)
+			return
+		}
+		httperr.DB(w, "Failed to retrieve the mascot", &err)
+		return
+	}
+
+	value := func(key, current string) string {
+		if _, ok := r.Form[key]; ok {
+			return r.FormValue(key)
+		}
+		return current
+	}
+	edited, err := validate.Mascot(
+		value(c.Name, mascot.Name),
+		value(c.Description, mascot.Description),
+		value(c.Avatar, mascot.Avatar),
+		value(c.GradientStart, mascot.GradientStart),
+		value(c.GradientEnd, mascot.GradientEnd))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	edited.Id = mascotId
+
+	err = datastore.UpdateMascot(edited)
+	if err != nil {
+		httperr.DB(w, "Failed to edit the mascot", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Mascot updated successfully")
+}
+
+func retireMascotHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:retireMascotHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
+		return
+	}
+	if mascotId == c.DefaultMascotId {
+		httperr.E(w, http.StatusBadRequest, "The default mascot cannot be retired", nil)
+		return
+	}
+
+	_, err = datastore.GetMascot(mascotId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No mascot exists for %d", mascotId), &err)
+			return
+		}
+		httperr.DB(w, "Failed to retrieve the mascot", &err)
+		return
+	}
+
+	err = datastore.RetireMascot(mascotId)
+	if err != nil {
+		httperr.DB(w, "Failed to retire the mascot", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Mascot retired successfully")
+}
+
+// Active mascots, for the app to offer as choices
+func getMascotsHandler(w http.ResponseWriter, r *http.Request) {
+	writeMascots(w, false)
+}
+
+// All mascots including the retired ones, for admins
+func getAllMascotsHandler(w http.ResponseWriter, r *http.Request) {
+	writeMascots(w, true)
+}
+
+func writeMascots(w http.ResponseWriter, includeRetired bool) {
+	var funcName = "main.go:writeMascots"
+	log.WithFields(log.Fields{
+		"includeRetired": includeRetired,
+	}).Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	mascots, err := datastore.GetMascots(includeRetired)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the mascots", &err)
+		return
+	}
+
+	j, err := json.Marshal(mascots)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+// Requests with a Flag are served the old way, LastSync and up to
+// c.NumOfPosts posts. Without it the feed is read in pages with cursors
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:feedHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	if r.FormValue(c.Flag) == "" {
+		feedPageHandler(w, r)
+		return
+	}
+
+	ls, ms, f, err := validate.Feed(
+		r.FormValue(c.LastSync),
+		r.FormValue(c.MascotId),
+		r.FormValue(c.Flag))
+
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	feed, err := feed.Get(ls, ms, f, session.Instance(r).Values[c.Id].(int))
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to get Feed", &err)
+		return
+	}
+	j, err := json.Marshal(feed)
+
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+func feedPageHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:feedPageHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	ms, ps, err := validate.FeedPage(
+		r.FormValue(c.MascotId),
+		r.FormValue(c.PageSize))
+
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	page, err := feed.Page(ms, r.FormValue(c.Cursor), ps, session.Instance(r).Values[c.Id].(int))
+	if err == feed.ErrInvalidCursor {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to get Feed", &err)
+		return
+	}
+	j, err := json.Marshal(page)
+
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
+		return
+	}
+
+	_, err = w.Write(j)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Writing to the response failed", &err)
+	}
+}
+
+// Merged feed of the mascots the user is subscribed to. Users without
+// subscriptions get the default mascot
+func subscribedFeedHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:subscribedFeedHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	ps, err := validate.PageSize(r.FormValue(c.PageSize))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	sess := session.Instance(r)
+	userId := sess.Values[c.Id].(int)
+	mascots, err := datastore.GetSubscriptions(userId)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the subscriptions", &err)
+		return
+	}
+	mascotIds := []int{c.DefaultMascotId}
+	if len(mascots) > 0 {
+		mascotIds = mascotIds[:0]
+		for _, m := range mascots {
+			mascotIds = append(mascotIds, m.Id)
+		}
+	}
+
+	page, err := feed.MergedPage(mascotIds, r.FormValue(c.Cursor), ps, userId)
+	if err == feed.ErrInvalidCursor {
 		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
 		return
 	}
-
-	postId, err := datastore.AddPost(p)
-
 	if err != nil {
-		httperr.DB(w, "Failed to create a post", &err)
+		httperr.E(w, http.StatusInternalServerError, "Failed to get Feed", &err)
 		return
 	}
-	log.Debugf("Created postId=%s", postId)
+	j, err := json.Marshal(page)
 
-	j, err := json.Marshal(postId)
 	if err != nil {
 		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
 		return
@@ -343,59 +2021,73 @@ func createPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func createPostLinkHandler(w http.ResponseWriter, r *http.Request) {
-	var funcName = "main.go:createPostLinkHandler"
+func subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:subscribeHandler"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	postId := r.FormValue(c.PostId)
-	mascotId := r.FormValue(c.MascotId)
-	mId, err := strconv.Atoi(mascotId)
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
 	if err != nil {
-		httperr.E(w, http.StatusBadRequest, "Invalid Request Parameters", &err)
+		httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
 		return
 	}
 
-	// makse sure the post exists
-	_, err = datastore.GetPostMetaData(postId)
+	mascot, err := datastore.GetMascot(mascotId)
 	if err != nil {
-		httperr.E(w, http.StatusBadRequest, "Invalid postId or post does not exists", &err)
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No mascot exists for %d", mascotId), &err)
+			return
+		}
+		httperr.DB(w, "Failed to retrieve the mascot", &err)
+		return
+	}
+	if !mascot.IsActive {
+		httperr.E(w, http.StatusBadRequest, "Mascot is retired", nil)
 		return
 	}
 
-	err = datastore.PostLink(mId, postId)
+	sess := session.Instance(r)
+	err = datastore.Subscribe(sess.Values[c.Id].(int), mascotId)
 	if err != nil {
-		httperr.DB(w, "Failed to create a post link", &err)
+		httperr.DB(w, "Failed to subscribe", &err)
 		return
 	}
-	//queue.AddItemToQueue(postId, mId)
-
-	httpsucc.SuccWithMessage(w, "Post successfully linked to mascot")
-
+	httpsucc.SuccWithMessage(w, "Subscribed successfully")
 }
 
-func feedHandler(w http.ResponseWriter, r *http.Request) {
-	var funcName = "main.go:feedHandler"
+func unsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:unsubscribeHandler"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	ls, ms, f, err := validate.Feed(
-		r.FormValue(c.LastSync),
-		r.FormValue(c.MascotId),
-		r.FormValue(c.Flag))
+	mascotId, err := strconv.Atoi(r.FormValue(c.MascotId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "MascotId not compatible", &err)
+		return
+	}
 
+	sess := session.Instance(r)
+	err = datastore.Unsubscribe(sess.Values[c.Id].(int), mascotId)
 	if err != nil {
-		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		httperr.DB(w, "Failed to unsubscribe", &err)
 		return
 	}
+	httpsucc.SuccWithMessage(w, "Unsubscribed successfully")
+}
+
+func getSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:getSubscriptionsHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
 
-	feed, err := feed.Get(ls, ms, f)
+	sess := session.Instance(r)
+	mascots, err := datastore.GetSubscriptions(sess.Values[c.Id].(int))
 	if err != nil {
-		httperr.E(w, http.StatusInternalServerError, "Failed to get Feed", &err)
+		httperr.DB(w, "Failed to retrieve the subscriptions", &err)
 		return
 	}
-	j, err := json.Marshal(feed)
 
+	j, err := json.Marshal(mascots)
 	if err != nil {
 		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
 		return
@@ -443,6 +2135,14 @@ func addProductHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
+	if err := r.ParseForm(); err != nil {
+		httperr.E(w, http.StatusBadRequest, fmt.Sprintf("Invalid Request Form"), &err)
+		return
+	}
+	if !mediaUrls(w, r.Form, productMedia) {
+		return
+	}
+
 	var product types.Product
 	var err error
 	product.Id = bson.NewObjectId()
@@ -642,6 +2342,46 @@ func getSaleHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Removes a product along with the uploaded media only it used. Products
+// on sale are kept, the sale refers to them by sku
+func deleteProductHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:deleteProductHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	productId := r.FormValue(c.ProductId)
+	if !bson.IsObjectIdHex(productId) {
+		httperr.E(w, http.StatusBadRequest, "Invalid ProductId", nil)
+		return
+	}
+	product, err := datastore.GetProduct(productId)
+	if err == mgo.ErrNotFound {
+		httperr.E(w, http.StatusNotFound, fmt.Sprintf("No Product found with %s", productId), nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the Product", &err)
+		return
+	}
+	sales, err := datastore.GetSales()
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the Sales info", &err)
+		return
+	}
+	for _, sale := range sales.Data {
+		if sale.ProductSku == product.Sku {
+			httperr.E(w, http.StatusConflict, "The product is on sale", nil)
+			return
+		}
+	}
+
+	if err := data.DeleteProduct(productId); err != nil {
+		httperr.DB(w, "Failed to delete the Product", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Product deleted")
+}
+
 func getSalesHandler(w http.ResponseWriter, r *http.Request) {
 
 	var funcName = "main.go:getSalesHandler"
@@ -680,19 +2420,33 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	var order types.Order
 	var err error
-	d, err := hex.DecodeString(r.FormValue(c.ProductId))
-	if err != nil || len(d) != 12 {
-		httperr.E(w, http.StatusBadRequest, "Invalid Product Id", &err)
+	order.ProductId = r.FormValue(c.ProductId)
+	if !bson.IsObjectIdHex(order.ProductId) {
+		httperr.E(w, http.StatusBadRequest, "Invalid Product Id", nil)
 		return
 	}
-	order.ProductId = r.FormValue(c.ProductId)
-	exists, err := mw.CheckExistanceMongo(c.ProductCollection, order.ProductId)
-	if !exists {
+	// The product may also go between the checks and the order, it is then
+	// not found either
+	noProduct := func(err error) bool {
+		if err != mgo.ErrNotFound {
+			return false
+		}
 		httperr.E(w, http.StatusNotFound, fmt.Sprintf("No Product exists with ProductId: %s", order.ProductId), &err)
+		return true
+	}
+	_, err = datastore.GetProduct(order.ProductId)
+	if err != nil {
+		if noProduct(err) {
+			return
+		}
+		httperr.DB(w, "Failed to retrieve the Product ", &err)
 		return
 	}
 	inStock, err := datastore.IsProductInStock(order.ProductId)
 	if err != nil {
+		if noProduct(err) {
+			return
+		}
 		httperr.E(w, http.StatusInternalServerError, "Failed to Check product stock", &err)
 		return
 	}
@@ -726,19 +2480,18 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err = mw.CheckExistanceMysql(c.AddressTable, c.Id, r.FormValue(c.AddressId), true)
+	order.AddressId, err = strconv.Atoi(r.FormValue(c.AddressId))
 	if err != nil {
-		httperr.E(w, http.StatusInternalServerError, "Coudnt not check id address exists", &err)
-		return
-	}
-	if !exists {
-		err = errors.New("Address Not Found")
-		httperr.E(w, http.StatusNotFound, "Address not found with the given AddressId", &err)
+		httperr.E(w, http.StatusBadRequest, "AddressId not compatible", &err)
 		return
 	}
-	order.AddressId, err = strconv.Atoi(r.FormValue(c.AddressId))
+	_, err = datastore.GetAddress(order.AddressId)
 	if err != nil {
-		httperr.E(w, http.StatusBadRequest, "AddressId not compatible", &err)
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, "Address not found with the given AddressId", &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Coudnt not check id address exists", &err)
 		return
 	}
 
@@ -756,6 +2509,9 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 
 	orderId, err := datastore.CreateOrder(order)
 	if err != nil {
+		if noProduct(err) {
+			return
+		}
 		httperr.DB(w, "Failed to create the order", &err)
 		return
 	}
@@ -1299,6 +3055,75 @@ func fbtokenHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// Sends a push notification to the devices of a user, of the subscribers of
+// a mascot, of the users of a role or of everyone. It is sent in the
+// background, the notification returned tells how many devices it goes to
+func notifyHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:notifyHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	n, err := validate.Notification(r.FormValue(c.Title), r.FormValue(c.Body), r.FormValue(c.Data),
+		r.FormValue(c.Target), r.FormValue(c.TargetId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	sess := session.Instance(r)
+	n.CreatedBy = sess.Values[c.Id].(int)
+
+	notification, err := push.Notify(n)
+	if err == push.ErrDisabled {
+		httperr.E(w, http.StatusServiceUnavailable, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to send the notification", &err)
+		return
+	}
+
+	j, err := json.Marshal(notification)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// A notification with the fate of each device it was sent to
+func notificationHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:notificationHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	notificationId, err := strconv.Atoi(r.FormValue(c.NotificationId))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, "NotificationId is not a valid Id", nil)
+		return
+	}
+	n, err := datastore.GetNotification(notificationId)
+	if err == sql.ErrNoRows {
+		httperr.E(w, http.StatusNotFound, fmt.Sprintf("No notification %d", notificationId), nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the notification", &err)
+		return
+	}
+	deliveries, err := datastore.GetDeliveries(notificationId)
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the deliveries", &err)
+		return
+	}
+
+	j, err := json.Marshal(types.NotificationReport{Notification: *n, Deliveries: deliveries})
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		return
+	}
+	w.Write(j)
+}
+
 func resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	var funcName = "main.go:resetPasswordHandler"
 	log.Debugf("Enter: %s", funcName)
@@ -1403,97 +3228,263 @@ func forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = aws.SendResetOtp(phone, code)
+	err = aws.SendResetOtp(phone, code)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to send reset code", &err)
+		return
+	}
+}
+
+// Urls of the manifest, for the app versions from before it
+func cacheHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:cacheHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	m, err := data.GetManifest()
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the manifest", &err)
+		return
+	}
+	urls := []string{}
+	for _, e := range m.Entries {
+		urls = append(urls, e.Url)
+	}
+
+	j, err := json.Marshal(urls)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Adds an url to the manifest or updates it, Type c.CacheAdd, or removes
+// it, Type c.CacheRemove. Without its Hash and Size the server downloads the
+// url to find them
+func urlHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:urlHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	url := r.FormValue(c.Url)
+	var version int64
+	var err error
+	switch r.FormValue(c.Type) {
+	case c.CacheAdd:
+		e, verr := validate.CacheUrl(url, r.FormValue(c.Priority), r.FormValue(c.Hash), r.FormValue(c.Size))
+		if verr != nil {
+			httperr.E(w, http.StatusBadRequest, verr.Error(), nil)
+			return
+		}
+		version, err = data.PutCacheUrl(e)
+		if _, ok := err.(*data.AssetError); ok {
+			httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	case c.CacheRemove:
+		version, err = data.RemoveCacheUrl(url)
+		if err == sql.ErrNoRows {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("%s is not cached", url), nil)
+			return
+		}
+	default:
+		httperr.E(w, http.StatusBadRequest, "Type should be 1 to add or 0 to remove", nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to change the manifest", &err)
+		return
+	}
+
+	httpsucc.SuccWithMessage(w, fmt.Sprintf("Manifest at version %d", version))
+}
+
+// Manifest of the urls the app keeps offline. Its ETag is its version, the
+// app sends it back in If-None-Match to only download it when it changed
+func manifestHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:manifestHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	m, err := data.GetManifest()
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the manifest", &err)
+		return
+	}
+	if notModified(w, r, manifestETag(m.Version)) {
+		return
+	}
+
+	j, err := json.Marshal(m)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+// Changes of the manifest Since a version of it, so that the app only
+// downloads the assets added or updated and drops the ones removed. A
+// Since past the version of the manifest is a conflict, the app should then
+// download the manifest whole
+func manifestChangesHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:manifestChangesHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	since, err := validate.ManifestVersion(r.FormValue(c.Since))
+	if err != nil {
+		httperr.E(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	changes, err := data.GetManifestChanges(since)
+	if err == data.ErrFutureVersion {
+		httperr.E(w, http.StatusConflict, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		httperr.DB(w, "Failed to retrieve the manifest", &err)
+		return
+	}
+	if notModified(w, r, manifestETag(changes.Version)) {
+		return
+	}
+
+	j, err := json.Marshal(changes)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		return
+	}
+	w.Write(j)
+}
+
+func manifestETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// notModified sets the ETag of the response and, when the request already
+// has it in If-None-Match, answers 304 Not Modified and returns true
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+func deletePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:deletePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	sess := session.Instance(r)
+	err := data.DeletePost(postId, sess.Values[c.Id].(int))
+	if err != nil {
+		if err.Error() == "Invalid postId" {
+			httperr.E(w, http.StatusBadRequest, "Invalid postId", &err)
+			return
+		}
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No post exists for %s out of the trash", postId), &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Couldnt delete post", &err)
+		return
+	}
+	httpsucc.SuccWithMessage(w, "Successfully Deleted Post ")
+}
+
+func restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:restorePostHandler"
+	log.Debugf("Enter: %s", funcName)
+	defer log.Debugf("Exit: %s", funcName)
+
+	postId := r.FormValue(c.PostId)
+	sess := session.Instance(r)
+	err := data.RestorePost(postId, sess.Values[c.Id].(int))
 	if err != nil {
-		httperr.E(w, http.StatusInternalServerError, "Failed to send reset code", &err)
+		if err.Error() == "Invalid postId" {
+			httperr.E(w, http.StatusBadRequest, "Invalid postId", &err)
+			return
+		}
+		if err == mgo.ErrNotFound {
+			httperr.E(w, http.StatusNotFound, fmt.Sprintf("No post %s in the trash", postId), &err)
+			return
+		}
+		httperr.E(w, http.StatusInternalServerError, "Couldnt restore post", &err)
 		return
 	}
+	httpsucc.SuccWithMessage(w, "Successfully Restored Post")
 }
 
-func cacheHandler(w http.ResponseWriter, r *http.Request) {
-	var funcName = "main.go:cacheHandler"
+// Lists the posts in the trash, last deleted first
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:trashHandler"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	// This is temporary function. This should be replaced later with the correct function
-
-	var ss []string
-
-	/*ss = append(ss, "https://cdn.twiq.in/r/tos.html")
-	ss = append(ss, "https://cdn.twiq.in/r/privacy.html")
-	ss = append(ss, "https://cdn.twiq.in/r/sales/demo-1.html")
-	ss = append(ss, "https://cdn.twiq.in/img/dorothyperkins_store.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/dress_1.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/dress_4.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/take_money.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/demo-1.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/dress_3.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/review_1.png")
-	ss = append(ss, "https://cdn.twiq.in/img/review_2.png")
-	ss = append(ss, "https://cdn.twiq.in/img/btn_dull.png")
-	ss = append(ss, "https://cdn.twiq.in/r/sales/demo-2.html")
-	ss = append(ss, "https://cdn.twiq.in/img/demo-2.jpg")
-	ss = append(ss, "https://cdn.twiq.in/img/demobrownie_2.jpg")
-	*/
-
-	ss, err := data.GetCacheDetails()
+	posts, err := datastore.GetDeletedPosts()
 	if err != nil {
-		httperr.E(w, http.StatusInternalServerError, "Failed to retrieve from DB", &err)
+		httperr.DB(w, "Failed to retrieve the trash", &err)
+		return
 	}
 
-	j, err := json.Marshal(ss)
-
+	j, err := json.Marshal(posts)
 	if err != nil {
-		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal response", &err)
+		httperr.E(w, http.StatusInternalServerError, "Failed to Marshal Response", &err)
 		return
 	}
-
 	w.Write(j)
 }
 
-func urlHandler(w http.ResponseWriter, r *http.Request) {
-	var funcName = "main.go:urlHandler"
+// Empties the trash of the posts deleted more than Days days ago, the
+// configured number of days when not given
+func purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var funcName = "main.go:purgeTrashHandler"
 	log.Debugf("Enter: %s", funcName)
 	defer log.Debugf("Exit: %s", funcName)
 
-	url := r.FormValue(c.Url)
-	op := r.FormValue(c.Type)
-
-	if op == "1" {
-		err := data.InsertCacheUrl(url)
-		if err != nil {
-			httperr.E(w, http.StatusInternalServerError, "Couldnt insert url", &err)
+	days := config.Get().Trash.Days
+	if v := r.FormValue(c.Days); v != "" {
+		var err error
+		days, err = strconv.Atoi(v)
+		if err != nil || days < 0 {
+			httperr.E(w, http.StatusBadRequest, "Days should be a number, 0 or more", nil)
 			return
 		}
 	}
 
-	if op == "0" {
-		err := data.DeleteCacheUrl(url)
-		if err != nil {
-			httperr.E(w, http.StatusInternalServerError, "Couldnt delete url", &err)
-			return
-		}
+	postIds, err := purgeTrash(days)
+	if err != nil {
+		httperr.E(w, http.StatusInternalServerError, "Couldnt purge the trash", &err)
+		return
 	}
-
-	httpsucc.SuccWithMessage(w, "Successfully completed operation")
+	httpsucc.SuccWithMessage(w, fmt.Sprintf("Purged %d posts", len(postIds)))
 }
 
-func deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	var funcName = "main.go:deletePostHandler"
-	log.Debugf("Enter: %s", funcName)
-	defer log.Debugf("Exit: %s", funcName)
+// purgeTrash removes for good the posts deleted more than days days ago
+func purgeTrash(days int) ([]string, error) {
+	deletedBefore := time.Now().UTC().Add(-time.Duration(days) * 24 * time.Hour).UnixNano()
+	return data.PurgeTrash(deletedBefore)
+}
 
-	postId := r.FormValue(c.PostId)
-	err := datastore.DeletePost(postId)
-	if err != nil {
-		if err.Error() == "Invalid postId" {
-			httperr.E(w, http.StatusBadRequest, "Invalid postId", &err)
-			return
+// purgeTrashEvery purges the trash every interval, for ever
+func purgeTrashEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		postIds, err := purgeTrash(config.Get().Trash.Days)
+		if err != nil {
+			log.WithField("ErrMsg", err.Error()).Error("Failed to purge the trash")
+			continue
 		}
-		httperr.E(w, http.StatusInternalServerError, "Couldnt delete post", &err)
-		return
+		log.WithField("postIds", postIds).Infof("Purged %d posts from the trash", len(postIds))
 	}
-	httpsucc.SuccWithMessage(w, "Successfully Deleted Post ")
 }
 
 func vrHandler(w http.ResponseWriter, r *http.Request) {
@@ -1514,7 +3505,7 @@ func initLogging() {
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 
-	if c.DE {
+	if config.Get().Debug {
 		log.SetLevel(log.DebugLevel)
 	}
 	//aws.DisableModule = true
@@ -1525,6 +3516,7 @@ func getRouter() http.Handler {
 	r := mux.NewRouter()
 
 	r.HandleFunc("/ok", okHandler).Methods("GET", "POST")
+	r.HandleFunc("/files/{name:.+}", filesHandler).Methods("GET", "HEAD")
 	r.Handle("/login-ok",
 		alice.New(mw.Auth).
 			ThenFunc(loginOkHandler)).
@@ -1552,9 +3544,15 @@ func getRouter() http.Handler {
 			ThenFunc(getPostHandler)).
 		Methods("GET")
 
-	r.Handle("/postlink",
+	r.Handle("/editPost",
 		alice.New(mw.Auth).
 			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(editPostHandler)).
+		Methods("POST")
+
+	r.Handle("/postlink",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
 			ThenFunc(createPostLinkHandler)).
 		Methods("POST")
 	r.Handle("/logout",
@@ -1568,12 +3566,96 @@ func getRouter() http.Handler {
 			ThenFunc(updateProfileHandler)).
 		Methods("POST")
 
+	r.Handle("/unlinkPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(unlinkPostHandler)).
+		Methods("POST")
+
+	r.Handle("/movePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(movePostHandler)).
+		Methods("POST")
+
+	r.Handle("/pinPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(pinPostHandler)).
+		Methods("POST")
+
+	r.Handle("/unpinPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(unpinPostHandler)).
+		Methods("POST")
+
+	r.Handle("/schedule",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(scheduleHandler)).
+		Methods("GET")
+
+	r.Handle("/mascot",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(createMascotHandler)).
+		Methods("POST")
+
+	r.Handle("/editMascot",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(editMascotHandler)).
+		Methods("POST")
+
+	r.Handle("/retireMascot",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(retireMascotHandler)).
+		Methods("POST")
+
+	r.Handle("/mascots",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(getMascotsHandler)).
+		Methods("GET")
+
+	r.Handle("/allMascots",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(getAllMascotsHandler)).
+		Methods("GET")
+
 	r.Handle("/feed",
 		alice.New(mw.Auth).
 			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
 			ThenFunc(feedHandler)).
 		Methods("POST")
 
+	r.Handle("/subscribedFeed",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(subscribedFeedHandler)).
+		Methods("POST")
+
+	r.Handle("/subscribe",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(subscribeHandler)).
+		Methods("POST")
+
+	r.Handle("/unsubscribe",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(unsubscribeHandler)).
+		Methods("POST")
+
+	r.Handle("/subscriptions",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(getSubscriptionsHandler)).
+		Methods("GET")
+
 	r.Handle("/product",
 		alice.New(mw.Auth).
 			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
@@ -1586,6 +3668,12 @@ func getRouter() http.Handler {
 			ThenFunc(getProductHandler)).
 		Methods("GET")
 
+	r.Handle("/deleteProduct",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(deleteProductHandler)).
+		Methods("POST")
+
 	r.Handle("/sale",
 		alice.New(mw.Auth).
 			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
@@ -1711,6 +3799,16 @@ func getRouter() http.Handler {
 			ThenFunc(urlHandler)).
 		Methods("POST")
 
+	r.Handle("/manifest",
+		alice.New(mw.Auth).
+			ThenFunc(manifestHandler)).
+		Methods("GET")
+
+	r.Handle("/manifestChanges",
+		alice.New(mw.Auth).
+			ThenFunc(manifestChangesHandler)).
+		Methods("GET")
+
 	r.Handle("/posts",
 		alice.New(mw.Auth).
 			Append(mw.CheckAccess(c.AdminRole)).
@@ -1723,6 +3821,198 @@ func getRouter() http.Handler {
 			ThenFunc(deletePostHandler)).
 		Methods("POST")
 
+	r.Handle("/submitPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(submitPostHandler)).
+		Methods("POST")
+
+	r.Handle("/approvePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(approvePostHandler)).
+		Methods("POST")
+
+	r.Handle("/rejectPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(rejectPostHandler)).
+		Methods("POST")
+
+	r.Handle("/reviewQueue",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(reviewQueueHandler)).
+		Methods("GET")
+
+	r.Handle("/myPosts",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(myPostsHandler)).
+		Methods("GET")
+
+	r.Handle("/revisions",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(revisionsHandler)).
+		Methods("GET")
+
+	r.Handle("/diffRevisions",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(diffRevisionsHandler)).
+		Methods("GET")
+
+	r.Handle("/revertPost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(revertPostHandler)).
+		Methods("POST")
+
+	r.Handle("/vote",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(voteHandler)).
+		Methods("POST")
+
+	r.Handle("/likePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(likePostHandler)).
+		Methods("POST")
+
+	r.Handle("/unlikePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(unlikePostHandler)).
+		Methods("POST")
+
+	r.Handle("/savePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(savePostHandler)).
+		Methods("POST")
+
+	r.Handle("/unsavePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(unsavePostHandler)).
+		Methods("POST")
+
+	r.Handle("/savedPosts",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(savedPostsHandler)).
+		Methods("GET")
+
+	r.Handle("/views",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(viewsHandler)).
+		Methods("POST")
+
+	r.Handle("/comment",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(commentHandler)).
+		Methods("POST")
+
+	r.Handle("/comments",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(commentsHandler)).
+		Methods("GET")
+
+	r.Handle("/deleteComment",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(deleteCommentHandler)).
+		Methods("POST")
+
+	r.Handle("/hideComment",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(hideCommentHandler)).
+		Methods("POST")
+
+	r.Handle("/approveComment",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(approveCommentHandler)).
+		Methods("POST")
+
+	r.Handle("/heldComments",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(heldCommentsHandler)).
+		Methods("GET")
+
+	r.Handle("/cacheStats",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(cacheStatsHandler)).
+		Methods("GET")
+
+	r.Handle("/notify",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(notifyHandler)).
+		Methods("POST")
+
+	r.Handle("/notification",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(notificationHandler)).
+		Methods("GET")
+
+	r.Handle("/media",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(uploadMediaHandler)).
+		Methods("POST")
+
+	r.Handle("/media",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole)).
+			ThenFunc(getMediaHandler)).
+		Methods("GET")
+
+	r.Handle("/searchPosts",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(searchPostsHandler)).
+		Methods("GET")
+
+	r.Handle("/searchProducts",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole, c.WriterRole, c.UserRole)).
+			ThenFunc(searchProductsHandler)).
+		Methods("GET")
+
+	r.Handle("/pollResults",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(pollResultsHandler)).
+		Methods("GET")
+
+	r.Handle("/restorePost",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(restorePostHandler)).
+		Methods("POST")
+
+	r.Handle("/trash",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(trashHandler)).
+		Methods("GET")
+
+	r.Handle("/purgeTrash",
+		alice.New(mw.Auth).
+			Append(mw.CheckAccess(c.AdminRole)).
+			ThenFunc(purgeTrashHandler)).
+		Methods("POST")
+
 	r.HandleFunc("/vr", vrHandler)
 
 	r.Handle("/initiateSignUp",
@@ -1747,26 +4037,53 @@ func initServer() error {
 }
 
 func main() {
+	// Fail before anything else when the configuration is not usable
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	session.Init()
+	aws.Init()
 
 	aws.DisableModule = false
 	aws.DisableSmsModule = false
 
 	initLogging()
-	datastore.InitMySql()
-	defer datastore.CloseMySql()
+	if cfg.Store == config.StoreMemory {
+		// Nothing is persisted across restarts. Useful for local testing
+		datastore.Use(datastore.NewMemStore())
+	} else {
+		datastore.InitMySql()
+		defer datastore.CloseMySql()
+		if err := datastore.InitMongo(); err != nil {
+			log.Fatal(err)
+		}
+		defer datastore.CloseMongo()
+	}
+	if err := blob.Init(); err != nil {
+		log.Fatal(err)
+	}
+	cache.Init()
+	if err := push.Init(); err != nil {
+		log.Fatal(err)
+	}
 
-	err := initServer()
+	err = initServer()
 	if err != nil {
 		panic(err)
 	}
 
+	if cfg.Trash.PurgeInterval > 0 {
+		go purgeTrashEvery(time.Duration(cfg.Trash.PurgeInterval) * time.Hour)
+	}
+
 	originsOk := handlers.AllowedOrigins([]string{"*"})
 	headersOk := handlers.AllowedHeaders([]string{"content-type"})
 	credsOk := handlers.AllowCredentials()
 
-	log.Info("Server running on port 9980")
+	log.Infof("Server running on port %d", cfg.Server.Port)
 
-	err = http.ListenAndServe(":9980", handlers.CORS(originsOk, headersOk, credsOk)(getRouter()))
+	err = http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.Port), handlers.CORS(originsOk, headersOk, credsOk)(getRouter()))
 	if err != nil {
 		log.Error(err)
 	}
@@ -2,31 +2,51 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"rob/lib/blob"
 	c "rob/lib/common/constants"
 	"rob/lib/common/types"
+	"rob/lib/config"
+	"rob/lib/data"
+	cache "rob/lib/datacache"
 	"rob/lib/datastore"
 	mw "rob/lib/middleware"
+	"rob/lib/push"
+	"rob/lib/push/fcmtest"
+	"rob/lib/session"
 
 	mgo "gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	//"rob/lib/queue"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 var router http.Handler
 
+// Set when the tests run against the in-memory store.
+// export DISHA_STORE=memory to run without mysql and mongo
+var memStore *datastore.MemStore
+
 func TestMain(m *testing.M) {
 	beforeTests()
 	code := m.Run()
@@ -37,11 +57,12 @@ func TestMain(m *testing.M) {
 
 // Makes sure the test database is created
 func TestDatabaseExists(t *testing.T) {
+	skipForMemStore(t)
 	query := fmt.Sprintf(`
 		SELECT schema_name
 		FROM information_schema.schemata
 		WHERE schema_name = '%s'`,
-		c.TestMysqlDbName)
+		config.Get().Mysql.DbName)
 
 	if err := notEmptyQuery(query); err != nil {
 		t.Error(err)
@@ -50,6 +71,7 @@ func TestDatabaseExists(t *testing.T) {
 
 // Makes sure that all the required database tables are created in new db
 func TestDatabaseTablesExists(t *testing.T) {
+	skipForMemStore(t)
 	//reqTables := []string{"Users", "Roles", "UserRole", "Mascot", "PostQueue", "Sale"}
 
 	for _, reqTable := range c.MysqlTables {
@@ -57,7 +79,7 @@ func TestDatabaseTablesExists(t *testing.T) {
 			SELECT table_name
 			FROM information_schema.tables
 			WHERE table_schema = '%s'
-			AND table_name = '%s';`, c.TestMysqlDbName, reqTable)
+			AND table_name = '%s';`, config.Get().Mysql.DbName, reqTable)
 
 		if err := notEmptyQuery(query); err != nil {
 			t.Error(fmt.Sprintf("Table %q not found", reqTable), err)
@@ -65,14 +87,46 @@ func TestDatabaseTablesExists(t *testing.T) {
 	}
 }
 
-func notEmptyQuery(query string) error {
-	db, err := sql.Open("mysql", c.DbUriBase)
+// Makes sure that all the migrations are applied on a new db and that a dry
+// run leaves the schema untouched
+func TestSchemaVersion(t *testing.T) {
+	skipForMemStore(t)
+
+	version, err := datastore.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != datastore.LatestSchemaVersion() {
+		t.Errorf("Schema version mismatch. Expected=%d but received=%d", datastore.LatestSchemaVersion(), version)
+	}
+
+	steps, err := datastore.Migrate(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != version {
+		t.Errorf("Dry run to version 0 expected %d steps but received %d", version, len(steps))
+	}
+	for _, s := range steps {
+		if s.Upgrade {
+			t.Errorf("Dry run to version 0 expected only downgrades but received %s", s)
+		}
+	}
+
+	after, err := datastore.SchemaVersion()
+	if err != nil || after != version {
+		t.Errorf("Dry run changed the schema version from %d to %d", version, after)
+	}
+}
+
+func notEmptyQuery(query string, args ...interface{}) error {
+	db, err := sql.Open("mysql", config.Get().Mysql.BaseUri())
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
-	rows, err := db.Query(query)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return err
 	}
@@ -131,7 +185,7 @@ func TestAccess(t *testing.T) {
 			"/postlink",
 			http.MethodPost,
 			true,
-			[]int{c.AdminRole, c.WriterRole},
+			[]int{c.AdminRole},
 		},
 		{
 			"/editprofile",
@@ -181,6 +235,306 @@ func TestAccess(t *testing.T) {
 			true,
 			allRoles,
 		},
+		{
+			"/unlinkPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/movePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/pinPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/unpinPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/submitPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/approvePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/rejectPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/reviewQueue",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/myPosts",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/revisions",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/diffRevisions",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/revertPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/restorePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/vote",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/pollResults",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/comment",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/comments",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/deleteComment",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/hideComment",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/approveComment",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/heldComments",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/media",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/media",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/deleteProduct",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/cacheStats",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/notify",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/notification",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/manifest",
+			http.MethodGet,
+			true,
+			allRoles,
+		},
+		{
+			"/manifestChanges",
+			http.MethodGet,
+			true,
+			allRoles,
+		},
+		{
+			"/searchPosts",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/searchProducts",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/likePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/unlikePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/savePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/unsavePost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/savedPosts",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/views",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole, c.UserRole},
+		},
+		{
+			"/trash",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/purgeTrash",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/schedule",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/editPost",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole, c.WriterRole},
+		},
+		{
+			"/subscribedFeed",
+			http.MethodPost,
+			true,
+			allRoles,
+		},
+		{
+			"/subscribe",
+			http.MethodPost,
+			true,
+			allRoles,
+		},
+		{
+			"/unsubscribe",
+			http.MethodPost,
+			true,
+			allRoles,
+		},
+		{
+			"/subscriptions",
+			http.MethodGet,
+			true,
+			allRoles,
+		},
+		{
+			"/mascot",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/editMascot",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/retireMascot",
+			http.MethodPost,
+			true,
+			[]int{c.AdminRole},
+		},
+		{
+			"/mascots",
+			http.MethodGet,
+			true,
+			allRoles,
+		},
+		{
+			"/allMascots",
+			http.MethodGet,
+			true,
+			[]int{c.AdminRole},
+		},
 		{
 			"/logout",
 			http.MethodGet,
@@ -296,18 +650,7 @@ func TestSignUp(t *testing.T) {
 func TestProduct(t *testing.T) {
 	// START STEP 1
 	// clear mongo product table
-	session, err := mgo.Dial(c.Server)
-	if err != nil {
-		t.Fatal("Failed to connect to mongo", err)
-	}
-	defer session.Close()
-
-	co := session.DB(c.DbName).C(c.ProductCollection)
-
-	_, err = co.RemoveAll(nil)
-	if err != nil {
-		t.Fatal("Failed clearing mongo", err)
-	}
+	clearTable(c.ProductCollection, t)
 
 	// Login as admin and use this for all subsequent requests
 	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
@@ -376,20 +719,7 @@ func TestProduct(t *testing.T) {
 func TestSale(t *testing.T) {
 	//1. Start step 1
 	// clear mysql Sale table
-	db, err := sql.Open("mysql", c.DbUri)
-	if err != nil {
-		t.Fatal("Failed to connect to mysql", err)
-	}
-	defer db.Close()
-
-	query := fmt.Sprintf(`
-		TRUNCATE %s`,
-		c.SaleTable)
-
-	err = datastore.PrepareAndExec(query, db)
-	if err != nil {
-		t.Fatal("Failed to clear mysql table", err)
-	}
+	clearTable(c.SaleTable, t)
 
 	// Login as admin and use this for all subsequent requests
 	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
@@ -479,25 +809,12 @@ type addPostLink struct {
 func TestOrder(t *testing.T) {
 	//1. Start step 1
 	// clear mysql Orders table
-	db, err := sql.Open("mysql", c.DbUri)
+	clearTable(c.OrderTable, t)
+
+	// Login as admin and use this for all subsequent requests
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
 	if err != nil {
-		t.Fatal("Failed to connect to mysql", err)
-	}
-	defer db.Close()
-
-	query := fmt.Sprintf(`
-		TRUNCATE %s`,
-		c.OrderTable)
-
-	err = datastore.PrepareAndExec(query, db)
-	if err != nil {
-		t.Fatal("Failed to clear mysql table", err)
-	}
-
-	// Login as admin and use this for all subsequent requests
-	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
-	if err != nil {
-		t.Fatal("Admin login failed", err)
+		t.Fatal("Admin login failed", err)
 	}
 
 	// Create a order with an invalid productId
@@ -508,6 +825,12 @@ func TestOrder(t *testing.T) {
 	if code != http.StatusBadRequest {
 		t.Errorf("For endpoint=%s, method=%s, auth, expected=400 but received=%d", endpoint, "POST", code)
 	}
+	for _, invalid := range []string{"", "zz969fce895a1d431178cc9c", "59969fce895a1d431178cc9c00"} {
+		order = orderInIt(invalid, 1503042122863263469, 100, 100, 0, 1, 200, 1)
+		if code := createOrderWithStatus(order, t, loginCookie); code != http.StatusBadRequest {
+			t.Errorf("For productId=%q expected=400 but received=%d", invalid, code)
+		}
+	}
 
 	// create a order with non existing product id
 	randomProductId = "59969fce895a1d431178cc9c"
@@ -611,20 +934,7 @@ func TestAddress(t *testing.T) {
 
 	//1. Start step 1
 	// clear mysql Address table
-	db, err := sql.Open("mysql", c.DbUri)
-	if err != nil {
-		t.Fatal("Failed to connect to mysql", err)
-	}
-	defer db.Close()
-
-	query := fmt.Sprintf(`
-		TRUNCATE %s`,
-		c.AddressTable)
-
-	err = datastore.PrepareAndExec(query, db)
-	if err != nil {
-		t.Fatal("Failed to clear mysql table", err)
-	}
+	clearTable(c.AddressTable, t)
 
 	// Login as admin and use this for all subsequent requests
 	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
@@ -774,34 +1084,10 @@ func TestFeed(t *testing.T) {
 	// START STEP 1
 	// clear mongo post table
 
-	session, err := mgo.Dial(c.Server)
-	if err != nil {
-		t.Fatal("Failed to connect to mongo", err)
-	}
-	defer session.Close()
-
-	co := session.DB(c.DbName).C(c.Collection)
-
-	_, err = co.RemoveAll(nil)
-	if err != nil {
-		t.Fatal("Failed clearing mongo", err)
-	}
+	clearTable(c.Collection, t)
 
 	// clear mysql postqueue table
-	db, err := sql.Open("mysql", c.DbUri)
-	if err != nil {
-		t.Fatal("Failed to connect to mysql", err)
-	}
-	defer db.Close()
-
-	query := fmt.Sprintf(`
-		TRUNCATE %s`,
-		c.PostQueueTable)
-
-	err = datastore.PrepareAndExec(query, db)
-	if err != nil {
-		t.Fatal("Failed to clear mysql table", err)
-	}
+	clearTable(c.PostQueueTable, t)
 
 	// START STEP 2
 	// create mascots 11, 12
@@ -812,29 +1098,8 @@ func TestFeed(t *testing.T) {
 	mascot11Id := 11
 	mascot12Id := 12
 
-	query = fmt.Sprintf(`
-		INSERT INTO %s
-		VALUES(%d,'%s','%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.MascotTable, mascot11Id, mascot11Name, "",
-		c.Id, mascot11Id)
-
-	if err := datastore.PrepareAndExec(query, db); err != nil {
-		t.Fatal("Failed to create mascot 11", err)
-	}
-
-	query = fmt.Sprintf(`
-		INSERT INTO %s
-		VALUES(%d,'%s','%s')
-		ON DUPLICATE KEY
-		UPDATE %s = %d;`,
-		c.MascotTable, mascot12Id, mascot12Name, "",
-		c.Id, mascot12Id)
-
-	if err := datastore.PrepareAndExec(query, db); err != nil {
-		t.Fatal("Failed to create mascot 12", err)
-	}
+	createMascot(mascot11Id, mascot11Name, t)
+	createMascot(mascot12Id, mascot12Name, t)
 
 	// START STEP 3
 
@@ -904,6 +1169,8 @@ func TestFeed(t *testing.T) {
 			t.Fatal("Failed to retrive created post ", i, err)
 		}
 		allPosts[i].TimeOfCreation = p.TimeOfCreation
+		allPosts[i].Status = p.Status
+		allPosts[i].CreatedBy = p.CreatedBy
 	}
 
 	// START STEP 6
@@ -987,252 +1254,3090 @@ func TestFeed(t *testing.T) {
 
 }
 
-// 1. Create feedback using endpoint
-// 2. Test that database has the contents
-func TestFeedback(t *testing.T) {
-	ph := testPhone(c.UserRoleName)
-	pw := testPassword(c.UserRoleName)
-	loginCookie, err := loginUser(ph, pw)
+// Cursor pages cover the whole queue exactly once in either direction,
+// also when links share a TimeOfCreation
+func TestFeedPages(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+
+	mascotId := 13
+	createMascot(mascotId, "mascot13", t)
+
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	emptyPage := getFeedPage(mascotId, "", 3, http.StatusOK, t, loginCookie)
+	if len(emptyPage.Posts) != 0 || emptyPage.HasMore || emptyPage.Next != "" || emptyPage.Prev != "" {
+		t.Fatalf("Expected an empty page but received %+v", emptyPage)
+	}
+
+	totalPosts := 7
+	for i := 0; i < totalPosts; i++ {
+		p := types.Post{
+			CardType:    c.CardTypeArticle,
+			Title:       fmt.Sprintf("Page_%d", i),
+			DpSrc:       "test",
+			Src:         fmt.Sprintf("http://img-%d.com", i),
+			Description: fmt.Sprintf("Description_%d", i),
+			ButtonText:  fmt.Sprintf("ButtonText_%d", i),
+			Url:         fmt.Sprintf("Url_%d", i),
+		}
+		id := createPost(p, t, loginCookie)
+		if err := createPostLink(id, mascotId, loginCookie); err != nil {
+			t.Fatal("Failed to create postlink. index=", i, err)
+		}
+	}
+
+	// Posts 2, 3 and 4 get linked at the same time
+	links, err := datastore.GetPostLinks(mascotId)
+	if err != nil || len(links) != totalPosts {
+		t.Fatalf("Expected %d postlinks but received %d: %v", totalPosts, len(links), err)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].TimeOfCreation < links[j].TimeOfCreation })
+	for i := 3; i <= 4; i++ {
+		setPostLinkTime(mascotId, links[i].PostId, links[2].TimeOfCreation, t)
+		links[i].TimeOfCreation = links[2].TimeOfCreation
+	}
+
+	// Newest first, ties by PostId
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].TimeOfCreation != links[j].TimeOfCreation {
+			return links[i].TimeOfCreation > links[j].TimeOfCreation
+		}
+		return links[i].PostId > links[j].PostId
+	})
+	var expected []string
+	for _, l := range links {
+		expected = append(expected, l.PostId)
+	}
+
+	// Older pages from the top
+	var got []string
+	var pages []*types.FeedPage
+	cursor := ""
+	for {
+		page := getFeedPage(mascotId, cursor, 3, http.StatusOK, t, loginCookie)
+		pages = append(pages, page)
+		for _, p := range page.Posts {
+			got = append(got, p.Id.Hex())
+		}
+		if !page.HasMore {
+			break
+		}
+		if len(pages) > totalPosts {
+			t.Fatal("Paging older posts never ended")
+		}
+		cursor = page.Next
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Older pages out of order\nExpected: %v\nReceived: %v", expected, got)
+	}
+	if len(pages) != 3 {
+		t.Errorf("Expected 3 pages but received %d", len(pages))
+	}
+
+	// Past the oldest post there is nothing more
+	last := getFeedPage(mascotId, pages[len(pages)-1].Next, 3, http.StatusOK, t, loginCookie)
+	if len(last.Posts) != 0 || last.HasMore || last.Next != "" {
+		t.Errorf("Expected an empty last page but received %+v", last)
+	}
+
+	// Newer pages back from the oldest page
+	got = nil
+	cursor = pages[len(pages)-1].Prev
+	for {
+		page := getFeedPage(mascotId, cursor, 2, http.StatusOK, t, loginCookie)
+		var ids []string
+		for _, p := range page.Posts {
+			ids = append(ids, p.Id.Hex())
+		}
+		got = append(ids, got...)
+		if !page.HasMore {
+			break
+		}
+		cursor = page.Prev
+	}
+	// The oldest page itself is not read again
+	oldest := len(pages[len(pages)-1].Posts)
+	if strings.Join(got, ",") != strings.Join(expected[:totalPosts-oldest], ",") {
+		t.Fatalf("Newer pages out of order\nExpected: %v\nReceived: %v", expected[:totalPosts-oldest], got)
+	}
+
+	getFeedPage(mascotId, "garbage", 3, http.StatusBadRequest, t, loginCookie)
+	getFeedPage(mascotId, "", c.MaxPageSize+1, http.StatusBadRequest, t, loginCookie)
+}
+
+// Tests the merged feed of subscribed mascots
+// 1. Without subscriptions the default mascot is served
+// 2. Subscribing to missing or retired mascots fails
+// 3. Posts of the subscribed mascots are interleaved in time order. A post
+// linked to two of them appears once, at its newest link
+// 4. Pages read on in both directions
+// 5. Unsubscribing drops the mascot from the feed
+func TestSubscribedFeed(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+	clearTable(c.SubscriptionTable, t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	userCookie, err := loginUser(testPhone(c.UserRoleName), testPassword(c.UserRoleName))
 	if err != nil {
 		t.Fatal("User login failed", err)
 	}
 
-	err = createFeedback(c.Feedback, "test desc", loginCookie)
+	mascot21, mascot22, mascot23 := 21, 22, 23
+	createMascot(mascot21, "mascot21", t)
+	createMascot(mascot22, "mascot22", t)
+	createMascot(mascot23, "mascot23", t)
+
+	var postIds []string
+	for i := 0; i < 7; i++ {
+		postIds = append(postIds, createPost(types.Post{
+			CardType:   c.CardTypeArticle,
+			Title:      fmt.Sprintf("Merged_%d", i),
+			DpSrc:      "test",
+			Src:        fmt.Sprintf("http://img-%d.com", i),
+			ButtonText: "Read",
+			Url:        fmt.Sprintf("Url_%d", i),
+		}, t, adminCookie))
+	}
+
+	// Link times in order, post 1 is linked to both subscribed mascots
+	// and post 5 also to one the user is not subscribed to
+	links := []struct {
+		post   int
+		mascot int
+	}{
+		{0, mascot21}, {1, mascot21}, {2, mascot21},
+		{3, mascot22}, {4, mascot22}, {5, mascot22},
+		{1, mascot22}, {5, mascot23}, {6, c.DefaultMascotId},
+	}
+	base := int64(1500000000000000000)
+	for i, l := range links {
+		if err := createPostLink(postIds[l.post], l.mascot, adminCookie); err != nil {
+			t.Fatal(err)
+		}
+		setPostLinkTime(l.mascot, postIds[l.post], base+int64(i), t)
+	}
+
+	// 1. No subscriptions yet
+	page := getSubscribedFeed("", 5, http.StatusOK, t, userCookie)
+	if len(page.Posts) != 1 || page.Posts[0].Id.Hex() != postIds[6] {
+		t.Errorf("Expected the default mascot feed without subscriptions but received %+v", page.Posts)
+	}
+
+	// 2. Subscriptions
+	subscribe := func(endpoint string, mascotId int) int {
+		data := url.Values{}
+		data.Set(c.MascotId, strconv.Itoa(mascotId))
+		return postForm(endpoint, data, userCookie).Code
+	}
+	if code := subscribe("/subscribe", 987654); code != http.StatusNotFound {
+		t.Errorf("Subscribing to a non existing mascot expected=404 but received=%d", code)
+	}
+	retired, err := datastore.CreateMascot(types.Mascot{Name: "retired"})
 	if err != nil {
-		t.Fatalf("Expected creation of new feedback to pass but it failed")
+		t.Fatal(err)
+	}
+	if err := datastore.RetireMascot(retired); err != nil {
+		t.Fatal(err)
+	}
+	if code := subscribe("/subscribe", retired); code != http.StatusBadRequest {
+		t.Errorf("Subscribing to a retired mascot expected=400 but received=%d", code)
+	}
+	for _, id := range []int{mascot21, mascot22, mascot22} {
+		if code := subscribe("/subscribe", id); code != http.StatusOK {
+			t.Fatalf("Subscribing to mascot %d expected=200 but received=%d", id, code)
+		}
+	}
+	mascots := getMascots("/subscriptions", t, userCookie)
+	if len(mascots) != 2 || mascots[0].Id != mascot21 || mascots[1].Id != mascot22 {
+		t.Errorf("Expected subscriptions to mascots %d and %d but received %+v", mascot21, mascot22, mascots)
+	}
+
+	// 3. and 4. Older pages then back to the newest
+	expected := []string{postIds[1], postIds[5], postIds[4], postIds[3], postIds[2], postIds[0]}
+	var got []string
+	var pages []*types.FeedPage
+	cursor := ""
+	for {
+		page := getSubscribedFeed(cursor, 4, http.StatusOK, t, userCookie)
+		pages = append(pages, page)
+		for _, p := range page.Posts {
+			got = append(got, p.Id.Hex())
+		}
+		if !page.HasMore || len(pages) > len(expected) {
+			break
+		}
+		cursor = page.Next
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Merged pages out of order\nExpected: %v\nReceived: %v", expected, got)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected 2 pages but received %d", len(pages))
 	}
 
-	// Assert the item is in database
-	query := fmt.Sprintf(`
-		SELECT *
-		FROM %s.%s
-		WHERE %s = '%s'`,
-		c.TestMysqlDbName, c.FeedbackTable,
-		c.Phone, ph)
+	newer := getSubscribedFeed(pages[1].Prev, 4, http.StatusOK, t, userCookie)
+	got = nil
+	for _, p := range newer.Posts {
+		got = append(got, p.Id.Hex())
+	}
+	if strings.Join(got, ",") != strings.Join(expected[:4], ",") || newer.HasMore {
+		t.Errorf("Newer page mismatch\nExpected: %v\nReceived: %v", expected[:4], got)
+	}
 
-	err = notEmptyQuery(query)
+	getSubscribedFeed("not-a-cursor", 4, http.StatusBadRequest, t, userCookie)
+
+	// 5. Unsubscribe
+	if code := subscribe("/unsubscribe", mascot22); code != http.StatusOK {
+		t.Fatalf("Unsubscribe expected=200 but received=%d", code)
+	}
+	page = getSubscribedFeed("", 10, http.StatusOK, t, userCookie)
+	got = nil
+	for _, p := range page.Posts {
+		got = append(got, p.Id.Hex())
+	}
+	expected = []string{postIds[2], postIds[1], postIds[0]}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Feed after unsubscribing mismatch\nExpected: %v\nReceived: %v", expected, got)
+	}
+}
+
+func getSubscribedFeed(cursor string, pageSize int, status int,
+	t *testing.T, loginCookie string) *types.FeedPage {
+	data := url.Values{}
+	data.Set(c.Cursor, cursor)
+	data.Set(c.PageSize, fmt.Sprintf("%d", pageSize))
+
+	res := postForm("/subscribedFeed", data, loginCookie)
+	if res.Code != status {
+		t.Fatalf("Subscribed feed request failed. Cursor=%q. Expected status=%d but received %d",
+			cursor, status, res.Code)
+	}
+	var page types.FeedPage
+	if status == http.StatusOK {
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatal("Feed page response unmarshal fail", err)
+		}
+	}
+	return &page
+}
+
+func getFeedPage(mid int, cursor string, pageSize int, status int,
+	t *testing.T, loginCookie string) *types.FeedPage {
+	data := url.Values{}
+	data.Set(c.MascotId, fmt.Sprintf("%d", mid))
+	data.Set(c.Cursor, cursor)
+	data.Set(c.PageSize, fmt.Sprintf("%d", pageSize))
+	req, _ := http.NewRequest(http.MethodPost, "/feed", bytes.NewBufferString(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Cookie", loginCookie)
+
+	res := executeRequest(req)
+	if res.Code != status {
+		t.Fatalf("Feed page request failed. Mascot=%d. Cursor=%q. Expected status=%d but received %d",
+			mid, cursor, status, res.Code)
+	}
+	var page types.FeedPage
+	if status == http.StatusOK {
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatal("Feed page response unmarshal fail", err)
+		}
+	}
+	return &page
+}
+
+func setPostLinkTime(mascotId int, postId string, timestamp int64, t *testing.T) {
+	if err := datastore.MovePostLink(mascotId, postId, timestamp); err != nil {
+		t.Fatal("Failed to update postlink", err)
+	}
+}
+
+// Tests for managing mascots, access is covered by TestAccess
+// 1. Invalid mascots are refused
+// 2. Create a mascot and edit it field by field
+// 3. Retire it and assert posts can no longer be linked to it
+// 4. Assert users only see the active mascots
+func TestMascots(t *testing.T) {
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
 	if err != nil {
-		t.Error(err)
+		t.Fatal("Admin login failed", err)
+	}
+	userCookie, err := loginUser(testPhone(c.UserRoleName), testPassword(c.UserRoleName))
+	if err != nil {
+		t.Fatal("User login failed", err)
+	}
+
+	// 1. Validation
+	invalid := []url.Values{
+		{c.Name: {"  "}},
+		{c.Name: {strings.Repeat("a", c.MaxMascotName+1)}},
+		{c.Name: {"Chef"}, c.Avatar: {"ftp://cdn.twiq.in/chef.png"}},
+		{c.Name: {"Chef"}, c.GradientStart: {"red"}},
+	}
+	for _, v := range invalid {
+		if code := postForm("/mascot", v, adminCookie).Code; code != http.StatusBadRequest {
+			t.Errorf("Create mascot with %v expected=400 but received=%d", v, code)
+		}
+	}
+
+	// 2. Create and edit
+	v := url.Values{}
+	v.Set(c.Name, "Chef")
+	v.Set(c.Description, "Recipes every day")
+	v.Set(c.Avatar, "https://cdn.twiq.in/chef.png")
+	v.Set(c.GradientStart, "#ff0000")
+	v.Set(c.GradientEnd, "#00FF00")
+	res := postForm("/mascot", v, adminCookie)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Create mascot expected=200 but received=%d", res.Code)
+	}
+	var mascotId int
+	if err := json.Unmarshal(res.Body.Bytes(), &mascotId); err != nil {
+		t.Fatal("Create mascot response unmarshal fail", err)
+	}
+
+	expected := types.Mascot{
+		Id:            mascotId,
+		Name:          "Chef",
+		Description:   "Recipes every day",
+		Avatar:        "https://cdn.twiq.in/chef.png",
+		GradientStart: "#ff0000",
+		GradientEnd:   "#00FF00",
+		IsActive:      true,
+	}
+	if m := findMascot(getMascots("/mascots", t, userCookie), mascotId); m == nil || *m != expected {
+		t.Errorf("Created mascot mismatch. Expected=%+v but received=%+v", expected, m)
+	}
+
+	// Only the fields sent change
+	v = url.Values{}
+	v.Set(c.MascotId, strconv.Itoa(mascotId))
+	v.Set(c.Name, "Head Chef")
+	v.Set(c.Description, "")
+	if code := postForm("/editMascot", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Edit mascot expected=200 but received=%d", code)
+	}
+	expected.Name = "Head Chef"
+	expected.Description = ""
+	if m := findMascot(getMascots("/mascots", t, userCookie), mascotId); m == nil || *m != expected {
+		t.Errorf("Edited mascot mismatch. Expected=%+v but received=%+v", expected, m)
+	}
+
+	v.Set(c.GradientEnd, "green")
+	if code := postForm("/editMascot", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit mascot with an invalid color expected=400 but received=%d", code)
+	}
+	v = url.Values{}
+	v.Set(c.MascotId, "987654")
+	if code := postForm("/editMascot", v, adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Edit of a non existing mascot expected=404 but received=%d", code)
+	}
+
+	// 3. Retire
+	postId := createPost(types.Post{
+		CardType:   c.CardTypeArticle,
+		Title:      "Mascot post",
+		DpSrc:      "https://cdn.twiq.in/dp.png",
+		Src:        "https://cdn.twiq.in/src.png",
+		ButtonText: "Read",
+		Url:        "https://twiq.in",
+	}, t, adminCookie)
+	if err := createPostLink(postId, mascotId, adminCookie); err != nil {
+		t.Error("Link to an active mascot failed", err)
+	}
+
+	v = url.Values{}
+	v.Set(c.MascotId, strconv.Itoa(c.DefaultMascotId))
+	if code := postForm("/retireMascot", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Retiring the default mascot expected=400 but received=%d", code)
+	}
+	v.Set(c.MascotId, "987654")
+	if code := postForm("/retireMascot", v, adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Retiring a non existing mascot expected=404 but received=%d", code)
+	}
+	v.Set(c.MascotId, strconv.Itoa(mascotId))
+	if code := postForm("/retireMascot", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Retire mascot expected=200 but received=%d", code)
+	}
+
+	if err := createPostLink(postId, mascotId, adminCookie); err == nil {
+		t.Error("Link to a retired mascot expected to fail but it passed")
+	}
+	if err := createPostLink(postId, 987654, adminCookie); err == nil {
+		t.Error("Link to a non existing mascot expected to fail but it passed")
+	}
+
+	// 4. Listing
+	if m := findMascot(getMascots("/mascots", t, userCookie), mascotId); m != nil {
+		t.Errorf("Retired mascot %d listed to users", mascotId)
+	}
+	m := findMascot(getMascots("/allMascots", t, adminCookie), mascotId)
+	if m == nil || m.IsActive {
+		t.Errorf("Retired mascot %d expected in the admin list as inactive, received=%+v", mascotId, m)
 	}
 }
 
-// Tests related to payment
-// 1. Clear all tables
-//2 . Try to process payment for an invalid orderid . Assert failure
-// 3. Try to process payment for an non existing orderid. Assert failure
-// 7. Try to process payment for an out of stock product for a orderid . Assert failure
-// 8. Process a valid payment . Assert success
+// Tests scheduled post links
+// 1. Links to be published later are hidden until then
+// 2. Expired links are hidden
+// 3. The schedule lists what is yet to be published or to expire
+func TestScheduledPosts(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
 
-func BrokenTestPayment(t *testing.T) {
-	//1. Start step 1
-	// clear mysql Transaction table
-	db, err := sql.Open("mysql", c.DbUri)
+	mascotId := 31
+	createMascot(mascotId, "mascot31", t)
+
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
 	if err != nil {
-		t.Fatal("Failed to connect to mysql", err)
+		t.Fatal("Admin login failed", err)
+	}
+
+	var postIds []string
+	for i := 0; i < 4; i++ {
+		postIds = append(postIds, createPost(types.Post{
+			CardType:   c.CardTypeArticle,
+			Title:      fmt.Sprintf("Scheduled_%d", i),
+			DpSrc:      "test",
+			Src:        fmt.Sprintf("http://img-%d.com", i),
+			ButtonText: "Read",
+			Url:        fmt.Sprintf("Url_%d", i),
+		}, t, loginCookie))
+	}
+
+	hour := int64(time.Hour)
+	now := time.Now().UTC().UnixNano()
+	schedule := func(postId string, publishAt, expireAt int64) int {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		v.Set(c.MascotId, strconv.Itoa(mascotId))
+		if publishAt != 0 {
+			v.Set(c.PublishAt, strconv.FormatInt(publishAt, 10))
+		}
+		if expireAt != 0 {
+			v.Set(c.ExpireAt, strconv.FormatInt(expireAt, 10))
+		}
+		return postForm("/postlink", v, loginCookie).Code
+	}
+
+	if code := schedule(postIds[0], now+2*hour, now+hour); code != http.StatusBadRequest {
+		t.Errorf("Link expiring before it is published expected=400 but received=%d", code)
+	}
+	for _, s := range []struct {
+		post      int
+		publishAt int64
+		expireAt  int64
+	}{
+		{0, 0, 0},
+		{1, now + hour, 0},
+		{2, 0, now + hour},
+	} {
+		if code := schedule(postIds[s.post], s.publishAt, s.expireAt); code != http.StatusOK {
+			t.Fatalf("Scheduling post %d expected=200 but received=%d", s.post, code)
+		}
+	}
+	// Published an hour ago and expired since
+	if err := datastore.PostLink(mascotId, postIds[3], now-hour, now-1); err != nil {
+		t.Fatal(err)
+	}
+
+	feedIds := func() string {
+		var ids []string
+		for _, p := range getFeedPage(mascotId, "", 10, http.StatusOK, t, loginCookie).Posts {
+			ids = append(ids, p.Id.Hex())
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// 1. and 2.
+	expected := strings.Join([]string{postIds[2], postIds[0]}, ",")
+	if got := feedIds(); got != expected {
+		t.Errorf("Feed mismatch\nExpected: %s\nReceived: %s", expected, got)
+	}
+
+	// 3.
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/schedule?%s=%d", c.MascotId, mascotId), nil)
+	req.Header.Add("Cookie", loginCookie)
+	res := executeRequest(req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Schedule expected=200 but received=%d", res.Code)
+	}
+	var links []types.PostLink
+	if err := json.Unmarshal(res.Body.Bytes(), &links); err != nil {
+		t.Fatal("Schedule response unmarshal fail", err)
+	}
+	if len(links) != 2 || links[0].PostId != postIds[2] || links[1].PostId != postIds[1] {
+		t.Fatalf("Expected the schedule of posts %s and %s but received %+v", postIds[2], postIds[1], links)
+	}
+	if links[0].ExpireAt != now+hour || links[1].TimeOfCreation != now+hour {
+		t.Errorf("Schedule times mismatch: %+v", links)
+	}
+
+	// Once its time comes the post is served
+	setPostLinkTime(mascotId, postIds[1], time.Now().UTC().UnixNano(), t)
+	expected = strings.Join([]string{postIds[1], postIds[2], postIds[0]}, ",")
+	if got := feedIds(); got != expected {
+		t.Errorf("Feed after publishing mismatch\nExpected: %s\nReceived: %s", expected, got)
+	}
+}
+
+// Tests arranging a mascot queue
+// 1. Unlink a post
+// 2. Move posts to the top, the middle and past the end
+// 3. Pin posts, at most MaxPinnedPosts, and unpin them
+// 4. Purging a deleted post removes it from the queue
+func TestArrangeQueue(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+
+	mascotId := 41
+	createMascot(mascotId, "mascot41", t)
+
+	// Admins arrange the queues
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	var p []string
+	base := int64(1500000000000000000)
+	for i := 0; i < 5; i++ {
+		id := createPost(types.Post{
+			CardType:   c.CardTypeArticle,
+			Title:      fmt.Sprintf("Arrange_%d", i),
+			DpSrc:      "test",
+			Src:        fmt.Sprintf("http://img-%d.com", i),
+			ButtonText: "Read",
+			Url:        fmt.Sprintf("Url_%d", i),
+		}, t, adminCookie)
+		if err := createPostLink(id, mascotId, adminCookie); err != nil {
+			t.Fatal(err)
+		}
+		setPostLinkTime(mascotId, id, base+int64(i)*1000, t)
+		p = append(p, id)
+	}
+
+	arrange := func(endpoint, postId string, position int) int {
+		v := url.Values{}
+		v.Set(c.MascotId, strconv.Itoa(mascotId))
+		v.Set(c.PostId, postId)
+		v.Set(c.Position, strconv.Itoa(position))
+		return postForm(endpoint, v, adminCookie).Code
+	}
+	ids := func(posts []types.Post) string {
+		var ids []string
+		for _, post := range posts {
+			ids = append(ids, post.Id.Hex())
+		}
+		return strings.Join(ids, ",")
+	}
+	assertFeed := func(step string, pinned, posts []string) {
+		page := getFeedPage(mascotId, "", 10, http.StatusOK, t, adminCookie)
+		if ids(page.Pinned) != strings.Join(pinned, ",") || ids(page.Posts) != strings.Join(posts, ",") {
+			t.Errorf("%s: feed mismatch\nExpected: %v %v\nReceived: %s %s",
+				step, pinned, posts, ids(page.Pinned), ids(page.Posts))
+		}
+	}
+
+	// 1. Unlink
+	if code := arrange("/unlinkPost", p[2], 0); code != http.StatusOK {
+		t.Fatalf("Unlink expected=200 but received=%d", code)
+	}
+	assertFeed("Unlink", nil, []string{p[4], p[3], p[1], p[0]})
+	if code := arrange("/unlinkPost", p[2], 0); code != http.StatusNotFound {
+		t.Errorf("Unlink of a post not linked expected=404 but received=%d", code)
+	}
+
+	// 2. Move
+	if code := arrange("/movePost", p[0], 0); code != http.StatusOK {
+		t.Fatalf("Move to the top expected=200 but received=%d", code)
+	}
+	assertFeed("Move to the top", nil, []string{p[0], p[4], p[3], p[1]})
+	if code := arrange("/movePost", p[4], 2); code != http.StatusOK {
+		t.Fatalf("Move to the middle expected=200 but received=%d", code)
+	}
+	assertFeed("Move to the middle", nil, []string{p[0], p[3], p[4], p[1]})
+	if code := arrange("/movePost", p[3], 99); code != http.StatusOK {
+		t.Fatalf("Move past the end expected=200 but received=%d", code)
+	}
+	assertFeed("Move past the end", nil, []string{p[0], p[4], p[1], p[3]})
+	if code := arrange("/movePost", p[2], 0); code != http.StatusNotFound {
+		t.Errorf("Move of a post not linked expected=404 but received=%d", code)
+	}
+	if code := arrange("/movePost", p[1], -1); code != http.StatusBadRequest {
+		t.Errorf("Move to a negative position expected=400 but received=%d", code)
+	}
+
+	// 3. Pin
+	if code := arrange("/pinPost", p[1], 0); code != http.StatusOK {
+		t.Fatalf("Pin expected=200 but received=%d", code)
+	}
+	assertFeed("Pin", []string{p[1]}, []string{p[0], p[4], p[3]})
+	if code := arrange("/movePost", p[1], 0); code != http.StatusBadRequest {
+		t.Errorf("Move of a pinned post expected=400 but received=%d", code)
+	}
+	for _, id := range []string{p[3], p[0]} {
+		if code := arrange("/pinPost", id, 0); code != http.StatusOK {
+			t.Fatalf("Pin expected=200 but received=%d", code)
+		}
+	}
+	// Last pinned first
+	assertFeed("Pin three", []string{p[0], p[3], p[1]}, []string{p[4]})
+	if code := arrange("/pinPost", p[4], 0); code != http.StatusBadRequest {
+		t.Errorf("Pin past the limit expected=400 but received=%d", code)
+	}
+	if code := arrange("/pinPost", p[1], 0); code != http.StatusOK {
+		t.Errorf("Pinning a pinned post again expected=200 but received=%d", code)
+	}
+	for _, id := range []string{p[0], p[3], p[3]} {
+		if code := arrange("/unpinPost", id, 0); code != http.StatusOK {
+			t.Fatalf("Unpin expected=200 but received=%d", code)
+		}
+	}
+	// Unpinned posts are back in their place
+	assertFeed("Unpin", []string{p[1]}, []string{p[0], p[4], p[3]})
+
+	// Later pages don't repeat the pinned post
+	page := getFeedPage(mascotId, "", 2, http.StatusOK, t, adminCookie)
+	page = getFeedPage(mascotId, page.Next, 2, http.StatusOK, t, adminCookie)
+	if len(page.Pinned) != 0 || ids(page.Posts) != p[3] {
+		t.Errorf("Second page mismatch. Expected: [] %s Received: %s %s", p[3], ids(page.Pinned), ids(page.Posts))
+	}
+
+	// 4. Delete and purge
+	v := url.Values{}
+	v.Set(c.PostId, p[4])
+	if code := postForm("/deletePost", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Delete post expected=200 but received=%d", code)
+	}
+	v = url.Values{}
+	v.Set(c.Days, "0")
+	if code := postForm("/purgeTrash", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Purge trash expected=200 but received=%d", code)
+	}
+	links, err := datastore.GetPostLinks(mascotId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range links {
+		if l.PostId == p[4] {
+			t.Errorf("Purged post %s still linked to mascot %d", p[4], mascotId)
+		}
+	}
+}
+
+// Tests the trash
+// 1. Deleted posts leave the feed, the list cards and the post listings
+// but keep their links
+// 2. They can't be edited or linked, and are listed in the trash
+// 3. Restored posts are back in their place
+// 4. Purging removes posts deleted long enough ago, their links and their
+// place in list cards
+func TestTrash(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+
+	mascotId := 42
+	createMascot(mascotId, "mascot42", t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	var children []string
+	for i := 0; i < 2; i++ {
+		children = append(children, createPost(types.Post{
+			CardType: c.CardTypeImage,
+			Title:    fmt.Sprintf("Trash_%d", i),
+			DpSrc:    "test",
+			Src:      fmt.Sprintf("http://img-%d.com", i),
+		}, t, adminCookie))
+	}
+	listId := createPost(types.Post{
+		CardType:      c.CardTypeList,
+		Title:         "Trash list",
+		GradientStart: "#123456",
+		GradientEnd:   "#123456",
+		Icon:          "Icon",
+		ChildPosts:    children,
+	}, t, adminCookie)
+	deletedId := children[0]
+	for _, id := range []string{deletedId, listId} {
+		if err := createPostLink(id, mascotId, adminCookie); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	postId := func(id string) url.Values {
+		v := url.Values{}
+		v.Set(c.PostId, id)
+		return v
+	}
+	// Ids of the feed, and whether a list card embeds the deleted post
+	feedIds := func() (string, bool) {
+		page := getFeedPage(mascotId, "", 10, http.StatusOK, t, adminCookie)
+		var ids []string
+		embedded := false
+		for _, p := range page.Posts {
+			ids = append(ids, p.Id.Hex())
+			embedded = embedded || strings.Contains(p.ChildPostsJson, deletedId)
+		}
+		return strings.Join(ids, ","), embedded
+	}
+
+	// 1. Delete
+	if code := postForm("/deletePost", postId("invalid"), adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Delete of an invalid postId expected=400 but received=%d", code)
+	}
+	if code := postForm("/deletePost", postId(deletedId), adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Delete expected=200 but received=%d", code)
+	}
+	if code := postForm("/deletePost", postId(deletedId), adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Delete of a post in the trash expected=404 but received=%d", code)
+	}
+	if got, embedded := feedIds(); got != listId || embedded {
+		t.Errorf("Feed with a deleted post expected=%s but received=%s. Embedded in the list card: %v",
+			listId, got, embedded)
+	}
+	for _, p := range getPostList("/posts", t, adminCookie) {
+		if p.Id.Hex() == deletedId {
+			t.Errorf("Deleted post %s listed in /posts", deletedId)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodGet, "/post?"+postId(deletedId).Encode(), nil)
+	req.Header.Add("Cookie", adminCookie)
+	if code := executeRequest(req).Code; code != http.StatusNotFound {
+		t.Errorf("Get of a deleted post expected=404 but received=%d", code)
+	}
+	if links, _ := datastore.GetPostLinks(mascotId); len(links) != 2 {
+		t.Errorf("Deleted posts keep their links. Expected 2 links but found %d", len(links))
+	}
+
+	// 2. In the trash
+	if err := createPostLink(deletedId, mascotId+1, adminCookie); err == nil {
+		t.Error("Expected linking a deleted post to fail but it passed")
+	}
+	edit := postId(deletedId)
+	edit.Set(c.Title, "Edited in the trash")
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Edit of a deleted post expected=404 but received=%d", code)
+	}
+	trash := getPostList("/trash", t, adminCookie)
+	if len(trash) != 1 || trash[0].Id.Hex() != deletedId || trash[0].Status != c.StatusDeleted ||
+		trash[0].DeletedBy == 0 || trash[0].TimeOfDeletion == 0 {
+		t.Errorf("Trash expected to hold %s but received %+v", deletedId, trash)
+	}
+
+	// 3. Restore
+	if code := postForm("/restorePost", postId(deletedId), adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Restore expected=200 but received=%d", code)
+	}
+	if code := postForm("/restorePost", postId(deletedId), adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Restore of a post out of the trash expected=404 but received=%d", code)
+	}
+	if got, embedded := feedIds(); got != listId+","+deletedId || !embedded {
+		t.Errorf("Feed after restore expected=%s,%s but received=%s. Embedded in the list card: %v",
+			listId, deletedId, got, embedded)
+	}
+	if trash := getPostList("/trash", t, adminCookie); len(trash) != 0 {
+		t.Errorf("Trash expected to be empty but holds %+v", trash)
+	}
+
+	// 4. Purge
+	for _, id := range children {
+		if code := postForm("/deletePost", postId(id), adminCookie).Code; code != http.StatusOK {
+			t.Fatalf("Delete expected=200 but received=%d", code)
+		}
+	}
+	days := url.Values{}
+	days.Set(c.Days, "-1")
+	if code := postForm("/purgeTrash", days, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Purge with negative days expected=400 but received=%d", code)
+	}
+	// Not deleted long enough ago
+	if code := postForm("/purgeTrash", nil, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Purge expected=200 but received=%d", code)
+	}
+	if trash := getPostList("/trash", t, adminCookie); len(trash) != 2 {
+		t.Errorf("Trash expected to hold 2 posts but holds %d", len(trash))
+	}
+	days.Set(c.Days, "0")
+	if code := postForm("/purgeTrash", days, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Purge expected=200 but received=%d", code)
+	}
+	if trash := getPostList("/trash", t, adminCookie); len(trash) != 0 {
+		t.Errorf("Trash expected to be empty but holds %+v", trash)
+	}
+	if links, _ := datastore.GetPostLinks(mascotId); len(links) != 1 || links[0].PostId != listId {
+		t.Errorf("Expected only %s linked after purge but found %+v", listId, links)
+	}
+	list, err := data.GetPostMetaData(listId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.ChildPosts) != 0 {
+		t.Errorf("Purged posts still children of the list card: %v", list.ChildPosts)
+	}
+	// Losing its children is a change of the list card
+	revisions, err := datastore.GetRevisions(listId)
+	if err != nil || len(revisions) == 0 {
+		t.Fatalf("Revisions of the list card expected but received %v, %v", revisions, err)
+	}
+	if last := revisions[len(revisions)-1]; last.Change != c.ChangeChildrenPurged || last.Author != 0 || len(last.Post.ChildPosts) != 0 {
+		t.Errorf("Revision of the list card losing its children mismatch %+v", last)
+	}
+	if n := len(revisions); n > 1 && revisions[n-2].Change == c.ChangeChildrenPurged {
+		t.Errorf("List card expected one revision for both children purged, received %+v", revisions)
+	}
+}
+
+// Tests the editorial workflow
+// 1. Writers create drafts that can't be linked
+// 2. They edit and submit their own drafts for review
+// 3. Admins reject them with a comment, and approve them resubmitted,
+// linking them to a mascot
+// 4. Published posts are edited by admins only, and restored posts get
+// back their status
+func TestEditorialWorkflow(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+
+	mascotId := 43
+	createMascot(mascotId, "mascot43", t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	writerCookie, err := loginUser(testPhone(c.WriterRoleName), testPassword(c.WriterRoleName))
+	if err != nil {
+		t.Fatal("Writer login failed", err)
+	}
+
+	postId := createPost(types.Post{
+		CardType:   c.CardTypeArticle,
+		Title:      "Workflow",
+		DpSrc:      "test",
+		Src:        "http://img.com",
+		ButtonText: "Read",
+		Url:        "Url",
+	}, t, writerCookie)
+	form := func(values ...string) url.Values {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		for i := 0; i+1 < len(values); i += 2 {
+			v.Set(values[i], values[i+1])
+		}
+		return v
+	}
+	status := func() *types.Post {
+		for _, p := range getPostList("/myPosts", t, writerCookie) {
+			if p.Id.Hex() == postId {
+				return &p
+			}
+		}
+		t.Fatalf("Post %s not in /myPosts", postId)
+		return nil
+	}
+	expect := func(step, endpoint string, v url.Values, cookie string, code int) {
+		if got := postForm(endpoint, v, cookie).Code; got != code {
+			t.Errorf("%s: %s expected=%d but received=%d", step, endpoint, code, got)
+		}
+	}
+
+	// 1. Drafts
+	if p := status(); p.Status != c.StatusDraft || p.CreatedBy == 0 {
+		t.Errorf("New post by a writer expected to be a draft with its author. Received %+v", p)
+	}
+	if err := createPostLink(postId, mascotId, writerCookie); err == nil {
+		t.Error("Expected linking a draft to fail but it passed")
+	}
+	expect("Approve a draft", "/approvePost", form(), adminCookie, http.StatusBadRequest)
+
+	// 2. Edit and submit
+	expect("Edit a draft", "/editPost", form(c.Title, "Workflow edited"), writerCookie, http.StatusOK)
+	expect("Submit", "/submitPost", form(), writerCookie, http.StatusOK)
+	expect("Submit again", "/submitPost", form(), writerCookie, http.StatusBadRequest)
+	expect("Edit once submitted", "/editPost", form(c.Title, "Too late"), writerCookie, http.StatusBadRequest)
+	queue := getPostList("/reviewQueue", t, adminCookie)
+	if len(queue) != 1 || queue[0].Id.Hex() != postId || queue[0].TimeOfSubmission == 0 {
+		t.Errorf("Review queue expected to hold %s but received %+v", postId, queue)
+	}
+	otherId, err := datastore.AddPost(types.Post{CardType: c.CardTypeImage, Title: "Not the writer's", Status: c.StatusDraft})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := url.Values{}
+	v.Set(c.PostId, otherId)
+	expect("Submit a post of someone else", "/submitPost", v, writerCookie, http.StatusUnauthorized)
+
+	// 3. Review
+	expect("Reject without a comment", "/rejectPost", form(), adminCookie, http.StatusBadRequest)
+	expect("Reject", "/rejectPost", form(c.Comment, "Needs a better title"), adminCookie, http.StatusOK)
+	if p := status(); p.Status != c.StatusRejected || p.ReviewComment != "Needs a better title" || p.ReviewedBy == 0 {
+		t.Errorf("Rejected post expected with its review. Received %+v", p)
+	}
+	expect("Edit a rejected post", "/editPost", form(c.Title, "A better title"), writerCookie, http.StatusOK)
+	expect("Resubmit", "/submitPost", form(), writerCookie, http.StatusOK)
+	expect("Approve to an unknown mascot", "/approvePost", form(c.MascotId, "1024"), adminCookie, http.StatusBadRequest)
+	expireAt := strconv.FormatInt(time.Now().Add(time.Hour).UnixNano(), 10)
+	expect("Approve", "/approvePost", form(c.MascotId, strconv.Itoa(mascotId), c.ExpireAt, expireAt), adminCookie, http.StatusOK)
+	if p := status(); p.Status != c.StatusPublished {
+		t.Errorf("Approved post expected to be %s. Received %+v", c.StatusPublished, p)
+	}
+	if queue := getPostList("/reviewQueue", t, adminCookie); len(queue) != 0 {
+		t.Errorf("Review queue expected to be empty but holds %+v", queue)
+	}
+	page := getFeedPage(mascotId, "", 5, http.StatusOK, t, writerCookie)
+	if len(page.Posts) != 1 || page.Posts[0].Id.Hex() != postId || page.Posts[0].Title != "A better title" {
+		t.Errorf("Approved post expected in the feed of mascot %d. Received %+v", mascotId, page.Posts)
+	}
+
+	// 4. Published
+	expect("Writer edit of a published post", "/editPost", form(c.Title, "Unreviewed"), writerCookie, http.StatusBadRequest)
+	expect("Admin edit of a published post", "/editPost", form(c.Title, "Reviewed"), adminCookie, http.StatusOK)
+	// Only admins arrange what users see
+	live := form(c.MascotId, strconv.Itoa(mascotId), c.Position, "0")
+	for _, endpoint := range []string{"/postlink", "/unlinkPost", "/movePost", "/pinPost", "/unpinPost"} {
+		expect("Writer arranging a published post", endpoint, live, writerCookie, http.StatusUnauthorized)
+	}
+	if page := getFeedPage(mascotId, "", 5, http.StatusOK, t, writerCookie); len(page.Posts) != 1 {
+		t.Errorf("Feed of mascot %d expected untouched by the writer but received %+v", mascotId, page.Posts)
+	}
+
+	draftId := createPost(types.Post{CardType: c.CardTypeImage, Title: "Draft", DpSrc: "test", Src: "http://img.com"}, t, writerCookie)
+	v.Set(c.PostId, draftId)
+	expect("Delete a draft", "/deletePost", v, adminCookie, http.StatusOK)
+	expect("Restore a draft", "/restorePost", v, adminCookie, http.StatusOK)
+	postId = draftId
+	if p := status(); p.Status != c.StatusDraft {
+		t.Errorf("Restored draft expected to be %s. Received %s", c.StatusDraft, p.Status)
+	}
+}
+
+// Tests the revision history of posts
+// 1. Every change is recorded with its author and the post as it became
+// 2. Revisions are diffed field by field
+// 3. Reverting puts back old content as a new revision
+// 4. Writers only see the history of their posts, and purged posts lose it
+// 5. Posts from before revisions were kept get their content as a baseline
+// on their first change
+// 6. A change is applied and reported so even if its revision can't be recorded
+func TestRevisions(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.RevisionCollection, t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	writerCookie, err := loginUser(testPhone(c.WriterRoleName), testPassword(c.WriterRoleName))
+	if err != nil {
+		t.Fatal("Writer login failed", err)
+	}
+
+	postId := createPost(types.Post{
+		CardType:   c.CardTypeArticle,
+		Title:      "First title",
+		DpSrc:      "test",
+		Src:        "http://img.com",
+		ButtonText: "Read",
+		Url:        "Url",
+	}, t, writerCookie)
+	form := func(values ...string) url.Values {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		for i := 0; i+1 < len(values); i += 2 {
+			v.Set(values[i], values[i+1])
+		}
+		return v
+	}
+	expect := func(step, endpoint string, v url.Values, cookie string, code int) {
+		if got := postForm(endpoint, v, cookie).Code; got != code {
+			t.Errorf("%s: %s expected=%d but received=%d", step, endpoint, code, got)
+		}
+	}
+	get := func(endpoint string, v url.Values, cookie string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, endpoint+"?"+v.Encode(), nil)
+		req.Header.Add("Cookie", cookie)
+		return executeRequest(req)
+	}
+	revisions := func(cookie string) []types.Revision {
+		res := get("/revisions", form(), cookie)
+		if res.Code != http.StatusOK {
+			t.Fatalf("Revisions expected=200 but received=%d", res.Code)
+		}
+		var revisions []types.Revision
+		if err := json.Unmarshal(res.Body.Bytes(), &revisions); err != nil {
+			t.Fatal("Revisions response unmarshal fail", err)
+		}
+		return revisions
+	}
+
+	// 1. Changes
+	expect("Edit title", "/editPost", form(c.Title, "Second title"), writerCookie, http.StatusOK)
+	expect("Edit description", "/editPost", form(c.Description, "Described"), writerCookie, http.StatusOK)
+	revs := revisions(writerCookie)
+	changes := []string{c.ChangeCreated, c.ChangeEdited, c.ChangeEdited}
+	titles := []string{"First title", "Second title", "Second title"}
+	if len(revs) != len(changes) {
+		t.Fatalf("Expected %d revisions but received %+v", len(changes), revs)
+	}
+	for i, r := range revs {
+		if r.Number != i+1 || r.Change != changes[i] || r.Post.Title != titles[i] || r.Author == 0 || r.TimeOfCreation == 0 {
+			t.Errorf("Revision %d expected %s with title %q. Received %+v", i+1, changes[i], titles[i], r)
+		}
+	}
+
+	// 2. Diff
+	res := get("/diffRevisions", form(c.From, "1", c.To, "3"), writerCookie)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Diff expected=200 but received=%d", res.Code)
+	}
+	var diff []types.FieldChange
+	if err := json.Unmarshal(res.Body.Bytes(), &diff); err != nil {
+		t.Fatal("Diff response unmarshal fail", err)
+	}
+	found := map[string]types.FieldChange{}
+	for _, f := range diff {
+		found[f.Field] = f
+	}
+	if f := found[c.Title]; f.From != "First title" || f.To != "Second title" {
+		t.Errorf("Title change expected in the diff. Received %+v", diff)
+	}
+	if f := found[c.Description]; f.From != "" || f.To != "Described" {
+		t.Errorf("Description change expected in the diff. Received %+v", diff)
+	}
+	if _, ok := found[c.Url]; ok {
+		t.Errorf("Unchanged Url in the diff %+v", diff)
+	}
+	if code := get("/diffRevisions", form(c.From, "1"), writerCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Diff without To expected=400 but received=%d", code)
+	}
+	if code := get("/diffRevisions", form(c.From, "1", c.To, "9"), writerCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Diff with a missing revision expected=404 but received=%d", code)
+	}
+
+	// 3. Revert
+	expect("Revert to a missing revision", "/revertPost", form(c.Revision, "9"), writerCookie, http.StatusNotFound)
+	expect("Revert without a revision", "/revertPost", form(), writerCookie, http.StatusBadRequest)
+	expect("Revert", "/revertPost", form(c.Revision, "1"), writerCookie, http.StatusOK)
+	revs = revisions(writerCookie)
+	last := revs[len(revs)-1]
+	if len(revs) != 4 || last.Change != c.ChangeReverted || last.RevertedTo != 1 ||
+		last.Post.Title != "First title" || last.Post.Description != "" {
+		t.Errorf("Revert expected as revision 4 with the first content. Received %+v", last)
+	}
+	p, err := data.GetPostMetaData(postId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "First title" || p.Status != c.StatusDraft {
+		t.Errorf("Reverted post expected with the first title, still a draft. Received %+v", p)
+	}
+	expect("Submit", "/submitPost", form(), writerCookie, http.StatusOK)
+	expect("Writer revert once submitted", "/revertPost", form(c.Revision, "3"), writerCookie, http.StatusBadRequest)
+	if revs = revisions(writerCookie); revs[len(revs)-1].Change != c.ChangeSubmitted {
+		t.Errorf("Submission expected as the last revision. Received %+v", revs[len(revs)-1])
+	}
+
+	// 4. Access and purge
+	adminPostId := createPost(types.Post{CardType: c.CardTypeImage, Title: "Admin", DpSrc: "test", Src: "http://img.com"}, t, adminCookie)
+	v := url.Values{}
+	v.Set(c.PostId, adminPostId)
+	if code := get("/revisions", v, writerCookie).Code; code != http.StatusUnauthorized {
+		t.Errorf("Writer reading the history of another's post expected=401 but received=%d", code)
+	}
+	if code := get("/revisions", form(), adminCookie).Code; code != http.StatusOK {
+		t.Errorf("Admin reading the history expected=200 but received=%d", code)
+	}
+	expect("Delete", "/deletePost", form(), adminCookie, http.StatusOK)
+	expect("Purge", "/purgeTrash", url.Values{c.Days: {"0"}}, adminCookie, http.StatusOK)
+	if code := get("/revisions", form(), adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("History of a purged post expected=404 but received=%d", code)
+	}
+	if revs, err := datastore.GetRevisions(postId); err != nil || len(revs) != 0 {
+		t.Errorf("Purged post expected without revisions. Received %+v, err=%v", revs, err)
+	}
+
+	// 5. Added without a revision, as before they were kept
+	postId, err = datastore.AddPost(types.Post{CardType: c.CardTypeImage, Title: "Old title", DpSrc: "test", Src: "http://img.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect("Edit an old post", "/editPost", form(c.Title, "New title"), adminCookie, http.StatusOK)
+	revs = revisions(adminCookie)
+	if len(revs) != 2 || revs[0].Change != c.ChangeBaseline || revs[0].Post.Title != "Old title" ||
+		revs[1].Change != c.ChangeEdited || revs[1].Post.Title != "New title" {
+		t.Fatalf("Baseline then edit expected. Received %+v", revs)
+	}
+	expect("Revert to the baseline", "/revertPost", form(c.Revision, "1"), adminCookie, http.StatusOK)
+	if p, err := data.GetPostMetaData(postId); err != nil || p.Title != "Old title" {
+		t.Errorf("Post expected back to its old title. Received %+v, %v", p, err)
+	}
+	expect("Delete after the baseline", "/deletePost", form(), adminCookie, http.StatusOK)
+	if revs = revisions(adminCookie); len(revs) != 4 || revs[3].Change != c.ChangeDeleted {
+		t.Errorf("One baseline only expected. Received %+v", revs)
+	}
+
+	// 6.
+	prevStore := datastore.Current()
+	datastore.Use(failingRevisions{prevStore})
+	expect("Restore without revisions", "/restorePost", form(), adminCookie, http.StatusOK)
+	datastore.Use(prevStore)
+	if p, err := data.GetPostMetaData(postId); err != nil || p.Status == c.StatusDeleted {
+		t.Errorf("Post expected restored. Received %+v, %v", p, err)
+	}
+	if revs = revisions(adminCookie); len(revs) != 4 {
+		t.Errorf("No revision expected for the restore. Received %+v", revs)
+	}
+}
+
+// failingRevisions is a store that can't record revisions
+type failingRevisions struct {
+	datastore.Store
+}
+
+func (failingRevisions) AddRevision(r types.Revision) (int, error) {
+	return 0, errors.New("Revisions unavailable")
+}
+
+// Tests editing a post
+// 1. Edits of missing or invalid posts fail
+// 2. Edits failing the rules of the card type are refused
+// 3. An edit replaces the cached post and the List cards embedding it,
+// and records the editor
+func TestEditPost(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	article := types.Post{
+		CardType:   c.CardTypeArticle,
+		Title:      "Before edit",
+		DpSrc:      "https://cdn.twiq.in/dp.png",
+		Src:        "https://cdn.twiq.in/src.png",
+		ButtonText: "Read",
+		Url:        "https://twiq.in",
+	}
+	articleId := createPost(article, t, adminCookie)
+	listId := createPost(types.Post{
+		CardType:      c.CardTypeList,
+		Title:         "List",
+		ChildPosts:    []string{articleId},
+		Icon:          "icon",
+		GradientStart: "#000000",
+		GradientEnd:   "#ffffff",
+	}, t, adminCookie)
+	if err := createPostLink(listId, c.DefaultMascotId, adminCookie); err != nil {
+		t.Fatal(err)
+	}
+
+	// Warm the cache
+	if _, err := data.GetPostMetaData(articleId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := data.GetPostMetaData(listId); err != nil {
+		t.Fatal(err)
+	}
+
+	// 1. Missing and invalid posts
+	v := url.Values{}
+	v.Set(c.PostId, bson.NewObjectId().Hex())
+	v.Set(c.Title, "Edited")
+	if code := postForm("/editPost", v, adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Edit of a non existing post expected=404 but received=%d", code)
+	}
+	v.Set(c.PostId, "5999c")
+	if code := postForm("/editPost", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit of an invalid postId expected=400 but received=%d", code)
+	}
+
+	// 2. Rules of the card type
+	v = url.Values{}
+	v.Set(c.PostId, articleId)
+	v.Set(c.Url, "")
+	if code := postForm("/editPost", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit of an article without Url expected=400 but received=%d", code)
+	}
+	v = url.Values{}
+	v.Set(c.PostId, listId)
+	v.Add(c.ChildPosts, articleId)
+	v.Add(c.ChildPosts, listId)
+	if code := postForm("/editPost", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit of a list into its own child expected=400 but received=%d", code)
+	}
+
+	// 3. Edit
+	v = url.Values{}
+	v.Set(c.PostId, articleId)
+	v.Set(c.Title, "After edit")
+	v.Set(c.Description, "Edited description")
+	if code := postForm("/editPost", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Edit post expected=200 but received=%d", code)
+	}
+
+	p, err := data.GetPostMetaData(articleId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "After edit" || p.Description != "Edited description" {
+		t.Errorf("Stale post served after the edit: %+v", p)
+	}
+	// Fields not sent are kept
+	if p.Url != article.Url || p.Src != article.Src || p.CardType != article.CardType {
+		t.Errorf("Fields not edited were changed: %+v", p)
+	}
+	if p.EditedBy == 0 || p.TimeOfEdit <= p.TimeOfCreation {
+		t.Errorf("Editor not recorded. EditedBy=%d TimeOfEdit=%d", p.EditedBy, p.TimeOfEdit)
+	}
+
+	page := getFeedPage(c.DefaultMascotId, "", 5, http.StatusOK, t, adminCookie)
+	if len(page.Posts) != 1 || !strings.Contains(page.Posts[0].ChildPostsJson, "After edit") {
+		t.Errorf("List card does not embed the edited post: %+v", page.Posts)
+	}
+}
+
+// Batched lookup returns posts in the requested order, served from the
+// cache or the database, and reports the ones missing
+func TestGetPostsByIds(t *testing.T) {
+	clearTable(c.Collection, t)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		id, err := datastore.AddPost(types.Post{CardType: c.CardTypeImage, Title: fmt.Sprintf("Batch_%d", i)})
+		if err != nil {
+			t.Fatal("Failed to add post", i, err)
+		}
+		ids = append(ids, id)
+	}
+
+	// Cache one of them so the lookup mixes hits and misses
+	if _, err := data.GetPostMetaData(ids[2]); err != nil {
+		t.Fatal("Failed to get post", err)
+	}
+
+	unknownId := bson.NewObjectId().Hex()
+	request := []string{ids[3], unknownId, ids[2], "invalid", ids[0], ids[3]}
+	posts, missing, err := data.GetPostsByIds(request)
+	if err != nil {
+		t.Fatal("Batched lookup failed", err)
+	}
+
+	expected := []string{ids[3], ids[2], ids[0], ids[3]}
+	if len(posts) != len(expected) {
+		t.Fatalf("Expected %d posts but received %d", len(expected), len(posts))
+	}
+	for i, p := range posts {
+		if p.Id.Hex() != expected[i] {
+			t.Errorf("Post %d out of order. Expected=%s but received=%s", i, expected[i], p.Id.Hex())
+		}
+	}
+	if len(missing) != 2 || missing[0] != unknownId || missing[1] != "invalid" {
+		t.Errorf("Expected missing posts [%s invalid] but received %v", unknownId, missing)
+	}
+
+	// Posts in the trash are served with their status, purged posts are
+	// no longer served from the cache
+	if err := data.DeletePost(ids[2], 0); err != nil {
+		t.Fatal("Failed to delete post", err)
+	}
+	if posts, err := data.GetPosts([]string{ids[2]}); err != nil || posts[0].Status != c.StatusDeleted {
+		t.Errorf("Expected the post in the trash to be %s. Received %+v, err=%v", c.StatusDeleted, posts, err)
+	}
+	if _, err := data.PurgeTrash(time.Now().UTC().UnixNano()); err != nil {
+		t.Fatal("Failed to purge the trash", err)
+	}
+	if _, err := data.GetPosts([]string{ids[0], ids[2]}); err == nil {
+		t.Error("Expected lookup of a purged post to fail but it passed")
+	} else if e, ok := err.(*data.MissingPostsError); !ok || len(e.PostIds) != 1 || e.PostIds[0] != ids[2] {
+		t.Errorf("Expected %s to be reported missing but received %v", ids[2], err)
+	}
+}
+
+// 1. Create feedback using endpoint
+// 2. Test that database has the contents
+func TestFeedback(t *testing.T) {
+	ph := testPhone(c.UserRoleName)
+	pw := testPassword(c.UserRoleName)
+	loginCookie, err := loginUser(ph, pw)
+	if err != nil {
+		t.Fatal("User login failed", err)
+	}
+
+	err = createFeedback(c.Feedback, "test desc", loginCookie)
+	if err != nil {
+		t.Fatalf("Expected creation of new feedback to pass but it failed")
+	}
+
+	// Assert the item is in database
+	if memStore != nil {
+		if memStore.FeedbackCount(ph) == 0 {
+			t.Error("Feedback not found in the store")
+		}
+		return
+	}
+
+	query := fmt.Sprintf(`
+		SELECT *
+		FROM %s.%s
+		WHERE %s = ?`,
+		config.Get().Mysql.DbName, c.FeedbackTable,
+		c.Phone)
+
+	err = notEmptyQuery(query, ph)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// Values that used to break the hand quoted sql statements
+var specialStrings = []string{
+	"it's",
+	`say "hi"`,
+	`back\slash\`,
+	`' OR '1'='1`,
+	"'); DROP TABLE Users; --",
+	"नमस्ते ✓ ünïcödé 😀",
+}
+
+// Round trips values with quotes, backslashes and unicode through every
+// table that stores user input and asserts they come back unchanged
+func TestSpecialCharacters(t *testing.T) {
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	for i, s := range specialStrings {
+		// Users
+		ph := fmt.Sprintf("955555555%d", i)
+		email := fmt.Sprintf("special%d@example.com", i)
+		datastore.DeleteUserByEmail(email)
+		u := types.User{
+			Email:     email,
+			Password:  s,
+			Gender:    sql.NullString{String: "O", Valid: true},
+			FirstName: sql.NullString{String: s, Valid: true},
+			LastName:  sql.NullString{String: s, Valid: true},
+			Phone:     sql.NullString{String: ph, Valid: true},
+			Code:      "1234",
+		}
+		if err := datastore.AddUser(u); err != nil {
+			t.Fatalf("AddUser failed for %q: %v", s, err)
+		}
+		got, err := datastore.GetUserByPhone(ph)
+		if err != nil {
+			t.Fatalf("GetUserByPhone failed for %q: %v", s, err)
+		}
+		if got.FirstName.String != s || got.LastName.String != s || got.Password != s {
+			t.Errorf("User round trip mismatch. Expected=%q but received=%q, %q, %q", s, got.FirstName.String, got.LastName.String, got.Password)
+		}
+		if err := datastore.UpdatePasswordResetToken(ph, s); err != nil {
+			t.Errorf("UpdatePasswordResetToken failed for %q: %v", s, err)
+		}
+		if err := datastore.UpdateToken(got.Id, s); err != nil {
+			t.Errorf("UpdateToken failed for %q: %v", s, err)
+		}
+		if err := datastore.DeleteUserByEmail(email); err != nil {
+			t.Errorf("DeleteUserByEmail failed for %q: %v", s, err)
+		}
+
+		// Address
+		a := types.Address{
+			Address:     s,
+			AddressType: s,
+			City:        s,
+			State:       s,
+			PostalCode:  560066,
+			Phone:       ph,
+		}
+		aId, err := datastore.AddAddress(a)
+		if err != nil {
+			t.Fatalf("AddAddress failed for %q: %v", s, err)
+		}
+		gotA, err := datastore.GetAddress(aId)
+		if err != nil {
+			t.Fatalf("GetAddress failed for %q: %v", s, err)
+		}
+		a.Id = aId
+		if !compareAddress(*gotA, a, t) {
+			t.Errorf("Address round trip mismatch for %q", s)
+		}
+		a.City = s + s
+		if err := datastore.EditAddress(aId, a); err != nil {
+			t.Fatalf("EditAddress failed for %q: %v", s, err)
+		}
+		gotA, err = datastore.GetAddress(aId)
+		if err != nil || gotA.City != s+s {
+			t.Errorf("Edited address round trip mismatch for %q", s)
+		}
+
+		// Sale
+		sale := types.Sale{
+			Title:       s,
+			Brand:       s,
+			ProductSku:  s,
+			Description: s,
+			ThumbNail:   s,
+			StockUnits:  10,
+		}
+		sId, err := datastore.AddSale(sale)
+		if err != nil {
+			t.Fatalf("AddSale failed for %q: %v", s, err)
+		}
+		gotS, err := datastore.GetSale(sId)
+		if err != nil {
+			t.Fatalf("GetSale failed for %q: %v", s, err)
+		}
+		sale.Id = sId
+		if !compareSale(*gotS, sale, t) {
+			t.Errorf("Sale round trip mismatch for %q", s)
+		}
+
+		// Orders take the product title
+		pId := createProduct(types.Product{Sku: "Sku", Title: s, Brand: "Brand", Quantity: 1, UnitPrice: 1}, t, loginCookie)
+		oId, err := datastore.CreateOrder(types.Order{ProductId: pId, SaleId: sId})
+		if err != nil {
+			t.Fatalf("CreateOrder failed for %q: %v", s, err)
+		}
+		gotO, err := datastore.GetOrder(oId)
+		if err != nil {
+			t.Fatalf("GetOrder failed for %q: %v", s, err)
+		}
+		if gotO.ProductTitle != s {
+			t.Errorf("Order round trip mismatch. Expected=%q but received=%q", s, gotO.ProductTitle)
+		}
+
+		// Transaction
+		trans := types.Transaction{
+			OrderId:     oId,
+			ProductInfo: s,
+			Email:       s,
+			FirstName:   s,
+			Hash:        s,
+		}
+		tId, err := datastore.InitiateTransaction(trans, sId)
+		if err != nil {
+			t.Fatalf("InitiateTransaction failed for %q: %v", s, err)
+		}
+		trans.Id = tId
+		trans.PaymentStatus = s
+		if err := datastore.UpdateSuccessTransaction(trans); err != nil {
+			t.Fatalf("UpdateSuccessTransaction failed for %q: %v", s, err)
+		}
+		gotT, err := datastore.GetTransaction(tId)
+		if err != nil {
+			t.Fatalf("GetTransaction failed for %q: %v", s, err)
+		}
+		if gotT.ProductInfo != s || gotT.FirstName != s || gotT.PaymentStatus != s {
+			t.Errorf("Transaction round trip mismatch for %q: %+v", s, gotT)
+		}
+
+		// Feedback
+		if err := datastore.AddFeedback(ph, c.Feedback, s); err != nil {
+			t.Fatalf("AddFeedback failed for %q: %v", s, err)
+		}
+		if memStore != nil {
+			if memStore.FeedbackCount(ph) == 0 {
+				t.Errorf("Feedback not found for %q", s)
+			}
+		} else {
+			query := fmt.Sprintf("SELECT * FROM %s.%s WHERE %s = ? AND %s = ?",
+				config.Get().Mysql.DbName, c.FeedbackTable, c.Phone, c.Description)
+			if err := notEmptyQuery(query, ph, s); err != nil {
+				t.Errorf("Feedback not found for %q: %v", s, err)
+			}
+		}
+
+		// Url cache
+		if _, err := datastore.PutManifestEntry(types.ManifestEntry{Url: s}); err != nil {
+			t.Fatalf("PutManifestEntry failed for %q: %v", s, err)
+		}
+		entries, err := datastore.GetManifestEntries()
+		found := false
+		for _, e := range entries {
+			found = found || (e.Url == s && !e.Removed)
+		}
+		if err != nil || !found {
+			t.Errorf("Url round trip mismatch for %q", s)
+		}
+		if _, err := datastore.RemoveManifestEntry(s); err != nil {
+			t.Errorf("RemoveManifestEntry failed for %q: %v", s, err)
+		}
+	}
+}
+
+// Tests related to payment
+// 1. Clear all tables
+//2 . Try to process payment for an invalid orderid . Assert failure
+// 3. Try to process payment for an non existing orderid. Assert failure
+// 7. Try to process payment for an out of stock product for a orderid . Assert failure
+// 8. Process a valid payment . Assert success
+
+func BrokenTestPayment(t *testing.T) {
+	//1. Start step 1
+	// clear mysql Transaction table
+	db, err := sql.Open("mysql", config.Get().Mysql.Uri())
+	if err != nil {
+		t.Fatal("Failed to connect to mysql", err)
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf(`
+		TRUNCATE %s`,
+		c.TransactionTable)
+
+	err = datastore.PrepareAndExec(query, db)
+	if err != nil {
+		t.Fatal("Failed to clear mysql table", err)
+	}
+
+	// Login as admin and use this for all subsequent requests
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	// test with invalid orderId
+	invalidOrderId := "444a"
+	amount := "100"
+	code := createPaymentRequest(amount, invalidOrderId, loginCookie, t)
+	if code != http.StatusBadRequest {
+		t.Errorf("For endpoint=/payment, method=%s, auth, expected=400 but received=%d", "POST", code)
+	}
+
+	// test with non existing orderId
+	invalidOrderId = "444678"
+	amount = "200"
+	code = createPaymentRequest(amount, invalidOrderId, loginCookie, t)
+	if code != http.StatusNotFound {
+		t.Errorf("For endpoint=/payment, method=%s, auth, expected=404 but received=%d", "POST", code)
+	}
+
+	// create a sale with 1 stock item
+	var sale types.Sale
+	sale.Title = fmt.Sprintf("Title")
+	sale.Brand = fmt.Sprintf("Brand")
+	sale.ProductSku = fmt.Sprintf("ProductSku")
+	sale.Description = fmt.Sprintf("Description")
+	sale.ThumbNail = fmt.Sprintf("http://localhost")
+	sale.StockUnits = 1
+	sale.SaleStartTime = 1503043001979004500
+	sale.SaleEndTime = 1503043031783511500
+
+	id := createSale(sale, t, loginCookie)
+	sale.Id, _ = strconv.Atoi(id)
+
+	// create a product with 1 stock item
+	var product types.Product
+	product.Sku = fmt.Sprintf("ProductSku")
+	product.Title = fmt.Sprintf("Title")
+	product.Brand = fmt.Sprintf("Brand")
+	product.Quantity = 1
+	product.UnitPrice = 10
+	product.Summary = fmt.Sprintf("Summary")
+	product.Image = fmt.Sprintf("http://img.com")
+	product.ThumbNail = fmt.Sprintf("http://thumb_img.com")
+	product.Description = fmt.Sprintf("Description")
+	product.Color = fmt.Sprintf("Color")
+	product.Size = fmt.Sprintf("Size")
+	productId := createProduct(product, t, loginCookie)
+
+	// create a valid addresss
+	var address types.Address
+	address.Address = fmt.Sprintf("Address")
+	address.AddressType = fmt.Sprintf("Address Type")
+	address.City = fmt.Sprintf("City")
+	address.State = fmt.Sprintf("State")
+	address.PostalCode = 560066
+	address.Phone = fmt.Sprintf("8095883377")
+	address.Id, _ = strconv.Atoi(createAddress(address, t, loginCookie))
+
+	// create an order with above data
+	var order types.Order
+	order = orderInIt(productId, 1503043001979004500, 100, 50, 0, address.Id, 200, sale.Id)
+	order.ProductTitle = product.Title
+	order.ProductThumb = product.ThumbNail
+	order.TransId = c.UninitiatedId
+	order.TransStatus = c.Uninitiated
+	order.ShippingStatus = c.Uninitiated
+	order.TrackingId = c.Uninitiated
+	order.ShippingId = c.UninitiatedId
+	order.Id, _ = strconv.Atoi(createOrder(order, t, loginCookie))
+
+	// process payment for order
+	res, err := createPayment(amount, loginCookie, order.Id, t)
+	if err != nil {
+		t.Fatal("couldnt process payment", err)
+		return
+	}
+	// Check transaction entry in Transaction table
+	exists, err := mw.CheckExistanceMysql(c.TransactionTable, c.Id, strconv.Itoa(res.TransId), true)
+	if err != nil {
+		t.Fatal("couldnt check transaction entry", err)
+		return
+	}
+
+	if !exists {
+		t.Error("No entry found for the transaction id")
+		return
+	}
+	// Assert that the product and sale have gone of stock
+	newProduct, err := datastore.GetProduct(productId)
+	if newProduct.Quantity != 0 {
+		t.Error("Product Quantity not decremented")
+	}
+	newSale, err := datastore.GetSale(sale.Id)
+	if newSale.StockUnits != 0 {
+		t.Error("Sale Stock not decremented")
+	}
+
+}
+
+// Test for updating the Instance Id (firebase token ) for a user
+
+func TestToken(t *testing.T) {
+
+	// Login as admin
+	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	token := "thisIsATestToken11234567!@#$"
+	code := updateToken(token, loginCookie)
+	if code != http.StatusOK {
+		t.Fatal("Updating token failed")
+	}
+}
+
+func updateToken(token string, loginCookie string) int {
+	data := url.Values{}
+	data.Set(c.Token, token)
+	req, _ := http.NewRequest(http.MethodPost, "/fbtoken", bytes.NewBufferString(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Cookie", loginCookie)
+
+	res := executeRequest(req)
+	return res.Code
+}
+
+func createPaymentRequest(amount, orderId, loginCookie string, t *testing.T) int {
+	data := url.Values{}
+	data.Set(c.Amount, amount)
+	data.Set(c.OrderId, orderId)
+	req, _ := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Cookie", loginCookie)
+
+	res := executeRequest(req)
+	return res.Code
+}
+
+func createPayment(amount, loginCookie string, orderId int, t *testing.T) (*types.TransactionResponse, error) {
+	data := url.Values{}
+	data.Set(c.Amount, amount)
+	id := strconv.Itoa(orderId)
+	data.Set(c.OrderId, id)
+	req, _ := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Cookie", loginCookie)
+
+	res := executeRequest(req)
+
+	if res.Code != http.StatusOK {
+		t.Fatalf("processing payment request failed for orderId=%d", orderId)
+		return nil, errors.New("processing payment request returned non-OK")
+	}
+	var result types.TransactionResponse
+	log.Debug("response from payment processing %s", res.Body)
+	err := json.Unmarshal(res.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal("Couldnt marshal payment response", err)
+		return nil, err
+	}
+	return &result, nil
+}
+
+func createFeedback(typ, desc, loginCookie string) error {
+	data := url.Values{}
+	data.Set(c.Type, typ)
+	data.Set(c.Description, desc)
+	req, _ := http.NewRequest(http.MethodPost, "/feedback", bytes.NewBufferString(data.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Cookie", loginCookie)
+
+	res := executeRequest(req)
+	if res.Code != http.StatusOK {
+		return errors.New(fmt.Sprintf("Status not Ok on feedback creation"))
+	}
+	return nil
+}
+
+func TestCardTypes(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+	clearTable(c.ProductCollection, t)
+	clearTable(c.SaleTable, t)
+
+	mascotId := 43
+	createMascot(mascotId, "mascot43", t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+
+	product := types.Product{Id: bson.NewObjectId(), Sku: "SHOE-43", Title: "Shoe", Quantity: 5, UnitPrice: 999}
+	if err := datastore.AddProduct(product); err != nil {
+		t.Fatal("AddProduct failed", err)
+	}
+	saleId, err := datastore.AddSale(types.Sale{
+		Title:         "Shoe sale",
+		ProductSku:    product.Sku,
+		StockUnits:    7,
+		SaleStartTime: time.Now().Add(time.Hour).UnixNano(),
+		SaleEndTime:   time.Now().Add(2 * time.Hour).UnixNano(),
+	})
+	if err != nil {
+		t.Fatal("AddSale failed", err)
+	}
+
+	// 1. Each type has its own rules
+	card := func(cardType int, kv ...string) url.Values {
+		v := url.Values{}
+		v.Set(c.CardType, strconv.Itoa(cardType))
+		v.Set(c.Title, "Card")
+		for i := 0; i < len(kv); i += 2 {
+			v.Add(kv[i], kv[i+1])
+		}
+		return v
+	}
+	invalid := []url.Values{
+		card(c.CardTypeVideo, c.Src, "http://v.com/a.mp4", c.Duration, "30"),
+		card(c.CardTypeVideo, c.Src, "http://v.com/a.mp4", c.Poster, "http://p.com", c.Duration, "0"),
+		card(c.CardTypeVideo, c.Poster, "http://p.com", c.Duration, "30"),
+		card(c.CardTypeCarousel, c.Media, "http://m.com/1"),
+		card(c.CardTypeCarousel, c.Media, "http://m.com/1", c.Media, ""),
+		card(c.CardTypeProduct, c.ProductId, "shoe"),
+		card(c.CardTypeProduct, c.ProductId, bson.NewObjectId().Hex()),
+		card(c.CardTypeSale, c.SaleId, "abc"),
+		card(c.CardTypeSale, c.SaleId, strconv.Itoa(saleId+1)),
+	}
+	for _, v := range invalid {
+		if code := postForm("/post", v, adminCookie).Code; code != http.StatusBadRequest {
+			t.Errorf("Create of %v expected=400 but received=%d", v, code)
+		}
+	}
+
+	videoId := createPost(types.Post{
+		CardType: c.CardTypeVideo,
+		Title:    "Video",
+		Src:      "http://v.com/a.mp4",
+		Poster:   "http://p.com/a.jpg",
+		Duration: 30,
+	}, t, adminCookie)
+	carouselId := createPost(types.Post{
+		CardType: c.CardTypeCarousel,
+		Title:    "Carousel",
+		Media:    []string{"http://m.com/2", "http://m.com/1", "http://m.com/3"},
+	}, t, adminCookie)
+	productId := createPost(types.Post{
+		CardType:  c.CardTypeProduct,
+		Title:     "Product",
+		ProductId: product.Id.Hex(),
+	}, t, adminCookie)
+	saleCardId := createPost(types.Post{
+		CardType: c.CardTypeSale,
+		Title:    "Sale",
+		SaleId:   saleId,
+	}, t, adminCookie)
+	for _, id := range []string{videoId, carouselId, productId, saleCardId} {
+		if err := createPostLink(id, mascotId, adminCookie); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	feed := func() map[string]types.Post {
+		page := getFeedPage(mascotId, "", 10, http.StatusOK, t, adminCookie)
+		posts := make(map[string]types.Post)
+		for _, p := range page.Posts {
+			posts[p.Id.Hex()] = p
+		}
+		return posts
+	}
+
+	// 2. The feed has the cards with the price and stock of the day
+	posts := feed()
+	if p := posts[videoId]; p.Poster != "http://p.com/a.jpg" || p.Duration != 30 {
+		t.Errorf("Video card expected Poster and Duration but received %+v", p)
+	}
+	if p := posts[carouselId]; strings.Join(p.Media, ",") != "http://m.com/2,http://m.com/1,http://m.com/3" {
+		t.Errorf("Carousel card Media out of order %v", p.Media)
+	}
+	if p := posts[productId]; p.Price != 999 || p.StockLeft != 5 {
+		t.Errorf("Product card expected Price=999 StockLeft=5 but received %d, %d", p.Price, p.StockLeft)
+	}
+	if p := posts[saleCardId]; p.Price != 999 || p.StockLeft != 7 || p.TimeToStart <= 0 {
+		t.Errorf("Sale card expected Price=999 StockLeft=7 and a future start but received %d, %d, %d",
+			p.Price, p.StockLeft, p.TimeToStart)
+	}
+
+	if err := datastore.DecrementStock(product.Id.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.UpdateSaleStock(saleId, -4); err != nil {
+		t.Fatal(err)
+	}
+	posts = feed()
+	if p := posts[productId]; p.StockLeft != 4 {
+		t.Errorf("Product card expected StockLeft=4 after a sale but received %d", p.StockLeft)
+	}
+	if p := posts[saleCardId]; p.StockLeft != 3 {
+		t.Errorf("Sale card expected StockLeft=3 but received %d", p.StockLeft)
+	}
+
+	// 3. Edits keep the fields of the type that are left out
+	edit := url.Values{}
+	edit.Set(c.PostId, videoId)
+	edit.Set(c.Duration, "45")
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Edit of the video card expected=200 but received=%d", code)
+	}
+	if p := feed()[videoId]; p.Duration != 45 || p.Poster != "http://p.com/a.jpg" {
+		t.Errorf("Edited video card expected Duration=45 and its Poster but received %+v", p)
+	}
+	edit.Set(c.Duration, fmt.Sprintf("%d", c.MaxVideoDuration+1))
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit of the video card past MaxVideoDuration expected=400 but received=%d", code)
+	}
+}
+
+func TestPolls(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+	clearTable(c.PollVoteTable, t)
+
+	mascotId := 44
+	createMascot(mascotId, "mascot44", t)
+
+	cookies := make(map[string]string)
+	for _, role := range []string{c.AdminRoleName, c.WriterRoleName, c.UserRoleName} {
+		cookie, err := loginUser(testPhone(role), testPassword(role))
+		if err != nil {
+			t.Fatal(role, "login failed", err)
+		}
+		cookies[role] = cookie
+	}
+	adminCookie, writerCookie, userCookie := cookies[c.AdminRoleName], cookies[c.WriterRoleName], cookies[c.UserRoleName]
+
+	// 1. Creation
+	poll := func(kv ...string) url.Values {
+		v := url.Values{}
+		v.Set(c.CardType, strconv.Itoa(c.CardTypePoll))
+		v.Set(c.Title, "Favourite color?")
+		for i := 0; i < len(kv); i += 2 {
+			v.Add(kv[i], kv[i+1])
+		}
+		return v
+	}
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).UnixNano(), 10)
+	invalid := []url.Values{
+		poll(c.Options, "Red"),
+		poll(c.Options, "Red", c.Options, " Red "),
+		poll(c.Options, "Red", c.Options, "Green", c.ClosesAt, "abc"),
+		poll(c.Options, "Red", c.Options, "Green", c.ClosesAt, past),
+		poll(c.Options, "1", c.Options, "2", c.Options, "3", c.Options, "4", c.Options, "5", c.Options, "6", c.Options, "7"),
+	}
+	for _, v := range invalid {
+		if code := postForm("/post", v, adminCookie).Code; code != http.StatusBadRequest {
+			t.Errorf("Create of poll %v expected=400 but received=%d", v, code)
+		}
+	}
+
+	pollId := createPost(types.Post{
+		CardType: c.CardTypePoll,
+		Title:    "Favourite color?",
+		Options:  []string{"Red", "Green", "Blue"},
+		ClosesAt: time.Now().Add(time.Hour).UnixNano(),
+	}, t, adminCookie)
+	imageId := createPost(types.Post{
+		CardType: c.CardTypeImage,
+		Title:    "Not a poll",
+		DpSrc:    "test",
+		Src:      "http://img.com",
+	}, t, adminCookie)
+	draftId := createPost(types.Post{
+		CardType: c.CardTypePoll,
+		Title:    "Draft poll",
+		Options:  []string{"Yes", "No"},
+	}, t, writerCookie)
+	if err := createPostLink(pollId, mascotId, adminCookie); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2. Votes
+	vote := func(postId, option, cookie string) (int, types.Post) {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		v.Set(c.Option, option)
+		res := postForm("/vote", v, cookie)
+		var p types.Post
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &p); err != nil {
+				t.Fatal("Vote response unmarshal fail", err)
+			}
+		}
+		return res.Code, p
+	}
+	code, p := vote(pollId, "1", userCookie)
+	if code != http.StatusOK || fmt.Sprint(p.Votes) != "[0 1 0]" || !p.Voted || p.MyVote != 1 {
+		t.Errorf("Vote expected=200 with Votes=[0 1 0] MyVote=1 but received=%d %v %v %d", code, p.Votes, p.Voted, p.MyVote)
+	}
+	tests := []struct {
+		postId, option, cookie string
+		code                   int
+	}{
+		{pollId, "2", userCookie, http.StatusConflict},
+		{pollId, "3", adminCookie, http.StatusBadRequest},
+		{pollId, "-1", adminCookie, http.StatusBadRequest},
+		{pollId, "abc", adminCookie, http.StatusBadRequest},
+		{imageId, "0", adminCookie, http.StatusBadRequest},
+		{draftId, "0", adminCookie, http.StatusBadRequest},
+		{bson.NewObjectId().Hex(), "0", adminCookie, http.StatusNotFound},
+		{pollId, "1", adminCookie, http.StatusOK},
+		{pollId, "2", writerCookie, http.StatusOK},
+	}
+	for _, test := range tests {
+		if code, _ := vote(test.postId, test.option, test.cookie); code != test.code {
+			t.Errorf("Vote for option %s of %s expected=%d but received=%d", test.option, test.postId, test.code, code)
+		}
+	}
+
+	// 3. The feed has the votes and the vote of whoever reads it
+	for cookie, mine := range map[string]int{userCookie: 1, writerCookie: 2, adminCookie: 1} {
+		page := getFeedPage(mascotId, "", 10, http.StatusOK, t, cookie)
+		if len(page.Posts) != 1 {
+			t.Fatalf("Feed expected the poll but received %d posts", len(page.Posts))
+		}
+		p := page.Posts[0]
+		if fmt.Sprint(p.Votes) != "[0 2 1]" || !p.Voted || p.MyVote != mine {
+			t.Errorf("Feed poll expected Votes=[0 2 1] MyVote=%d but received %v %v %d", mine, p.Votes, p.Voted, p.MyVote)
+		}
+	}
+
+	// 4. Options stay once voted on
+	edit := url.Values{}
+	edit.Set(c.PostId, pollId)
+	edit.Add(c.Options, "Red")
+	edit.Add(c.Options, "Blue")
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Edit of the options of a poll voted on expected=400 but received=%d", code)
+	}
+	edit = url.Values{}
+	edit.Set(c.PostId, pollId)
+	edit.Set(c.Title, "Favourite colour?")
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusOK {
+		t.Errorf("Edit of the question of a poll expected=200 but received=%d", code)
+	}
+
+	// 5. Results
+	req, _ := http.NewRequest(http.MethodGet, "/pollResults?"+c.PostId+"="+pollId, nil)
+	req.Header.Add("Cookie", adminCookie)
+	res := executeRequest(req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Poll results expected=200 but received=%d", res.Code)
+	}
+	var results types.PollResults
+	if err := json.Unmarshal(res.Body.Bytes(), &results); err != nil {
+		t.Fatal("Poll results unmarshal fail", err)
+	}
+	if results.Question != "Favourite colour?" || fmt.Sprint(results.Votes) != "[0 2 1]" ||
+		results.Total != 3 || len(results.Ballot) != 3 {
+		t.Errorf("Poll results mismatch %+v", results)
+	}
+
+	// 6. Closed polls take no votes
+	edit = url.Values{}
+	edit.Set(c.PostId, pollId)
+	edit.Set(c.ClosesAt, past)
+	if code := postForm("/editPost", edit, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Closing the poll expected=200 but received=%d", code)
+	}
+	clearTable(c.PollVoteTable, t)
+	if code, _ := vote(pollId, "0", userCookie); code != http.StatusBadRequest {
+		t.Errorf("Vote on a closed poll expected=400 but received=%d", code)
+	}
+}
+
+func TestEngagement(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+	clearTable(c.EngagementTable, t)
+
+	mascotId := 45
+	createMascot(mascotId, "mascot45", t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	userCookie, err := loginUser(testPhone(c.UserRoleName), testPassword(c.UserRoleName))
+	if err != nil {
+		t.Fatal("User login failed", err)
+	}
+	writerCookie, err := loginUser(testPhone(c.WriterRoleName), testPassword(c.WriterRoleName))
+	if err != nil {
+		t.Fatal("Writer login failed", err)
+	}
+
+	var postIds []string
+	for i := 0; i < 3; i++ {
+		postIds = append(postIds, createPost(types.Post{
+			CardType: c.CardTypeImage,
+			Title:    fmt.Sprintf("Engagement_%d", i),
+			DpSrc:    "test",
+			Src:      fmt.Sprintf("http://img-%d.com", i),
+		}, t, adminCookie))
+		if err := createPostLink(postIds[i], mascotId, adminCookie); err != nil {
+			t.Fatal(err)
+		}
+	}
+	draftId := createPost(types.Post{
+		CardType: c.CardTypeImage,
+		Title:    "Engagement draft",
+		DpSrc:    "test",
+		Src:      "http://img.com",
+	}, t, writerCookie)
+
+	act := func(endpoint, postId, cookie string) int {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		return postForm(endpoint, v, cookie).Code
+	}
+	feed := func(cookie string) map[string]types.Post {
+		posts := make(map[string]types.Post)
+		for _, p := range getFeedPage(mascotId, "", 10, http.StatusOK, t, cookie).Posts {
+			posts[p.Id.Hex()] = p
+		}
+		return posts
+	}
+
+	// 1. Likes and saves, twice changes nothing
+	tests := []struct {
+		endpoint, postId, cookie string
+		code                     int
+	}{
+		{"/likePost", postIds[0], userCookie, http.StatusOK},
+		{"/likePost", postIds[0], userCookie, http.StatusOK},
+		{"/likePost", postIds[0], adminCookie, http.StatusOK},
+		{"/likePost", postIds[1], adminCookie, http.StatusOK},
+		{"/savePost", postIds[1], userCookie, http.StatusOK},
+		{"/savePost", postIds[0], userCookie, http.StatusOK},
+		{"/savePost", postIds[2], userCookie, http.StatusOK},
+		{"/likePost", "invalid", userCookie, http.StatusBadRequest},
+		{"/likePost", bson.NewObjectId().Hex(), userCookie, http.StatusNotFound},
+		{"/savePost", draftId, userCookie, http.StatusBadRequest},
+		{"/unlikePost", "invalid", userCookie, http.StatusBadRequest},
+		{"/unlikePost", postIds[1], adminCookie, http.StatusOK},
+		{"/unsavePost", postIds[2], userCookie, http.StatusOK},
+		{"/unsavePost", postIds[2], userCookie, http.StatusOK},
+	}
+	for _, test := range tests {
+		if code := act(test.endpoint, test.postId, test.cookie); code != test.code {
+			t.Errorf("%s of %s expected=%d but received=%d", test.endpoint, test.postId, test.code, code)
+		}
+	}
+
+	// 2. Views, each user counts once
+	views := url.Values{}
+	for _, id := range []string{postIds[0], postIds[0], postIds[1], draftId, bson.NewObjectId().Hex()} {
+		views.Add(c.PostId, id)
+	}
+	for _, cookie := range []string{userCookie, userCookie, adminCookie} {
+		if code := postForm("/views", views, cookie).Code; code != http.StatusOK {
+			t.Fatalf("Views expected=200 but received=%d", code)
+		}
+	}
+	tooMany := url.Values{}
+	for i := 0; i <= c.MaxViewBatch; i++ {
+		tooMany.Add(c.PostId, postIds[0])
+	}
+	for _, v := range []url.Values{{}, tooMany, {c.PostId: {"invalid"}}} {
+		if code := postForm("/views", v, userCookie).Code; code != http.StatusBadRequest {
+			t.Errorf("Views of %d posts expected=400 but received=%d", len(v[c.PostId]), code)
+		}
+	}
+
+	// 3. The feed has the counts and what the reader did
+	type state struct {
+		likes, saves, views int
+		liked, saved        bool
+	}
+	expected := map[string]map[string]state{
+		userCookie: {
+			postIds[0]: {2, 1, 2, true, true},
+			postIds[1]: {0, 1, 2, false, true},
+			postIds[2]: {0, 0, 0, false, false},
+		},
+		adminCookie: {
+			postIds[0]: {2, 1, 2, true, false},
+			postIds[1]: {0, 1, 2, false, false},
+		},
+	}
+	for cookie, want := range expected {
+		posts := feed(cookie)
+		for id, s := range want {
+			p := posts[id]
+			got := state{p.Likes, p.Saves, p.Views, p.Liked, p.Saved}
+			if got != s {
+				t.Errorf("Feed counts of %s expected=%+v but received=%+v", id, s, got)
+			}
+		}
+	}
+
+	// 4. Saved posts, last saved first, without the deleted ones
+	saved := getPostList("/savedPosts", t, userCookie)
+	if len(saved) != 2 || saved[0].Id.Hex() != postIds[0] || saved[1].Id.Hex() != postIds[1] || !saved[0].Saved {
+		t.Errorf("Saved posts expected=%v but received %d posts", postIds[:2], len(saved))
+	}
+	if code := act("/deletePost", postIds[0], adminCookie); code != http.StatusOK {
+		t.Fatalf("Delete expected=200 but received=%d", code)
+	}
+	saved = getPostList("/savedPosts", t, userCookie)
+	if len(saved) != 1 || saved[0].Id.Hex() != postIds[1] {
+		t.Errorf("Saved posts after a delete expected=%s but received %d posts", postIds[1], len(saved))
+	}
+	if code := act("/unsavePost", postIds[0], userCookie); code != http.StatusOK {
+		t.Errorf("Unsave of a deleted post expected=200 but received=%d", code)
+	}
+	if saved := getPostList("/savedPosts", t, adminCookie); len(saved) != 0 {
+		t.Errorf("Saved posts of the admin expected none but received %d", len(saved))
+	}
+}
+
+func TestComments(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.PostQueueTable, t)
+	clearTable(c.CommentTable, t)
+
+	mascotId := 46
+	createMascot(mascotId, "mascot46", t)
+
+	banned := config.Get().Comments.BannedWords
+	config.Get().Comments.BannedWords = "spam,scam"
+	defer func() { config.Get().Comments.BannedWords = banned }()
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	userCookie, err := loginUser(testPhone(c.UserRoleName), testPassword(c.UserRoleName))
+	if err != nil {
+		t.Fatal("User login failed", err)
+	}
+	writerCookie, err := loginUser(testPhone(c.WriterRoleName), testPassword(c.WriterRoleName))
+	if err != nil {
+		t.Fatal("Writer login failed", err)
+	}
+
+	postId := createPost(types.Post{
+		CardType: c.CardTypeImage,
+		Title:    "Comments",
+		DpSrc:    "test",
+		Src:      "http://img.com",
+	}, t, adminCookie)
+	if err := createPostLink(postId, mascotId, adminCookie); err != nil {
+		t.Fatal(err)
+	}
+	draftId := createPost(types.Post{
+		CardType: c.CardTypeImage,
+		Title:    "Comments draft",
+		DpSrc:    "test",
+		Src:      "http://img.com",
+	}, t, writerCookie)
+
+	comment := func(postId, parentId, body, cookie string) (int, types.Comment) {
+		v := url.Values{}
+		v.Set(c.PostId, postId)
+		v.Set(c.ParentId, parentId)
+		v.Set(c.Body, body)
+		res := postForm("/comment", v, cookie)
+		var cm types.Comment
+		if res.Code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &cm); err != nil {
+				t.Fatal("Comment response unmarshal fail", err)
+			}
+		}
+		return res.Code, cm
+	}
+	list := func(parentId, after int, pageSize int, cookie string) types.CommentPage {
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("/comments?%s=%s&%s=%d&%s=%d&%s=%d",
+			c.PostId, postId, c.ParentId, parentId, c.After, after, c.PageSize, pageSize), nil)
+		req.Header.Add("Cookie", cookie)
+		res := executeRequest(req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("Comments expected=200 but received=%d", res.Code)
+		}
+		var page types.CommentPage
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatal("Comments response unmarshal fail", err)
+		}
+		return page
+	}
+	commentIds := func(page types.CommentPage) string {
+		var ids []string
+		for _, cm := range page.Comments {
+			ids = append(ids, strconv.Itoa(cm.Id))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// 1. Comments, replies and replies to replies joining the thread
+	var top []int
+	for i := 0; i < 3; i++ {
+		code, cm := comment(postId, "", fmt.Sprintf("Comment %d", i), userCookie)
+		if code != http.StatusOK || cm.Status != c.CommentVisible {
+			t.Fatalf("Comment expected=200 and visible but received=%d %s", code, cm.Status)
+		}
+		top = append(top, cm.Id)
+	}
+	_, reply := comment(postId, strconv.Itoa(top[0]), "A reply", adminCookie)
+	code, nested := comment(postId, strconv.Itoa(reply.Id), "A reply to the reply", userCookie)
+	if code != http.StatusOK || nested.ParentId != top[0] {
+		t.Errorf("Reply to a reply expected=200 in the thread of %d but received=%d %d", top[0], code, nested.ParentId)
+	}
+	_, held := comment(postId, "", "Buy SPAM now!", userCookie)
+	if held.Status != c.CommentHeld {
+		t.Errorf("Comment with a banned word expected=%s but received=%s", c.CommentHeld, held.Status)
+	}
+	for _, test := range []struct {
+		postId, parentId, body string
+		code                   int
+	}{
+		{postId, "", "  ", http.StatusBadRequest},
+		{postId, "", strings.Repeat("a", config.Get().Comments.MaxLength+1), http.StatusBadRequest},
+		{postId, "abc", "Hi", http.StatusBadRequest},
+		{postId, "999", "Hi", http.StatusBadRequest},
+		{postId, strconv.Itoa(held.Id), "Hi", http.StatusBadRequest},
+		{draftId, "", "Hi", http.StatusBadRequest},
+		{bson.NewObjectId().Hex(), "", "Hi", http.StatusNotFound},
+	} {
+		if code, _ := comment(test.postId, test.parentId, test.body, userCookie); code != test.code {
+			t.Errorf("Comment %q on %s replying to %q expected=%d but received=%d",
+				test.body, test.postId, test.parentId, test.code, code)
+		}
+	}
+
+	// 2. Pages, oldest first, without the held comment
+	page := list(0, 0, 2, userCookie)
+	if commentIds(page) != fmt.Sprintf("%d,%d", top[0], top[1]) || !page.HasMore || page.Comments[0].Replies != 2 {
+		t.Errorf("First page of comments mismatch %+v", page)
+	}
+	page = list(0, page.After, 2, userCookie)
+	if commentIds(page) != strconv.Itoa(top[2]) || page.HasMore {
+		t.Errorf("Second page of comments mismatch %+v", page)
+	}
+	if page = list(top[0], 0, 10, userCookie); commentIds(page) != fmt.Sprintf("%d,%d", reply.Id, nested.Id) {
+		t.Errorf("Replies mismatch %+v", page)
+	}
+	feedComments := func() int {
+		return getFeedPage(mascotId, "", 10, http.StatusOK, t, userCookie).Posts[0].Comments
+	}
+	if n := feedComments(); n != 5 {
+		t.Errorf("Feed comment count expected=5 but received=%d", n)
+	}
+
+	// 3. Moderation
+	req, _ := http.NewRequest(http.MethodGet, "/heldComments", nil)
+	req.Header.Add("Cookie", adminCookie)
+	var heldList []types.Comment
+	if err := json.Unmarshal(executeRequest(req).Body.Bytes(), &heldList); err != nil || len(heldList) != 1 || heldList[0].Id != held.Id {
+		t.Errorf("Held comments expected=[%d] but received %+v", held.Id, heldList)
+	}
+	commentId := func(id int) url.Values {
+		v := url.Values{}
+		v.Set(c.CommentId, strconv.Itoa(id))
+		return v
+	}
+	for _, test := range []struct {
+		endpoint string
+		id       int
+		cookie   string
+		code     int
+	}{
+		{"/approveComment", held.Id, adminCookie, http.StatusOK},
+		{"/hideComment", top[1], adminCookie, http.StatusOK},
+		{"/hideComment", 999, adminCookie, http.StatusNotFound},
+		{"/deleteComment", top[2], writerCookie, http.StatusUnauthorized},
+		{"/deleteComment", top[2], userCookie, http.StatusOK},
+		{"/deleteComment", top[2], userCookie, http.StatusNotFound},
+		{"/deleteComment", top[0], adminCookie, http.StatusOK},
+	} {
+		if code := postForm(test.endpoint, commentId(test.id), test.cookie).Code; code != test.code {
+			t.Errorf("%s of %d expected=%d but received=%d", test.endpoint, test.id, test.code, code)
+		}
+	}
+	// The approved comment is left, the deleted one went with its replies
+	if page = list(0, 0, 10, userCookie); commentIds(page) != strconv.Itoa(held.Id) {
+		t.Errorf("Comments after moderation expected=%d but received=%s", held.Id, commentIds(page))
+	}
+	if n := feedComments(); n != 1 {
+		t.Errorf("Feed comment count after moderation expected=1 but received=%d", n)
+	}
+}
+
+// Tests the search of posts and products
+// 1. Posts rank by where the words are found, drafts and trashed posts left out
+// 2. Pages and card type filter
+// 3. Products rank the same way and filter by brand
+// 4. Invalid queries
+func TestSearch(t *testing.T) {
+	clearTable(c.Collection, t)
+	clearTable(c.ProductCollection, t)
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	userCookie, err := loginUser(testPhone(c.UserRoleName), testPassword(c.UserRoleName))
+	if err != nil {
+		t.Fatal("User login failed", err)
+	}
+	writerCookie, err := loginUser(testPhone(c.WriterRoleName), testPassword(c.WriterRoleName))
+	if err != nil {
+		t.Fatal("Writer login failed", err)
+	}
+
+	post := func(cardType int, title, description, cookie string) string {
+		return createPost(types.Post{
+			CardType:    cardType,
+			Title:       title,
+			Description: description,
+			DpSrc:       "test",
+			Src:         "http://img.com",
+		}, t, cookie)
+	}
+	inTitle := post(c.CardTypeImage, "Umbrella sale", "Stay dry this monsoon", adminCookie)
+	twice := post(c.CardTypeGif, "Cats", "A cat under an umbrella, then another umbrella", adminCookie)
+	once := post(c.CardTypeImage, "Weather", "Carry an umbrella", adminCookie)
+	post(c.CardTypeImage, "Sunshine", "Nothing to carry", adminCookie)
+	post(c.CardTypeImage, "Umbrella draft", "Not reviewed yet", writerCookie)
+	trashed := post(c.CardTypeImage, "Umbrella deleted", "In the trash", adminCookie)
+	if err := datastore.DeletePost(trashed, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	searchPosts := func(query string, params url.Values, code int) types.PostSearchPage {
+		params.Set(c.Query, query)
+		req, _ := http.NewRequest(http.MethodGet, "/searchPosts?"+params.Encode(), nil)
+		req.Header.Add("Cookie", userCookie)
+		res := executeRequest(req)
+		var page types.PostSearchPage
+		if res.Code != code {
+			t.Errorf("Search of %q %v expected=%d but received=%d", query, params, code, res.Code)
+		} else if code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+				t.Fatal("Search response unmarshal fail", err)
+			}
+		}
+		return page
+	}
+	postIds := func(page types.PostSearchPage) string {
+		var ids []string
+		for _, p := range page.Posts {
+			ids = append(ids, p.Id.Hex())
+		}
+		return strings.Join(ids, ",")
+	}
+
+	// 1. Best match first
+	page := searchPosts("Umbrella", url.Values{}, http.StatusOK)
+	if got, want := postIds(page), strings.Join([]string{inTitle, twice, once}, ","); got != want || page.HasMore {
+		t.Errorf("Search expected=%s but received=%s", want, got)
+	}
+	if page = searchPosts("snow", url.Values{}, http.StatusOK); page.Posts == nil || len(page.Posts) != 0 {
+		t.Errorf("Search without a match expected=[] but received %+v", page.Posts)
+	}
+
+	// 2. Pages and card types
+	page = searchPosts("umbrella", url.Values{c.PageSize: {"2"}}, http.StatusOK)
+	if got, want := postIds(page), inTitle+","+twice; got != want || !page.HasMore || page.Offset != 2 {
+		t.Errorf("First page expected=%s but received=%s, %+v", want, got, page)
+	}
+	page = searchPosts("umbrella", url.Values{c.PageSize: {"2"}, c.Offset: {"2"}}, http.StatusOK)
+	if got := postIds(page); got != once || page.HasMore || page.Offset != 3 {
+		t.Errorf("Second page expected=%s but received=%s, %+v", once, got, page)
+	}
+	page = searchPosts("umbrella", url.Values{c.CardType: {strconv.Itoa(c.CardTypeGif)}}, http.StatusOK)
+	if got := postIds(page); got != twice {
+		t.Errorf("Gif cards expected=%s but received=%s", twice, got)
+	}
+	page = searchPosts("umbrella carry", url.Values{c.CardType: {strconv.Itoa(c.CardTypeGif), strconv.Itoa(c.CardTypeImage)}}, http.StatusOK)
+	if len(page.Posts) != 4 {
+		t.Errorf("Gif and image cards expected=4 but received %d", len(page.Posts))
+	}
+
+	// 3. Products
+	product := func(title, brand, summary string) string {
+		return createProduct(types.Product{
+			Sku:       title,
+			Title:     title,
+			Brand:     brand,
+			Summary:   summary,
+			Quantity:  10,
+			UnitPrice: 10,
+		}, t, adminCookie)
+	}
+	shoes := product("Trail running shoes", "Acme", "Grips wet rock")
+	socks := product("Running socks", "Zephyr", "A pair of socks")
+	jacket := product("Rain jacket", "Acme", "Goes well with our shoes")
+
+	searchProducts := func(query, brand string, pageSize int) types.ProductSearchPage {
+		params := url.Values{}
+		params.Set(c.Query, query)
+		params.Set(c.Brand, brand)
+		params.Set(c.PageSize, strconv.Itoa(pageSize))
+		req, _ := http.NewRequest(http.MethodGet, "/searchProducts?"+params.Encode(), nil)
+		req.Header.Add("Cookie", userCookie)
+		res := executeRequest(req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("Search of products %v expected=200 but received=%d", params, res.Code)
+		}
+		var page types.ProductSearchPage
+		if err := json.Unmarshal(res.Body.Bytes(), &page); err != nil {
+			t.Fatal("Search response unmarshal fail", err)
+		}
+		return page
+	}
+	productIds := func(page types.ProductSearchPage) string {
+		var ids []string
+		for _, p := range page.Products {
+			ids = append(ids, p.Id.Hex())
+		}
+		return strings.Join(ids, ",")
+	}
+	for _, test := range []struct {
+		query    string
+		brand    string
+		pageSize int
+		expected []string
+		hasMore  bool
+	}{
+		{"shoes", "", 10, []string{shoes, jacket}, false},
+		{"shoes", "", 1, []string{shoes}, true},
+		// Equal matches, newest first
+		{"running", "", 10, []string{socks, shoes}, false},
+		{"running", "Acme", 10, []string{shoes}, false},
+		{"zephyr", "", 10, []string{socks}, false},
+		{"shoes", "Zephyr", 10, nil, false},
+	} {
+		page := searchProducts(test.query, test.brand, test.pageSize)
+		if got, want := productIds(page), strings.Join(test.expected, ","); got != want || page.HasMore != test.hasMore {
+			t.Errorf("Search of products %q of %q expected=%s but received=%s", test.query, test.brand, want, got)
+		}
+	}
+
+	// 4. Invalid queries
+	for _, test := range []struct {
+		query  string
+		params url.Values
+	}{
+		{" ", url.Values{}},
+		{strings.Repeat("a", c.MaxSearchQuery+1), url.Values{}},
+		{"umbrella", url.Values{c.Offset: {"-1"}}},
+		{"umbrella", url.Values{c.Offset: {strconv.Itoa(c.MaxSearchOffset + 1)}}},
+		{"umbrella", url.Values{c.PageSize: {"0"}}},
+		{"umbrella", url.Values{c.CardType: {"99"}}},
+	} {
+		searchPosts(test.query, test.params, http.StatusBadRequest)
+	}
+}
+
+// Tests the manifest of urls the app keeps offline
+// 1. Urls added are hashed, unless their hash is given, each change making a version
+// 2. The manifest is only sent again when its ETag changed
+// 3. Changes since a version list what was added, updated and removed
+// 4. Invalid changes
+func TestManifest(t *testing.T) {
+	clearTable(c.UrlCacheTable, t)
+	cache.RemoveManifest()
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	asset := []byte("body { color: #333; }")
+	assets := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/app.css" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(asset)
+	}))
+	defer assets.Close()
+
+	change := func(v url.Values, code int) {
+		t.Helper()
+		if res := postForm("/cache", v, adminCookie); res.Code != code {
+			t.Errorf("Change of the manifest %v expected=%d but received=%d %s", v, code, res.Code, res.Body.String())
+		}
+	}
+	get := func(endpoint, etag string, code int, v interface{}) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
+		req.Header.Add("Cookie", adminCookie)
+		if etag != "" {
+			req.Header.Add("If-None-Match", etag)
+		}
+		res := executeRequest(req)
+		if res.Code != code {
+			t.Fatalf("For endpoint=%s expected=%d but received=%d %s", endpoint, code, res.Code, res.Body.String())
+		}
+		if code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), v); err != nil {
+				t.Fatal("Manifest response unmarshal fail", err)
+			}
+		}
+		return res.Header().Get("ETag")
+	}
+
+	// 1. Versions
+	css := assets.URL + "/app.css"
+	logo := "https://cdn.twiq.in/img/logo.png"
+	logoHash := strings.Repeat("0f", 32)
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {css}, c.Priority: {"1"}}, http.StatusOK)
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {logo}, c.Priority: {"5"}, c.Hash: {logoHash}, c.Size: {"1024"}}, http.StatusOK)
+	// Unchanged, no new version
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {logo}, c.Priority: {"5"}, c.Hash: {logoHash}, c.Size: {"1024"}}, http.StatusOK)
+
+	var m types.Manifest
+	etag := get("/manifest", "", http.StatusOK, &m)
+	sum := sha256.Sum256(asset)
+	expected := []types.ManifestEntry{
+		{Url: logo, Hash: logoHash, Size: 1024, Priority: 5, Version: 2},
+		{Url: css, Hash: hex.EncodeToString(sum[:]), Size: int64(len(asset)), Priority: 1, Version: 1},
+	}
+	if m.Version != 2 || !reflect.DeepEqual(m.Entries, expected) {
+		t.Errorf("Manifest expected version 2 with %+v but received %+v", expected, m)
+	}
+
+	// 2. ETag
+	if etag != `"2"` {
+		t.Errorf("ETag expected=\"2\" but received=%s", etag)
+	}
+	get("/manifest", etag, http.StatusNotModified, nil)
+	get("/manifest", `W/"1", `+etag, http.StatusNotModified, nil)
+	var urls []string
+	get("/cache", "", http.StatusOK, &urls)
+	if !reflect.DeepEqual(urls, []string{logo, css}) {
+		t.Errorf("Cached urls expected=%v but received=%v", []string{logo, css}, urls)
+	}
+
+	// 3. Changes
+	change(url.Values{c.Type: {c.CacheRemove}, c.Url: {css}}, http.StatusOK)
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {logo}, c.Priority: {"9"}, c.Hash: {logoHash}, c.Size: {"1024"}}, http.StatusOK)
+	var changes types.ManifestChanges
+	etag = get("/manifestChanges?"+c.Since+"=2", etag, http.StatusOK, &changes)
+	if changes.Since != 2 || changes.Version != 4 || len(changes.Changed) != 1 || changes.Changed[0].Priority != 9 ||
+		!reflect.DeepEqual(changes.Removed, []string{css}) {
+		t.Errorf("Changes since 2 mismatch %+v", changes)
+	}
+	get("/manifestChanges?"+c.Since+"=2", etag, http.StatusNotModified, nil)
+	get("/manifestChanges?"+c.Since+"=4", "", http.StatusOK, &changes)
+	if changes.Version != 4 || len(changes.Changed) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("Changes since the version expected none but received %+v", changes)
+	}
+	get("/manifestChanges", "", http.StatusOK, &changes)
+	if len(changes.Changed) != 1 || len(changes.Removed) != 1 {
+		t.Errorf("Changes since 0 expected the whole manifest but received %+v", changes)
+	}
+	// Added back
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {css}}, http.StatusOK)
+	get("/manifestChanges?"+c.Since+"=4", "", http.StatusOK, &changes)
+	if len(changes.Changed) != 1 || changes.Changed[0].Url != css || len(changes.Removed) != 0 {
+		t.Errorf("Changes expected %s added back but received %+v", css, changes)
+	}
+
+	// 4. Invalid
+	get("/manifestChanges?"+c.Since+"=9", "", http.StatusConflict, nil)
+	get("/manifestChanges?"+c.Since+"=-1", "", http.StatusBadRequest, nil)
+	change(url.Values{c.Type: {c.CacheRemove}, c.Url: {logo + "?v=2"}}, http.StatusNotFound)
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {assets.URL + "/missing.css"}}, http.StatusBadRequest)
+	change(url.Values{c.Type: {c.CacheAdd}, c.Url: {"/img/logo.png"}}, http.StatusBadRequest)
+	change(url.Values{c.Type: {"2"}, c.Url: {logo}}, http.StatusBadRequest)
+}
+
+// Tests that admins see the statistics of the post cache, counting reads
+// of the same post
+func TestCacheStats(t *testing.T) {
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
+	if err != nil {
+		t.Fatal("Admin login failed", err)
+	}
+	stats := func() types.CacheStats {
+		req, _ := http.NewRequest(http.MethodGet, "/cacheStats", nil)
+		req.Header.Add("Cookie", adminCookie)
+		res := executeRequest(req)
+		if res.Code != http.StatusOK {
+			t.Fatalf("Cache stats expected=200 but received=%d", res.Code)
+		}
+		var s []types.CacheStats
+		if err := json.Unmarshal(res.Body.Bytes(), &s); err != nil || len(s) != 2 || s[0].Name != "posts" {
+			t.Fatalf("Cache stats mismatch %s, %v", res.Body.String(), err)
+		}
+		return s[0]
+	}
+
+	postId, err := datastore.AddPost(types.Post{Title: "Cached", CardType: c.CardTypeImage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := stats()
+	for i := 0; i < 2; i++ {
+		if _, err := data.GetPostMetaData(postId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	after := stats()
+	if after.Misses != before.Misses+1 || after.Hits != before.Hits+1 {
+		t.Errorf("Expected a miss then a hit but received %+v after %+v", after, before)
+	}
+}
+
+// Tests push notifications, sent to a local fake of FCM
+// 1. Without credentials nothing is sent
+// 2. Invalid notifications
+// 3. A notification to the subscribers of a mascot is recorded with its deliveries
+// 4. Devices failing for a while are retried, unregistered ones pruned
+// 5. A single user and the users of a role
+func TestNotifications(t *testing.T) {
+	clearTable(c.NotificationTable, t)
+	clearTable(c.DeliveryTable, t)
+	clearTable(c.SubscriptionTable, t)
+
+	prev := config.Get().Push
+	defer func() {
+		config.Get().Push = prev
+		push.Use(nil)
+	}()
+
+	cookies := map[int]string{}
+	userIds := map[int]int{}
+	for _, role := range rolePairs {
+		cookie, err := loginUser(testPhone(role.Name), testPassword(role.Name))
+		if err != nil {
+			t.Fatal("Login failed", err)
+		}
+		u, err := datastore.GetUserByPhone(testPhone(role.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookies[role.Id] = cookie
+		userIds[role.Id] = u.Id
+	}
+	adminCookie := cookies[c.AdminRole]
+	notify := func(v url.Values, code int) *types.Notification {
+		t.Helper()
+		res := postForm("/notify", v, adminCookie)
+		if res.Code != code {
+			t.Fatalf("Notification %v expected=%d but received=%d %s", v, code, res.Code, res.Body.String())
+		}
+		if code != http.StatusOK {
+			return nil
+		}
+		var n types.Notification
+		if err := json.Unmarshal(res.Body.Bytes(), &n); err != nil {
+			t.Fatal("Notification response unmarshal fail", err)
+		}
+		push.Wait()
+		return &n
+	}
+	report := func(notificationId string, code int) types.NotificationReport {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "/notification?"+c.NotificationId+"="+notificationId, nil)
+		req.Header.Add("Cookie", adminCookie)
+		res := executeRequest(req)
+		if res.Code != code {
+			t.Fatalf("Notification %s expected=%d but received=%d %s", notificationId, code, res.Code, res.Body.String())
+		}
+		var r types.NotificationReport
+		if code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &r); err != nil {
+				t.Fatal("Notification report unmarshal fail", err)
+			}
+		}
+		return r
+	}
+	// Deliveries by user id, as not only the test users may have a device
+	deliveries := func(r types.NotificationReport) map[int]types.Delivery {
+		if len(r.Deliveries) != r.Notification.Recipients {
+			t.Errorf("Deliveries expected=%d but received=%+v", r.Notification.Recipients, r.Deliveries)
+		}
+		byUser := map[int]types.Delivery{}
+		for _, d := range r.Deliveries {
+			byUser[d.UserId] = d
+		}
+		return byUser
 	}
-	defer db.Close()
 
-	query := fmt.Sprintf(`
-		TRUNCATE %s`,
-		c.TransactionTable)
+	// 1.
+	config.Get().Push.Credentials = ""
+	push.Use(nil)
+	notify(url.Values{c.Title: {"Hello"}, c.Body: {"World"}, c.Target: {c.TargetAll}}, http.StatusServiceUnavailable)
 
-	err = datastore.PrepareAndExec(query, db)
+	server, err := fcmtest.NewServer(t.TempDir())
 	if err != nil {
-		t.Fatal("Failed to clear mysql table", err)
+		t.Fatal(err)
 	}
+	defer server.Close()
+	config.Get().Push.Credentials = server.Credentials
+	config.Get().Push.Endpoint = server.URL
+	config.Get().Push.MaxAttempts = 3
+	config.Get().Push.Backoff = 1
+	push.Use(nil)
 
-	// Login as admin and use this for all subsequent requests
-	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
-	if err != nil {
-		t.Fatal("Admin login failed", err)
+	for _, role := range rolePairs {
+		if code := updateToken("device-"+role.Name, cookies[role.Id]); code != http.StatusOK {
+			t.Fatalf("Updating token of %s expected=200 but received=%d", role.Name, code)
+		}
 	}
 
-	// test with invalid orderId
-	invalidOrderId := "444a"
-	amount := "100"
-	code := createPaymentRequest(amount, invalidOrderId, loginCookie, t)
-	if code != http.StatusBadRequest {
-		t.Errorf("For endpoint=/payment, method=%s, auth, expected=400 but received=%d", "POST", code)
+	// 2.
+	var invalid = []url.Values{
+		{c.Title: {""}, c.Body: {"World"}, c.Target: {c.TargetAll}},
+		{c.Title: {"Hello"}, c.Body: {""}, c.Target: {c.TargetAll}},
+		{c.Title: {"Hello"}, c.Body: {"World"}, c.Data: {"[]"}, c.Target: {c.TargetAll}},
+		{c.Title: {"Hello"}, c.Body: {"World"}, c.Target: {"group"}},
+		{c.Title: {"Hello"}, c.Body: {"World"}, c.Target: {c.TargetUser}},
 	}
-
-	// test with non existing orderId
-	invalidOrderId = "444678"
-	amount = "200"
-	code = createPaymentRequest(amount, invalidOrderId, loginCookie, t)
-	if code != http.StatusNotFound {
-		t.Errorf("For endpoint=/payment, method=%s, auth, expected=404 but received=%d", "POST", code)
+	for _, v := range invalid {
+		notify(v, http.StatusBadRequest)
 	}
+	report("a", http.StatusBadRequest)
+	report("987654", http.StatusNotFound)
 
-	// create a sale with 1 stock item
-	var sale types.Sale
-	sale.Title = fmt.Sprintf("Title")
-	sale.Brand = fmt.Sprintf("Brand")
-	sale.ProductSku = fmt.Sprintf("ProductSku")
-	sale.Description = fmt.Sprintf("Description")
-	sale.ThumbNail = fmt.Sprintf("http://localhost")
-	sale.StockUnits = 1
-	sale.SaleStartTime = 1503043001979004500
-	sale.SaleEndTime = 1503043031783511500
-
-	id := createSale(sale, t, loginCookie)
-	sale.Id, _ = strconv.Atoi(id)
-
-	// create a product with 1 stock item
-	var product types.Product
-	product.Sku = fmt.Sprintf("ProductSku")
-	product.Title = fmt.Sprintf("Title")
-	product.Brand = fmt.Sprintf("Brand")
-	product.Quantity = 1
-	product.UnitPrice = 10
-	product.Summary = fmt.Sprintf("Summary")
-	product.Image = fmt.Sprintf("http://img.com")
-	product.ThumbNail = fmt.Sprintf("http://thumb_img.com")
-	product.Description = fmt.Sprintf("Description")
-	product.Color = fmt.Sprintf("Color")
-	product.Size = fmt.Sprintf("Size")
-	productId := createProduct(product, t, loginCookie)
-
-	// create a valid addresss
-	var address types.Address
-	address.Address = fmt.Sprintf("Address")
-	address.AddressType = fmt.Sprintf("Address Type")
-	address.City = fmt.Sprintf("City")
-	address.State = fmt.Sprintf("State")
-	address.PostalCode = 560066
-	address.Phone = fmt.Sprintf("8095883377")
-	address.Id, _ = strconv.Atoi(createAddress(address, t, loginCookie))
+	// 3.
+	createMascot(1, "Mascot", t)
+	if err := datastore.Subscribe(userIds[c.UserRole], 1); err != nil {
+		t.Fatal(err)
+	}
+	n := notify(url.Values{
+		c.Title:    {"Hello"},
+		c.Body:     {"Subscribers"},
+		c.Data:     {`{"MascotId":"1"}`},
+		c.Target:   {c.TargetMascot},
+		c.TargetId: {"1"},
+	}, http.StatusOK)
+	if n.Recipients != 1 || n.Status != c.NotificationSending || n.CreatedBy != userIds[c.AdminRole] {
+		t.Errorf("Notification to 1 device expected but received %+v", n)
+	}
+	r := report(strconv.Itoa(n.Id), http.StatusOK)
+	if r.Notification.Status != c.NotificationDone || r.Notification.Sent != 1 || r.Notification.Data["MascotId"] != "1" {
+		t.Errorf("Notification expected done and sent but received %+v", r.Notification)
+	}
+	if d := deliveries(r)[userIds[c.UserRole]]; d.Status != c.DeliverySent || d.Attempts != 1 || d.MessageId == "" {
+		t.Errorf("Delivery to the subscriber expected sent but received %+v", d)
+	}
+	sent := server.Sent()
+	if last := sent[len(sent)-1]; last.Token != "device-"+c.UserRoleName || last.Title != "Hello" || last.Data["MascotId"] != "1" {
+		t.Errorf("Message to the subscriber mismatch %+v", last)
+	}
+
+	// 4.
+	server.FailTimes("device-"+c.AdminRoleName, 2)
+	server.FailTimes("device-"+c.WriterRoleName, 3)
+	server.Unregister("device-" + c.UserRoleName)
+	n = notify(url.Values{c.Title: {"Hello"}, c.Body: {"Everyone"}, c.Target: {c.TargetAll}}, http.StatusOK)
+	byUser := deliveries(report(strconv.Itoa(n.Id), http.StatusOK))
+	if d := byUser[userIds[c.AdminRole]]; d.Status != c.DeliverySent || d.Attempts != 3 {
+		t.Errorf("Delivery to admin expected sent on the third attempt but received %+v", d)
+	}
+	if d := byUser[userIds[c.WriterRole]]; d.Status != c.DeliveryFailed || d.Attempts != 3 || d.Error == "" {
+		t.Errorf("Delivery to writer expected failed after 3 attempts but received %+v", d)
+	}
+	if d := byUser[userIds[c.UserRole]]; d.Status != c.DeliveryInvalid || d.Attempts != 1 {
+		t.Errorf("Delivery to user expected invalid but received %+v", d)
+	}
+	if memStore != nil {
+		if _, has := memStore.PushToken(userIds[c.UserRole]); has {
+			t.Error("Token of user expected pruned")
+		}
+	}
 
-	// create an order with above data
-	var order types.Order
-	order = orderInIt(productId, 1503043001979004500, 100, 50, 0, address.Id, 200, sale.Id)
-	order.ProductTitle = product.Title
-	order.ProductThumb = product.ThumbNail
-	order.TransId = c.UninitiatedId
-	order.TransStatus = c.Uninitiated
-	order.ShippingStatus = c.Uninitiated
-	order.TrackingId = c.Uninitiated
-	order.ShippingId = c.UninitiatedId
-	order.Id, _ = strconv.Atoi(createOrder(order, t, loginCookie))
+	// 5.
+	n = notify(url.Values{c.Title: {"Hello"}, c.Body: {"Writers"}, c.Target: {c.TargetRole}, c.TargetId: {strconv.Itoa(c.WriterRole)}}, http.StatusOK)
+	if n.Recipients != 1 {
+		t.Errorf("Notification to the writer expected but received %+v", n)
+	}
+	n = notify(url.Values{c.Title: {"Hello"}, c.Body: {"Pruned"}, c.Target: {c.TargetUser}, c.TargetId: {strconv.Itoa(userIds[c.UserRole])}}, http.StatusOK)
+	if n.Recipients != 0 {
+		t.Errorf("Notification to a user without a device expected no recipients but received %+v", n)
+	}
+	if r := report(strconv.Itoa(n.Id), http.StatusOK); r.Notification.Status != c.NotificationDone || len(r.Deliveries) != 0 {
+		t.Errorf("Notification without recipients expected done but received %+v", r)
+	}
+}
 
-	// process payment for order
-	res, err := createPayment(amount, loginCookie, order.Id, t)
+// Tests media uploads
+// 1. Images are stored with a thumbnail, the same one twice once
+// 2. Files not accepted
+// 3. Posts and products refer to media by id
+// 4. Private media are served through signed urls only
+// 5. Files go once neither posts nor products use them
+func TestMedia(t *testing.T) {
+	clearTable(c.MediaCollection, t)
+	clearTable(c.Collection, t)
+	clearTable(c.ProductCollection, t)
+
+	prev := config.Get().Media
+	defer func() {
+		config.Get().Media = prev
+		blob.Use(nil)
+	}()
+	files := blob.NewLocal(config.Get().Blob)
+	files.Dir = t.TempDir()
+	blob.Use(files)
+	config.Get().Media.MaxBytes = 64 << 10
+	config.Get().Media.ThumbSize = 16
+
+	adminCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
 	if err != nil {
-		t.Fatal("couldnt process payment", err)
-		return
+		t.Fatal("Admin login failed", err)
 	}
-	// Check transaction entry in Transaction table
-	exists, err := mw.CheckExistanceMysql(c.TransactionTable, c.Id, strconv.Itoa(res.TransId), true)
-	if err != nil {
-		t.Fatal("couldnt check transaction entry", err)
-		return
+
+	upload := func(content []byte, private bool, code int) types.Media {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		if private {
+			form.WriteField(c.Private, "true")
+		}
+		part, _ := form.CreateFormFile(c.File, "photo.jpg")
+		part.Write(content)
+		form.Close()
+		req, _ := http.NewRequest(http.MethodPost, "/media", &body)
+		req.Header.Add("Content-Type", form.FormDataContentType())
+		req.Header.Add("Cookie", adminCookie)
+		res := executeRequest(req)
+		var m types.Media
+		if res.Code != code {
+			t.Errorf("Upload expected=%d but received=%d %s", code, res.Code, res.Body.String())
+		} else if code == http.StatusOK {
+			if err := json.Unmarshal(res.Body.Bytes(), &m); err != nil {
+				t.Fatal("Media response unmarshal fail", err)
+			}
+		}
+		return m
 	}
 
-	if !exists {
-		t.Error("No entry found for the transaction id")
-		return
+	// 1. Stored with a thumbnail, sniffed as png whatever its name
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	var png1 bytes.Buffer
+	if err := png.Encode(&png1, img); err != nil {
+		t.Fatal(err)
 	}
-	// Assert that the product and sale have gone of stock
-	newProduct, err := datastore.GetProduct(productId)
-	if newProduct.Quantity != 0 {
-		t.Error("Product Quantity not decremented")
+	m := upload(png1.Bytes(), false, http.StatusOK)
+	if m.ContentType != "image/png" || m.Width != 64 || m.Height != 32 || m.Url == "" || m.ThumbUrl == "" {
+		t.Errorf("Uploaded media mismatch %+v", m)
 	}
-	newSale, err := datastore.GetSale(sale.Id)
-	if newSale.StockUnits != 0 {
-		t.Error("Sale Stock not decremented")
+	if _, err := os.Stat(filepath.Join(files.Dir, m.Thumb)); err != nil {
+		t.Errorf("Thumbnail not stored, %v", err)
+	}
+	if again := upload(png1.Bytes(), false, http.StatusOK); again.Id != m.Id {
+		t.Errorf("Same upload expected=%s but received=%s", m.Id, again.Id)
+	}
+	if code := getRequest("/media?"+c.MediaId+"="+m.Id, t, adminCookie); code != http.StatusOK {
+		t.Errorf("Get media expected=200 but received=%d", code)
+	}
+	if code := getRequest("/media?"+c.MediaId+"=abc", t, adminCookie); code != http.StatusNotFound {
+		t.Errorf("Get unknown media expected=404 but received=%d", code)
 	}
 
-}
+	// 2. Not accepted
+	upload([]byte("#!/bin/sh\necho hello"), false, http.StatusUnsupportedMediaType)
+	upload(make([]byte, 65<<10), false, http.StatusRequestEntityTooLarge)
+	upload(png1.Bytes()[:40], false, http.StatusBadRequest)
 
-// Test for updating the Instance Id (firebase token ) for a user
+	// 3. References
+	v := url.Values{}
+	v.Set(c.CardType, strconv.Itoa(c.CardTypeImage))
+	v.Set(c.Title, "Uploaded")
+	v.Set(c.SrcMediaId, m.Id)
+	v.Set(c.DpSrcMediaId, m.Id)
+	res := postForm("/post", v, adminCookie)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Post with media expected=200 but received=%d %s", res.Code, res.Body.String())
+	}
+	var postId string
+	json.Unmarshal(res.Body.Bytes(), &postId)
+	p, err := datastore.GetPostMetaData(postId)
+	if err != nil || p.Src != m.Url || p.DpSrc != m.Url {
+		t.Errorf("Post Src expected=%s but received %+v, %v", m.Url, p, err)
+	}
+	v.Set(c.SrcMediaId, "abc")
+	if code := postForm("/post", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Post with unknown media expected=400 but received=%d", code)
+	}
+
+	v = url.Values{}
+	v.Set(c.Sku, "media")
+	v.Set(c.Title, "Media")
+	v.Set(c.Quantity, "1")
+	v.Set(c.UnitPrice, "1")
+	v.Set(c.ImageMediaId, m.Id)
+	res = postForm("/product", v, adminCookie)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Product with media expected=200 but received=%d %s", res.Code, res.Body.String())
+	}
+	var productId string
+	json.Unmarshal(res.Body.Bytes(), &productId)
+	product, err := datastore.GetProduct(productId)
+	if err != nil || product.Image != m.Url || product.ThumbNail != m.ThumbUrl {
+		t.Errorf("Product images expected=%s, %s but received %+v, %v", m.Url, m.ThumbUrl, product, err)
+	}
 
-func TestToken(t *testing.T) {
+	// 4. Private
+	fetch := func(u string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodGet, strings.TrimPrefix(u, strings.TrimSuffix(files.BaseUrl, "/files/")), nil)
+		return executeRequest(req)
+	}
+	if res := fetch(m.Url); res.Code != http.StatusOK || !bytes.Equal(res.Body.Bytes(), png1.Bytes()) {
+		t.Errorf("Public file expected=200 but received=%d", res.Code)
+	}
+	var png2 bytes.Buffer
+	if err := png.Encode(&png2, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	secret := upload(png2.Bytes(), true, http.StatusOK)
+	if !secret.Private {
+		t.Errorf("Media expected private but received %+v", secret)
+	}
+	// Public content keeps its public url
+	upload(png1.Bytes(), true, http.StatusConflict)
+	if res := fetch(secret.Url); res.Code != http.StatusOK || !bytes.Equal(res.Body.Bytes(), png2.Bytes()) {
+		t.Errorf("Signed private file expected=200 but received=%d", res.Code)
+	}
+	for _, u := range []string{
+		files.BaseUrl + secret.Name,
+		strings.Replace(secret.Url, blob.Signature+"=", blob.Signature+"=0", 1),
+		files.BaseUrl + secret.Thumb + secret.Url[strings.Index(secret.Url, "?"):],
+	} {
+		if code := fetch(u).Code; code != http.StatusUnauthorized {
+			t.Errorf("Private file at %s expected=401 but received=%d", u, code)
+		}
+	}
+	v = url.Values{}
+	v.Set(c.CardType, strconv.Itoa(c.CardTypeImage))
+	v.Set(c.Title, "Secret")
+	v.Set(c.SrcMediaId, secret.Id)
+	if code := postForm("/post", v, adminCookie).Code; code != http.StatusBadRequest {
+		t.Errorf("Post with private media expected=400 but received=%d", code)
+	}
 
-	// Login as admin
-	loginCookie, err := loginUser(testPhone(c.AdminRoleName), testPassword(c.AdminRoleName))
-	if err != nil {
-		t.Fatal("Admin login failed", err)
+	// 5. Deletion. The product still uses the media once the post is gone
+	v = url.Values{}
+	v.Set(c.PostId, postId)
+	if code := postForm("/deletePost", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Delete post expected=200 but received=%d", code)
 	}
-	token := "thisIsATestToken11234567!@#$"
-	code := updateToken(token, loginCookie)
-	if code != http.StatusOK {
-		t.Fatal("Updating token failed")
+	v = url.Values{}
+	v.Set(c.Days, "0")
+	if code := postForm("/purgeTrash", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Purge trash expected=200 but received=%d", code)
+	}
+	if _, err := datastore.GetMedia(m.Id); err != nil {
+		t.Errorf("Media used by the product expected kept but received %v", err)
+	}
+	v = url.Values{}
+	v.Set(c.ProductId, productId)
+	if code := postForm("/deleteProduct", v, adminCookie).Code; code != http.StatusOK {
+		t.Fatalf("Delete product expected=200 but received=%d", code)
+	}
+	if code := postForm("/deleteProduct", v, adminCookie).Code; code != http.StatusNotFound {
+		t.Errorf("Delete of a deleted product expected=404 but received=%d", code)
+	}
+	if _, err := datastore.GetMedia(m.Id); err != mgo.ErrNotFound {
+		t.Errorf("Released media expected gone but received %v", err)
+	}
+	for _, name := range []string{m.Name, m.Thumb} {
+		if _, err := os.Stat(filepath.Join(files.Dir, name)); !os.IsNotExist(err) {
+			t.Errorf("File %s expected removed but received %v", name, err)
+		}
+	}
+	if code := fetch(m.Url).Code; code != http.StatusNotFound {
+		t.Errorf("Removed file expected=404 but received=%d", code)
 	}
 }
 
-func updateToken(token string, loginCookie string) int {
+func createPostLink(postId string, mascotId int, loginCookie string) error {
 	data := url.Values{}
-	data.Set(c.Token, token)
-	req, _ := http.NewRequest(http.MethodPost, "/fbtoken", bytes.NewBufferString(data.Encode()))
+	data.Set(c.PostId, postId)
+	data.Set(c.MascotId, fmt.Sprintf("%d", mascotId))
+	req, _ := http.NewRequest(http.MethodPost, "/postlink", bytes.NewBufferString(data.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Cookie", loginCookie)
 
 	res := executeRequest(req)
-	return res.Code
+	if res.Code != http.StatusOK {
+		return errors.New(fmt.Sprintf("Status not Ok on postlink creation with postId=%s, mascotId=%d", postId, mascotId))
+	}
+	return nil
 }
 
-func createPaymentRequest(amount, orderId, loginCookie string, t *testing.T) int {
-	data := url.Values{}
-	data.Set(c.Amount, amount)
-	data.Set(c.OrderId, orderId)
-	req, _ := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(data.Encode()))
+func postForm(endpoint string, data url.Values, loginCookie string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(data.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Cookie", loginCookie)
-
-	res := executeRequest(req)
-	return res.Code
+	return executeRequest(req)
 }
 
-func createPayment(amount, loginCookie string, orderId int, t *testing.T) (*types.TransactionResponse, error) {
-	data := url.Values{}
-	data.Set(c.Amount, amount)
-	id := strconv.Itoa(orderId)
-	data.Set(c.OrderId, id)
-	req, _ := http.NewRequest(http.MethodPost, "/payment", bytes.NewBufferString(data.Encode()))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+func getMascots(endpoint string, t *testing.T, loginCookie string) []types.Mascot {
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
 	req.Header.Add("Cookie", loginCookie)
 
 	res := executeRequest(req)
-
 	if res.Code != http.StatusOK {
-		t.Fatalf("processing payment request failed for orderId=%d", orderId)
-		return nil, errors.New("processing payment request returned non-OK")
+		t.Fatalf("For endpoint=%s, expected=200 but received=%d", endpoint, res.Code)
 	}
-	var result types.TransactionResponse
-	log.Debug("response from payment processing %s", res.Body)
-	err := json.Unmarshal(res.Body.Bytes(), &result)
-	if err != nil {
-		t.Fatal("Couldnt marshal payment response", err)
-		return nil, err
+	var mascots []types.Mascot
+	if err := json.Unmarshal(res.Body.Bytes(), &mascots); err != nil {
+		t.Fatal("Mascots response unmarshal fail", err)
 	}
-	return &result, nil
+	return mascots
 }
 
-func createFeedback(typ, desc, loginCookie string) error {
-	data := url.Values{}
-	data.Set(c.Type, typ)
-	data.Set(c.Description, desc)
-	req, _ := http.NewRequest(http.MethodPost, "/feedback", bytes.NewBufferString(data.Encode()))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+func getPostList(endpoint string, t *testing.T, loginCookie string) []types.Post {
+	req, _ := http.NewRequest(http.MethodGet, endpoint, nil)
 	req.Header.Add("Cookie", loginCookie)
 
 	res := executeRequest(req)
 	if res.Code != http.StatusOK {
-		return errors.New(fmt.Sprintf("Status not Ok on feedback creation"))
+		t.Fatalf("For endpoint=%s, expected=200 but received=%d", endpoint, res.Code)
 	}
-	return nil
+	var posts []types.Post
+	if err := json.Unmarshal(res.Body.Bytes(), &posts); err != nil {
+		t.Fatal("Posts response unmarshal fail", err)
+	}
+	return posts
 }
 
-func createPostLink(postId string, mascotId int, loginCookie string) error {
-	data := url.Values{}
-	data.Set(c.PostId, postId)
-	data.Set(c.MascotId, fmt.Sprintf("%d", mascotId))
-	req, _ := http.NewRequest(http.MethodPost, "/postlink", bytes.NewBufferString(data.Encode()))
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Cookie", loginCookie)
-
-	res := executeRequest(req)
-	if res.Code != http.StatusOK {
-		return errors.New(fmt.Sprintf("Status not Ok on postlink creation with postId=%s, mascotId=%d", postId, mascotId))
+func findMascot(mascots []types.Mascot, id int) *types.Mascot {
+	for i := range mascots {
+		if mascots[i].Id == id {
+			return &mascots[i]
+		}
 	}
 	return nil
 }
@@ -1252,6 +4357,17 @@ func createPost(p types.Post, t *testing.T, loginCookie string) string {
 	data.Set(c.Icon, p.Icon)
 	data.Set(c.GradientStart, p.GradientStart)
 	data.Set(c.GradientEnd, p.GradientEnd)
+	data.Set(c.Poster, p.Poster)
+	data.Set(c.Duration, fmt.Sprintf("%d", p.Duration))
+	for _, v := range p.Media {
+		data.Add(c.Media, v)
+	}
+	data.Set(c.ProductId, p.ProductId)
+	data.Set(c.SaleId, fmt.Sprintf("%d", p.SaleId))
+	for _, v := range p.Options {
+		data.Add(c.Options, v)
+	}
+	data.Set(c.ClosesAt, fmt.Sprintf("%d", p.ClosesAt))
 
 	req, _ := http.NewRequest(http.MethodPost, "/post", bytes.NewBufferString(data.Encode()))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -1733,11 +4849,19 @@ func executeRequest(req *http.Request) *httptest.ResponseRecorder {
 
 func beforeTests() {
 	// Set config to test database
-	c.SetMysqlCreds(c.TestMysqlUser, c.TestMysqlPass, c.TestMysqlDbName)
+	if _, err := config.LoadProfile(config.Test); err != nil {
+		panic(err)
+	}
+	session.Init()
 	initLogging()
-	// drop database incase previous run panniced and left the db intact
-	dropDatabase()
-	datastore.InitMySql()
+	if config.Get().Store == config.StoreMemory {
+		memStore = datastore.NewMemStore()
+		datastore.Use(memStore)
+	} else {
+		// drop database incase previous run panniced and left the db intact
+		dropDatabase()
+		datastore.InitMySql()
+	}
 	initServer()
 	router = getRouter()
 	// Add default users
@@ -1817,13 +4941,87 @@ func testPassword(s string) string {
 }
 
 func afterTests() {
+	if memStore != nil {
+		return
+	}
 	dropDatabase()
 	datastore.CloseMySql()
 }
 
+func skipForMemStore(t *testing.T) {
+	if memStore != nil {
+		t.Skip("Not applicable to the in-memory store")
+	}
+}
+
+// Empties a mysql table or a mongo collection of the store in use
+func clearTable(name string, t *testing.T) {
+	if memStore != nil {
+		if err := memStore.Truncate(name); err != nil {
+			t.Fatal("Failed to clear table", err)
+		}
+		return
+	}
+
+	if name == c.Collection || name == c.RevisionCollection || name == c.ProductCollection || name == c.MediaCollection {
+		session, err := mgo.Dial(config.Get().Mongo.Server)
+		if err != nil {
+			t.Fatal("Failed to connect to mongo", err)
+		}
+		defer session.Close()
+
+		_, err = session.DB(config.Get().Mongo.DbName).C(name).RemoveAll(nil)
+		if err != nil {
+			t.Fatal("Failed clearing mongo", err)
+		}
+		return
+	}
+
+	db, err := sql.Open("mysql", config.Get().Mysql.Uri())
+	if err != nil {
+		t.Fatal("Failed to connect to mysql", err)
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf(`
+		TRUNCATE %s`,
+		name)
+
+	err = datastore.PrepareAndExec(query, db)
+	if err != nil {
+		t.Fatal("Failed to clear mysql table", err)
+	}
+}
+
+func createMascot(id int, name string, t *testing.T) {
+	if memStore != nil {
+		memStore.AddMascot(id, name, "")
+		return
+	}
+
+	db, err := sql.Open("mysql", config.Get().Mysql.Uri())
+	if err != nil {
+		t.Fatal("Failed to connect to mysql", err)
+	}
+	defer db.Close()
+
+	query := fmt.Sprintf(`
+		INSERT INTO %s(%s, %s, %s)
+		VALUES(%d,'%s','%s')
+		ON DUPLICATE KEY
+		UPDATE %s = 1;`,
+		c.MascotTable, c.Id, c.Name, c.Description,
+		id, name, "",
+		c.IsActive)
+
+	if err := datastore.PrepareAndExec(query, db); err != nil {
+		t.Fatal("Failed to create mascot", id, err)
+	}
+}
+
 func dropDatabase() {
 	// Delete the created database to clear the state
-	db, err := sql.Open("mysql", c.DbUriBase)
+	db, err := sql.Open("mysql", config.Get().Mysql.BaseUri())
 	if err != nil {
 		panic(err)
 	}
@@ -1831,7 +5029,7 @@ func dropDatabase() {
 
 	query := fmt.Sprintf(`
 		DROP DATABASE IF EXISTS %s;`,
-		c.TestMysqlDbName)
+		config.Get().Mysql.DbName)
 
 	if err := datastore.PrepareAndExec(query, db); err != nil {
 		panic(err)
@@ -0,0 +1,91 @@
+// Command line tool to inspect and change the mysql schema version.
+// Uses the same configuration, and so database, as the server
+//
+//	go run ./migrate                 # upgrade to the latest version
+//	go run ./migrate -status         # print the current version
+//	go run ./migrate -to 3           # upgrade or downgrade to version 3
+//	go run ./migrate -down 1         # undo the last migration
+//	go run ./migrate -to 0 -dry-run  # list what would be done
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"rob/lib/config"
+	"rob/lib/datastore"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	var (
+		to     = flag.Int("to", -1, "schema version to migrate to, defaults to the latest")
+		down   = flag.Int("down", 0, "number of migrations to undo")
+		dryRun = flag.Bool("dry-run", false, "only list the migrations that would run")
+		status = flag.Bool("status", false, "print the current schema version and exit")
+	)
+	flag.Parse()
+	if *down < 0 {
+		usage("-down can't be negative")
+	}
+	if *down > 0 && *to >= 0 {
+		usage("-down and -to can't be used together")
+	}
+
+	log.SetLevel(log.InfoLevel)
+
+	if _, err := config.Load(); err != nil {
+		fail(err)
+	}
+
+	datastore.InitMySql()
+	defer datastore.CloseMySql()
+
+	current, err := datastore.SchemaVersion()
+	if err != nil {
+		fail(err)
+	}
+
+	if *status {
+		fmt.Printf("Schema version %d, latest %d\n", current, datastore.LatestSchemaVersion())
+		return
+	}
+
+	target := datastore.LatestSchemaVersion()
+	if *to >= 0 {
+		target = *to
+	}
+	if *down > 0 {
+		if *down > current {
+			usage(fmt.Sprintf("-down %d is more than the %d migrations applied", *down, current))
+		}
+		target = current - *down
+	}
+
+	steps, err := datastore.Migrate(target, *dryRun)
+	for _, step := range steps {
+		fmt.Println(step)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	if len(steps) == 0 {
+		fmt.Printf("Schema already at version %d\n", current)
+	} else if *dryRun {
+		fmt.Printf("Dry run, schema left at version %d\n", current)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// usage reports flags that can't be used as given
+func usage(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	flag.Usage()
+	os.Exit(2)
+}
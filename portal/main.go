@@ -19,17 +19,18 @@ import (
 	//"rob/lib/common/httperr"
 	//lh "rob/lib/common/loghelper"
 	"rob/lib/common/types"
+	"rob/lib/config"
 	//	"rob/lib/datastore"
 	mw "rob/lib/middleware"
 	//	"rob/lib/queue"
-	//"rob/lib/session"
 	"bytes"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http/httputil"
 	"net/url"
+	"rob/lib/session"
 	"strconv"
 	"strings"
-	"time"
 )
 
 type gzreadCloser struct {
@@ -64,7 +65,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 	data := url.Values{}
 	data.Set(c.Email, em)
 	data.Set(c.Password, pw)
-	req, err := http.NewRequest(http.MethodPost, c.LocalHost+"/login", bytes.NewBufferString(data.Encode()))
+	req, err := http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/login", bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		http.Redirect(w, r, "/error", 302)
 	}
@@ -123,7 +124,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	hc := http.Client{}
 	log.Debug(fmt.Sprintf(" Logout R header : %v", r.Header))
 	log.Debug(fmt.Sprintf("Logout R Body: %v", r.Body))
-	req, err := http.NewRequest(http.MethodGet, c.LocalHost+"/logout", nil)
+	req, err := http.NewRequest(http.MethodGet, config.Get().Server.ApiUrl+"/logout", nil)
 	if err != nil {
 		log.Error(err.Error())
 		http.Redirect(w, r, "/error", 302)
@@ -165,7 +166,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 
 func listHandler(w http.ResponseWriter, r *http.Request) {
 	hc := http.Client{}
-	req, err := http.NewRequest(http.MethodGet, c.LocalHost+"/posts", nil)
+	req, err := http.NewRequest(http.MethodGet, config.Get().Server.ApiUrl+"/posts", nil)
 	if err != nil {
 		log.Error(err.Error())
 		http.Redirect(w, r, "/error", 302)
@@ -204,19 +205,54 @@ func listHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Debug(fmt.Sprintf("Result : %#v", result))
 
+	mascots, err := getMascots(r)
+	if err != nil {
+		log.Error(err.Error())
+		http.Redirect(w, r, "/error", 302)
+		return
+	}
+
 	//fmt.Sprintf("data : %v", result)
 	t, err := template.New("list.html").ParseFiles("tmpl/list.html")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = t.Execute(w, result)
+	err = t.Execute(w, struct {
+		Posts   []types.Post
+		Mascots []types.Mascot
+	}{result, mascots})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// getMascots fetches the active mascots posts can be linked to
+func getMascots(r *http.Request) ([]types.Mascot, error) {
+	hc := http.Client{}
+	req, err := http.NewRequest(http.MethodGet, config.Get().Server.ApiUrl+"/mascots", nil)
+	if err != nil {
+		return nil, err
+	}
+	copyHeader(req.Header, r.Header)
+	// decoded below, so no compression
+	req.Header.Del("Accept-Encoding")
+
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching mascots failed. Status=%d", res.StatusCode)
+	}
+
+	var mascots []types.Mascot
+	err = json.NewDecoder(res.Body).Decode(&mascots)
+	return mascots, err
+}
+
 func createHandler(w http.ResponseWriter, r *http.Request) {
 	hc := http.Client{}
 	var p types.Post
@@ -229,15 +265,13 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 	//fmt.Fprintf(w, "%v", handler.Header)
-	suff := strconv.FormatInt(time.Now().UTC().UnixNano(), 10)
-	f, err := os.OpenFile("./uploads/"+suff+"_"+handler.Filename, os.O_WRONLY|os.O_CREATE, 0666)
+	// The api checks the image and stores it, the post refers to it by id
+	mediaId, err := uploadMedia(r, file, handler.Filename)
 	if err != nil {
-		fmt.Println(err)
+		log.Error(err)
 		http.Redirect(w, r, "/error", 302)
+		return
 	}
-	defer f.Close()
-	io.Copy(f, file)
-	p.Src = "https://cdn.twiq.in/uploads/" + suff + "_" + handler.Filename
 	p.DpSrc = r.FormValue(c.DpSrc)
 	p.Title = r.FormValue(c.Title)
 	p.Description = r.FormValue(c.Description)
@@ -253,11 +287,11 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 	data.Set(c.CardType, ct)
 	data.Set(c.DpSrc, p.DpSrc)
 	data.Set(c.Title, p.Title)
-	data.Set(c.Src, p.Src)
+	data.Set(c.SrcMediaId, mediaId)
 	data.Set(c.Description, p.Description)
 	data.Set(c.ButtonText, p.ButtonText)
 	data.Set(c.Url, p.Url)
-	req, err := http.NewRequest(http.MethodPost, c.LocalHost+"/post", bytes.NewBufferString(data.Encode()))
+	req, err := http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/post", bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		log.Error(err)
 	}
@@ -286,8 +320,12 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 	hc = http.Client{}
 	data = url.Values{}
 	data.Set(c.PostId, postId)
-	data.Set(c.MascotId, "1")
-	req, err = http.NewRequest(http.MethodPost, c.LocalHost+"/postlink", bytes.NewBufferString(data.Encode()))
+	mascotId := r.FormValue(c.MascotId)
+	if mascotId == "" {
+		mascotId = strconv.Itoa(c.DefaultMascotId)
+	}
+	data.Set(c.MascotId, mascotId)
+	req, err = http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/postlink", bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		log.Error(err.Error())
 		http.Redirect(w, r, "/error", 302)
@@ -300,7 +338,7 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/error", 302)
 	}
 	if res.StatusCode != http.StatusOK {
-		log.Error("Could not link the post %s to mascotId 1", postId)
+		log.Errorf("Could not link the post %s to mascotId %s", postId, mascotId)
 		http.Redirect(w, r, "/error", 302)
 	}
 
@@ -310,13 +348,52 @@ func createHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// uploadMedia sends a file to the api media endpoint as the user of r and
+// returns the id of the media
+func uploadMedia(r *http.Request, file io.Reader, filename string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(c.File, filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/media", &body)
+	if err != nil {
+		return "", err
+	}
+	copyHeader(req.Header, r.Header)
+	req.Header["Content-Type"] = []string{form.FormDataContentType()}
+
+	hc := http.Client{}
+	res, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Media upload failed. File=%s. Status=%d", filename, res.StatusCode)
+	}
+	var m types.Media
+	if err := json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return "", err
+	}
+	return m.Id, nil
+}
+
 func deleteHandler(w http.ResponseWriter, r *http.Request) {
 
 	hc := http.Client{}
 	postId := r.FormValue(c.PostId)
 	data := url.Values{}
 	data.Set(c.PostId, postId)
-	req, err := http.NewRequest(http.MethodPost, c.LocalHost+"/deletePost", strings.NewReader(data.Encode()))
+	req, err := http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/deletePost", strings.NewReader(data.Encode()))
 	if err != nil {
 		log.Error(err)
 	}
@@ -350,7 +427,7 @@ func postlinkHandler(w http.ResponseWriter, r *http.Request) {
 	data := url.Values{}
 	data.Set(c.PostId, postId)
 	data.Set(c.MascotId, mascotId)
-	req, err := http.NewRequest(http.MethodPost, c.LocalHost+"/postlink", bytes.NewBufferString(data.Encode()))
+	req, err := http.NewRequest(http.MethodPost, config.Get().Server.ApiUrl+"/postlink", bytes.NewBufferString(data.Encode()))
 	if err != nil {
 		log.Error(err.Error())
 		http.Redirect(w, r, "/error", 302)
@@ -387,7 +464,7 @@ func initLogging() {
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.DebugLevel)
 
-	if c.DE {
+	if config.Get().Debug {
 		log.SetLevel(log.DebugLevel)
 	}
 	//aws.DisableModule = true
@@ -451,12 +528,18 @@ func getRouter() http.Handler {
 }
 
 func main() {
+	// Fail before anything else when the configuration is not usable
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	session.Init()
 
 	http.Handle("/", getRouter())
 
-	log.Info("Server running on port 8898")
+	log.Infof("Server running on port %d", cfg.Server.PortalPort)
 
-	err := http.ListenAndServe(":8898", nil)
+	err = http.ListenAndServe(fmt.Sprintf(":%d", cfg.Server.PortalPort), nil)
 	if err != nil {
 		log.Error(err)
 	}